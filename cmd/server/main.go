@@ -1,35 +1,531 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"log"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/acme/autocert"
 
 	"yiwang/internal/api"
+	"yiwang/internal/attach"
+	"yiwang/internal/config"
+	"yiwang/internal/cors"
+	"yiwang/internal/events"
+	"yiwang/internal/logging"
+	"yiwang/internal/metrics"
+	"yiwang/internal/oauth"
+	"yiwang/internal/ratelimit"
+	"yiwang/internal/session"
+	"yiwang/internal/stale"
 	"yiwang/internal/store"
+	"yiwang/internal/tasks"
+	"yiwang/internal/tracing"
+	"yiwang/internal/webhook"
 )
 
 func main() {
+	configFile := flag.String("config", "", "YAML file of settings keyed by flag name, e.g. daily-target: 30; YIWANG_* environment variables such as YIWANG_DSN override it, and command-line flags override both")
 	addr := flag.String("addr", ":8080", "listen address")
-	dsn := flag.String("dsn", "root:123456@tcp(127.0.0.1:3306)/yiwang?parseTime=true&loc=Local", "MySQL DSN")
+	driver := flag.String("driver", "", "storage backend: mysql, sqlite, or postgres (default: postgres for postgres:// DSNs, else mysql)")
+	dsn := flag.String("dsn", "", "MySQL DSN, Postgres URL, or SQLite database file (default: a local MySQL, or yiwang.db for sqlite)")
+	tz := flag.String("tz", "", "IANA time zone used for day boundaries (default: server local time)")
+	dailyTarget := flag.Int("daily-target", 20, "default number of reviews to aim for per day")
+	maxReviewsPerDay := flag.Int("max-reviews-per-day", 0, "most previously studied cards /tasks/ready and sessions hand out per day; 0 means no limit")
+	maxNewPerDay := flag.Int("max-new-per-day", 0, "most never-studied cards /tasks/ready and sessions hand out per day; 0 means no limit")
+	dayStart := flag.Duration("day-start", 0, "how long after midnight the daily limits reset, e.g. 4h so late-night reviews count toward the day before")
+	strictAccept := flag.Bool("strict-accept", true, "reject requests whose Accept header excludes the response type with 406")
+	readTimeout := flag.Duration("read-timeout", 15*time.Second, "maximum time to read a whole request, including the body")
+	readHeaderTimeout := flag.Duration("read-header-timeout", 5*time.Second, "maximum time to read request headers")
+	writeTimeout := flag.Duration("write-timeout", 30*time.Second, "maximum time to write a response; streaming endpoints lift it per request")
+	idleTimeout := flag.Duration("idle-timeout", 2*time.Minute, "how long keep-alive connections may sit idle")
+	exposeErrors := flag.Bool("expose-errors", false, "include internal error details in 500 responses (development only)")
+	dueInterval := flag.Duration("due-interval", 2*time.Second, "how often long-poll waiters are checked for newly due cards")
+	enableMetrics := flag.Bool("metrics", false, "expose Prometheus metrics at /metrics: requests per route, tasks by status, and database pool stats")
+	scheduleFile := flag.String("schedule-file", "", "JSON or YAML file with the stage durations to use instead of the built-in schedule")
+	stages := flag.String("stages", "", "comma-separated stage durations to use instead of the built-in schedule, e.g. 5m,30m,1d,3d,7d; conflicts with -schedule-file")
+	allowPastSchedule := flag.Bool("allow-past-schedule", false, "accept past times when scheduling a task, making it ready immediately")
+	maxImageBytes := flag.Int("max-image-bytes", 256<<10, "largest task image accepted for upload, in bytes")
+	earlyReview := flag.String("early-review", "allow", "what reviewing a card before it is due does: allow, rejectEarly (409), or allowNoAdvance (logged, schedule kept)")
+	webhookURL := flag.String("webhook-url", "", "also POST task lifecycle events to this URL, besides the webhooks registered through the API")
+	webhookInterval := flag.Duration("webhook-interval", 5*time.Second, "how often the outbox is checked for events to deliver")
+	staleAfter := flag.Duration("stale-after", 0, "suspend cards overdue by more than this, e.g. 720h; 0 disables")
+	staleInterval := flag.Duration("stale-interval", time.Hour, "how often cards are checked against -stale-after")
+	admin := flag.Bool("admin", false, "mount the /api/admin development endpoints, which change every task at once, for callers with the admin role; never enable in production")
+	jsonNaming := flag.String("json-naming", "camelCase", "JSON response key style: camelCase or snake_case")
+	maxInterval := flag.Duration("max-interval", 0, "longest wait any schedule step may produce, after difficulty scaling, e.g. 2160h; 0 means no cap")
+	familiarity := flag.String("familiarity", "", "where familiar and known cards start on their schedule, from 0 (first stage) to 1 (last), e.g. familiar=0.5,known=0.85")
+	scheduler := flag.String("scheduler", "stages", "review algorithm for new tasks that don't pick one: stages (the fixed stage ladder), sm2 (SuperMemo 2 with per-task ease), or fsrs (Free Spaced Repetition Scheduler)")
+	leechThreshold := flag.Int("leech-threshold", 8, "lapses after which a card is tagged leech; 0 turns leech detection off")
+	leechAction := flag.String("leech-action", "tag", "what happens to a card that becomes a leech: tag, or suspend (tag and take it out of the queue)")
+	attachments := flag.String("attachments", "disk", "where task attachments are stored: disk, s3, or off")
+	attachmentsDir := flag.String("attachments-dir", "attachments", "directory for attachments with -attachments disk")
+	maxAttachmentBytes := flag.Int64("max-attachment-bytes", 10<<20, "largest task attachment accepted for upload, in bytes")
+	s3Endpoint := flag.String("s3-endpoint", "", "S3 or compatible service URL for -attachments s3, e.g. https://s3.eu-west-1.amazonaws.com; credentials come from AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY")
+	s3Region := flag.String("s3-region", "us-east-1", "S3 region for -attachments s3")
+	s3Bucket := flag.String("s3-bucket", "", "S3 bucket for -attachments s3")
+	s3Prefix := flag.String("s3-prefix", "", "prefix for attachment object keys with -attachments s3, e.g. yiwang/")
+	readOnly := flag.Bool("read-only", false, "reject every write with 503, e.g. during backups; toggle at runtime with PUT /api/admin/read-only when -admin is set")
+	tlsCert := flag.String("tls-cert", "", "serve HTTPS with this PEM certificate file; needs -tls-key")
+	tlsKey := flag.String("tls-key", "", "PEM private key file for -tls-cert")
+	autocertDomain := flag.String("autocert-domain", "", "comma-separated domains to serve HTTPS for with certificates from Let's Encrypt; -addr should then be :443")
+	autocertCache := flag.String("autocert-cache", "autocert", "directory where -autocert-domain keeps its certificates")
+	autocertEmail := flag.String("autocert-email", "", "contact address given to Let's Encrypt with -autocert-domain")
+	autocertHTTP := flag.String("autocert-http-addr", ":80", "listen address for Let's Encrypt's HTTP challenges with -autocert-domain, which also redirects plain HTTP to HTTPS; empty disables it")
+	corsOrigins := flag.String("cors-origins", "", "comma-separated origins allowed to call the API from a browser, e.g. https://app.example.com; * allows any")
+	requireAuth := flag.Bool("require-auth", false, "refuse /api requests without an API key (Authorization: Bearer) or web UI session; without it such requests act as the user role. POST /api/keys stays open until the first key is minted")
+	signInAllow := flag.String("signin-allow", "", "comma-separated emails, or domains such as example.com, whose verified accounts may sign in with an OAuth provider; empty lets only -admin-emails in")
+	adminEmails := flag.String("admin-emails", "", "comma-separated verified emails that may sign in with an OAuth provider and whose new accounts are admins")
+	publicURL := flag.String("public-url", "", "external base URL of the server, e.g. https://yiwang.example.com, for OAuth callbacks (default: taken from each request)")
+	sessionTTL := flag.Duration("session-ttl", 30*24*time.Hour, "how long a web UI sign-in lasts")
+	sessionStore := flag.String("session-store", "memory", "where web UI sessions are kept: memory (lost on restart) or redis")
+	redisURL := flag.String("redis-url", "redis://localhost:6379/0", "Redis server for -session-store redis")
+	rateLimit := flag.Float64("rate-limit", 0, "requests per second each client IP, and each API key or user, may make to /api on average; 0 means no limit")
+	rateBurst := flag.Int("rate-burst", 20, "requests a client may make at once before -rate-limit applies")
+	trustedProxies := flag.String("trusted-proxies", "", "comma-separated addresses or CIDR ranges of reverse proxies whose X-Forwarded-For names the client; empty trusts none and uses the connection's address")
+	shutdownTimeout := flag.Duration("shutdown-timeout", 30*time.Second, "how long a shutdown on SIGINT or SIGTERM waits for in-flight requests to finish")
+	logLevel := flag.String("log-level", "info", "least severe log records written: debug, info, warn, or error")
+	readDSN := flag.String("read-dsn", "", "DSN of a read replica of the database for task lists and statistics; writes stay on -dsn")
+	dbMaxOpen := flag.Int("db-max-open-conns", store.DefaultPool.MaxOpenConns, "most database connections open at once; negative means no limit")
+	dbMaxIdle := flag.Int("db-max-idle-conns", store.DefaultPool.MaxIdleConns, "most idle database connections kept for reuse; negative keeps none")
+	dbConnLifetime := flag.Duration("db-conn-max-lifetime", store.DefaultPool.ConnMaxLifetime, "how long a database connection is reused before it is closed; negative means forever")
+	autoMigrate := flag.Bool("auto-migrate", true, "apply pending database migrations at startup; when false the server refuses to start until they are applied with the migrate command")
 	flag.Parse()
+	if err := config.Apply(flag.CommandLine, "config"); err != nil {
+		log.Fatalf("config: %v", err)
+	}
+
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(*logLevel)); err != nil {
+		log.Fatalf("-log-level must be debug, info, warn, or error")
+	}
+	slog.SetDefault(logging.New(os.Stderr, level))
+
+	if *dsn == "" {
+		*dsn = "root:123456@tcp(127.0.0.1:3306)/yiwang?parseTime=true&loc=Local"
+		if *driver == store.DriverSQLite {
+			*dsn = "yiwang.db"
+		}
+	}
+	if *driver == "" {
+		*driver = store.DriverFor(*dsn)
+	}
+
+	loc := time.Local
+	if *tz != "" {
+		l, err := time.LoadLocation(*tz)
+		if err != nil {
+			log.Fatalf("load time zone: %v", err)
+		}
+		loc = l
+	}
+
+	switch {
+	case *scheduleFile != "" && *stages != "":
+		log.Fatalf("-stages and -schedule-file both set the schedule; use one")
+	case *scheduleFile != "":
+		durations, labels, err := tasks.LoadSchedule(*scheduleFile)
+		if err != nil {
+			log.Fatalf("load schedule: %v", err)
+		}
+		if err := tasks.SetSchedule(durations, labels); err != nil {
+			log.Fatalf("load schedule: %v", err)
+		}
+	case *stages != "":
+		durations, err := tasks.ParseStageList(*stages)
+		if err != nil {
+			log.Fatalf("-stages: %v", err)
+		}
+		if err := tasks.SetSchedule(durations, nil); err != nil {
+			log.Fatalf("-stages: %v", err)
+		}
+	}
+
+	if (*tlsCert == "") != (*tlsKey == "") {
+		log.Fatalf("-tls-cert and -tls-key must be set together")
+	}
+	if *tlsCert != "" && *autocertDomain != "" {
+		log.Fatalf("-autocert-domain conflicts with -tls-cert")
+	}
+	tlsMode := "off"
+	switch {
+	case *tlsCert != "":
+		tlsMode = "files"
+	case *autocertDomain != "":
+		tlsMode = "autocert"
+	}
+
+	if *maxReviewsPerDay < 0 || *maxNewPerDay < 0 {
+		log.Fatalf("-max-reviews-per-day and -max-new-per-day must not be negative")
+	}
+	if *dayStart < 0 || *dayStart >= 24*time.Hour {
+		log.Fatalf("-day-start must be between 0 and 24h")
+	}
+	if *maxInterval < 0 {
+		log.Fatalf("-max-interval must not be negative")
+	}
+	tasks.MaxInterval = *maxInterval
+	if *familiarity != "" {
+		start, err := tasks.ParseFamiliarityStart(*familiarity)
+		if err != nil {
+			log.Fatalf("-familiarity: %v", err)
+		}
+		tasks.FamiliarityStart = start
+	}
+
+	if *leechThreshold < 0 {
+		log.Fatalf("-leech-threshold must not be negative")
+	}
+	tasks.LeechThreshold = *leechThreshold
+	switch *leechAction {
+	case "tag":
+	case "suspend":
+		tasks.LeechSuspend = true
+	default:
+		log.Fatalf("-leech-action must be tag or suspend")
+	}
 
-	st, err := store.New(*dsn)
+	defaultScheduler, err := tasks.ParseScheduler(*scheduler)
+	if err != nil {
+		log.Fatalf("-scheduler: %v", err)
+	}
+	tasks.DefaultScheduler = defaultScheduler
+
+	earlyPolicy, err := tasks.ParseEarlyReview(*earlyReview)
+	if err != nil {
+		log.Fatalf("-early-review: %v", err)
+	}
+	naming, err := api.ParseFieldNaming(*jsonNaming)
+	if err != nil {
+		log.Fatalf("-json-naming: %v", err)
+	}
+
+	var files attach.Storage
+	switch *attachments {
+	case "disk":
+		files = attach.NewDisk(*attachmentsDir)
+	case "s3":
+		s3, err := attach.NewS3(attach.S3Config{
+			Endpoint:        *s3Endpoint,
+			Region:          *s3Region,
+			Bucket:          *s3Bucket,
+			Prefix:          *s3Prefix,
+			AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+			SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		})
+		if err != nil {
+			log.Fatalf("-attachments s3: %v", err)
+		}
+		files = s3
+	case "off":
+	default:
+		log.Fatalf("-attachments must be disk, s3, or off")
+	}
+
+	// ctx ends on SIGINT or SIGTERM, which stops the background workers
+	// and starts a graceful shutdown.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// "yiwang migrate ..." manages the schema and exits instead of serving.
+	migrateCmd := flag.Arg(0) == "migrate"
+	if flag.NArg() > 0 && !migrateCmd {
+		log.Fatalf("unknown command %q; the only command is migrate", flag.Arg(0))
+	}
+	st, err := store.NewWithOptions(*dsn, store.Options{
+		Driver:           *driver,
+		Outbox:           true,
+		EarlyReview:      earlyPolicy,
+		ManualMigrations: migrateCmd || !*autoMigrate,
+		ReadDSN:          *readDSN,
+		Pool: store.Pool{
+			MaxOpenConns:    *dbMaxOpen,
+			MaxIdleConns:    *dbMaxIdle,
+			ConnMaxLifetime: *dbConnLifetime,
+		},
+	})
 	if err != nil {
 		log.Fatalf("open store: %v", err)
 	}
+	if migrateCmd {
+		err := runMigrate(st, flag.Args()[1:])
+		st.Close()
+		if err != nil {
+			log.Fatalf("migrate: %v", err)
+		}
+		return
+	}
+	if !*autoMigrate {
+		n, err := st.PendingMigrations()
+		if err != nil {
+			log.Fatalf("check migrations: %v", err)
+		}
+		if n > 0 {
+			log.Fatalf("%d database migrations are pending; apply them with %s migrate up, or start with -auto-migrate", n, os.Args[0])
+		}
+	}
+	// workers tracks the background loops that use the store; shutdown
+	// waits for them before closing it.
+	var workers sync.WaitGroup
+	goWorker := func(run func()) {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			run()
+		}()
+	}
+	notifier := webhook.New(st, *webhookURL)
+	goWorker(func() { notifier.Run(ctx, *webhookInterval) })
 
-	r := gin.Default()
-	api.New(st).Register(r.Group("/api"))
+	bus := events.NewBus()
+	bus.Subscribe("metrics", 256, func(e events.Event) {
+		if e.Kind == events.TaskReviewed {
+			metrics.ObserveReview(e.Result)
+		}
+	})
+
+	stopTracing := func(context.Context) error { return nil }
+	if tracing.Enabled() {
+		if stopTracing, err = tracing.Setup(context.Background()); err != nil {
+			log.Fatalf("tracing: %v", err)
+		}
+	}
+
+	r := gin.New()
+	// Client IPs, which rate limits are keyed by, come from
+	// X-Forwarded-For only when the request arrives from a trusted proxy.
+	if err := r.SetTrustedProxies(splitList(*trustedProxies)); err != nil {
+		log.Fatalf("-trusted-proxies: %v", err)
+	}
+	r.Use(logging.Middleware(), gin.Recovery())
+	if tracing.Enabled() {
+		r.Use(tracing.Middleware())
+	}
+	origins := cors.ParseOrigins(*corsOrigins)
+	if len(origins) > 0 {
+		r.Use(cors.Middleware(origins))
+	}
+	if *enableMetrics {
+		r.Use(metrics.Middleware())
+		metrics.WatchStore(st)
+	}
+	var guard, throttle gin.HandlerFunc
+	if *rateLimit > 0 {
+		// Health checks come often and from few addresses.
+		health := func(c *gin.Context) bool { return c.FullPath() == "/api/healthz" }
+		// Every client IP is limited before its credentials are checked,
+		// so guessing keys is as slow as any other request.
+		perIP := ratelimit.New(*rateLimit, *rateBurst)
+		perIP.Exempt = health
+		perIP.Deny = api.TooManyRequests
+		guard = perIP.Middleware()
+		// Each key or user is limited too, wherever it calls from.
+		perCaller := ratelimit.New(*rateLimit, *rateBurst)
+		perCaller.Key = api.Caller
+		perCaller.Exempt = func(c *gin.Context) bool { return health(c) || api.Caller(c) == "" }
+		perCaller.Deny = api.TooManyRequests
+		throttle = perCaller.Middleware()
+	}
+	// Sign-in with a provider is available once its credentials are set,
+	// e.g. GITHUB_CLIENT_ID and GITHUB_CLIENT_SECRET.
+	providers := oauth.FromEnv()
+	if len(providers) > 0 && *signInAllow == "" && *adminEmails == "" {
+		slog.Warn("OAuth providers are configured but nobody may sign in with them; set -signin-allow or -admin-emails")
+	}
+	var sessionBackend session.Store
+	var redisSessions *session.Redis
+	switch *sessionStore {
+	case "memory":
+		sessionBackend = session.NewMemory()
+	case "redis":
+		if redisSessions, err = session.NewRedis(ctx, *redisURL); err != nil {
+			log.Fatalf("session store: %v", err)
+		}
+		sessionBackend = redisSessions
+	default:
+		log.Fatalf("-session-store must be memory or redis")
+	}
+	secure := tlsMode != "off" || strings.HasPrefix(*publicURL, "https://")
+	sessions := session.NewManager(sessionBackend, *sessionTTL, secure)
+	h := api.New(st, bus, api.Config{
+		Location:          loc,
+		DailyTarget:       *dailyTarget,
+		StrictAccept:      *strictAccept,
+		ExposeErrors:      *exposeErrors,
+		AllowPastSchedule: *allowPastSchedule,
+		MaxImageBytes:     *maxImageBytes,
+		Admin:             *admin,
+		FieldNaming:       naming,
+		ReadOnly:          *readOnly,
+		Server: api.ServerSettings{
+			Addr:              *addr,
+			Backend:           *driver,
+			DSN:               *dsn,
+			ReadTimeout:       *readTimeout,
+			ReadHeaderTimeout: *readHeaderTimeout,
+			WriteTimeout:      *writeTimeout,
+			IdleTimeout:       *idleTimeout,
+			DueInterval:       *dueInterval,
+			Metrics:           *enableMetrics,
+			ScheduleFile:      *scheduleFile,
+			EarlyReview:       earlyPolicy,
+			WebhookURL:        *webhookURL,
+			WebhookInterval:   *webhookInterval,
+			StaleAfter:        *staleAfter,
+			StaleInterval:     *staleInterval,
+			MaxInterval:       *maxInterval,
+			Tracing:           tracing.Enabled(),
+			TLS:               tlsMode,
+			CORSOrigins:       origins,
+			RateLimit:         *rateLimit,
+			RateBurst:         *rateBurst,
+			SessionStore:      *sessionStore,
+			ConfigFile:        *configFile,
+			Pool:              st.Pool(),
+			ReadDSN:           *readDSN,
+		},
+		Attachments:        files,
+		MaxAttachmentBytes: *maxAttachmentBytes,
+		MaxReviewsPerDay:   *maxReviewsPerDay,
+		MaxNewPerDay:       *maxNewPerDay,
+		DayStart:           *dayStart,
+		RequireAuth:        *requireAuth,
+		Guard:              guard,
+		Throttle:           throttle,
+		OAuth:              providers,
+		SignInAllow:        splitList(*signInAllow),
+		AdminEmails:        splitList(*adminEmails),
+		Sessions:           sessions,
+		PublicURL:          *publicURL,
+	})
+	h.Register(r.Group("/api"))
+	goWorker(func() { h.WatchDue(ctx, *dueInterval) })
+	if *staleAfter > 0 {
+		sus := stale.New(st, bus, *staleAfter)
+		sus.Paused = h.ReadOnly
+		goWorker(func() { sus.Run(ctx, *staleInterval) })
+	}
+	if *enableMetrics {
+		r.GET("/metrics", gin.WrapH(metrics.Handler()))
+	}
 	r.GET("/", func(c *gin.Context) {
 		c.File("./web/index.html")
 	})
 	r.StaticFile("/app.js", "./web/app.js")
 	r.StaticFile("/styles.css", "./web/styles.css")
 
-	log.Printf("listening on %s (MySQL DSN: %s)", *addr, *dsn)
-	if err := r.Run(*addr); err != nil {
-		log.Fatalf("server error: %v", err)
+	// WriteTimeout bounds every response, which would cut long-lived streams
+	// short; streaming handlers clear their own write deadline through
+	// http.ResponseController instead of relying on a global setting.
+	srv := &http.Server{
+		Addr:              *addr,
+		Handler:           r,
+		ReadTimeout:       *readTimeout,
+		ReadHeaderTimeout: *readHeaderTimeout,
+		WriteTimeout:      *writeTimeout,
+		IdleTimeout:       *idleTimeout,
+	}
+
+	srv.RegisterOnShutdown(h.Drain)
+
+	// challenges answers Let's Encrypt's HTTP challenges in autocert mode.
+	var challenges *http.Server
+	if tlsMode == "autocert" {
+		m := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(splitList(*autocertDomain)...),
+			Cache:      autocert.DirCache(*autocertCache),
+			Email:      *autocertEmail,
+		}
+		srv.TLSConfig = m.TLSConfig()
+		if *autocertHTTP != "" {
+			challenges = &http.Server{
+				Addr:              *autocertHTTP,
+				Handler:           m.HTTPHandler(nil),
+				ReadHeaderTimeout: *readHeaderTimeout,
+			}
+		}
+	}
+
+	slog.Info("listening", "addr", *addr, "tls", tlsMode, "backend", *driver, "dsn", api.RedactDSN(*driver, *dsn))
+	serveErr := make(chan error, 1)
+	go func() {
+		switch tlsMode {
+		case "files":
+			serveErr <- srv.ListenAndServeTLS(*tlsCert, *tlsKey)
+		case "autocert":
+			serveErr <- srv.ListenAndServeTLS("", "")
+		default:
+			serveErr <- srv.ListenAndServe()
+		}
+	}()
+	if challenges != nil {
+		go func() {
+			// Certificates can still be issued over TLS-ALPN on -addr,
+			// so a failure here isn't fatal.
+			if err := challenges.ListenAndServe(); err != http.ErrServerClosed {
+				slog.Error("autocert challenge listener", "addr", *autocertHTTP, "err", err)
+			}
+		}()
+	}
+	// A listener that fails still goes through the cleanup below, so the
+	// store and session client close before the process exits non-zero.
+	failed := false
+	select {
+	case err := <-serveErr:
+		slog.Error("server error", "err", err)
+		failed = true
+	case <-ctx.Done():
+	}
+	// A second signal now kills the process instead of waiting. Stopping
+	// also cancels ctx, which ends the background workers.
+	stop()
+
+	// Shutdown stops accepting connections and waits for the requests in
+	// flight, so a review mid-transaction commits before the pool closes.
+	slog.Info("shutting down", "timeout", shutdownTimeout.String())
+	sctx, cancel := context.WithTimeout(context.Background(), *shutdownTimeout)
+	defer cancel()
+	if challenges != nil {
+		challenges.Shutdown(sctx)
+	}
+	if err := srv.Shutdown(sctx); err != nil {
+		slog.Error("shutdown: requests still running were cut off", "err", err)
+	}
+	// ctx is already cancelled, so each worker returns once its current
+	// pass over the store finishes.
+	workers.Wait()
+	if err := st.Close(); err != nil {
+		slog.Error("close store", "err", err)
+	}
+	if redisSessions != nil {
+		redisSessions.Close()
+	}
+	if err := stopTracing(sctx); err != nil {
+		slog.Error("flush traces", "err", err)
+	}
+	slog.Info("stopped")
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// splitList splits a comma-separated flag value, dropping blanks.
+func splitList(list string) []string {
+	var out []string
+	for _, v := range strings.Split(list, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
 	}
+	return out
 }
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"yiwang/internal/store"
+)
+
+// runMigrate runs the migrate command: up applies pending migrations, down
+// [n] rolls back the latest n (default 1), and status, the default, lists
+// them all.
+func runMigrate(st *store.Store, args []string) error {
+	cmd := "status"
+	if len(args) > 0 {
+		cmd, args = args[0], args[1:]
+	}
+	switch cmd {
+	case "up":
+		if len(args) > 0 {
+			return fmt.Errorf("up takes no arguments")
+		}
+		done, err := st.MigrateUp(time.Now())
+		for _, m := range done {
+			fmt.Printf("applied %04d_%s\n", m.Version, m.Name)
+		}
+		if err == nil && len(done) == 0 {
+			fmt.Println("no pending migrations")
+		}
+		return err
+	case "down":
+		steps := 1
+		if len(args) > 0 {
+			n, err := strconv.Atoi(args[0])
+			if err != nil || n < 1 || len(args) > 1 {
+				return fmt.Errorf("down takes one optional count of at least 1")
+			}
+			steps = n
+		}
+		for i := 0; i < steps; i++ {
+			m, err := st.MigrateDown()
+			if err != nil {
+				return err
+			}
+			fmt.Printf("rolled back %04d_%s\n", m.Version, m.Name)
+		}
+		return nil
+	case "status":
+		if len(args) > 0 {
+			return fmt.Errorf("status takes no arguments")
+		}
+		all, err := st.Migrations()
+		if err != nil {
+			return err
+		}
+		for _, m := range all {
+			state := "pending"
+			if m.AppliedAt != nil {
+				state = "applied " + m.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Printf("%04d_%-40s %s\n", m.Version, m.Name, state)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown subcommand %q; use up, down [n], or status", cmd)
+	}
+}
@@ -0,0 +1,199 @@
+// Package anki reads notes out of Anki .apkg deck packages.
+//
+// An .apkg is a zip holding the collection as a SQLite database, named
+// collection.anki21 or, in older exports, collection.anki2. Anki 2.1.50 and
+// later default to a zstd-compressed collection.anki21b with only a stub
+// collection.anki2 beside it; those packages are rejected with
+// ErrUnsupported, since the stub holds no real notes. Media files are
+// ignored.
+package anki
+
+import (
+	"archive/zip"
+	"database/sql"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+// MaxCollectionBytes caps the uncompressed size of the collection database.
+const MaxCollectionBytes = 256 << 20
+
+var (
+	ErrFormat      = errors.New("not an Anki package: expected a zip with collection.anki21 or collection.anki2")
+	ErrUnsupported = errors.New(`package uses the newer Anki format; export it again with "Support older Anki versions" checked`)
+	// ErrTooLarge reports a package over the caller's limit or a
+	// collection over MaxCollectionBytes.
+	ErrTooLarge = errors.New("Anki package is too large")
+)
+
+// Note is one Anki note with its fields converted to plain text.
+type Note struct {
+	ID     int64
+	Fields []string
+	Tags   []string
+	// Interval is the longest current interval among the note's cards,
+	// or 0 when none of them has been studied.
+	Interval time.Duration
+}
+
+// Read parses the package in r and returns its notes in creation order,
+// or ErrTooLarge if r holds more than limit bytes. The package is spooled
+// to a temporary file because both zip and SQLite need random access.
+func Read(r io.Reader, limit int64) ([]Note, error) {
+	pkg, err := spool(r, limit, "yiwang-apkg-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(pkg.Name())
+	defer pkg.Close()
+
+	info, err := pkg.Stat()
+	if err != nil {
+		return nil, err
+	}
+	zr, err := zip.NewReader(pkg, info.Size())
+	if err != nil {
+		return nil, ErrFormat
+	}
+	entry, err := collectionEntry(zr)
+	if err != nil {
+		return nil, err
+	}
+	if entry.UncompressedSize64 > MaxCollectionBytes {
+		return nil, ErrTooLarge
+	}
+	rc, err := entry.Open()
+	if err != nil {
+		return nil, fmt.Errorf("open %s: %w", entry.Name, err)
+	}
+	defer rc.Close()
+	// The header size can lie, so the copy is capped as well.
+	col, err := spool(rc, MaxCollectionBytes, "yiwang-anki-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(col.Name())
+	col.Close()
+
+	return readCollection(col.Name())
+}
+
+// spool copies at most limit bytes of r to a new temporary file,
+// returning ErrTooLarge when there is more.
+func spool(r io.Reader, limit int64, pattern string) (*os.File, error) {
+	f, err := os.CreateTemp("", pattern)
+	if err != nil {
+		return nil, err
+	}
+	n, err := io.Copy(f, io.LimitReader(r, limit+1))
+	if err == nil && n > limit {
+		err = ErrTooLarge
+	}
+	if err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return nil, err
+	}
+	return f, nil
+}
+
+func collectionEntry(zr *zip.Reader) (*zip.File, error) {
+	byName := make(map[string]*zip.File, len(zr.File))
+	for _, f := range zr.File {
+		byName[f.Name] = f
+	}
+	switch {
+	case byName["collection.anki21"] != nil:
+		return byName["collection.anki21"], nil
+	case byName["collection.anki21b"] != nil:
+		return nil, ErrUnsupported
+	case byName["collection.anki2"] != nil:
+		return byName["collection.anki2"], nil
+	}
+	return nil, ErrFormat
+}
+
+func readCollection(path string) ([]Note, error) {
+	db, err := sql.Open("sqlite", "file:"+path+"?mode=ro")
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	intervals, err := readIntervals(db)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Query(`SELECT id, flds, tags FROM notes ORDER BY id`)
+	if err != nil {
+		return nil, fmt.Errorf("read notes: %w", err)
+	}
+	defer rows.Close()
+	notes := []Note{}
+	for rows.Next() {
+		var (
+			n          Note
+			flds, tags string
+		)
+		if err := rows.Scan(&n.ID, &flds, &tags); err != nil {
+			return nil, fmt.Errorf("read notes: %w", err)
+		}
+		for _, f := range strings.Split(flds, "\x1f") {
+			n.Fields = append(n.Fields, Text(f))
+		}
+		n.Tags = strings.Fields(tags)
+		n.Interval = intervals[n.ID]
+		notes = append(notes, n)
+	}
+	return notes, rows.Err()
+}
+
+// readIntervals returns the longest interval per note. Anki stores review
+// intervals in days and learning intervals as negative seconds.
+func readIntervals(db *sql.DB) (map[int64]time.Duration, error) {
+	rows, err := db.Query(`SELECT nid, ivl FROM cards`)
+	if err != nil {
+		return nil, fmt.Errorf("read cards: %w", err)
+	}
+	defer rows.Close()
+	out := map[int64]time.Duration{}
+	for rows.Next() {
+		var nid, ivl int64
+		if err := rows.Scan(&nid, &ivl); err != nil {
+			return nil, fmt.Errorf("read cards: %w", err)
+		}
+		d := time.Duration(ivl) * 24 * time.Hour
+		if ivl < 0 {
+			d = time.Duration(-ivl) * time.Second
+		}
+		if d > out[nid] {
+			out[nid] = d
+		}
+	}
+	return out, rows.Err()
+}
+
+var (
+	lineBreaks = regexp.MustCompile(`(?i)<br\s*/?>|</(div|p|li)>`)
+	htmlTags   = regexp.MustCompile(`<[^>]*>`)
+	soundRefs  = regexp.MustCompile(`\[sound:[^\]]*\]`)
+)
+
+// Text turns an Anki field, which is HTML, into plain text: line-breaking
+// elements become newlines, other tags and sound references are dropped,
+// and entities are decoded.
+func Text(field string) string {
+	s := lineBreaks.ReplaceAllString(field, "\n")
+	s = htmlTags.ReplaceAllString(s, "")
+	s = soundRefs.ReplaceAllString(s, "")
+	return strings.TrimSpace(html.UnescapeString(s))
+}
@@ -0,0 +1,108 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"yiwang/internal/events"
+	"yiwang/internal/store"
+	"yiwang/internal/tasks"
+)
+
+type reviewAllRequest struct {
+	Result  string `json:"result"`
+	Confirm bool   `json:"confirm"`
+}
+
+// adminReviewAll reviews every ready task with the same result in one
+// transaction, for seeding and demos. It is only mounted with
+// Config.Admin and still needs confirm=true in the body.
+func (a *API) adminReviewAll(c *gin.Context) {
+	var req reviewAllRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		writeError(c, http.StatusBadRequest, "invalid json")
+		return
+	}
+	outcome, err := tasks.ParseResult(req.Result)
+	if err != nil {
+		writeError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	if !req.Confirm {
+		writeError(c, http.StatusBadRequest, "this reviews every ready task; pass confirm=true")
+		return
+	}
+
+	ts, err := a.storeFor(c).ReviewAll(store.Filter{}, outcome, a.now())
+	if err != nil {
+		a.internalError(c, err)
+		return
+	}
+	for _, t := range ts {
+		a.publish(events.TaskReviewed, t, string(outcome))
+	}
+	renderJSON(c, http.StatusOK, gin.H{"reviewed": len(ts), "result": outcome})
+}
+
+type scanErrorResponse struct {
+	ID    string `json:"id"`
+	Error string `json:"error"`
+}
+
+// adminScanErrors lists stored tasks that can't be read, which the task
+// list skips over.
+func (a *API) adminScanErrors(c *gin.Context) {
+	bad, err := a.storeFor(c).ScanErrors()
+	if err != nil {
+		a.internalError(c, err)
+		return
+	}
+	items := make([]scanErrorResponse, 0, len(bad))
+	for _, e := range bad {
+		items = append(items, scanErrorResponse{ID: e.ID, Error: e.Err.Error()})
+	}
+	renderJSON(c, http.StatusOK, gin.H{"items": items})
+}
+
+type auditFinding struct {
+	Check       string   `json:"check"`
+	Description string   `json:"description"`
+	Count       int      `json:"count"`
+	Sample      []string `json:"sample"`
+	Repairable  bool     `json:"repairable"`
+	Repaired    int      `json:"repaired"`
+}
+
+// adminAudit reports data anomalies such as unfinished tasks without a
+// next review or history left behind by purged tasks. ?repair=true also
+// fixes the ones with a safe fix; counts are from before the repair.
+func (a *API) adminAudit(c *gin.Context) {
+	repair := false
+	if raw := c.Query("repair"); raw != "" {
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			writeError(c, http.StatusBadRequest, "repair must be true or false")
+			return
+		}
+		repair = b
+	}
+	if repair && a.ReadOnly() {
+		writeError(c, http.StatusServiceUnavailable, "server is in read-only mode; writes are disabled")
+		return
+	}
+
+	findings, err := a.storeFor(c).Audit(repair, a.now())
+	if err != nil {
+		a.internalError(c, err)
+		return
+	}
+	out := make([]auditFinding, 0, len(findings))
+	clean := true
+	for _, f := range findings {
+		out = append(out, auditFinding(f))
+		clean = clean && f.Count == 0
+	}
+	renderJSON(c, http.StatusOK, gin.H{"clean": clean, "repaired": repair, "checks": out})
+}
@@ -0,0 +1,82 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"yiwang/internal/tasks"
+)
+
+const maxVelocityDays = 365
+
+type velocityDay struct {
+	Date      string `json:"date"`
+	Added     int    `json:"added"`
+	Graduated int    `json:"graduated"`
+	Net       int    `json:"net"`
+}
+
+type velocityResponse struct {
+	Days      []velocityDay `json:"days"`
+	Added     int           `json:"added"`
+	Graduated int           `json:"graduated"`
+	Net       int           `json:"net"`
+}
+
+// velocity compares cards added against cards graduated per local day over
+// the last ?days days (including today).
+func (a *API) velocity(c *gin.Context) {
+	days := 30
+	if raw := c.Query("days"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n <= 0 || n > maxVelocityDays {
+			writeError(c, http.StatusBadRequest, "days must be between 1 and 365")
+			return
+		}
+		days = n
+	}
+
+	end := a.startOfDay(a.now()).AddDate(0, 0, 1)
+	start := end.AddDate(0, 0, -days)
+
+	created, err := a.storeFor(c).CreatedTimes(start, end)
+	if err != nil {
+		a.internalError(c, err)
+		return
+	}
+	graduated, err := a.storeFor(c).GraduatedTimes(start, end, tasks.TotalStages())
+	if err != nil {
+		a.internalError(c, err)
+		return
+	}
+
+	added := a.countByDay(created)
+	grads := a.countByDay(graduated)
+	resp := velocityResponse{Days: make([]velocityDay, 0, days)}
+	for d := start; d.Before(end); d = d.AddDate(0, 0, 1) {
+		key := d.Format(time.DateOnly)
+		day := velocityDay{
+			Date:      key,
+			Added:     added[key],
+			Graduated: grads[key],
+		}
+		day.Net = day.Added - day.Graduated
+		resp.Days = append(resp.Days, day)
+		resp.Added += day.Added
+		resp.Graduated += day.Graduated
+	}
+	resp.Net = resp.Added - resp.Graduated
+	renderJSON(c, http.StatusOK, resp)
+}
+
+// countByDay buckets timestamps by their local calendar date (YYYY-MM-DD).
+func (a *API) countByDay(times []time.Time) map[string]int {
+	out := make(map[string]int)
+	for _, t := range times {
+		out[t.In(a.cfg.Location).Format(time.DateOnly)]++
+	}
+	return out
+}
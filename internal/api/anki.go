@@ -0,0 +1,125 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"yiwang/internal/anki"
+	"yiwang/internal/events"
+	"yiwang/internal/tasks"
+)
+
+const maxAnkiBytes = 64 << 20
+
+// importAnki serves POST /import/anki, also mounted at /tasks/import/anki.
+// It creates tasks from the notes of an uploaded Anki .apkg, sent as the
+// "file" field of a multipart form or as the raw body. The first field of
+// each note is the question and the second the answer; note tags carry
+// over. Tasks start at stage 0 unless ?schedule=map, which places
+// studied notes on the stage nearest their Anki interval. Results are
+// reported per note as with the CSV import, and ?validateOnly=true writes
+// nothing.
+func (a *API) importAnki(c *gin.Context) {
+	validateOnly, ok := queryBool(c, "validateOnly")
+	if !ok {
+		return
+	}
+	mapSchedule := false
+	switch c.Query("schedule") {
+	case "", "drop":
+	case "map":
+		mapSchedule = true
+	default:
+		writeError(c, http.StatusBadRequest, "schedule must be 'drop' or 'map'")
+		return
+	}
+
+	body, err := ankiBody(c)
+	if err != nil {
+		writeError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	defer body.Close()
+
+	notes, err := anki.Read(body, maxAnkiBytes)
+	if err != nil {
+		var maxErr *http.MaxBytesError
+		switch {
+		case errors.Is(err, anki.ErrTooLarge), errors.As(err, &maxErr):
+			writeError(c, http.StatusRequestEntityTooLarge, fmt.Sprintf("package must be at most %d bytes", maxAnkiBytes))
+		case errors.Is(err, anki.ErrFormat), errors.Is(err, anki.ErrUnsupported):
+			writeError(c, http.StatusUnprocessableEntity, err.Error())
+		default:
+			writeError(c, http.StatusUnprocessableEntity, "invalid Anki package: "+err.Error())
+		}
+		return
+	}
+
+	now := a.now()
+	resp := importResponse{ValidateOnly: validateOnly, Rows: make([]importRow, 0, len(notes))}
+	for i, n := range notes {
+		row := importRow{Line: i + 1, NoteID: n.ID}
+		t, err := ankiTask(n, mapSchedule, now)
+		if err != nil {
+			row.Error = err.Error()
+			resp.Failed++
+		} else {
+			row.OK = true
+			row.task = t
+			if !validateOnly {
+				row.ID = t.ID
+			}
+			resp.Succeeded++
+		}
+		resp.Total++
+		resp.Rows = append(resp.Rows, row)
+	}
+
+	if valid := resp.valid(0, len(resp.Rows)); len(valid) > 0 && !validateOnly {
+		if err := a.storeFor(c).Import(c.Request.Context(), valid); err != nil {
+			a.internalError(c, err)
+			return
+		}
+		a.publishAll(events.TaskCreated, valid)
+	}
+	renderJSON(c, http.StatusOK, resp)
+}
+
+func ankiTask(n anki.Note, mapSchedule bool, now time.Time) (*tasks.Task, error) {
+	if len(n.Fields) < 2 {
+		return nil, errors.New("note needs a front and a back field")
+	}
+	t, err := tasks.NewTaskWithOptions(n.Fields[0], n.Fields[1], now, tasks.Options{Tags: n.Tags})
+	if err != nil {
+		return nil, err
+	}
+	if mapSchedule && n.Interval > 0 {
+		t.PlaceNear(n.Interval, now)
+	}
+	return t, nil
+}
+
+// ankiBody returns the uploaded package, taken from the "file" field of a
+// multipart form or else from the raw request body.
+func ankiBody(c *gin.Context) (io.ReadCloser, error) {
+	// Leave room for the multipart framing around the file.
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxAnkiBytes+64<<10)
+	if !strings.HasPrefix(c.ContentType(), "multipart/") {
+		return c.Request.Body, nil
+	}
+	fh, err := c.FormFile("file")
+	if err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			return nil, fmt.Errorf("package must be at most %d bytes", maxAnkiBytes)
+		}
+		return nil, errors.New(`multipart upload needs a "file" field`)
+	}
+	return fh.Open()
+}
@@ -1,51 +1,384 @@
 package api
 
 import (
+	"encoding/json"
 	"errors"
 	"net/http"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gin-gonic/gin"
 
+	"yiwang/internal/attach"
+	"yiwang/internal/events"
+	"yiwang/internal/markdown"
+	"yiwang/internal/oauth"
+	"yiwang/internal/session"
 	"yiwang/internal/store"
 	"yiwang/internal/tasks"
 )
 
+// Config holds the tunable behaviour of the API.
+type Config struct {
+	// Location defines where a "day" starts and ends for daily stats.
+	// Defaults to time.Local.
+	Location *time.Location
+	// DailyTarget is the default number of reviews to aim for per day.
+	DailyTarget int
+	// ExposeErrors includes internal error details in 500 responses. They
+	// are always logged; only enable this for development.
+	ExposeErrors bool
+	// AllowPastSchedule lets an explicit schedule time lie in the past,
+	// making the task ready at once instead of rejecting the request.
+	AllowPastSchedule bool
+	// StrictAccept makes endpoints answer 406 Not Acceptable when the
+	// Accept header excludes every media type they can produce.
+	StrictAccept bool
+	// MaxImageBytes caps the size of an uploaded task image. Defaults to
+	// 256 KiB.
+	MaxImageBytes int
+	// Attachments keeps the files attached to tasks. Nil leaves the
+	// attachment endpoints unmounted.
+	Attachments attach.Storage
+	// MaxAttachmentBytes caps the size of one attachment. Defaults to
+	// 10 MiB.
+	MaxAttachmentBytes int64
+	// FieldNaming is the style of JSON response keys. Defaults to
+	// CamelCase.
+	FieldNaming FieldNaming
+	// Server describes the rest of the process configuration, shown by
+	// GET /config.
+	Server ServerSettings
+	// Admin mounts the /admin endpoints, which mutate the whole dataset
+	// for development and demos. Leave it off in production.
+	Admin bool
+	// ReadOnly starts the API in read-only mode, where every mutating
+	// request gets 503. With Admin it can be toggled at runtime.
+	ReadOnly bool
+	// MaxReviewsPerDay and MaxNewPerDay cap how many previously studied
+	// and never studied cards /tasks/ready and new sessions hand out per
+	// day; 0 means no limit. The counts reset DayStart after midnight in
+	// Location.
+	MaxReviewsPerDay int
+	MaxNewPerDay     int
+	DayStart         time.Duration
+	// RequireAuth refuses requests without an API key or session with
+	// 401, except for POST /keys while no user or key is an admin.
+	// Without it credentials are checked when given but not required, and
+	// requests without them act as users.
+	RequireAuth bool
+	// Guard, when set, runs on every route before the caller is
+	// identified, e.g. a rate limiter keyed by client IP, so requests with
+	// bad credentials are limited before they cost a lookup.
+	Guard gin.HandlerFunc
+	// Throttle, when set, runs on every route once the caller is known,
+	// e.g. a rate limiter keyed by Caller.
+	Throttle gin.HandlerFunc
+	// Sessions keeps the sessions of the web UI, begun by POST
+	// /auth/login with an API key or by signing in with one of the OAuth
+	// providers at /auth/{provider}/login. Sign-in is off without it.
+	OAuth    []*oauth.Provider
+	Sessions *session.Manager
+	// SignInAllow lists who may sign in with a provider: email addresses,
+	// or domains such as example.com for every address there. Only an
+	// email the provider has verified is matched, and an empty list lets
+	// nobody in, so a public server isn't open to every account.
+	SignInAllow []string
+	// AdminEmails are verified emails that may always sign in and whose
+	// new accounts are admins, which is how the first admin is made.
+	AdminEmails []string
+	// PublicURL is the server's external base URL, e.g.
+	// https://yiwang.example.com, from which OAuth callback URLs are
+	// built. Empty derives it from each request.
+	PublicURL string
+}
+
+const (
+	maxRandomTasks = 100
+	maxReviewToken = 64
+)
+
 type API struct {
-	store *store.Store
-	now   func() time.Time
+	store  *store.Store
+	events *events.Bus
+	now    func() time.Time
+	cfg    Config
+	due    *dueHub
+	ready  *readyHub
+
+	readOnly atomic.Bool
+	// draining is closed by Drain when the server shuts down.
+	draining  chan struct{}
+	drainOnce sync.Once
 }
 
-func New(store *store.Store) *API {
-	return &API{
-		store: store,
-		now:   time.Now,
+// New builds the API. Lifecycle events are published on bus; a nil bus
+// gets a private one.
+func New(store *store.Store, bus *events.Bus, cfg Config) *API {
+	if cfg.Location == nil {
+		cfg.Location = time.Local
+	}
+	if cfg.DailyTarget <= 0 {
+		cfg.DailyTarget = 20
+	}
+	if cfg.MaxImageBytes <= 0 {
+		cfg.MaxImageBytes = 256 << 10
+	}
+	if cfg.MaxAttachmentBytes <= 0 {
+		cfg.MaxAttachmentBytes = 10 << 20
+	}
+	if bus == nil {
+		bus = events.NewBus()
+	}
+	a := &API{
+		store:  store,
+		events: bus,
+		now:    time.Now,
+		cfg:    cfg,
+		due:    newDueHub(),
+		ready:  newReadyHub(),
+
+		draining: make(chan struct{}),
 	}
+	a.readOnly.Store(cfg.ReadOnly)
+	bus.Subscribe("due-watcher", 1, func(events.Event) { a.due.poke() })
+	return a
+}
+
+// Drain tells long-polling requests to answer now rather than hold the
+// server's shutdown until they time out. It is safe to call more than
+// once.
+func (a *API) Drain() {
+	a.drainOnce.Do(func() { close(a.draining) })
+}
+
+// storeFor is the store bound to the request's context, so its queries
+// stop when the client goes away and join the request's trace.
+func (a *API) storeFor(c *gin.Context) *store.Store {
+	return a.store.WithContext(c.Request.Context())
 }
 
 // Register mounts routes under the provided group (e.g., /api).
+// JSON endpoints answer 406 to clients that refuse application/json;
+// endpoints with their own content types register on r directly.
 func (a *API) Register(r *gin.RouterGroup) {
-	r.GET("/healthz", func(c *gin.Context) {
-		c.JSON(http.StatusOK, gin.H{"status": "ok"})
+	safe := make(map[string]bool, len(safeWrites))
+	for _, p := range safeWrites {
+		safe[r.BasePath()+p] = true
+	}
+	open := make(map[string]bool, len(openRoutes))
+	for _, p := range openRoutes {
+		open[r.BasePath()+p] = true
+	}
+	r.Use(requestID, a.naming)
+	if a.cfg.Guard != nil {
+		r.Use(a.cfg.Guard)
+	}
+	r.Use(a.authenticate(open, r.BasePath()+"/keys"))
+	if a.cfg.Throttle != nil {
+		r.Use(a.cfg.Throttle)
+	}
+	r.Use(a.rejectWrites(safe))
+	g := r.Group("", a.produces(mimeJSON))
+	g.GET("/healthz", func(c *gin.Context) {
+		renderJSON(c, http.StatusOK, gin.H{"status": "ok"})
 	})
-	r.POST("/tasks", a.createTask)
-	r.GET("/tasks", a.listTasks)
-	r.GET("/tasks/ready", a.readyTasks)
-	r.GET("/tasks/:id", a.getTask)
-	r.PUT("/tasks/:id", a.updateTask)
-	r.PATCH("/tasks/:id", a.updateTask)
-	r.DELETE("/tasks/:id", a.deleteTask)
-	r.POST("/tasks/:id/review", a.reviewTask)
+	g.POST("/tasks", a.createTask)
+	g.POST("/tasks:action", a.taskCollectionAction)
+	g.POST("/tasks/bulk-delete", a.deleteTasks)
+	g.POST("/tasks/batch-get", a.batchGetTasks)
+	g.GET("/tasks", a.listTasks)
+	g.GET("/tasks/ready", a.readyTasks)
+	g.GET("/tasks/statuses", a.taskStatuses)
+	g.GET("/tasks/counts", a.taskCounts)
+	g.GET("/tasks/random", a.randomTasks)
+	g.GET("/tasks/distribution", a.distribution)
+	g.GET("/tasks/wait", a.waitDue)
+	g.GET("/tasks/simulate", a.simulateDeck)
+	g.GET("/tasks/search", a.searchTasks)
+	g.POST("/tasks/import/anki", a.importAnki)
+	g.POST("/import/anki", a.importAnki)
+	g.GET("/tasks/:id", a.getTask)
+	g.PUT("/tasks/:id", a.updateTask)
+	g.PATCH("/tasks/:id", a.updateTask)
+	g.DELETE("/tasks/:id", a.deleteTask)
+	g.GET("/tasks/:id/simulate", a.simulateTask)
+	g.POST("/tasks/:id/review", a.reviewTask)
+	g.POST("/reviews/bulk", a.bulkReview)
+	g.POST("/tasks/:id/review/undo", a.undoReview)
+	g.POST("/tasks/:id/check", a.checkAnswer)
+	g.POST("/tasks/:id/reclassify-last", a.reclassifyLast)
+	g.POST("/tasks/:id/restore", a.restoreTask)
+	g.POST("/tasks/:id/archive", a.archiveTask)
+	g.POST("/tasks/:id/unarchive", a.unarchiveTask)
+	g.POST("/tasks/:id/suspend", a.suspendTask)
+	g.POST("/tasks/:id/unsuspend", a.unsuspendTask)
+	g.POST("/tasks/:id/schedule", a.scheduleTask)
+	g.POST("/tasks/:id/image", a.uploadImage)
+	g.DELETE("/tasks/:id/image", a.deleteImage)
+	if a.cfg.Attachments != nil {
+		g.POST("/tasks/:id/attachments", a.uploadAttachment)
+		g.DELETE("/tasks/:id/attachments/:attachmentId", a.deleteAttachment)
+		r.GET("/tasks/:id/attachments/:attachmentId", a.getAttachment)
+	}
+	g.POST("/sessions", a.createSession)
+	g.GET("/sessions/:id", a.getSession)
+	g.GET("/sessions/:id/next", a.nextSessionCard)
+	g.GET("/tag-schedules", a.listTagSchedules)
+	g.GET("/tags", a.listTags)
+	g.GET("/decks", a.listDecks)
+	g.POST("/decks", a.createDeck)
+	g.GET("/decks/:id", a.getDeck)
+	g.PUT("/decks/:id", a.renameDeck)
+	g.DELETE("/decks/:id", a.deleteDeck)
+	g.POST("/normalize-preview", a.normalizePreview)
+	g.GET("/progress", a.progress)
+	g.GET("/streak", a.streak)
+	g.GET("/analytics/velocity", a.velocity)
+	g.GET("/analytics/heatmap", a.heatmap)
+	g.GET("/stats/reviews", a.reviewStats)
+	g.GET("/stats/overview", a.overview)
+	g.GET("/stats/forecast", a.forecast)
+	g.GET("/stats/streak", a.studyStreak)
+	g.GET("/auth/providers", a.authProviders)
+	g.GET("/auth/session", a.currentSession)
+	g.POST("/auth/login", a.login)
+	g.POST("/auth/logout", a.logout)
+
+	admin := g.Group("", a.requireRole(store.RoleAdmin))
+	admin.POST("/keys", a.createKey)
+	admin.GET("/keys", a.listKeys)
+	admin.DELETE("/keys/:id", a.deleteKey)
+	admin.GET("/users", a.listUsers)
+	admin.PUT("/users/:id/role", a.setUserRole)
+	admin.DELETE("/users/:id", a.deleteUser)
+	admin.PUT("/tag-schedules/:tag", a.putTagSchedule)
+	admin.DELETE("/tag-schedules/:tag", a.deleteTagSchedule)
+	admin.GET("/backup", a.exportBackup)
+	admin.POST("/restore", a.restoreBackup)
+	admin.POST("/webhooks", a.createWebhook)
+	admin.GET("/webhooks", a.listWebhooks)
+	admin.DELETE("/webhooks/:id", a.deleteWebhook)
+	admin.GET("/webhooks/:id/deliveries", a.webhookDeliveries)
+	if a.cfg.Admin {
+		admin.POST("/admin/review-all", a.adminReviewAll)
+		admin.GET("/admin/scan-errors", a.adminScanErrors)
+		admin.GET("/admin/audit", a.adminAudit)
+		admin.GET("/config", a.effectiveConfig)
+		admin.PUT("/admin/read-only", a.setReadOnly)
+	}
+
+	r.POST("/tasks/import", a.produces(mimeJSON, mimeNDJSON), a.importTasks)
+	r.GET("/tasks/:id/image", a.produces(imageTypes...), a.getImage)
+	r.GET("/tasks/export", a.produces(mimeJSON, mimeCSV), a.exportTasks)
+	r.GET("/ws", a.readySocket)
+	r.GET("/events", a.produces(mimeEventStream), a.streamEvents)
+	r.GET("/auth/:provider/login", a.oauthLogin)
+	r.GET("/auth/:provider/callback", a.oauthCallback)
 }
 
 type createTaskRequest struct {
-	Question string `json:"question"`
-	Answer   string `json:"answer"`
+	Question   string   `json:"question"`
+	Answer     string   `json:"answer"`
+	Tags       []string `json:"tags"`
+	Difficulty string   `json:"difficulty"`
+	// AnswerMatch is how typed answers are checked: exact or whitespace.
+	AnswerMatch string `json:"answerMatch"`
+	// Format is plain or markdown; markdown tasks are also returned as
+	// sanitized HTML.
+	Format string `json:"format"`
+	// Type is basic or cloze. A cloze task is written as its question,
+	// with deletions marked {{c1::text}} or {{c1::text::hint}}; its answer
+	// is ignored.
+	Type string `json:"type"`
+	// Reversible also creates the reverse task, with question and answer
+	// swapped, linked through siblingId. Updates ignore it.
+	Reversible bool `json:"reversible"`
+	// FirstReviewIn delays the first review by a duration such as "10m"
+	// or "1d", or a number of seconds; 0 makes the task ready at once.
+	FirstReviewIn *durationField `json:"firstReviewIn"`
+	// Immediate is shorthand for firstReviewIn 0.
+	Immediate bool `json:"immediate"`
+	// Schedule overrides the stage ladder, e.g. ["1h", "1d", "7d"]. On
+	// update an empty list removes the override.
+	Schedule []string `json:"schedule"`
+	// Familiarity is new (the default), familiar, or known, and picks the
+	// starting stage. Updates ignore it.
+	Familiarity string `json:"familiarity"`
+	// Scheduler is stages, sm2, or fsrs; empty uses the server default.
+	// Updates ignore it.
+	Scheduler string `json:"scheduler"`
+	// DeckID files the task in a deck. Omitted keeps the current deck; on
+	// update "" takes the task out of its deck.
+	DeckID *string `json:"deckId"`
+	// Version is the task version an update was made against, unless
+	// given in If-Match. Creation ignores it.
+	Version int64 `json:"version"`
+}
+
+func (r createTaskRequest) options() (tasks.Options, error) {
+	opts := tasks.Options{
+		Tags:        r.Tags,
+		Difficulty:  r.Difficulty,
+		AnswerMatch: r.AnswerMatch,
+		Format:      r.Format,
+		Type:        r.Type,
+		Familiarity: r.Familiarity,
+		Scheduler:   r.Scheduler,
+		Deck:        r.DeckID,
+	}
+	if r.FirstReviewIn != nil {
+		d := time.Duration(*r.FirstReviewIn)
+		if r.Immediate && d != 0 {
+			return opts, errors.New("immediate conflicts with a non-zero firstReviewIn")
+		}
+		opts.FirstReviewIn = &d
+	} else if r.Immediate {
+		var zero time.Duration
+		opts.FirstReviewIn = &zero
+	}
+	if r.Schedule != nil {
+		opts.Schedule = tasks.Schedule{}
+		if len(r.Schedule) > 0 {
+			s, err := tasks.ParseSchedule(r.Schedule)
+			if err != nil {
+				return opts, err
+			}
+			opts.Schedule = s
+		}
+	}
+	return opts, nil
+}
+
+// durationField decodes a JSON duration given either as a string in
+// tasks.ParseDuration syntax or as a number of seconds.
+type durationField time.Duration
+
+func (d *durationField) UnmarshalJSON(b []byte) error {
+	var secs float64
+	if err := json.Unmarshal(b, &secs); err == nil {
+		*d = durationField(secs * float64(time.Second))
+		return nil
+	}
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return errors.New("duration must be a string such as \"10m\" or a number of seconds")
+	}
+	v, err := tasks.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = durationField(v)
+	return nil
 }
 
 type reviewRequest struct {
 	Result string `json:"result"`
+	// Token identifies this review so that resubmitting it is harmless.
+	Token string `json:"token"`
 }
 
 func (a *API) createTask(c *gin.Context) {
@@ -54,97 +387,306 @@ func (a *API) createTask(c *gin.Context) {
 		writeError(c, http.StatusBadRequest, "invalid json")
 		return
 	}
-	t, err := a.store.Create(req.Question, req.Answer, a.now())
+	opts, err := req.options()
 	if err != nil {
 		writeError(c, http.StatusBadRequest, err.Error())
 		return
 	}
-	c.JSON(http.StatusCreated, mapTask(t, a.now()))
+	var t, sibling *tasks.Task
+	if req.Reversible {
+		t, sibling, err = a.storeFor(c).CreateReversible(req.Question, req.Answer, opts, a.now())
+	} else {
+		t, err = a.storeFor(c).Create(req.Question, req.Answer, opts, a.now())
+	}
+	if err != nil {
+		if tasks.IsValidation(err) || errors.Is(err, store.ErrDeckNotFound) {
+			writeError(c, http.StatusBadRequest, err.Error())
+			return
+		}
+		a.internalError(c, err)
+		return
+	}
+	a.publish(events.TaskCreated, t, "")
+	if sibling != nil {
+		a.publish(events.TaskCreated, sibling, "")
+	}
+	renderJSON(c, http.StatusCreated, mapTask(t, a.now()))
 }
 
+// listTasks returns tasks, optionally narrowed by ?status, ?tag, ?deck,
+// and ?filter=leech for tasks tagged as leeches. Filtering, paging and
+// sorting are done in the database; see listTaskPage. ?ids=a,b,c returns
+// just those tasks, ignoring the rest.
 func (a *API) listTasks(c *gin.Context) {
 	now := a.now()
-	all, err := a.store.All()
-	if err != nil {
-		writeError(c, http.StatusInternalServerError, err.Error())
+	preview, ok := previewParam(c)
+	if !ok {
+		return
+	}
+	scope := scopeParams(c)
+	switch strings.ToLower(strings.TrimSpace(c.Query("filter"))) {
+	case "":
+	case "leech":
+		scope.leech = true
+	default:
+		writeError(c, http.StatusBadRequest, "filter must be leech")
 		return
 	}
 	filter := strings.ToLower(strings.TrimSpace(c.Query("status")))
-	out := make([]taskResponse, 0, len(all))
-	for _, t := range all {
-		tr := mapTask(t, now)
-		if filter == "" || filter == "all" || tr.Status == filter {
-			out = append(out, tr)
-		}
+	if a.listNotModified(c, now) {
+		return
 	}
-	c.JSON(http.StatusOK, out)
+	if ids, ok := c.GetQuery("ids"); ok {
+		a.writeTasksByID(c, strings.Split(ids, ","), preview, now)
+		return
+	}
+	a.listTaskPage(c, filter, scope, preview, now)
 }
 
+// readyTasks returns the tasks due now, optionally narrowed by ?tag and
+// ?deck, and trimmed to what the daily limits have left.
 func (a *API) readyTasks(c *gin.Context) {
 	now := a.now()
-	all, err := a.store.All()
+	preview, ok := previewParam(c)
+	if !ok {
+		return
+	}
+	scope := scopeParams(c)
+	if a.listNotModified(c, now) {
+		return
+	}
+	due, err := a.storeFor(c).Due(now, 0)
+	if err != nil {
+		a.internalError(c, err)
+		return
+	}
+	var ready []*tasks.Task
+	for _, t := range due {
+		if scope.match(t) && t.Status(now) == "ready" {
+			ready = append(ready, t)
+		}
+	}
+	ready, err = a.limitReady(c, ready, now)
 	if err != nil {
-		writeError(c, http.StatusInternalServerError, err.Error())
+		a.internalError(c, err)
 		return
 	}
-	out := make([]taskResponse, 0)
-	for _, t := range all {
+	out := make([]taskResponse, 0, len(ready))
+	for _, t := range ready {
 		tr := mapTask(t, now)
-		if tr.Status == "ready" {
-			out = append(out, tr)
+		tr.truncate(preview)
+		out = append(out, tr)
+	}
+	renderJSON(c, http.StatusOK, out)
+}
+
+// randomTasks returns ?n (default 10, at most 100) random tasks whatever
+// their due time, optionally narrowed by ?status.
+func (a *API) randomTasks(c *gin.Context) {
+	now := a.now()
+	preview, ok := previewParam(c)
+	if !ok {
+		return
+	}
+	n := 10
+	if raw := c.Query("n"); raw != "" {
+		v, err := strconv.Atoi(raw)
+		if err != nil || v <= 0 || v > maxRandomTasks {
+			writeError(c, http.StatusBadRequest, "n must be between 1 and 100")
+			return
+		}
+		n = v
+	}
+	status := strings.ToLower(strings.TrimSpace(c.Query("status")))
+
+	ts, err := a.storeFor(c).RandomSample(n, status, now)
+	if err != nil {
+		if errors.Is(err, store.ErrInvalidFilter) {
+			writeError(c, http.StatusBadRequest, err.Error())
+			return
 		}
+		a.internalError(c, err)
+		return
+	}
+	out := make([]taskResponse, 0, len(ts))
+	for _, t := range ts {
+		tr := mapTask(t, now)
+		tr.truncate(preview)
+		out = append(out, tr)
 	}
-	c.JSON(http.StatusOK, out)
+	renderJSON(c, http.StatusOK, out)
 }
 
 func (a *API) getTask(c *gin.Context) {
 	id := c.Param("id")
-	t, err := a.store.Get(id)
+	t, err := a.storeFor(c).Get(id)
 	if err != nil {
 		if errors.Is(err, store.ErrNotFound) {
 			writeError(c, http.StatusNotFound, err.Error())
 			return
 		}
-		writeError(c, http.StatusInternalServerError, err.Error())
+		a.internalError(c, err)
 		return
 	}
-	c.JSON(http.StatusOK, mapTask(t, a.now()))
+	now := a.now()
+	if notModified(c, taskETag(t, now)) {
+		return
+	}
+	renderJSON(c, http.StatusOK, mapTask(t, now))
+}
+
+// patchTaskRequest is an update: createTaskRequest with the question and
+// answer optional too.
+type patchTaskRequest struct {
+	createTaskRequest
+	// Question and Answer keep their current text when omitted.
+	Question *string `json:"question"`
+	Answer   *string `json:"answer"`
 }
 
+// updateTask edits a task. PUT replaces the question and answer, which
+// must both be sent; PATCH changes only the fields sent. Either way
+// omitted optional fields are kept.
 func (a *API) updateTask(c *gin.Context) {
 	id := c.Param("id")
-	var req createTaskRequest
+	var req patchTaskRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		writeError(c, http.StatusBadRequest, "invalid json")
 		return
 	}
-	t, err := a.store.UpdateContent(id, req.Question, req.Answer, a.now())
+	if c.Request.Method == http.MethodPut {
+		// Missing text becomes empty, which fails validation.
+		if req.Question == nil {
+			req.Question = new(string)
+		}
+		if req.Answer == nil {
+			req.Answer = new(string)
+		}
+	}
+	opts, err := req.options()
 	if err != nil {
-		status := http.StatusBadRequest
-		if errors.Is(err, store.ErrNotFound) {
-			status = http.StatusNotFound
-		} else if err != nil {
-			status = http.StatusInternalServerError
+		writeError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	var ok bool
+	if opts.Version, ok = versionParam(c, req.Version); !ok {
+		return
+	}
+	t, err := a.storeFor(c).UpdateContent(id, req.Question, req.Answer, opts, a.now())
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			writeError(c, http.StatusNotFound, err.Error())
+		case errors.Is(err, store.ErrVersionConflict):
+			writeError(c, http.StatusConflict, err.Error())
+		case tasks.IsValidation(err), errors.Is(err, store.ErrDeckNotFound):
+			writeError(c, http.StatusBadRequest, err.Error())
+		default:
+			a.internalError(c, err)
 		}
-		writeError(c, status, err.Error())
 		return
 	}
-	c.JSON(http.StatusOK, mapTask(t, a.now()))
+	a.publish(events.TaskUpdated, t, "")
+	renderJSON(c, http.StatusOK, mapTask(t, a.now()))
 }
 
+// deleteTask soft-deletes a task. With ?hard=true it instead purges a task
+// that has already been soft-deleted, including its history.
 func (a *API) deleteTask(c *gin.Context) {
 	id := c.Param("id")
-	if err := a.store.Delete(id); err != nil {
+	hard, ok := queryBool(c, "hard")
+	if !ok {
+		return
+	}
+
+	var (
+		err    error
+		attIDs []string
+	)
+	if hard && a.cfg.Attachments != nil {
+		if attIDs, err = a.storeFor(c).AttachmentIDs(id); err != nil {
+			a.internalError(c, err)
+			return
+		}
+	}
+	if hard {
+		err = a.storeFor(c).HardDelete(id)
+	} else {
+		err = a.storeFor(c).Delete(id, a.now())
+	}
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			writeError(c, http.StatusNotFound, err.Error())
+		case errors.Is(err, store.ErrNotDeleted):
+			writeError(c, http.StatusConflict, err.Error())
+		default:
+			a.internalError(c, err)
+		}
+		return
+	}
+	if hard {
+		a.removeAttachmentFiles(c, id, attIDs)
+	} else {
+		a.events.Publish(events.Event{Kind: events.TaskDeleted, TaskID: id, At: a.now()})
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func (a *API) restoreTask(c *gin.Context) {
+	id := c.Param("id")
+	t, err := a.storeFor(c).Restore(id, a.now())
+	if err != nil {
 		if errors.Is(err, store.ErrNotFound) {
 			writeError(c, http.StatusNotFound, err.Error())
 			return
 		}
-		writeError(c, http.StatusInternalServerError, err.Error())
+		a.internalError(c, err)
 		return
 	}
-	c.Status(http.StatusNoContent)
+	a.publish(events.TaskUpdated, t, "")
+	renderJSON(c, http.StatusOK, mapTask(t, a.now()))
 }
 
+// archiveTask retires a task from study; unarchiveTask brings it back.
+// Both are idempotent.
+func (a *API) archiveTask(c *gin.Context) {
+	a.setTaskState(c, a.storeFor(c).Archive)
+}
+
+func (a *API) unarchiveTask(c *gin.Context) {
+	a.setTaskState(c, a.storeFor(c).Unarchive)
+}
+
+// suspendTask takes a task out of /tasks/ready, keeping its schedule and
+// history; unsuspendTask puts it back. Both are idempotent.
+func (a *API) suspendTask(c *gin.Context) {
+	a.setTaskState(c, a.storeFor(c).SuspendTask)
+}
+
+func (a *API) unsuspendTask(c *gin.Context) {
+	a.setTaskState(c, a.storeFor(c).UnsuspendTask)
+}
+
+func (a *API) setTaskState(c *gin.Context, apply func(string, time.Time) (*tasks.Task, error)) {
+	t, err := apply(c.Param("id"), a.now())
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			writeError(c, http.StatusNotFound, err.Error())
+			return
+		}
+		a.internalError(c, err)
+		return
+	}
+	a.publish(events.TaskUpdated, t, "")
+	renderJSON(c, http.StatusOK, mapTask(t, a.now()))
+}
+
+// reviewTask applies a review. A client that may send the same review
+// twice (a retry, or two devices) gives it a token in the body or in an
+// Idempotency-Key header; repeats of a token are answered with the task's
+// current state and an Idempotent-Replayed header instead of applying
+// again.
 func (a *API) reviewTask(c *gin.Context) {
 	id := c.Param("id")
 	var req reviewRequest
@@ -153,41 +695,127 @@ func (a *API) reviewTask(c *gin.Context) {
 		return
 	}
 
-	result := strings.ToLower(strings.TrimSpace(req.Result))
-	var remembered bool
-	switch result {
-	case "remembered", "remember", "ok", "done":
-		remembered = true
-	case "forgot", "forget", "miss":
-		remembered = false
-	default:
-		writeError(c, http.StatusBadRequest, "result must be 'remembered' or 'forgot'")
+	outcome, err := tasks.ParseResult(req.Result)
+	if err != nil {
+		writeError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	token := strings.TrimSpace(req.Token)
+	if token == "" {
+		token = strings.TrimSpace(c.GetHeader("Idempotency-Key"))
+	}
+	if len(token) > maxReviewToken {
+		writeError(c, http.StatusBadRequest, "token must be at most 64 bytes")
+		return
+	}
+
+	withNext, ok := queryBool(c, "withNext")
+	if !ok {
 		return
 	}
 
-	t, err := a.store.Review(id, remembered, a.now())
+	review := a.storeFor(c).Review
+	if withNext {
+		review = a.storeFor(c).ReviewAndNext
+	}
+	res, err := review(id, outcome, token, a.now())
 	if err != nil {
-		if errors.Is(err, store.ErrNotFound) {
-			writeError(c, http.StatusNotFound, err.Error())
-			return
-		}
-		writeError(c, http.StatusInternalServerError, err.Error())
+		a.writeReviewError(c, err)
+		return
+	}
+	if res.Replayed {
+		c.Header("Idempotent-Replayed", "true")
+	} else {
+		a.publish(events.TaskReviewed, res.Task, string(outcome))
+	}
+
+	now := a.now()
+	if !withNext {
+		renderJSON(c, http.StatusOK, mapTask(res.Task, now))
+		return
+	}
+	resp := reviewNextResponse{Task: mapTask(res.Task, now)}
+	if res.Next != nil {
+		n := mapTask(res.Next, now)
+		resp.Next = &n
+	}
+	renderJSON(c, http.StatusOK, resp)
+}
+
+// reviewNextResponse pairs a reviewed task with the next one due; Next is
+// null once the queue is empty.
+type reviewNextResponse struct {
+	Task taskResponse  `json:"task"`
+	Next *taskResponse `json:"next"`
+}
+
+func (a *API) writeReviewError(c *gin.Context, err error) {
+	status := reviewErrorStatus(err)
+	if status == http.StatusInternalServerError {
+		a.internalError(c, err)
 		return
 	}
-	c.JSON(http.StatusOK, mapTask(t, a.now()))
+	writeError(c, status, err.Error())
 }
 
 type taskResponse struct {
-	ID           string     `json:"id"`
-	Question     string     `json:"question"`
-	Answer       string     `json:"answer"`
-	Stage        int        `json:"stage"`
-	TotalStages  int        `json:"totalStages"`
-	Status       string     `json:"status"`
-	NextReviewAt *time.Time `json:"nextReviewAt,omitempty"`
-	CreatedAt    time.Time  `json:"createdAt"`
-	UpdatedAt    time.Time  `json:"updatedAt"`
-	CompletedAt  *time.Time `json:"completedAt,omitempty"`
+	ID            string     `json:"id"`
+	Question      string     `json:"question"`
+	Answer        string     `json:"answer"`
+	Stage         int        `json:"stage"`
+	StageLabel    string     `json:"stageLabel,omitempty"`
+	TotalStages   int        `json:"totalStages"`
+	Status        string     `json:"status"`
+	NextReviewAt  *time.Time `json:"nextReviewAt,omitempty"`
+	CreatedAt     time.Time  `json:"createdAt"`
+	UpdatedAt     time.Time  `json:"updatedAt"`
+	CompletedAt   *time.Time `json:"completedAt,omitempty"`
+	ArchivedAt    *time.Time `json:"archivedAt,omitempty"`
+	SuspendedAt   *time.Time `json:"suspendedAt,omitempty"`
+	SuspendReason string     `json:"suspendReason,omitempty"`
+	Tags          []string   `json:"tags"`
+	DeckID        string     `json:"deckId,omitempty"`
+	Images        []string   `json:"images"`
+	Difficulty    string     `json:"difficulty"`
+	AnswerMatch   string     `json:"answerMatch"`
+	Format        string     `json:"format"`
+	// QuestionHTML and AnswerHTML are the rendered text of markdown
+	// tasks, safe to insert into a page as is.
+	QuestionHTML string `json:"questionHtml,omitempty"`
+	AnswerHTML   string `json:"answerHtml,omitempty"`
+	// Type is basic or cloze. A cloze task's Question has its deletions
+	// masked and its Answer is the whole text; Text is the text with the
+	// markers, as written.
+	Type string `json:"type"`
+	Text string `json:"text,omitempty"`
+	// SiblingID is the reverse of a reversible task.
+	SiblingID string `json:"siblingId,omitempty"`
+	// Lapses counts the times the task was forgotten.
+	Lapses int `json:"lapses"`
+	// Version goes up with every change to the task. Updates send the
+	// version they were made against, in If-Match or the body.
+	Version int64 `json:"version"`
+	// Attachments are the task's files, each with a download URL.
+	Attachments []attachmentResponse `json:"attachments"`
+	// Schedule is the stage ladder the task follows and ScheduleSource
+	// where it comes from: "task", "tag" (named by ScheduleTag), or
+	// "default".
+	Schedule       []string `json:"schedule"`
+	ScheduleSource string   `json:"scheduleSource"`
+	ScheduleTag    string   `json:"scheduleTag,omitempty"`
+	// Scheduler is stages, sm2, or fsrs. SM-2 and FSRS tasks also report
+	// their current interval, and their Stage counts successful reviews in
+	// a row. Ease is SM-2's, or for stage tasks the factor on their stage
+	// durations; Stability (in days) and FSRSDifficulty (1 to 10) are
+	// FSRS's.
+	Scheduler      string  `json:"scheduler"`
+	Ease           float64 `json:"ease,omitempty"`
+	Stability      float64 `json:"stability,omitempty"`
+	FSRSDifficulty float64 `json:"fsrsDifficulty,omitempty"`
+	Interval       string  `json:"interval,omitempty"`
+	// Truncated is set when question or answer was shortened for a
+	// ?preview list; fetch the task by ID for the full text.
+	Truncated bool `json:"truncated,omitempty"`
 }
 
 func mapTask(t *tasks.Task, now time.Time) taskResponse {
@@ -195,20 +823,63 @@ func mapTask(t *tasks.Task, now time.Time) taskResponse {
 	if !t.NextReviewAt.IsZero() {
 		next = &t.NextReviewAt
 	}
+	tags := t.Tags
+	if tags == nil {
+		tags = []string{}
+	}
+	images := make([]string, len(t.Images))
+	for i, side := range t.Images {
+		images[i] = string(side)
+	}
+	var interval string
+	if t.Interval > 0 {
+		interval = tasks.FormatDuration(t.Interval)
+	}
+	question, answer, text := t.Question, t.Answer, ""
+	if t.Type == tasks.CardCloze {
+		question, answer, text = tasks.MaskCloze(t.Question), tasks.RevealCloze(t.Question), t.Question
+	}
+	var questionHTML, answerHTML string
+	if t.Format == tasks.FormatMarkdown {
+		questionHTML = markdown.Render(question)
+		answerHTML = markdown.Render(answer)
+	}
 	return taskResponse{
-		ID:           t.ID,
-		Question:     t.Question,
-		Answer:       t.Answer,
-		Stage:        t.Stage,
-		TotalStages:  tasks.TotalStages(),
-		Status:       t.Status(now),
-		NextReviewAt: next,
-		CreatedAt:    t.CreatedAt,
-		UpdatedAt:    t.UpdatedAt,
-		CompletedAt:  t.CompletedAt,
+		ID:             t.ID,
+		Question:       question,
+		Answer:         answer,
+		Stage:          t.Stage,
+		StageLabel:     t.StageLabel(),
+		TotalStages:    t.StageCount(),
+		Status:         t.Status(now),
+		NextReviewAt:   next,
+		CreatedAt:      t.CreatedAt,
+		UpdatedAt:      t.UpdatedAt,
+		CompletedAt:    t.CompletedAt,
+		ArchivedAt:     t.ArchivedAt,
+		SuspendedAt:    t.SuspendedAt,
+		SuspendReason:  t.SuspendReason,
+		Tags:           tags,
+		DeckID:         t.DeckID,
+		Images:         images,
+		Attachments:    mapAttachments(t),
+		Difficulty:     string(t.Difficulty),
+		AnswerMatch:    string(t.AnswerMatch),
+		Format:         string(t.Format),
+		QuestionHTML:   questionHTML,
+		AnswerHTML:     answerHTML,
+		Type:           string(t.Type),
+		Text:           text,
+		SiblingID:      t.SiblingID,
+		Lapses:         t.Lapses,
+		Version:        t.Version,
+		Schedule:       t.Stages().Strings(),
+		ScheduleSource: t.ScheduleSource(),
+		ScheduleTag:    t.ScheduleTag,
+		Scheduler:      string(t.Scheduler),
+		Ease:           t.Ease,
+		Stability:      t.Stability,
+		FSRSDifficulty: t.FSRSDifficulty,
+		Interval:       interval,
 	}
 }
-
-func writeError(c *gin.Context, status int, msg string) {
-	c.JSON(status, gin.H{"error": msg})
-}
@@ -0,0 +1,324 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"yiwang/internal/store"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+// testNow is the clock the API tests run at, unless they move it.
+var testNow = time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)
+
+// testServer is an API over a fresh SQLite store, served at /api.
+type testServer struct {
+	*API
+	router *gin.Engine
+
+	mu    sync.Mutex
+	clock time.Time
+}
+
+// newTestServer serves cfg's API with its clock stopped at testNow, until
+// advance moves it. The store is removed when the test ends.
+func newTestServer(t *testing.T, cfg Config, opts store.Options) *testServer {
+	t.Helper()
+	opts.Driver = store.DriverSQLite
+	st, err := store.NewWithOptions(filepath.Join(t.TempDir(), "test.db"), opts)
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	t.Cleanup(func() { st.Close() })
+	if cfg.Location == nil {
+		cfg.Location = time.UTC
+	}
+	s := &testServer{API: New(st, nil, cfg), router: gin.New(), clock: testNow}
+	s.API.now = s.now
+	s.Register(s.router.Group("/api"))
+	return s
+}
+
+func (s *testServer) now() time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.clock
+}
+
+// advance moves the server's clock forward by d.
+func (s *testServer) advance(d time.Duration) {
+	s.mu.Lock()
+	s.clock = s.clock.Add(d)
+	s.mu.Unlock()
+}
+
+// do sends a request with an optional JSON body and headers given as
+// name, value pairs.
+func (s *testServer) do(method, path, body string, header ...string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if body != "" {
+		req.Header.Set("Content-Type", mimeJSON)
+	}
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+	w := httptest.NewRecorder()
+	s.router.ServeHTTP(w, req)
+	return w
+}
+
+// expect fails the test unless w has status.
+func expect(t *testing.T, w *httptest.ResponseRecorder, status int) {
+	t.Helper()
+	if w.Code != status {
+		t.Fatalf("status = %d, want %d; body: %s", w.Code, status, w.Body)
+	}
+}
+
+// adminAuth mints the server's first API key, which is an admin's, and
+// returns the header that authenticates with it.
+func (s *testServer) adminAuth(t *testing.T) []string {
+	t.Helper()
+	w := s.do(http.MethodPost, "/api/keys", `{"name":"test"}`)
+	expect(t, w, http.StatusCreated)
+	var key struct{ Key, Role string }
+	if err := json.Unmarshal(w.Body.Bytes(), &key); err != nil || key.Role != store.RoleAdmin {
+		t.Fatalf("bootstrap key = %s, want an admin key", w.Body)
+	}
+	return []string{"Authorization", "Bearer " + key.Key}
+}
+
+// createTask creates a task from a JSON body and returns it.
+func (s *testServer) createTask(t *testing.T, body string) taskResponse {
+	t.Helper()
+	w := s.do(http.MethodPost, "/api/tasks", body)
+	expect(t, w, http.StatusCreated)
+	var task taskResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &task); err != nil {
+		t.Fatal(err)
+	}
+	return task
+}
+
+// listIDs returns the IDs of the tasks a list endpoint answers with.
+func (s *testServer) listIDs(t *testing.T, path string) []string {
+	t.Helper()
+	w := s.do(http.MethodGet, path, "")
+	expect(t, w, http.StatusOK)
+	var list []taskResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &list); err != nil {
+		t.Fatalf("GET %s: %v", path, err)
+	}
+	ids := make([]string, len(list))
+	for i, task := range list {
+		ids[i] = task.ID
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func sorted(ids ...string) []string {
+	sort.Strings(ids)
+	return ids
+}
+
+func TestArchiveAmongStatuses(t *testing.T) {
+	s := newTestServer(t, Config{}, store.Options{})
+	ready := s.createTask(t, `{"question":"ready","answer":"a","firstReviewIn":"0s"}`)
+	pending := s.createTask(t, `{"question":"pending","answer":"a","firstReviewIn":"1h"}`)
+	suspended := s.createTask(t, `{"question":"suspended","answer":"a","firstReviewIn":"0s"}`)
+	archived := s.createTask(t, `{"question":"archived","answer":"a","firstReviewIn":"0s"}`)
+	both := s.createTask(t, `{"question":"suspended and archived","answer":"a","firstReviewIn":"0s"}`)
+	deleted := s.createTask(t, `{"question":"archived then deleted","answer":"a","firstReviewIn":"0s"}`)
+
+	expect(t, s.do(http.MethodPost, "/api/tasks/"+suspended.ID+"/suspend", ""), http.StatusOK)
+	expect(t, s.do(http.MethodPost, "/api/tasks/"+both.ID+"/suspend", ""), http.StatusOK)
+	for _, task := range []taskResponse{archived, both, deleted} {
+		w := s.do(http.MethodPost, "/api/tasks/"+task.ID+"/archive", "")
+		expect(t, w, http.StatusOK)
+		if !strings.Contains(w.Body.String(), `"status":"archived"`) {
+			t.Errorf("archive answered %s, want status archived", w.Body)
+		}
+	}
+	expect(t, s.do(http.MethodDelete, "/api/tasks/"+deleted.ID, ""), http.StatusNoContent)
+
+	for _, tc := range []struct {
+		path string
+		want []string
+	}{
+		{"/api/tasks", sorted(ready.ID, pending.ID, suspended.ID)},
+		{"/api/tasks?status=ready", sorted(ready.ID)},
+		{"/api/tasks?status=suspended", sorted(suspended.ID)},
+		{"/api/tasks?status=archived", sorted(archived.ID, both.ID)},
+		{"/api/tasks?status=deleted", sorted(deleted.ID)},
+		{"/api/tasks/ready", sorted(ready.ID)},
+	} {
+		if got := s.listIDs(t, tc.path); !slices.Equal(got, tc.want) {
+			t.Errorf("GET %s = %v, want %v", tc.path, got, tc.want)
+		}
+	}
+	w := s.do(http.MethodGet, "/api/tasks/counts", "")
+	expect(t, w, http.StatusOK)
+	var counts taskCountsResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &counts); err != nil {
+		t.Fatal(err)
+	}
+	if counts != (taskCountsResponse{Ready: 1, Pending: 1, Total: 3}) {
+		t.Errorf("counts = %+v, want archived tasks left out", counts)
+	}
+
+	// Archived cards can't be reviewed or rescheduled, and a deleted one
+	// can't be archived or unarchived.
+	expect(t, s.do(http.MethodPost, "/api/tasks/"+archived.ID+"/review", `{"result":"remembered"}`), http.StatusConflict)
+	expect(t, s.do(http.MethodPost, "/api/tasks/"+archived.ID+"/schedule", `{"at":"2024-03-02T09:00:00Z"}`), http.StatusConflict)
+	expect(t, s.do(http.MethodPost, "/api/tasks/"+deleted.ID+"/unarchive", ""), http.StatusNotFound)
+
+	// Unarchiving restores whatever status the card had underneath.
+	for _, tc := range []struct {
+		task taskResponse
+		want string
+	}{
+		{archived, "ready"},
+		{both, "suspended"},
+	} {
+		w := s.do(http.MethodPost, "/api/tasks/"+tc.task.ID+"/unarchive", "")
+		expect(t, w, http.StatusOK)
+		var got taskResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+			t.Fatal(err)
+		}
+		if got.Status != tc.want {
+			t.Errorf("unarchived %q is %s, want %s", tc.task.Question, got.Status, tc.want)
+		}
+	}
+	// Restoring the deleted one brings it back archived.
+	w = s.do(http.MethodPost, "/api/tasks/"+deleted.ID+"/restore", "")
+	expect(t, w, http.StatusOK)
+	if got := s.listIDs(t, "/api/tasks?status=archived"); !slices.Equal(got, []string{deleted.ID}) {
+		t.Errorf("archived after restore = %v, want %v", got, []string{deleted.ID})
+	}
+}
+
+func TestCreateFirstReview(t *testing.T) {
+	s := newTestServer(t, Config{}, store.Options{})
+	for _, tc := range []struct {
+		body   string
+		in     time.Duration
+		status string
+	}{
+		{`{"question":"q","answer":"a"}`, 5 * time.Minute, "pending"},
+		{`{"question":"q","answer":"a","immediate":true}`, 0, "ready"},
+		{`{"question":"q","answer":"a","firstReviewIn":0}`, 0, "ready"},
+		{`{"question":"q","answer":"a","firstReviewIn":"0s","immediate":true}`, 0, "ready"},
+		{`{"question":"q","answer":"a","firstReviewIn":"10m"}`, 10 * time.Minute, "pending"},
+		{`{"question":"q","answer":"a","firstReviewIn":"1d"}`, 24 * time.Hour, "pending"},
+		{`{"question":"q","answer":"a","firstReviewIn":90}`, 90 * time.Second, "pending"},
+	} {
+		task := s.createTask(t, tc.body)
+		if task.NextReviewAt == nil || !task.NextReviewAt.Equal(testNow.Add(tc.in)) {
+			t.Errorf("%s: next review %v, want %v", tc.body, task.NextReviewAt, testNow.Add(tc.in))
+		}
+		if task.Status != tc.status {
+			t.Errorf("%s: status %q, want %q", tc.body, task.Status, tc.status)
+		}
+	}
+	for _, body := range []string{
+		`{"question":"q","answer":"a","firstReviewIn":"10m","immediate":true}`,
+		`{"question":"q","answer":"a","firstReviewIn":"-1m"}`,
+		`{"question":"q","answer":"a","firstReviewIn":"soon"}`,
+	} {
+		if w := s.do(http.MethodPost, "/api/tasks", body); w.Code != http.StatusBadRequest {
+			t.Errorf("%s = %d, want 400", body, w.Code)
+		}
+	}
+}
+
+// TestListFiltersInSQL checks that GET /tasks agrees with itself paged and
+// unpaged, and with the status each task reports, including a task left
+// past the end of a schedule that shrank.
+func TestListFiltersInSQL(t *testing.T) {
+	s := newTestServer(t, Config{}, store.Options{})
+	auth := s.adminAuth(t)
+	finished := s.createTask(t, `{"question":"finished","answer":"a","tags":["short"],"firstReviewIn":"0s"}`)
+	expect(t, s.do(http.MethodPost, "/api/tasks/"+finished.ID+"/review", `{"result":"remembered"}`, auth...), http.StatusOK)
+	ready := s.createTask(t, `{"question":"ready","answer":"a","firstReviewIn":"0s"}`)
+	pending := s.createTask(t, `{"question":"pending","answer":"a","firstReviewIn":"1h"}`)
+	// A day later both unreviewed tasks are due.
+	s.advance(24 * time.Hour)
+	// The reviewed task is on stage 1 of a schedule that now has one.
+	expect(t, s.do(http.MethodPut, "/api/tag-schedules/short", `{"schedule":["1h"]}`, auth...), http.StatusOK)
+
+	w := s.do(http.MethodGet, "/api/tasks/"+finished.ID, "", auth...)
+	expect(t, w, http.StatusOK)
+	var got taskResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Status != "done" {
+		t.Fatalf("task past its schedule's end is %s, want done", got.Status)
+	}
+
+	for status, want := range map[string][]string{
+		"ready":   {ready.ID, pending.ID},
+		"pending": {},
+		"done":    {finished.ID},
+		"all":     sorted(finished.ID, ready.ID, pending.ID),
+	} {
+		want = sorted(want...)
+		unpaged := s.listIDs(t, "/api/tasks?status="+status)
+		w := s.do(http.MethodGet, "/api/tasks?limit=50&status="+status, "", auth...)
+		expect(t, w, http.StatusOK)
+		var page taskPageResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &page); err != nil {
+			t.Fatal(err)
+		}
+		paged := []string{}
+		for _, task := range page.Items {
+			paged = append(paged, task.ID)
+		}
+		if !slices.Equal(unpaged, want) || !slices.Equal(sorted(paged...), want) {
+			t.Errorf("status=%s: unpaged %v, paged %v; want %v", status, unpaged, paged, want)
+		}
+	}
+
+	expect(t, s.do(http.MethodGet, "/api/tasks?status=bogus", "", auth...), http.StatusBadRequest)
+	expect(t, s.do(http.MethodGet, "/api/tasks?status=bogus&limit=10", "", auth...), http.StatusBadRequest)
+}
+
+func TestKeyBootstrapOnlyWithoutAdmin(t *testing.T) {
+	s := newTestServer(t, Config{RequireAuth: true}, store.Options{})
+	admin := s.adminAuth(t)
+	expect(t, s.do(http.MethodPost, "/api/keys", `{"name":"again"}`), http.StatusUnauthorized)
+
+	// With the admin key deleted and only a user key left, an admin user
+	// alone keeps the bootstrap closed, as in an OAuth-only deployment.
+	w := s.do(http.MethodPost, "/api/keys", `{"name":"script","role":"user"}`, admin...)
+	expect(t, w, http.StatusCreated)
+	keys, err := s.store.APIKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, k := range keys {
+		if k.Role == store.RoleAdmin {
+			expect(t, s.do(http.MethodDelete, "/api/keys/"+k.ID, "", admin...), http.StatusNoContent)
+		}
+	}
+	id := store.Identity{Provider: "github", Subject: "1", Name: "Ada", Email: "ada@example.com"}
+	if _, err := s.store.SignIn(id, "", store.RoleAdmin, testNow); err != nil {
+		t.Fatal(err)
+	}
+	expect(t, s.do(http.MethodPost, "/api/keys", `{"name":"again"}`), http.StatusUnauthorized)
+}
@@ -0,0 +1,196 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"yiwang/internal/events"
+	"yiwang/internal/store"
+	"yiwang/internal/tasks"
+)
+
+type attachmentResponse struct {
+	ID          string `json:"id"`
+	Filename    string `json:"filename"`
+	ContentType string `json:"contentType"`
+	Size        int64  `json:"size"`
+	// URL downloads the file, relative to the server root.
+	URL string `json:"url"`
+}
+
+// inlineTypes are served for display in the page; anything else is
+// served as a download, so uploaded HTML or SVG can't run script.
+var inlineTypes = []string{"image/png", "image/jpeg", "image/gif", "image/webp", "application/pdf"}
+
+// attachmentKey is where a task's attachment is kept in the storage.
+func attachmentKey(taskID, attID string) string {
+	return taskID + "/" + attID
+}
+
+func mapAttachments(t *tasks.Task) []attachmentResponse {
+	out := make([]attachmentResponse, len(t.Attachments))
+	for i, att := range t.Attachments {
+		out[i] = attachmentResponse{
+			ID:          att.ID,
+			Filename:    att.Filename,
+			ContentType: att.ContentType,
+			Size:        att.Size,
+			// cmd/server mounts the API under /api.
+			URL: "/api/tasks/" + t.ID + "/attachments/" + att.ID,
+		}
+	}
+	return out
+}
+
+// uploadAttachment stores the "file" field of a multipart form as a new
+// attachment of a task and returns the task. The content type is sniffed
+// from the bytes rather than trusted from the client.
+func (a *API) uploadAttachment(c *gin.Context) {
+	limit := a.cfg.MaxAttachmentBytes
+	// Leave room for the multipart framing around the file.
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, limit+64<<10)
+	if !strings.HasPrefix(c.ContentType(), "multipart/") {
+		writeError(c, http.StatusBadRequest, `upload the file as multipart/form-data in a "file" field`)
+		return
+	}
+	fh, err := c.FormFile("file")
+	if err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			writeError(c, http.StatusRequestEntityTooLarge, fmt.Sprintf("attachment must be at most %d bytes", limit))
+			return
+		}
+		writeError(c, http.StatusBadRequest, `multipart upload needs a "file" field`)
+		return
+	}
+	if fh.Size > limit {
+		writeError(c, http.StatusRequestEntityTooLarge, fmt.Sprintf("attachment must be at most %d bytes", limit))
+		return
+	}
+	if fh.Size == 0 {
+		writeError(c, http.StatusUnprocessableEntity, "attachment is empty")
+		return
+	}
+	f, err := fh.Open()
+	if err != nil {
+		a.internalError(c, err)
+		return
+	}
+	defer f.Close()
+	head := make([]byte, 512)
+	n, err := io.ReadFull(f, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		a.internalError(c, err)
+		return
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		a.internalError(c, err)
+		return
+	}
+
+	id := c.Param("id")
+	if _, err := a.storeFor(c).Get(id); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			writeError(c, http.StatusNotFound, err.Error())
+			return
+		}
+		a.internalError(c, err)
+		return
+	}
+	att, err := tasks.NewAttachment(fh.Filename, http.DetectContentType(head[:n]), fh.Size, a.now())
+	if err != nil {
+		a.internalError(c, err)
+		return
+	}
+	ctx := c.Request.Context()
+	key := attachmentKey(id, att.ID)
+	if err := a.cfg.Attachments.Put(ctx, key, f, att.Size, att.ContentType); err != nil {
+		a.internalError(c, err)
+		return
+	}
+	t, err := a.storeFor(c).AddAttachment(id, att)
+	if err != nil {
+		if err := a.cfg.Attachments.Delete(ctx, key); err != nil {
+			slog.WarnContext(c.Request.Context(), "remove attachment file", "key", key, "err", err)
+		}
+		if errors.Is(err, store.ErrNotFound) {
+			writeError(c, http.StatusNotFound, err.Error())
+			return
+		}
+		a.internalError(c, err)
+		return
+	}
+	a.publish(events.TaskUpdated, t, "")
+	renderJSON(c, http.StatusCreated, mapTask(t, a.now()))
+}
+
+// getAttachment serves an attached file.
+func (a *API) getAttachment(c *gin.Context) {
+	id, attID := c.Param("id"), c.Param("attachmentId")
+	att, err := a.storeFor(c).Attachment(id, attID)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) || errors.Is(err, store.ErrNoAttachment) {
+			writeError(c, http.StatusNotFound, err.Error())
+			return
+		}
+		a.internalError(c, err)
+		return
+	}
+	rc, err := a.cfg.Attachments.Open(c.Request.Context(), attachmentKey(id, attID))
+	if err != nil {
+		a.internalError(c, err)
+		return
+	}
+	defer rc.Close()
+
+	disposition := "attachment"
+	for _, typ := range inlineTypes {
+		if att.ContentType == typ {
+			disposition = "inline"
+		}
+	}
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.Header("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": att.Filename}))
+	c.Header("Content-Length", strconv.FormatInt(att.Size, 10))
+	c.Header("Content-Type", att.ContentType)
+	c.Status(http.StatusOK)
+	if _, err := io.Copy(c.Writer, rc); err != nil && c.Request.Context().Err() == nil {
+		slog.WarnContext(c.Request.Context(), "send attachment", "attachment", attID, "err", err)
+	}
+}
+
+// deleteAttachment removes an attachment and its file, returning the task.
+func (a *API) deleteAttachment(c *gin.Context) {
+	id, attID := c.Param("id"), c.Param("attachmentId")
+	t, err := a.storeFor(c).DeleteAttachment(id, attID, a.now())
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) || errors.Is(err, store.ErrNoAttachment) {
+			writeError(c, http.StatusNotFound, err.Error())
+			return
+		}
+		a.internalError(c, err)
+		return
+	}
+	a.removeAttachmentFiles(c, id, []string{attID})
+	a.publish(events.TaskUpdated, t, "")
+	renderJSON(c, http.StatusOK, mapTask(t, a.now()))
+}
+
+// removeAttachmentFiles deletes files whose records are gone. Failures
+// only leave an orphaned file behind, so they are logged.
+func (a *API) removeAttachmentFiles(c *gin.Context, taskID string, attIDs []string) {
+	for _, attID := range attIDs {
+		key := attachmentKey(taskID, attID)
+		if err := a.cfg.Attachments.Delete(c.Request.Context(), key); err != nil {
+			slog.WarnContext(c.Request.Context(), "remove attachment file", "key", key, "err", err)
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"yiwang/internal/store"
+)
+
+const (
+	apiKeyKey = "apiKey"
+	userKey   = "user"
+	roleKey   = "role"
+	// bootstrapKey marks an anonymous POST /keys let through because the
+	// store has no admin yet.
+	bootstrapKey = "bootstrap"
+)
+
+// openRoutes, relative to the Register group, answer without credentials
+// even when RequireAuth is set.
+var openRoutes = []string{
+	"/healthz",
+	"/auth/providers",
+	"/auth/session",
+	"/auth/login",
+	"/auth/logout",
+	"/auth/:provider/login",
+	"/auth/:provider/callback",
+}
+
+// authenticate accepts an API key given as "Authorization: Bearer <key>",
+// or else a session cookie from OAuth sign-in or POST /auth/login, so
+// scripts and the web UI can share routes. A request carrying a bad key is
+// always refused; one carrying no credentials only when RequireAuth is
+// set, and otherwise acts as a user, so admin routes always need an admin
+// key or session. While no user or key is an admin, an anonymous POST /keys
+// is let through to mint the first admin key. It runs after routing, so routes are matched by their pattern.
+func (a *API) authenticate(open map[string]bool, keysRoute string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if header := c.GetHeader("Authorization"); header != "" {
+			scheme, key, _ := strings.Cut(header, " ")
+			key = strings.TrimSpace(key)
+			if !strings.EqualFold(scheme, "Bearer") || key == "" {
+				unauthorized(c, "authorization must be Bearer <api key>")
+				return
+			}
+			k, err := a.storeFor(c).AuthenticateAPIKey(key, a.now())
+			if errors.Is(err, store.ErrAPIKeyNotFound) {
+				unauthorized(c, "invalid api key")
+				return
+			}
+			if err != nil {
+				a.internalError(c, err)
+				c.Abort()
+				return
+			}
+			c.Set(apiKeyKey, k)
+			c.Set(roleKey, k.Role)
+			return
+		}
+		if a.cfg.Sessions != nil {
+			ok, err := a.sessionCaller(c)
+			if err != nil {
+				a.internalError(c, err)
+				c.Abort()
+				return
+			}
+			if ok {
+				return
+			}
+		}
+		if c.Request.Method == http.MethodPost && c.FullPath() == keysRoute {
+			// The first admin has to come from somewhere.
+			admin, err := a.storeFor(c).HasAdmin()
+			if err != nil {
+				a.internalError(c, err)
+				c.Abort()
+				return
+			}
+			if !admin {
+				c.Set(roleKey, store.RoleAdmin)
+				c.Set(bootstrapKey, true)
+				return
+			}
+		}
+		if !a.cfg.RequireAuth {
+			c.Set(roleKey, store.RoleUser)
+			return
+		}
+		if open[c.FullPath()] {
+			return
+		}
+		unauthorized(c, "authentication required")
+	}
+}
+
+// sessionCaller identifies the caller by its session cookie, reporting
+// whether there was a live session. A session whose user or key has since
+// been deleted counts as none.
+func (a *API) sessionCaller(c *gin.Context) (bool, error) {
+	sess, ok, err := a.cfg.Sessions.Load(c.Request)
+	if err != nil || !ok {
+		return false, err
+	}
+	switch {
+	case sess.UserID != "":
+		u, err := a.storeFor(c).User(sess.UserID)
+		if errors.Is(err, store.ErrUserNotFound) {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		c.Set(userKey, u)
+		c.Set(roleKey, u.Role)
+	case sess.APIKeyID != "":
+		k, err := a.storeFor(c).APIKey(sess.APIKeyID)
+		if errors.Is(err, store.ErrAPIKeyNotFound) {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		c.Set(apiKeyKey, k)
+		c.Set(roleKey, k.Role)
+	default:
+		return false, nil
+	}
+	return true, nil
+}
+
+// requireRole refuses requests whose caller lacks role with 403, or 401
+// when the caller is unknown. Admins hold every role. Routes declare it
+// when they are registered, alone or for a group.
+func (a *API) requireRole(role string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		switch c.GetString(roleKey) {
+		case role, store.RoleAdmin:
+			return
+		case "":
+			unauthorized(c, "authentication required")
+		default:
+			writeError(c, http.StatusForbidden, "this needs the "+role+" role")
+			c.Abort()
+		}
+	}
+}
+
+func unauthorized(c *gin.Context, msg string) {
+	c.Header("WWW-Authenticate", `Bearer realm="yiwang"`)
+	writeError(c, http.StatusUnauthorized, msg)
+	c.Abort()
+}
+
+// Caller names who made the request for per-client accounting, such as
+// rate limits: "key:<id>" for an API key, "user:<id>" for a signed-in
+// user, or "" when the request carried no credentials.
+func Caller(c *gin.Context) string {
+	if k, ok := c.Get(apiKeyKey); ok {
+		return "key:" + k.(store.APIKey).ID
+	}
+	if u, ok := c.Get(userKey); ok {
+		return "user:" + u.(store.User).ID
+	}
+	return ""
+}
@@ -0,0 +1,96 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"yiwang/internal/backup"
+)
+
+const maxBackupBytes = 256 << 20
+
+// exportBackup downloads every task, review, and image as a checksummed
+// backup file; see package backup for the format.
+func (a *API) exportBackup(c *gin.Context) {
+	snap, err := a.storeFor(c).Snapshot(c.Request.Context())
+	if err != nil {
+		a.internalError(c, err)
+		return
+	}
+	now := a.now()
+	f, err := backup.New(snap, now)
+	if err != nil {
+		a.internalError(c, err)
+		return
+	}
+	filename := "yiwang-backup-" + now.In(a.cfg.Location).Format("20060102-150405") + ".json"
+	c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+	// The file format is fixed whatever the API's field naming, so any
+	// server can restore it.
+	c.JSON(http.StatusOK, f)
+}
+
+type restoreResponse struct {
+	ValidateOnly bool `json:"validateOnly"`
+	Tasks        int  `json:"tasks"`
+	Reviews      int  `json:"reviews"`
+	Images       int  `json:"images"`
+	TagSchedules int  `json:"tagSchedules"`
+	Decks        int  `json:"decks"`
+	Attachments  int  `json:"attachments"`
+}
+
+// restoreBackup verifies an uploaded backup and, unless ?validateOnly=true,
+// replaces the whole store with it. Files that fail verification are
+// rejected before anything is touched.
+func (a *API) restoreBackup(c *gin.Context) {
+	validateOnly, ok := queryBool(c, "validateOnly")
+	if !ok {
+		return
+	}
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxBackupBytes)
+	var f backup.File
+	if err := json.NewDecoder(c.Request.Body).Decode(&f); err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			writeError(c, http.StatusRequestEntityTooLarge, fmt.Sprintf("backup must be at most %d bytes", maxBackupBytes))
+			return
+		}
+		writeError(c, http.StatusBadRequest, "invalid backup file: "+err.Error())
+		return
+	}
+	if err := f.Verify(); err != nil {
+		switch {
+		case errors.Is(err, backup.ErrChecksum):
+			writeError(c, http.StatusUnprocessableEntity, err.Error())
+		case errors.Is(err, backup.ErrFormat), errors.Is(err, backup.ErrVersion):
+			writeError(c, http.StatusBadRequest, err.Error())
+		default:
+			a.internalError(c, err)
+		}
+		return
+	}
+
+	resp := restoreResponse{
+		ValidateOnly: validateOnly,
+		Tasks:        len(f.Data.Tasks),
+		Reviews:      len(f.Data.Reviews),
+		Images:       len(f.Data.Images),
+		TagSchedules: len(f.Data.TagSchedules),
+		Decks:        len(f.Data.Decks),
+		Attachments:  len(f.Data.Attachments),
+	}
+	if !validateOnly {
+		if err := a.storeFor(c).ReplaceAll(c.Request.Context(), f.Data); err != nil {
+			a.internalError(c, err)
+			return
+		}
+		a.due.poke()
+	}
+	renderJSON(c, http.StatusOK, resp)
+}
@@ -0,0 +1,68 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const maxBatchGet = 500
+
+type batchGetRequest struct {
+	IDs []string `json:"ids"`
+}
+
+// batchGetTasks returns the tasks named in the body's ids, for a client
+// hydrating a set of cards it already knows about. It is GET /tasks?ids=
+// for lists too long for a query string.
+func (a *API) batchGetTasks(c *gin.Context) {
+	var req batchGetRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		writeError(c, http.StatusBadRequest, "invalid json")
+		return
+	}
+	preview, ok := previewParam(c)
+	if !ok {
+		return
+	}
+	a.writeTasksByID(c, req.IDs, preview, a.now())
+}
+
+// writeTasksByID answers with the live tasks among ids, in the order
+// asked for. Unknown and deleted IDs are skipped rather than failing the
+// request, so a client can tell what's gone by what's missing.
+func (a *API) writeTasksByID(c *gin.Context, ids []string, preview int, now time.Time) {
+	seen := make(map[string]bool, len(ids))
+	var uniq []string
+	for _, id := range ids {
+		id = strings.TrimSpace(id)
+		if id == "" || seen[id] {
+			continue
+		}
+		seen[id] = true
+		uniq = append(uniq, id)
+	}
+	if len(uniq) == 0 {
+		writeError(c, http.StatusBadRequest, "ids is required")
+		return
+	}
+	if len(uniq) > maxBatchGet {
+		writeError(c, http.StatusBadRequest, "at most 500 ids per request")
+		return
+	}
+
+	ts, err := a.storeFor(c).GetMany(uniq)
+	if err != nil {
+		a.internalError(c, err)
+		return
+	}
+	out := make([]taskResponse, 0, len(ts))
+	for _, t := range ts {
+		tr := mapTask(t, now)
+		tr.truncate(preview)
+		out = append(out, tr)
+	}
+	renderJSON(c, http.StatusOK, out)
+}
@@ -0,0 +1,128 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"yiwang/internal/events"
+	"yiwang/internal/store"
+)
+
+// taskCollectionAction dispatches custom methods on the task collection,
+// such as POST /tasks:reset. Gin can't register "/tasks:reset" next to
+// "/tasks" as a static route, so the suffix arrives as a parameter.
+func (a *API) taskCollectionAction(c *gin.Context) {
+	switch c.Param("action") {
+	case ":reset":
+		a.resetTasks(c)
+	case ":unsuspend":
+		a.unsuspendTasks(c)
+	case ":delete":
+		a.deleteTasks(c)
+	default:
+		writeError(c, http.StatusNotFound, "unknown action")
+	}
+}
+
+type filterRequest struct {
+	IDs        []string `json:"ids"`
+	Status     string   `json:"status"`
+	Tag        string   `json:"tag"`
+	Deck       string   `json:"deck"`
+	ConfirmAll bool     `json:"confirmAll"`
+}
+
+func (r filterRequest) filter() store.Filter {
+	return store.Filter{
+		IDs:    r.IDs,
+		Status: strings.ToLower(strings.TrimSpace(r.Status)),
+		Tag:    strings.ToLower(strings.TrimSpace(r.Tag)),
+		Deck:   strings.TrimSpace(r.Deck),
+	}
+}
+
+// resetTasks moves every task matching the filter back to stage 0. An empty
+// filter would reset the whole collection, so it needs confirmAll.
+func (a *API) resetTasks(c *gin.Context) {
+	var req filterRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		writeError(c, http.StatusBadRequest, "invalid json")
+		return
+	}
+	f := req.filter()
+	if f.IsEmpty() && !req.ConfirmAll {
+		writeError(c, http.StatusBadRequest, "filter matches every task; pass confirmAll=true to reset all")
+		return
+	}
+
+	ts, err := a.storeFor(c).Reset(f, a.now())
+	if err != nil {
+		if errors.Is(err, store.ErrInvalidFilter) {
+			writeError(c, http.StatusBadRequest, err.Error())
+			return
+		}
+		a.internalError(c, err)
+		return
+	}
+	a.publishAll(events.TaskUpdated, ts)
+	renderJSON(c, http.StatusOK, gin.H{"reset": len(ts)})
+}
+
+type unsuspendRequest struct {
+	filterRequest
+	// Reason limits the action to tasks suspended for it, e.g. "stale".
+	Reason string `json:"reason"`
+}
+
+// unsuspendTasks returns the suspended tasks matching the filter to the
+// review queue; the filter's status is ignored. Overdue ones become due
+// now.
+func (a *API) unsuspendTasks(c *gin.Context) {
+	var req unsuspendRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		writeError(c, http.StatusBadRequest, "invalid json")
+		return
+	}
+	reason := strings.ToLower(strings.TrimSpace(req.Reason))
+	ts, err := a.storeFor(c).Unsuspend(req.filter(), reason, a.now())
+	if err != nil {
+		a.internalError(c, err)
+		return
+	}
+	a.publishAll(events.TaskUpdated, ts)
+	renderJSON(c, http.StatusOK, gin.H{"unsuspended": len(ts)})
+}
+
+// deleteTasks soft-deletes every task matching the filter, as DELETE
+// /tasks/:id does one, and returns their IDs. Like resetTasks it needs
+// confirmAll for an empty filter.
+func (a *API) deleteTasks(c *gin.Context) {
+	var req filterRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		writeError(c, http.StatusBadRequest, "invalid json")
+		return
+	}
+	f := req.filter()
+	if f.IsEmpty() && !req.ConfirmAll {
+		writeError(c, http.StatusBadRequest, "filter matches every task; pass confirmAll=true to delete all")
+		return
+	}
+
+	now := a.now()
+	ids, err := a.storeFor(c).DeleteMatching(f, now)
+	if err != nil {
+		if errors.Is(err, store.ErrInvalidFilter) {
+			writeError(c, http.StatusBadRequest, err.Error())
+			return
+		}
+		a.internalError(c, err)
+		return
+	}
+	for _, id := range ids {
+		a.events.Publish(events.Event{Kind: events.TaskDeleted, TaskID: id, At: now})
+	}
+	renderJSON(c, http.StatusOK, gin.H{"deleted": len(ids), "ids": ids})
+}
@@ -0,0 +1,54 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"yiwang/internal/store"
+	"yiwang/internal/tasks"
+)
+
+type checkRequest struct {
+	Answer string `json:"answer"`
+	// Match overrides the task's answerMatch for this check.
+	Match string `json:"match"`
+}
+
+type checkResponse struct {
+	Correct  bool   `json:"correct"`
+	Match    string `json:"match"`
+	Expected string `json:"expected"`
+}
+
+// checkAnswer compares a typed answer with the task's answer. It only
+// reports the result; recording it is up to the client's review call.
+func (a *API) checkAnswer(c *gin.Context) {
+	var req checkRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		writeError(c, http.StatusBadRequest, "invalid json")
+		return
+	}
+	t, err := a.storeFor(c).Get(c.Param("id"))
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			writeError(c, http.StatusNotFound, err.Error())
+			return
+		}
+		a.internalError(c, err)
+		return
+	}
+	match := t.AnswerMatch
+	if req.Match != "" {
+		if match, err = tasks.ParseMatch(req.Match); err != nil {
+			writeError(c, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+	renderJSON(c, http.StatusOK, checkResponse{
+		Correct:  match.Check(req.Answer, t.Answer),
+		Match:    string(match),
+		Expected: t.Answer,
+	})
+}
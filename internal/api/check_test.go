@@ -0,0 +1,45 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"yiwang/internal/store"
+)
+
+func TestCheckReformattedAnswer(t *testing.T) {
+	s := newTestServer(t, Config{}, store.Options{})
+	// The stored answer is indented with a tab; the typed one with spaces.
+	const typed = `"answer":"if x {\n    return\n}"`
+	exact := s.createTask(t, `{"question":"q","answer":"if x {\n\treturn\n}"}`)
+	loose := s.createTask(t, `{"question":"q","answer":"if x {\n\treturn\n}","answerMatch":"whitespace"}`)
+
+	for _, tc := range []struct {
+		name    string
+		task    taskResponse
+		body    string
+		match   string
+		correct bool
+	}{
+		{"task default", exact, `{` + typed + `}`, "exact", false},
+		{"task whitespace", loose, `{` + typed + `}`, "whitespace", true},
+		{"request overrides to whitespace", exact, `{` + typed + `,"match":"whitespace"}`, "whitespace", true},
+		{"request overrides to exact", loose, `{` + typed + `,"match":"exact"}`, "exact", false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			w := s.do(http.MethodPost, "/api/tasks/"+tc.task.ID+"/check", tc.body)
+			expect(t, w, http.StatusOK)
+			var got checkResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+				t.Fatal(err)
+			}
+			if got.Correct != tc.correct || got.Match != tc.match {
+				t.Errorf("check = %+v, want correct %v under %s", got, tc.correct, tc.match)
+			}
+		})
+	}
+
+	expect(t, s.do(http.MethodPost, "/api/tasks/"+exact.ID+"/check", `{"answer":"x","match":"fuzzy"}`), http.StatusBadRequest)
+	expect(t, s.do(http.MethodPost, "/api/tasks/missing/check", `{"answer":"x"}`), http.StatusNotFound)
+}
@@ -0,0 +1,290 @@
+package api
+
+import (
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-sql-driver/mysql"
+
+	"yiwang/internal/store"
+	"yiwang/internal/tasks"
+)
+
+const redacted = "REDACTED"
+
+// ServerSettings records how the process was started, for GET /config.
+// Secrets in it are redacted before they are shown.
+type ServerSettings struct {
+	Addr              string
+	Backend           string
+	DSN               string
+	ReadTimeout       time.Duration
+	ReadHeaderTimeout time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+	DueInterval       time.Duration
+	Metrics           bool
+	ScheduleFile      string
+	EarlyReview       tasks.EarlyReview
+	WebhookURL        string
+	WebhookInterval   time.Duration
+	StaleAfter        time.Duration
+	StaleInterval     time.Duration
+	MaxInterval       time.Duration
+
+	// Tracing is set when traces are exported over OTLP.
+	Tracing bool
+	// TLS is off, files (-tls-cert), or autocert.
+	TLS string
+	// CORSOrigins are the origins browsers may call the API from.
+	CORSOrigins []string
+	// RateLimit is the requests per second allowed each client, 0 for
+	// no limit, in bursts of up to RateBurst.
+	RateLimit float64
+	RateBurst int
+	// SessionStore is memory or redis.
+	SessionStore string
+	// ConfigFile is the YAML file settings were read from, if any.
+	ConfigFile string
+	// Pool is the database connection pool's limits.
+	Pool store.Pool
+	// ReadDSN is the read replica's DSN, if any.
+	ReadDSN string
+}
+
+type configResponse struct {
+	Server   serverConfig   `json:"server"`
+	API      apiConfig      `json:"api"`
+	Schedule scheduleConfig `json:"schedule"`
+}
+
+type serverConfig struct {
+	Addr              string `json:"addr"`
+	Backend           string `json:"backend"`
+	DSN               string `json:"dsn"`
+	ReadTimeout       string `json:"readTimeout"`
+	ReadHeaderTimeout string `json:"readHeaderTimeout"`
+	WriteTimeout      string `json:"writeTimeout"`
+	IdleTimeout       string `json:"idleTimeout"`
+	DueInterval       string `json:"dueInterval"`
+	Metrics           bool   `json:"metrics"`
+	ScheduleFile      string `json:"scheduleFile,omitempty"`
+	EarlyReview       string `json:"earlyReview"`
+	WebhookURL        string `json:"webhookUrl,omitempty"`
+	WebhookInterval   string `json:"webhookInterval,omitempty"`
+	// StaleAfter is "0s" when auto-suspension is off.
+	StaleAfter    string `json:"staleAfter"`
+	StaleInterval string `json:"staleInterval,omitempty"`
+	Tracing       bool   `json:"tracing"`
+	TLS           string `json:"tls"`
+	// CORSOrigins is left out when no origin is allowed.
+	CORSOrigins []string `json:"corsOrigins,omitempty"`
+	// RateLimit is 0 when requests aren't limited.
+	RateLimit float64 `json:"rateLimit"`
+	RateBurst int     `json:"rateBurst,omitempty"`
+	// SessionStore is where web UI sessions are kept.
+	SessionStore string `json:"sessionStore"`
+	ConfigFile   string `json:"configFile,omitempty"`
+	// Pool limits are 0 when unlimited.
+	Pool    poolConfig `json:"pool"`
+	ReadDSN string     `json:"readDsn,omitempty"`
+}
+
+type poolConfig struct {
+	MaxOpenConns    int    `json:"maxOpenConns"`
+	MaxIdleConns    int    `json:"maxIdleConns"`
+	ConnMaxLifetime string `json:"connMaxLifetime"`
+}
+
+type apiConfig struct {
+	Location          string `json:"location"`
+	DailyTarget       int    `json:"dailyTarget"`
+	StrictAccept      bool   `json:"strictAccept"`
+	ExposeErrors      bool   `json:"exposeErrors"`
+	AllowPastSchedule bool   `json:"allowPastSchedule"`
+	MaxImageBytes     int    `json:"maxImageBytes"`
+	FieldNaming       string `json:"fieldNaming"`
+	Admin             bool   `json:"admin"`
+	ReadOnly          bool   `json:"readOnly"`
+
+	// Attachments names the attachment storage; both fields are omitted
+	// when attachments are off.
+	Attachments        string `json:"attachments,omitempty"`
+	MaxAttachmentBytes int64  `json:"maxAttachmentBytes,omitempty"`
+
+	// MaxReviewsPerDay and MaxNewPerDay are 0 when unlimited.
+	MaxReviewsPerDay int    `json:"maxReviewsPerDay"`
+	MaxNewPerDay     int    `json:"maxNewPerDay"`
+	DayStart         string `json:"dayStart"`
+	RequireAuth      bool   `json:"requireAuth"`
+
+	// OAuth names the providers users can sign in with.
+	OAuth       []string `json:"oauth,omitempty"`
+	PublicURL   string   `json:"publicUrl,omitempty"`
+	SignInAllow []string `json:"signInAllow,omitempty"`
+	AdminEmails []string `json:"adminEmails,omitempty"`
+}
+
+type scheduleConfig struct {
+	Stages []string `json:"stages"`
+	Labels []string `json:"labels,omitempty"`
+	// MaxInterval is omitted when steps are uncapped.
+	MaxInterval string `json:"maxInterval,omitempty"`
+	// FamiliarityStart is where each creation rating starts, from 0 (the
+	// first stage) to 1 (the last).
+	FamiliarityStart map[tasks.Familiarity]float64 `json:"familiarityStart"`
+	// Scheduler is the algorithm new tasks use unless they pick one.
+	Scheduler tasks.Scheduler `json:"scheduler"`
+	// LeechThreshold is 0 when leech detection is off.
+	LeechThreshold int  `json:"leechThreshold"`
+	LeechSuspend   bool `json:"leechSuspend"`
+}
+
+// effectiveConfig shows the settings the server is running with, minus
+// secrets: the DSN password and any credentials or query values in the
+// webhook URL are redacted.
+func (a *API) effectiveConfig(c *gin.Context) {
+	s := a.cfg.Server
+	resp := configResponse{
+		Server: serverConfig{
+			Addr:              s.Addr,
+			Backend:           s.Backend,
+			DSN:               RedactDSN(s.Backend, s.DSN),
+			ReadDSN:           RedactDSN(s.Backend, s.ReadDSN),
+			ReadTimeout:       s.ReadTimeout.String(),
+			ReadHeaderTimeout: s.ReadHeaderTimeout.String(),
+			WriteTimeout:      s.WriteTimeout.String(),
+			IdleTimeout:       s.IdleTimeout.String(),
+			DueInterval:       s.DueInterval.String(),
+			Metrics:           s.Metrics,
+			ScheduleFile:      s.ScheduleFile,
+			EarlyReview:       string(s.EarlyReview),
+			StaleAfter:        s.StaleAfter.String(),
+			Tracing:           s.Tracing,
+			TLS:               s.TLS,
+			CORSOrigins:       s.CORSOrigins,
+			RateLimit:         s.RateLimit,
+			SessionStore:      s.SessionStore,
+			ConfigFile:        s.ConfigFile,
+			Pool: poolConfig{
+				MaxOpenConns:    s.Pool.MaxOpenConns,
+				MaxIdleConns:    s.Pool.MaxIdleConns,
+				ConnMaxLifetime: s.Pool.ConnMaxLifetime.String(),
+			},
+		},
+		API: apiConfig{
+			Location:          a.cfg.Location.String(),
+			DailyTarget:       a.cfg.DailyTarget,
+			StrictAccept:      a.cfg.StrictAccept,
+			ExposeErrors:      a.cfg.ExposeErrors,
+			AllowPastSchedule: a.cfg.AllowPastSchedule,
+			MaxImageBytes:     a.cfg.MaxImageBytes,
+			FieldNaming:       string(a.cfg.FieldNaming),
+			Admin:             a.cfg.Admin,
+			ReadOnly:          a.ReadOnly(),
+			MaxReviewsPerDay:  a.cfg.MaxReviewsPerDay,
+			MaxNewPerDay:      a.cfg.MaxNewPerDay,
+			DayStart:          a.cfg.DayStart.String(),
+			RequireAuth:       a.cfg.RequireAuth,
+		},
+		Schedule: scheduleConfig{
+			Stages:           tasks.Schedule(tasks.StageDurations).Strings(),
+			Labels:           tasks.StageLabels,
+			FamiliarityStart: tasks.FamiliarityStart,
+			Scheduler:        tasks.DefaultScheduler,
+			LeechThreshold:   tasks.LeechThreshold,
+			LeechSuspend:     tasks.LeechSuspend,
+		},
+	}
+	if a.cfg.Attachments != nil {
+		resp.API.Attachments = a.cfg.Attachments.Name()
+		resp.API.MaxAttachmentBytes = a.cfg.MaxAttachmentBytes
+	}
+	if s.MaxInterval > 0 {
+		resp.Schedule.MaxInterval = tasks.FormatDuration(s.MaxInterval)
+	}
+	if s.WebhookURL != "" {
+		resp.Server.WebhookURL = redactURL(s.WebhookURL)
+		resp.Server.WebhookInterval = s.WebhookInterval.String()
+	}
+	if s.StaleAfter > 0 {
+		resp.Server.StaleInterval = s.StaleInterval.String()
+	}
+	if a.cfg.Sessions != nil {
+		for _, p := range a.cfg.OAuth {
+			resp.API.OAuth = append(resp.API.OAuth, p.Name)
+		}
+	}
+	resp.API.PublicURL = a.cfg.PublicURL
+	resp.API.SignInAllow = a.cfg.SignInAllow
+	resp.API.AdminEmails = a.cfg.AdminEmails
+	if s.RateLimit > 0 {
+		resp.Server.RateBurst = s.RateBurst
+	}
+	renderJSON(c, http.StatusOK, resp)
+}
+
+// RedactDSN hides the password of a MySQL or Postgres DSN, or the whole
+// DSN if it can't be parsed. A SQLite DSN is a file path and holds no
+// secrets.
+func RedactDSN(backend, dsn string) string {
+	switch {
+	case dsn == "" || backend == store.DriverSQLite:
+		return dsn
+	case backend == store.DriverPostgres:
+		return redactPostgresDSN(dsn)
+	}
+	cfg, err := mysql.ParseDSN(dsn)
+	if err != nil {
+		return redacted
+	}
+	if cfg.Passwd != "" {
+		cfg.Passwd = redacted
+	}
+	return cfg.FormatDSN()
+}
+
+var pgPassword = regexp.MustCompile(`(?i)(\bpassword\s*=\s*)('(?:[^'\\]|\\.)*'|\S+)`)
+
+// redactPostgresDSN handles both URL and key=value connection strings.
+func redactPostgresDSN(dsn string) string {
+	if strings.Contains(dsn, "://") {
+		u, err := url.Parse(dsn)
+		if err != nil {
+			return redacted
+		}
+		if _, ok := u.User.Password(); ok {
+			u.User = url.UserPassword(u.User.Username(), redacted)
+		}
+		if q := u.Query(); q.Has("password") {
+			q.Set("password", redacted)
+			u.RawQuery = q.Encode()
+		}
+		return u.String()
+	}
+	return pgPassword.ReplaceAllString(dsn, "${1}"+redacted)
+}
+
+// redactURL hides user info and query values, which is where webhook
+// endpoints usually carry their tokens.
+func redactURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return redacted
+	}
+	if u.User != nil {
+		u.User = url.User(redacted)
+	}
+	if u.RawQuery != "" {
+		q := u.Query()
+		for k := range q {
+			q[k] = []string{redacted}
+		}
+		u.RawQuery = q.Encode()
+	}
+	return u.String()
+}
@@ -0,0 +1,32 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type taskCountsResponse struct {
+	Ready   int `json:"ready"`
+	Pending int `json:"pending"`
+	Done    int `json:"done"`
+	// Total counts every task not archived or deleted, suspended ones
+	// included, so it can exceed the sum of the others.
+	Total int `json:"total"`
+}
+
+// taskCounts counts tasks by status in the database, for badges that
+// shouldn't have to load the task list.
+func (a *API) taskCounts(c *gin.Context) {
+	statuses, err := a.storeFor(c).CountByStatus(a.now())
+	if err != nil {
+		a.internalError(c, err)
+		return
+	}
+	renderJSON(c, http.StatusOK, taskCountsResponse{
+		Ready:   statuses["ready"],
+		Pending: statuses["pending"],
+		Done:    statuses["done"],
+		Total:   statuses["ready"] + statuses["pending"] + statuses["done"] + statuses["suspended"],
+	})
+}
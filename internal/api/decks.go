@@ -0,0 +1,103 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"yiwang/internal/store"
+	"yiwang/internal/tasks"
+)
+
+type deckRequest struct {
+	Name string `json:"name"`
+}
+
+type deckResponse struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	// Tasks counts the active tasks in the deck.
+	Tasks     int       `json:"tasks"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+func mapDeck(d store.Deck) deckResponse {
+	return deckResponse{ID: d.ID, Name: d.Name, Tasks: d.Tasks, CreatedAt: d.CreatedAt, UpdatedAt: d.UpdatedAt}
+}
+
+// listDecks returns every deck by name. Tasks are filed in a deck with
+// deckId on create or update, and GET /tasks?deck= lists one deck.
+func (a *API) listDecks(c *gin.Context) {
+	all, err := a.storeFor(c).Decks()
+	if err != nil {
+		a.internalError(c, err)
+		return
+	}
+	out := make([]deckResponse, 0, len(all))
+	for _, d := range all {
+		out = append(out, mapDeck(d))
+	}
+	renderJSON(c, http.StatusOK, out)
+}
+
+func (a *API) getDeck(c *gin.Context) {
+	d, err := a.storeFor(c).Deck(c.Param("id"))
+	if err != nil {
+		a.deckError(c, err)
+		return
+	}
+	renderJSON(c, http.StatusOK, mapDeck(d))
+}
+
+func (a *API) createDeck(c *gin.Context) {
+	var req deckRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		writeError(c, http.StatusBadRequest, "invalid json")
+		return
+	}
+	d, err := a.storeFor(c).CreateDeck(req.Name, a.now())
+	if err != nil {
+		a.deckError(c, err)
+		return
+	}
+	renderJSON(c, http.StatusCreated, mapDeck(d))
+}
+
+func (a *API) renameDeck(c *gin.Context) {
+	var req deckRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		writeError(c, http.StatusBadRequest, "invalid json")
+		return
+	}
+	d, err := a.storeFor(c).RenameDeck(c.Param("id"), req.Name, a.now())
+	if err != nil {
+		a.deckError(c, err)
+		return
+	}
+	renderJSON(c, http.StatusOK, mapDeck(d))
+}
+
+// deleteDeck removes a deck; its tasks stay, unfiled.
+func (a *API) deleteDeck(c *gin.Context) {
+	if err := a.storeFor(c).DeleteDeck(c.Param("id"), a.now()); err != nil {
+		a.deckError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func (a *API) deckError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, store.ErrDeckNotFound):
+		writeError(c, http.StatusNotFound, err.Error())
+	case errors.Is(err, store.ErrDeckExists):
+		writeError(c, http.StatusConflict, err.Error())
+	case tasks.IsValidation(err):
+		writeError(c, http.StatusBadRequest, err.Error())
+	default:
+		a.internalError(c, err)
+	}
+}
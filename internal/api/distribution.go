@@ -0,0 +1,90 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"yiwang/internal/tasks"
+)
+
+var defaultDistributionBounds = []time.Duration{
+	time.Hour,
+	6 * time.Hour,
+	24 * time.Hour,
+	7 * 24 * time.Hour,
+}
+
+const maxDistributionBuckets = 20
+
+var errBadBuckets = errors.New("buckets must be up to 20 increasing positive durations, e.g. 1h,6h,1d,7d")
+
+type distributionBucket struct {
+	Label string `json:"label"`
+	Count int    `json:"count"`
+}
+
+// distribution buckets unfinished tasks by how long until they are due.
+// ?buckets=1h,6h,1d,7d sets the upper bounds; cards already due land in a
+// leading "due" bucket and anything past the last bound in a trailing one.
+func (a *API) distribution(c *gin.Context) {
+	bounds := defaultDistributionBounds
+	if raw := strings.TrimSpace(c.Query("buckets")); raw != "" {
+		parsed, err := parseBounds(raw)
+		if err != nil {
+			writeError(c, http.StatusBadRequest, err.Error())
+			return
+		}
+		bounds = parsed
+	}
+
+	times, err := a.storeFor(c).NextReviewTimes()
+	if err != nil {
+		a.internalError(c, err)
+		return
+	}
+
+	out := make([]distributionBucket, len(bounds)+2)
+	out[0].Label = "due"
+	prev := "0"
+	for i, b := range bounds {
+		cur := tasks.FormatDuration(b)
+		out[i+1].Label = prev + "-" + cur
+		prev = cur
+	}
+	out[len(out)-1].Label = prev + "+"
+
+	now := a.now()
+	for _, t := range times {
+		until := t.Sub(now)
+		if until <= 0 {
+			out[0].Count++
+			continue
+		}
+		i := sort.Search(len(bounds), func(i int) bool { return until < bounds[i] })
+		out[i+1].Count++
+	}
+	renderJSON(c, http.StatusOK, gin.H{"buckets": out})
+}
+
+// parseBounds reads a comma-separated, strictly increasing list of positive
+// durations.
+func parseBounds(raw string) ([]time.Duration, error) {
+	parts := strings.Split(raw, ",")
+	if len(parts) > maxDistributionBuckets {
+		return nil, errBadBuckets
+	}
+	out := make([]time.Duration, 0, len(parts))
+	for _, p := range parts {
+		d, err := tasks.ParseDuration(p)
+		if err != nil || d <= 0 || (len(out) > 0 && d <= out[len(out)-1]) {
+			return nil, errBadBuckets
+		}
+		out = append(out, d)
+	}
+	return out, nil
+}
@@ -0,0 +1,162 @@
+package api
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultWait = 30 * time.Second
+	maxWait     = 2 * time.Minute
+)
+
+// dueHub fans out "cards are due" notifications to waiting requests.
+type dueHub struct {
+	mu      sync.Mutex
+	waiters map[chan int]struct{}
+	// pokes asks the watcher to check now rather than at the next tick.
+	pokes chan struct{}
+}
+
+func newDueHub() *dueHub {
+	return &dueHub{
+		waiters: make(map[chan int]struct{}),
+		pokes:   make(chan struct{}, 1),
+	}
+}
+
+// poke schedules an immediate check; pokes arriving while one is pending
+// are merged.
+func (h *dueHub) poke() {
+	select {
+	case h.pokes <- struct{}{}:
+	default:
+	}
+}
+
+// subscribe registers a waiter. The returned channel receives the ready
+// count whenever the watcher sees due cards; cancel must be called once the
+// waiter is done.
+func (h *dueHub) subscribe() (ch <-chan int, cancel func()) {
+	c := make(chan int, 1)
+	h.mu.Lock()
+	h.waiters[c] = struct{}{}
+	h.mu.Unlock()
+	return c, func() {
+		h.mu.Lock()
+		delete(h.waiters, c)
+		h.mu.Unlock()
+	}
+}
+
+func (h *dueHub) hasWaiters() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.waiters) > 0
+}
+
+// broadcast hands ready to every waiter without blocking on slow ones.
+func (h *dueHub) broadcast(ready int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for c := range h.waiters {
+		select {
+		case c <- ready:
+		default:
+		}
+	}
+}
+
+// WatchDue polls for due cards every interval while anyone is waiting and
+// wakes the waiters when there are some; with WebSocket clients connected
+// it also announces each card as it comes due. Task events trigger an
+// extra check so a newly created or rescheduled card doesn't wait for the
+// next tick. It returns when ctx is done.
+func (a *API) WatchDue(ctx context.Context, every time.Duration) {
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-a.due.pokes:
+		}
+		if a.ready.hasClients() {
+			a.checkReady(a.now())
+		} else {
+			a.ready.seen = nil
+		}
+		if !a.due.hasWaiters() {
+			continue
+		}
+		n, err := a.store.CountDue(a.now())
+		if err != nil {
+			slog.Error("due watcher", "err", err)
+			continue
+		}
+		if n > 0 {
+			a.due.broadcast(n)
+		}
+	}
+}
+
+// waitDue long-polls until at least one card is due, answering with the
+// ready count, or 204 once ?timeout (default 30s, capped at 2m) passes or
+// the server starts shutting down.
+func (a *API) waitDue(c *gin.Context) {
+	timeout := defaultWait
+	if raw := c.Query("timeout"); raw != "" {
+		d, err := time.ParseDuration(raw)
+		if err != nil || d <= 0 {
+			writeError(c, http.StatusBadRequest, "timeout must be a positive duration such as 30s")
+			return
+		}
+		timeout = min(d, maxWait)
+	}
+
+	// Subscribe before the first check so a card turning due in between
+	// still wakes us.
+	ready, cancel := a.due.subscribe()
+	defer cancel()
+
+	n, err := a.storeFor(c).CountDue(a.now())
+	if err != nil {
+		a.internalError(c, err)
+		return
+	}
+	if n > 0 {
+		renderJSON(c, http.StatusOK, gin.H{"ready": n})
+		return
+	}
+
+	extendWriteDeadline(c, timeout)
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case n := <-ready:
+		renderJSON(c, http.StatusOK, gin.H{"ready": n})
+	case <-timer.C:
+		c.Status(http.StatusNoContent)
+	case <-a.draining:
+		c.Status(http.StatusNoContent)
+	case <-c.Request.Context().Done():
+	}
+}
+
+// extendWriteDeadline gives a long-running handler d (plus some slack) past
+// the server-wide WriteTimeout. Zero clears the deadline entirely.
+func extendWriteDeadline(c *gin.Context, d time.Duration) {
+	deadline := time.Time{}
+	if d > 0 {
+		deadline = time.Now().Add(d + 10*time.Second)
+	}
+	if err := http.NewResponseController(c.Writer).SetWriteDeadline(deadline); err != nil {
+		slog.WarnContext(c.Request.Context(), "set write deadline", "err", err)
+	}
+}
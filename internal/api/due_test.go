@@ -0,0 +1,71 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"yiwang/internal/store"
+)
+
+func TestWaitDueWakesWhenCardComesDue(t *testing.T) {
+	s := newTestServer(t, Config{}, store.Options{})
+	expect(t, s.do(http.MethodPost, "/api/tasks", `{"question":"q","answer":"a","firstReviewIn":"10m"}`), http.StatusCreated)
+
+	ctx, stop := context.WithCancel(context.Background())
+	defer stop()
+	go s.WatchDue(ctx, 5*time.Millisecond)
+
+	done := make(chan *httptest.ResponseRecorder)
+	go func() { done <- s.do(http.MethodGet, "/api/tasks/wait?timeout=1m", "") }()
+
+	// Nothing is due yet, so the request waits.
+	deadline := time.Now().Add(5 * time.Second)
+	for !s.due.hasWaiters() {
+		if time.Now().After(deadline) {
+			t.Fatal("the request never started waiting")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	select {
+	case w := <-done:
+		t.Fatalf("answered %d %s before the card was due", w.Code, w.Body)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	s.advance(11 * time.Minute)
+	select {
+	case w := <-done:
+		expect(t, w, http.StatusOK)
+		var body struct{ Ready int }
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || body.Ready != 1 {
+			t.Errorf("body = %s, want ready 1", w.Body)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the request didn't wake once the card was due")
+	}
+}
+
+func TestWaitDueAnswersAtOnceWhenDue(t *testing.T) {
+	s := newTestServer(t, Config{}, store.Options{})
+	expect(t, s.do(http.MethodPost, "/api/tasks", `{"question":"q","answer":"a","firstReviewIn":"0s"}`), http.StatusCreated)
+
+	// No watcher runs, so only the first check can answer.
+	w := s.do(http.MethodGet, "/api/tasks/wait?timeout=1m", "")
+	expect(t, w, http.StatusOK)
+	if s.due.hasWaiters() {
+		t.Error("the finished request is still subscribed")
+	}
+}
+
+func TestWaitDueTimesOut(t *testing.T) {
+	s := newTestServer(t, Config{}, store.Options{})
+	expect(t, s.do(http.MethodGet, "/api/tasks/wait?timeout=20ms", ""), http.StatusNoContent)
+	expect(t, s.do(http.MethodGet, "/api/tasks/wait?timeout=soon", ""), http.StatusBadRequest)
+	if s.due.hasWaiters() {
+		t.Error("a timed-out request is still subscribed")
+	}
+}
@@ -0,0 +1,60 @@
+package api
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"regexp"
+
+	"github.com/gin-gonic/gin"
+
+	"yiwang/internal/logging"
+)
+
+const (
+	requestIDHeader = "X-Request-ID"
+	requestIDKey    = "requestID"
+)
+
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// requestID tags each request with an ID, reusing a well-formed incoming
+// X-Request-ID so IDs can be correlated across proxies. The ID goes into
+// the request's context too, for the logs of the store and others.
+func requestID(c *gin.Context) {
+	id := c.GetHeader(requestIDHeader)
+	if !validRequestID.MatchString(id) {
+		var b [8]byte
+		_, _ = rand.Read(b[:])
+		id = hex.EncodeToString(b[:])
+	}
+	c.Set(requestIDKey, id)
+	c.Header(requestIDHeader, id)
+	c.Request = c.Request.WithContext(logging.WithRequestID(c.Request.Context(), id))
+}
+
+// internalError logs err with the request ID and answers 500. The client
+// only sees err's text when ExposeErrors is on, since it can carry SQL or
+// other internals.
+func (a *API) internalError(c *gin.Context, err error) {
+	id := c.GetString(requestIDKey)
+	slog.ErrorContext(c.Request.Context(), "internal error", "method", c.Request.Method, "path", c.Request.URL.Path, "err", err)
+
+	msg := "internal server error"
+	if a.cfg.ExposeErrors {
+		msg = err.Error()
+	}
+	renderJSON(c, http.StatusInternalServerError, gin.H{"error": msg, "requestId": id})
+}
+
+// TooManyRequests answers 429 in the API's error shape and aborts, for a
+// rate limiter in front of the routes.
+func TooManyRequests(c *gin.Context) {
+	writeError(c, http.StatusTooManyRequests, "rate limit exceeded")
+	c.Abort()
+}
+
+func writeError(c *gin.Context, status int, msg string) {
+	renderJSON(c, status, gin.H{"error": msg})
+}
@@ -0,0 +1,88 @@
+package api
+
+import (
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"yiwang/internal/tasks"
+)
+
+// listNotModified sets the ETag of a task list from the store's version
+// token and reports whether it has answered the request: with 304 if the
+// client already has that version, or with an error. The token is read
+// without loading any tasks, so an unchanged list costs one small query.
+// It includes the day, as daily limits change the ready list at the day
+// boundary.
+func (a *API) listNotModified(c *gin.Context, now time.Time) bool {
+	v, err := a.storeFor(c).TasksVersion(now)
+	if err != nil {
+		a.internalError(c, err)
+		return true
+	}
+	return notModified(c, etag(v, a.startOfDay(now).Format(time.RFC3339)))
+}
+
+// taskETag tags one task's representation at now: its version, then a
+// hash of what else changes it, its status, which moves with the clock,
+// and the stages it follows, which a tag schedule can change. Updates
+// accept it back in If-Match, where only the version counts.
+func taskETag(t *tasks.Task, now time.Time) string {
+	return fmt.Sprintf(`"%d-%x"`, t.Version, hash(t.Status(now), t.Stages().String()))
+}
+
+// versionParam returns the task version an update was made against: from
+// If-Match, a version or an ETag from taskETag, or else from body. It
+// answers 428 when neither gives one, and 400 when they disagree.
+func versionParam(c *gin.Context, body int64) (int64, bool) {
+	raw := strings.TrimSpace(c.GetHeader("If-Match"))
+	if raw == "" {
+		if body <= 0 {
+			writeError(c, http.StatusPreconditionRequired, "send the version the update was made against in If-Match or version")
+			return 0, false
+		}
+		return body, true
+	}
+	tag, _, _ := strings.Cut(strings.Trim(raw, `"`), "-")
+	v, err := strconv.ParseInt(tag, 10, 64)
+	if err != nil || v <= 0 || (body != 0 && body != v) {
+		writeError(c, http.StatusBadRequest, "If-Match must be the task's version or ETag, and agree with version")
+		return 0, false
+	}
+	return v, true
+}
+
+// etag hashes parts into an entity tag. It is weak because it names the
+// data, not the exact bytes sent for it.
+func etag(parts ...string) string {
+	return fmt.Sprintf(`W/"%x"`, hash(parts...))
+}
+
+func hash(parts ...string) uint64 {
+	h := fnv.New64a()
+	for _, p := range parts {
+		h.Write([]byte(p))
+		h.Write([]byte{0})
+	}
+	return h.Sum64()
+}
+
+// notModified sets tag as the response's ETag and, if the request's
+// If-None-Match already names it, answers 304 Not Modified.
+func notModified(c *gin.Context, tag string) bool {
+	c.Header("ETag", tag)
+	c.Header("Cache-Control", "no-cache")
+	for _, candidate := range strings.Split(c.GetHeader("If-None-Match"), ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(tag, "W/") {
+			c.Status(http.StatusNotModified)
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,132 @@
+package api
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"yiwang/internal/tasks"
+)
+
+const mimeCSV = "text/csv"
+
+// exportColumns heads the CSV export. The first three are the CSV
+// import's question,answer,tags.
+var exportColumns = []string{
+	"question", "answer", "tags", "id", "deck_id", "sibling_id", "status", "stage", "total_stages",
+	"next_review_at", "created_at", "updated_at", "completed_at", "archived_at",
+	"suspended_at", "suspend_reason", "difficulty", "answer_match", "format", "type", "text", "schedule",
+	"scheduler", "ease", "interval", "stability", "fsrs_difficulty", "lapses",
+}
+
+// exportTasks serves GET /tasks/export?format=csv|json: every task that
+// isn't deleted, archived ones included, with its scheduling state. The
+// JSON form is an array of tasks as GET /tasks/:id returns them; the CSV
+// form has a header row and tags separated by ";". Tasks are written as
+// they are read from the store, so a failure part way through ends the
+// download early rather than changing the status.
+func (a *API) exportTasks(c *gin.Context) {
+	format := strings.ToLower(c.Query("format"))
+	if format == "" {
+		format = "json"
+	}
+	if format != "json" && format != "csv" {
+		writeError(c, http.StatusBadRequest, "format must be csv or json")
+		return
+	}
+
+	now := a.now()
+	extendWriteDeadline(c, 0)
+	filename := "yiwang-tasks-" + now.In(a.cfg.Location).Format("20060102-150405") + "." + format
+	c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+
+	var (
+		write  func(*tasks.Task) error
+		finish func() error
+	)
+	switch format {
+	case "json":
+		c.Header("Content-Type", mimeJSON+"; charset=utf-8")
+		c.Status(http.StatusOK)
+		n := 0
+		write = func(t *tasks.Task) error {
+			sep := ",\n"
+			if n == 0 {
+				sep = "[\n"
+			}
+			n++
+			var v interface{} = mapTask(t, now)
+			if c.GetBool(snakeCaseKey) {
+				v = snakeKeys(v)
+			}
+			b, err := json.Marshal(v)
+			if err != nil {
+				return err
+			}
+			_, err = c.Writer.WriteString(sep + string(b))
+			return err
+		}
+		finish = func() error {
+			end := "\n]\n"
+			if n == 0 {
+				end = "[]\n"
+			}
+			_, err := c.Writer.WriteString(end)
+			return err
+		}
+	case "csv":
+		c.Header("Content-Type", mimeCSV+"; charset=utf-8")
+		c.Status(http.StatusOK)
+		w := csv.NewWriter(c.Writer)
+		if err := w.Write(exportColumns); err != nil {
+			return
+		}
+		write = func(t *tasks.Task) error {
+			return w.Write(exportRecord(mapTask(t, now)))
+		}
+		finish = func() error {
+			w.Flush()
+			return w.Error()
+		}
+	}
+
+	err := a.storeFor(c).EachTask(c.Request.Context(), write)
+	if err == nil {
+		err = finish()
+	}
+	if err != nil && c.Request.Context().Err() == nil {
+		slog.ErrorContext(c.Request.Context(), "export", "err", err)
+	}
+}
+
+func exportRecord(r taskResponse) []string {
+	return []string{
+		r.Question, r.Answer, strings.Join(r.Tags, ";"), r.ID, r.DeckID, r.SiblingID, r.Status,
+		strconv.Itoa(r.Stage), strconv.Itoa(r.TotalStages),
+		exportTime(r.NextReviewAt), exportTime(&r.CreatedAt), exportTime(&r.UpdatedAt),
+		exportTime(r.CompletedAt), exportTime(r.ArchivedAt), exportTime(r.SuspendedAt),
+		r.SuspendReason, r.Difficulty, r.AnswerMatch, r.Format, r.Type, r.Text, strings.Join(r.Schedule, ";"),
+		r.Scheduler, exportFloat(r.Ease), r.Interval, exportFloat(r.Stability), exportFloat(r.FSRSDifficulty),
+		strconv.Itoa(r.Lapses),
+	}
+}
+
+func exportTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+func exportFloat(f float64) string {
+	if f == 0 {
+		return ""
+	}
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
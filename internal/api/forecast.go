@@ -0,0 +1,64 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const maxForecastDays = 365
+
+type forecastDay struct {
+	Date string `json:"date"`
+	Due  int    `json:"due"`
+}
+
+type forecastResponse struct {
+	Days []forecastDay `json:"days"`
+	// Overdue counts the cards already due, which today includes too.
+	Overdue int `json:"overdue"`
+	Total   int `json:"total"`
+}
+
+// forecast reports how many cards come due on each of the next ?days
+// local days (default 30, starting with today). Cards already overdue
+// count toward today, since that is when they will be studied. The days
+// are bucketed in the configured time zone rather than the database's.
+func (a *API) forecast(c *gin.Context) {
+	days := 30
+	if raw := c.Query("days"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n <= 0 || n > maxForecastDays {
+			writeError(c, http.StatusBadRequest, "days must be between 1 and 365")
+			return
+		}
+		days = n
+	}
+
+	now := a.now()
+	today := a.startOfDay(now)
+	// The first window reaches back to take in every overdue card, and
+	// one more ends at now to count them.
+	bounds := []time.Time{time.Unix(0, 0), now}
+	for i := 1; i <= days; i++ {
+		bounds = append(bounds, today.AddDate(0, 0, i))
+	}
+	counts, err := a.storeFor(c).DueCounts(bounds)
+	if err != nil {
+		a.internalError(c, err)
+		return
+	}
+
+	resp := forecastResponse{Days: make([]forecastDay, 0, days), Overdue: counts[0]}
+	for i := 0; i < days; i++ {
+		day := forecastDay{Date: today.AddDate(0, 0, i).Format(time.DateOnly), Due: counts[i+1]}
+		if i == 0 {
+			day.Due += counts[0]
+		}
+		resp.Days = append(resp.Days, day)
+		resp.Total += day.Due
+	}
+	renderJSON(c, http.StatusOK, resp)
+}
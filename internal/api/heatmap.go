@@ -0,0 +1,51 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type heatmapResponse struct {
+	Year  int            `json:"year"`
+	Total int            `json:"total"`
+	Max   int            `json:"max"`
+	Days  map[string]int `json:"days"`
+}
+
+// heatmap counts reviews per local day over one calendar year (?year,
+// default the current one), with every day of the year present. The range
+// is always a single year so the response stays bounded; the timestamps
+// come from one query and are bucketed here so days follow cfg.Location.
+func (a *API) heatmap(c *gin.Context) {
+	year := a.now().In(a.cfg.Location).Year()
+	if raw := c.Query("year"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1970 || n > 9999 {
+			writeError(c, http.StatusBadRequest, "year must be between 1970 and 9999")
+			return
+		}
+		year = n
+	}
+
+	start := time.Date(year, time.January, 1, 0, 0, 0, 0, a.cfg.Location)
+	end := start.AddDate(1, 0, 0)
+	times, err := a.storeFor(c).ReviewTimes(start, end)
+	if err != nil {
+		a.internalError(c, err)
+		return
+	}
+
+	counts := a.countByDay(times)
+	resp := heatmapResponse{Year: year, Days: make(map[string]int, 366)}
+	for d := start; d.Before(end); d = d.AddDate(0, 0, 1) {
+		key := d.Format(time.DateOnly)
+		n := counts[key]
+		resp.Days[key] = n
+		resp.Total += n
+		resp.Max = max(resp.Max, n)
+	}
+	renderJSON(c, http.StatusOK, resp)
+}
@@ -0,0 +1,185 @@
+package api
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"yiwang/internal/events"
+	"yiwang/internal/store"
+	"yiwang/internal/tasks"
+)
+
+// imageTypes are the formats accepted for task images, as reported by
+// http.DetectContentType.
+var imageTypes = []string{"image/png", "image/jpeg", "image/webp"}
+
+// errImageTooLarge is reported as 413; every other upload error is the
+// client's fault in some other way.
+var errImageTooLarge = errors.New("image too large")
+
+type imageUploadRequest struct {
+	// Data is the base64 image, optionally as a data: URL.
+	Data string `json:"data"`
+}
+
+// uploadImage attaches an image to one side of a task (?side=question, the
+// default, or answer). The image comes either as the "file" field of a
+// multipart form or as base64 in a JSON body. The format is sniffed from
+// the bytes rather than trusted from the client.
+func (a *API) uploadImage(c *gin.Context) {
+	side, err := tasks.ParseSide(c.Query("side"))
+	if err != nil {
+		writeError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	data, err := a.readImage(c)
+	if err != nil {
+		if errors.Is(err, errImageTooLarge) {
+			writeError(c, http.StatusRequestEntityTooLarge, fmt.Sprintf("image must be at most %d bytes", a.cfg.MaxImageBytes))
+			return
+		}
+		writeError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	if len(data) == 0 {
+		writeError(c, http.StatusUnprocessableEntity, "image is empty")
+		return
+	}
+	contentType := http.DetectContentType(data)
+	if !slices.Contains(imageTypes, contentType) {
+		writeError(c, http.StatusUnprocessableEntity, "image must be PNG, JPEG, or WebP")
+		return
+	}
+
+	t, err := a.storeFor(c).SetImage(c.Param("id"), side, store.Image{
+		ContentType: contentType,
+		Data:        data,
+		UpdatedAt:   a.now(),
+	})
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			writeError(c, http.StatusNotFound, err.Error())
+			return
+		}
+		a.internalError(c, err)
+		return
+	}
+	a.publish(events.TaskUpdated, t, "")
+	renderJSON(c, http.StatusOK, mapTask(t, a.now()))
+}
+
+// readImage returns the uploaded image bytes, or errImageTooLarge once
+// they pass MaxImageBytes.
+func (a *API) readImage(c *gin.Context) ([]byte, error) {
+	limit := a.cfg.MaxImageBytes
+	switch {
+	case strings.HasPrefix(c.ContentType(), "multipart/"):
+		// Leave room for the multipart framing around the file.
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, int64(limit)+64<<10)
+		fh, err := c.FormFile("file")
+		if err != nil {
+			var maxErr *http.MaxBytesError
+			if errors.As(err, &maxErr) {
+				return nil, errImageTooLarge
+			}
+			return nil, errors.New(`multipart upload needs a "file" field`)
+		}
+		if fh.Size > int64(limit) {
+			return nil, errImageTooLarge
+		}
+		f, err := fh.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		return readLimited(f, limit)
+
+	case c.ContentType() == mimeJSON:
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, int64(base64.StdEncoding.EncodedLen(limit))+4<<10)
+		var req imageUploadRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			var maxErr *http.MaxBytesError
+			if errors.As(err, &maxErr) {
+				return nil, errImageTooLarge
+			}
+			return nil, errors.New("invalid json")
+		}
+		raw := req.Data
+		if strings.HasPrefix(raw, "data:") {
+			i := strings.Index(raw, ";base64,")
+			if i < 0 {
+				return nil, errors.New("data URL must be base64-encoded")
+			}
+			raw = raw[i+len(";base64,"):]
+		}
+		data, err := base64.StdEncoding.DecodeString(strings.TrimSpace(raw))
+		if err != nil {
+			return nil, errors.New("data must be base64")
+		}
+		if len(data) > limit {
+			return nil, errImageTooLarge
+		}
+		return data, nil
+	}
+	return nil, errors.New("upload the image as multipart/form-data or as base64 JSON")
+}
+
+func readLimited(r io.Reader, limit int) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(r, int64(limit)+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > limit {
+		return nil, errImageTooLarge
+	}
+	return data, nil
+}
+
+// getImage serves the image on one side of a task.
+func (a *API) getImage(c *gin.Context) {
+	side, err := tasks.ParseSide(c.Query("side"))
+	if err != nil {
+		writeError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	img, err := a.storeFor(c).GetImage(c.Param("id"), side)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) || errors.Is(err, store.ErrNoImage) {
+			writeError(c, http.StatusNotFound, err.Error())
+			return
+		}
+		a.internalError(c, err)
+		return
+	}
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.Header("Last-Modified", img.UpdatedAt.UTC().Format(http.TimeFormat))
+	c.Data(http.StatusOK, img.ContentType, img.Data)
+}
+
+// deleteImage removes the image on one side of a task.
+func (a *API) deleteImage(c *gin.Context) {
+	side, err := tasks.ParseSide(c.Query("side"))
+	if err != nil {
+		writeError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	t, err := a.storeFor(c).DeleteImage(c.Param("id"), side, a.now())
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) || errors.Is(err, store.ErrNoImage) {
+			writeError(c, http.StatusNotFound, err.Error())
+			return
+		}
+		a.internalError(c, err)
+		return
+	}
+	a.publish(events.TaskUpdated, t, "")
+	renderJSON(c, http.StatusOK, mapTask(t, a.now()))
+}
@@ -0,0 +1,256 @@
+package api
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"yiwang/internal/events"
+	"yiwang/internal/tasks"
+)
+
+const (
+	maxImportBytes     = 10 << 20
+	defaultImportChunk = 500
+	maxImportChunk     = 5000
+)
+
+type importRow struct {
+	Line int `json:"line"`
+	// NoteID is the source note of an Anki import.
+	NoteID int64  `json:"noteId,omitempty"`
+	OK     bool   `json:"ok"`
+	ID     string `json:"id,omitempty"`
+	Error  string `json:"error,omitempty"`
+
+	task *tasks.Task
+}
+
+type importResponse struct {
+	ValidateOnly bool        `json:"validateOnly"`
+	Total        int         `json:"total"`
+	Succeeded    int         `json:"succeeded"`
+	Failed       int         `json:"failed"`
+	Rows         []importRow `json:"rows"`
+}
+
+// importTasks creates tasks from a CSV of question,answer[,tags] rows,
+// where tags are separated by ";". Valid rows are created in one
+// transaction and invalid ones are reported per line. With
+// ?validateOnly=true nothing is written; with ?stream=true rows are
+// committed in chunks and progress is streamed back (see streamImport).
+func (a *API) importTasks(c *gin.Context) {
+	validateOnly, ok := queryBool(c, "validateOnly")
+	if !ok {
+		return
+	}
+	stream, ok := queryBool(c, "stream")
+	if !ok {
+		return
+	}
+	chunkSize := defaultImportChunk
+	if raw := c.Query("chunkSize"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n <= 0 || n > maxImportChunk {
+			writeError(c, http.StatusBadRequest, "chunkSize must be between 1 and 5000")
+			return
+		}
+		chunkSize = n
+	}
+
+	body, err := importBody(c)
+	if err != nil {
+		writeError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	defer body.Close()
+
+	resp, err := parseImport(body, a.now())
+	if err != nil {
+		writeError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	resp.ValidateOnly = validateOnly
+	if validateOnly {
+		// Nothing is created, so the generated IDs would only mislead.
+		for i := range resp.Rows {
+			resp.Rows[i].ID = ""
+		}
+		renderJSON(c, http.StatusOK, resp)
+		return
+	}
+	if stream {
+		a.streamImport(c, resp, chunkSize)
+		return
+	}
+
+	if valid := resp.valid(0, len(resp.Rows)); len(valid) > 0 {
+		if err := a.storeFor(c).Import(c.Request.Context(), valid); err != nil {
+			a.internalError(c, err)
+			return
+		}
+		a.publishAll(events.TaskCreated, valid)
+	}
+	renderJSON(c, http.StatusOK, resp)
+}
+
+type importProgress struct {
+	Processed int         `json:"processed"`
+	Total     int         `json:"total"`
+	Created   int         `json:"created"`
+	Errors    int         `json:"errors"`
+	Done      bool        `json:"done,omitempty"`
+	Error     string      `json:"error,omitempty"`
+	Failures  []importRow `json:"failures,omitempty"`
+}
+
+// streamImport commits the parsed rows chunkSize at a time, writing one
+// NDJSON progress line per chunk. Each chunk is its own transaction, so a
+// failure or a client disconnect keeps the chunks already committed. The
+// last line has done=true and lists the rows that failed validation.
+func (a *API) streamImport(c *gin.Context, resp importResponse, chunkSize int) {
+	ctx := c.Request.Context()
+	extendWriteDeadline(c, 0)
+	c.Header("Content-Type", mimeNDJSON)
+	c.Status(http.StatusOK)
+	enc := json.NewEncoder(c.Writer)
+	emit := func(p importProgress) {
+		var v interface{} = p
+		if c.GetBool(snakeCaseKey) {
+			v = snakeKeys(p)
+		}
+		_ = enc.Encode(v)
+		c.Writer.Flush()
+	}
+
+	p := importProgress{Total: resp.Total}
+	for start := 0; start < len(resp.Rows); start += chunkSize {
+		end := min(start+chunkSize, len(resp.Rows))
+		valid := resp.valid(start, end)
+		if len(valid) > 0 {
+			if err := a.storeFor(c).Import(ctx, valid); err != nil {
+				if ctx.Err() != nil {
+					return
+				}
+				slog.ErrorContext(ctx, "import chunk", "err", err)
+				p.Error = "import failed after " + strconv.Itoa(p.Processed) + " rows"
+				if a.cfg.ExposeErrors {
+					p.Error += ": " + err.Error()
+				}
+				emit(p)
+				return
+			}
+			a.publishAll(events.TaskCreated, valid)
+		}
+		p.Processed = end
+		p.Created += len(valid)
+		p.Errors += (end - start) - len(valid)
+		emit(p)
+	}
+
+	p.Done = true
+	for _, r := range resp.Rows {
+		if !r.OK {
+			p.Failures = append(p.Failures, r)
+		}
+	}
+	emit(p)
+}
+
+// importBody returns the uploaded CSV, taken from the "file" field of a
+// multipart form or else from the raw request body.
+func importBody(c *gin.Context) (io.ReadCloser, error) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxImportBytes)
+	if !strings.HasPrefix(c.ContentType(), "multipart/") {
+		return c.Request.Body, nil
+	}
+	fh, err := c.FormFile("file")
+	if err != nil {
+		return nil, errors.New(`multipart upload needs a "file" field`)
+	}
+	return fh.Open()
+}
+
+// valid returns the tasks built from the valid rows in Rows[start:end].
+func (r importResponse) valid(start, end int) []*tasks.Task {
+	out := []*tasks.Task{}
+	for _, row := range r.Rows[start:end] {
+		if row.task != nil {
+			out = append(out, row.task)
+		}
+	}
+	return out
+}
+
+// parseImport reads and validates every CSV row, keeping the task built
+// from each valid one. Dry runs and real imports share it so they can't
+// disagree about what is valid.
+func parseImport(r io.Reader, now time.Time) (importResponse, error) {
+	resp := importResponse{Rows: []importRow{}}
+
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	first := true
+	for {
+		rec, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			var maxErr *http.MaxBytesError
+			if errors.As(err, &maxErr) {
+				return resp, fmt.Errorf("csv must be at most %d bytes", maxImportBytes)
+			}
+			return resp, fmt.Errorf("invalid csv: %w", err)
+		}
+		line, _ := cr.FieldPos(0)
+		if first {
+			first = false
+			rec[0] = strings.TrimPrefix(rec[0], "\ufeff")
+			if isImportHeader(rec) {
+				continue
+			}
+		}
+
+		row := importRow{Line: line}
+		t, err := importTask(rec, now)
+		if err != nil {
+			row.Error = err.Error()
+			resp.Failed++
+		} else {
+			row.OK = true
+			row.ID = t.ID
+			row.task = t
+			resp.Succeeded++
+		}
+		resp.Total++
+		resp.Rows = append(resp.Rows, row)
+	}
+	return resp, nil
+}
+
+func importTask(rec []string, now time.Time) (*tasks.Task, error) {
+	if len(rec) < 2 || len(rec) > 3 {
+		return nil, errors.New("expected question,answer[,tags]")
+	}
+	var opts tasks.Options
+	if len(rec) == 3 && strings.TrimSpace(rec[2]) != "" {
+		opts.Tags = strings.Split(rec[2], ";")
+	}
+	return tasks.NewTaskWithOptions(rec[0], rec[1], now, opts)
+}
+
+func isImportHeader(rec []string) bool {
+	return len(rec) >= 2 &&
+		strings.EqualFold(strings.TrimSpace(rec[0]), "question") &&
+		strings.EqualFold(strings.TrimSpace(rec[1]), "answer")
+}
@@ -0,0 +1,103 @@
+package api
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"yiwang/internal/store"
+)
+
+// largeCSV builds rows question,answer,tags rows under a header; every
+// tenth row lacks its answer.
+func largeCSV(rows int) (csv string, invalid int) {
+	var b strings.Builder
+	b.WriteString("question,answer,tags\n")
+	for i := 1; i <= rows; i++ {
+		if i%10 == 0 {
+			fmt.Fprintf(&b, "question %d,,bulk\n", i)
+			invalid++
+			continue
+		}
+		fmt.Fprintf(&b, "question %d,answer %d,bulk;n%d\n", i, i, i%7)
+	}
+	return b.String(), invalid
+}
+
+func TestStreamImportLargeCSV(t *testing.T) {
+	s := newTestServer(t, Config{}, store.Options{})
+	const rows, chunk = 5000, 800
+	csv, invalid := largeCSV(rows)
+
+	w := s.do(http.MethodPost, fmt.Sprintf("/api/tasks/import?stream=true&chunkSize=%d", chunk), csv, "Content-Type", "text/csv")
+	expect(t, w, http.StatusOK)
+	if ct := w.Header().Get("Content-Type"); ct != mimeNDJSON {
+		t.Errorf("Content-Type = %q, want %q", ct, mimeNDJSON)
+	}
+
+	var lines []importProgress
+	sc := bufio.NewScanner(w.Body)
+	for sc.Scan() {
+		var p importProgress
+		if err := json.Unmarshal(sc.Bytes(), &p); err != nil {
+			t.Fatalf("progress line %q: %v", sc.Text(), err)
+		}
+		lines = append(lines, p)
+	}
+	chunks := (rows + chunk - 1) / chunk
+	if len(lines) != chunks+1 {
+		t.Fatalf("got %d progress lines, want one per chunk and a last one: %d", len(lines), chunks+1)
+	}
+	for i, p := range lines[:chunks] {
+		if want := min((i+1)*chunk, rows); p.Processed != want || p.Total != rows || p.Done {
+			t.Errorf("line %d = %+v, want %d of %d processed", i, p, want, rows)
+		}
+		if p.Created+p.Errors != p.Processed {
+			t.Errorf("line %d: created %d and errors %d don't add up to %d", i, p.Created, p.Errors, p.Processed)
+		}
+	}
+	last := lines[chunks]
+	if !last.Done || last.Processed != rows || last.Created != rows-invalid || last.Errors != invalid || len(last.Failures) != invalid {
+		t.Errorf("last line = done %v, %d processed, %d created, %d errors, %d failures; want done, %d, %d, %d, %d",
+			last.Done, last.Processed, last.Created, last.Errors, len(last.Failures), rows, rows-invalid, invalid, invalid)
+	}
+	// Line 1 is the header, so question 10 is on line 11.
+	if len(last.Failures) > 0 && last.Failures[0].Line != 11 {
+		t.Errorf("first failure on line %d, want 11", last.Failures[0].Line)
+	}
+
+	all, err := s.store.All()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != rows-invalid {
+		t.Errorf("store holds %d tasks, want %d", len(all), rows-invalid)
+	}
+}
+
+func TestImportLargeCSVAtOnce(t *testing.T) {
+	s := newTestServer(t, Config{}, store.Options{})
+	const rows = 3000
+	csv, invalid := largeCSV(rows)
+
+	w := s.do(http.MethodPost, "/api/tasks/import", csv, "Content-Type", "text/csv")
+	expect(t, w, http.StatusOK)
+	var resp importResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Total != rows || resp.Succeeded != rows-invalid || resp.Failed != invalid {
+		t.Errorf("response = %d total, %d succeeded, %d failed; want %d, %d, %d",
+			resp.Total, resp.Succeeded, resp.Failed, rows, rows-invalid, invalid)
+	}
+	all, err := s.store.All()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != rows-invalid {
+		t.Errorf("store holds %d tasks, want %d", len(all), rows-invalid)
+	}
+}
@@ -0,0 +1,113 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+
+	"yiwang/internal/store"
+)
+
+const maxKeyName = 64
+
+type keyRequest struct {
+	Name string `json:"name"`
+	// Role is user (the default) or admin. The first key is always an
+	// admin's.
+	Role string `json:"role"`
+}
+
+type keyResponse struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	// Prefix is the start of the key, to tell keys apart.
+	Prefix     string     `json:"prefix"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	LastUsedAt *time.Time `json:"lastUsedAt"`
+	Role       string     `json:"role"`
+	// Key is the secret itself, only returned when the key is created.
+	Key string `json:"key,omitempty"`
+}
+
+func mapKey(k store.APIKey) keyResponse {
+	return keyResponse{ID: k.ID, Name: k.Name, Prefix: k.Prefix, CreatedAt: k.CreatedAt, LastUsedAt: k.LastUsedAt, Role: k.Role}
+}
+
+// createKey mints an API key for scripts, which send it as
+// "Authorization: Bearer <key>". The key is shown once, in the response.
+// An anonymous caller can only mint the first admin key.
+func (a *API) createKey(c *gin.Context) {
+	var req keyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		writeError(c, http.StatusBadRequest, "invalid json")
+		return
+	}
+	name := strings.TrimSpace(req.Name)
+	if name == "" || utf8.RuneCountInString(name) > maxKeyName {
+		writeError(c, http.StatusBadRequest, "name must be 1 to 64 characters")
+		return
+	}
+	role := req.Role
+	if role == "" {
+		role = store.RoleUser
+	}
+	if !store.ValidRole(role) {
+		writeError(c, http.StatusBadRequest, "role must be user or admin")
+		return
+	}
+	var (
+		k      store.APIKey
+		secret string
+		err    error
+	)
+	if c.GetBool(bootstrapKey) {
+		// The bootstrap key is an admin key whatever was asked for. An
+		// admin may have appeared since authenticate looked.
+		k, secret, err = a.storeFor(c).CreateFirstAPIKey(name, a.now())
+		if errors.Is(err, store.ErrAdminExists) {
+			unauthorized(c, "authentication required")
+			return
+		}
+	} else {
+		k, secret, err = a.storeFor(c).CreateAPIKey(name, role, a.now())
+	}
+	if err != nil {
+		a.internalError(c, err)
+		return
+	}
+	resp := mapKey(k)
+	resp.Key = secret
+	renderJSON(c, http.StatusCreated, resp)
+}
+
+// listKeys returns every API key, without the secrets.
+func (a *API) listKeys(c *gin.Context) {
+	keys, err := a.storeFor(c).APIKeys()
+	if err != nil {
+		a.internalError(c, err)
+		return
+	}
+	out := make([]keyResponse, 0, len(keys))
+	for _, k := range keys {
+		out = append(out, mapKey(k))
+	}
+	renderJSON(c, http.StatusOK, out)
+}
+
+// deleteKey revokes an API key at once.
+func (a *API) deleteKey(c *gin.Context) {
+	err := a.storeFor(c).DeleteAPIKey(c.Param("id"))
+	if errors.Is(err, store.ErrAPIKeyNotFound) {
+		writeError(c, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		a.internalError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,93 @@
+package api
+
+import (
+	"errors"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"yiwang/internal/tasks"
+)
+
+var errDailyLimit = errors.New("daily limits reached; more cards open up when the day rolls over")
+
+// allowance is how many more cards the daily limits let through today,
+// math.MaxInt for a kind that isn't limited.
+type allowance struct {
+	reviews int
+	fresh   int
+}
+
+// limitsOn reports whether either daily limit is set.
+func (a *API) limitsOn() bool {
+	return a.cfg.MaxReviewsPerDay > 0 || a.cfg.MaxNewPerDay > 0
+}
+
+// studyDayStart returns when the day containing t began for the daily
+// limits: DayStart past midnight in the configured location, so with 4h
+// a review at 2am still counts toward the previous day.
+func (a *API) studyDayStart(t time.Time) time.Time {
+	return a.startOfDay(t.Add(-a.cfg.DayStart)).Add(a.cfg.DayStart)
+}
+
+// dailyAllowance counts what has been studied since the study day began
+// against the limits.
+func (a *API) dailyAllowance(c *gin.Context, now time.Time) (allowance, error) {
+	l := allowance{reviews: math.MaxInt, fresh: math.MaxInt}
+	if !a.limitsOn() {
+		return l, nil
+	}
+	newCards, reviews, err := a.storeFor(c).CountStudied(a.studyDayStart(now))
+	if err != nil {
+		return l, err
+	}
+	if a.cfg.MaxReviewsPerDay > 0 {
+		l.reviews = max(a.cfg.MaxReviewsPerDay-reviews, 0)
+	}
+	if a.cfg.MaxNewPerDay > 0 {
+		l.fresh = max(a.cfg.MaxNewPerDay-newCards, 0)
+	}
+	return l, nil
+}
+
+// limitReady trims ready tasks to what is left of today's limits, keeping
+// the earliest due of each kind, in due order. Without limits ts is
+// returned as is.
+func (a *API) limitReady(c *gin.Context, ts []*tasks.Task, now time.Time) ([]*tasks.Task, error) {
+	if !a.limitsOn() || len(ts) == 0 {
+		return ts, nil
+	}
+	left, err := a.dailyAllowance(c, now)
+	if err != nil {
+		return nil, err
+	}
+	studied, err := a.storeFor(c).StudiedIDs()
+	if err != nil {
+		return nil, err
+	}
+	sorted := append([]*tasks.Task(nil), ts...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if !sorted[i].NextReviewAt.Equal(sorted[j].NextReviewAt) {
+			return sorted[i].NextReviewAt.Before(sorted[j].NextReviewAt)
+		}
+		return sorted[i].CreatedAt.Before(sorted[j].CreatedAt)
+	})
+	out := sorted[:0]
+	for _, t := range sorted {
+		if studied[t.ID] {
+			if left.reviews == 0 {
+				continue
+			}
+			left.reviews--
+		} else {
+			if left.fresh == 0 {
+				continue
+			}
+			left.fresh--
+		}
+		out = append(out, t)
+	}
+	return out, nil
+}
@@ -0,0 +1,67 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"yiwang/internal/store"
+)
+
+// TestEmptyListsAreArrays checks that every list an endpoint returns is
+// [] rather than null when there is nothing in it.
+func TestEmptyListsAreArrays(t *testing.T) {
+	s := newTestServer(t, Config{Admin: true}, store.Options{})
+	auth := s.adminAuth(t)
+	w := s.do(http.MethodPost, "/api/webhooks", `{"url":"https://example.com/hook"}`, auth...)
+	expect(t, w, http.StatusCreated)
+	var hook struct{ ID string }
+	if err := json.Unmarshal(w.Body.Bytes(), &hook); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		method, path, body string
+		// field names the list in an object; empty means the body is one.
+		field string
+	}{
+		{"GET", "/api/tasks", "", ""},
+		{"GET", "/api/tasks?status=archived", "", ""},
+		{"GET", "/api/tasks?status=deleted", "", ""},
+		{"GET", "/api/tasks?ids=a,b", "", ""},
+		{"GET", "/api/tasks?filter=leech", "", ""},
+		{"GET", "/api/tasks/ready", "", ""},
+		{"GET", "/api/tasks/random", "", ""},
+		{"GET", "/api/tasks/search?q=x", "", ""},
+		{"GET", "/api/tasks/statuses", "", "items"},
+		{"GET", "/api/tasks/simulate", "", "items"},
+		{"GET", "/api/tasks/export", "", ""},
+		{"POST", "/api/tasks/batch-get", `{"ids":["missing"]}`, ""},
+		{"GET", "/api/tag-schedules", "", ""},
+		{"GET", "/api/tags", "", ""},
+		{"GET", "/api/decks", "", ""},
+		{"GET", "/api/auth/providers", "", "providers"},
+		{"GET", "/api/users", "", ""},
+		{"GET", "/api/webhooks/" + hook.ID + "/deliveries", "", ""},
+		{"GET", "/api/admin/scan-errors", "", "items"},
+	} {
+		w := s.do(tc.method, tc.path, tc.body, auth...)
+		if w.Code != http.StatusOK {
+			t.Errorf("%s %s = %d, want 200; body: %s", tc.method, tc.path, w.Code, w.Body)
+			continue
+		}
+		raw := json.RawMessage(w.Body.Bytes())
+		if tc.field != "" {
+			var obj map[string]json.RawMessage
+			if err := json.Unmarshal(raw, &obj); err != nil {
+				t.Errorf("%s %s: %v", tc.method, tc.path, err)
+				continue
+			}
+			raw = obj[tc.field]
+		}
+		var list []interface{}
+		if err := json.Unmarshal(raw, &list); err != nil || list == nil || len(list) != 0 {
+			t.Errorf("%s %s: list is %s, want []", tc.method, tc.path, raw)
+		}
+	}
+}
@@ -0,0 +1,191 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+)
+
+// FieldNaming is the style of JSON object keys in responses.
+type FieldNaming string
+
+const (
+	// CamelCase keys, e.g. "nextReviewAt"; the default.
+	CamelCase FieldNaming = "camelCase"
+	// SnakeCase keys, e.g. "next_review_at".
+	SnakeCase FieldNaming = "snake_case"
+)
+
+const snakeCaseKey = "snakeCase"
+
+// ParseFieldNaming accepts camelCase or snake_case; empty means camelCase.
+func ParseFieldNaming(s string) (FieldNaming, error) {
+	switch n := FieldNaming(s); n {
+	case "":
+		return CamelCase, nil
+	case CamelCase, SnakeCase:
+		return n, nil
+	}
+	return "", fmt.Errorf("field naming must be %s or %s", CamelCase, SnakeCase)
+}
+
+// naming records the response key style for renderJSON.
+func (a *API) naming(c *gin.Context) {
+	c.Set(snakeCaseKey, a.cfg.FieldNaming == SnakeCase)
+}
+
+// renderJSON writes v as the JSON response body, converting object keys to
+// snake_case when the server is configured for it. Every JSON response
+// goes through here so the two styles never mix.
+func renderJSON(c *gin.Context, status int, v interface{}) {
+	if c.GetBool(snakeCaseKey) {
+		v = snakeKeys(v)
+	}
+	c.JSON(status, v)
+}
+
+// snakeKeys round-trips v through JSON and renames the keys that name
+// fields: those of structs and of gin.H literals. Keys of other maps are
+// data, such as the dates of the heatmap, and come through unchanged.
+func snakeKeys(v interface{}) interface{} {
+	b, err := json.Marshal(v)
+	if err != nil {
+		// Let c.JSON report the error as it would have.
+		return v
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	var generic interface{}
+	if err := dec.Decode(&generic); err != nil {
+		return v
+	}
+	return renameKeys(reflect.ValueOf(v), generic)
+}
+
+var (
+	marshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	ginHType      = reflect.TypeOf(gin.H(nil))
+)
+
+// renameKeys walks the decoded form of rv alongside rv itself, which
+// tells struct fields from map entries.
+func renameKeys(rv reflect.Value, v interface{}) interface{} {
+	for rv.Kind() == reflect.Pointer || rv.Kind() == reflect.Interface {
+		if rv.IsNil() {
+			return v
+		}
+		rv = rv.Elem()
+	}
+	if !rv.IsValid() || rv.Type().Implements(marshalerType) || reflect.PointerTo(rv.Type()).Implements(marshalerType) {
+		// Encoded its own way; whatever keys it has aren't field names.
+		return v
+	}
+	switch v := v.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		switch rv.Kind() {
+		case reflect.Struct:
+			fields := jsonFields(rv)
+			for k, val := range v {
+				out[toSnake(k)] = renameKeys(fields[k], val)
+			}
+		case reflect.Map:
+			fieldNames := rv.Type() == ginHType
+			for k, val := range v {
+				key := k
+				if fieldNames {
+					key = toSnake(k)
+				}
+				out[key] = renameKeys(mapIndex(rv, k), val)
+			}
+		default:
+			return v
+		}
+		return out
+	case []interface{}:
+		if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+			return v
+		}
+		for i := range v {
+			v[i] = renameKeys(rv.Index(i), v[i])
+		}
+		return v
+	}
+	return v
+}
+
+// jsonFields maps the JSON keys of a struct's fields, promoted ones
+// included, to their values.
+func jsonFields(rv reflect.Value) map[string]reflect.Value {
+	fields := map[string]reflect.Value{}
+	var embedded []reflect.Value
+	for i := 0; i < rv.NumField(); i++ {
+		f := rv.Type().Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" || (!f.IsExported() && !f.Anonymous) {
+			continue
+		}
+		name, _, _ := strings.Cut(tag, ",")
+		if f.Anonymous && name == "" {
+			embedded = append(embedded, rv.Field(i))
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		fields[name] = rv.Field(i)
+	}
+	// Fields of the outer struct shadow promoted ones.
+	for _, e := range embedded {
+		for e.Kind() == reflect.Pointer && !e.IsNil() {
+			e = e.Elem()
+		}
+		if e.Kind() != reflect.Struct {
+			continue
+		}
+		for name, val := range jsonFields(e) {
+			if _, ok := fields[name]; !ok {
+				fields[name] = val
+			}
+		}
+	}
+	return fields
+}
+
+// mapIndex returns the entry of the map rv that encoded under key.
+func mapIndex(rv reflect.Value, key string) reflect.Value {
+	if rv.Type().Key().Kind() == reflect.String {
+		return rv.MapIndex(reflect.ValueOf(key).Convert(rv.Type().Key()))
+	}
+	iter := rv.MapRange()
+	for iter.Next() {
+		if fmt.Sprint(iter.Key().Interface()) == key {
+			return iter.Value()
+		}
+	}
+	return reflect.Value{}
+}
+
+// toSnake converts a camelCase key: "nextReviewAt" becomes
+// "next_review_at" and "taskID" becomes "task_id".
+func toSnake(s string) string {
+	runes := []rune(s)
+	var b strings.Builder
+	for i, r := range runes {
+		if unicode.IsUpper(r) {
+			prevLower := i > 0 && (unicode.IsLower(runes[i-1]) || unicode.IsDigit(runes[i-1]))
+			nextLower := i > 0 && i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if prevLower || nextLower {
+				b.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
@@ -0,0 +1,126 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"yiwang/internal/store"
+)
+
+func TestToSnake(t *testing.T) {
+	for in, want := range map[string]string{
+		"id":           "id",
+		"nextReviewAt": "next_review_at",
+		"taskID":       "task_id",
+		"questionHtml": "question_html",
+		"stage2Label":  "stage2_label",
+		"HTTPStatus":   "http_status",
+	} {
+		if got := toSnake(in); got != want {
+			t.Errorf("toSnake(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+type namingInner struct {
+	StageCount int `json:"stageCount"`
+}
+
+type namingEmbedded struct {
+	RequestID string `json:"requestId"`
+}
+
+type namingSample struct {
+	namingEmbedded
+	NextReviewAt string         `json:"nextReviewAt"`
+	Inner        *namingInner   `json:"inner"`
+	List         []namingInner  `json:"list"`
+	ByName       map[string]int `json:"byName"`
+	Extra        interface{}    `json:"extra"`
+	Skipped      string         `json:"-"`
+	Untagged     string
+	Nested       map[string]gin.H `json:"nested"`
+}
+
+func TestSnakeKeysRenamesOnlyFields(t *testing.T) {
+	got := snakeKeys(namingSample{
+		namingEmbedded: namingEmbedded{RequestID: "r"},
+		NextReviewAt:   "soon",
+		Inner:          &namingInner{StageCount: 1},
+		List:           []namingInner{{StageCount: 2}},
+		// Map keys are data, even when they look like field names.
+		ByName: map[string]int{"dueSoon": 3},
+		Extra:  gin.H{"readOnly": true},
+		Nested: map[string]gin.H{"userKey": {"innerField": 4}},
+	})
+	b, err := json.Marshal(got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var want interface{}
+	if err := json.Unmarshal([]byte(`{
+		"request_id": "r",
+		"next_review_at": "soon",
+		"inner": {"stage_count": 1},
+		"list": [{"stage_count": 2}],
+		"by_name": {"dueSoon": 3},
+		"extra": {"read_only": true},
+		"untagged": "",
+		"nested": {"userKey": {"inner_field": 4}}
+	}`), &want); err != nil {
+		t.Fatal(err)
+	}
+	var gotJSON interface{}
+	if err := json.Unmarshal(b, &gotJSON); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(gotJSON, want) {
+		t.Errorf("snakeKeys = %s", b)
+	}
+}
+
+func TestFieldNamingModes(t *testing.T) {
+	for _, tc := range []struct {
+		naming FieldNaming
+		// want and unwanted are keys the task and error bodies must and
+		// must not have.
+		want, unwanted []string
+	}{
+		{CamelCase, []string{`"nextReviewAt"`, `"createdAt"`, `"totalStages"`}, []string{`"next_review_at"`, `"created_at"`}},
+		{SnakeCase, []string{`"next_review_at"`, `"created_at"`, `"total_stages"`}, []string{`"nextReviewAt"`, `"createdAt"`}},
+	} {
+		t.Run(string(tc.naming), func(t *testing.T) {
+			s := newTestServer(t, Config{FieldNaming: tc.naming}, store.Options{})
+			w := s.do(http.MethodPost, "/api/tasks", `{"question":"q","answer":"a","firstReviewIn":"0s"}`)
+			expect(t, w, http.StatusCreated)
+			for _, key := range tc.want {
+				if !strings.Contains(w.Body.String(), key) {
+					t.Errorf("task %s lacks %s", w.Body, key)
+				}
+			}
+			for _, key := range tc.unwanted {
+				if strings.Contains(w.Body.String(), key) {
+					t.Errorf("task %s has %s", w.Body, key)
+				}
+			}
+
+			w = s.do(http.MethodGet, "/api/tasks/missing", "")
+			expect(t, w, http.StatusNotFound)
+			if !strings.HasPrefix(w.Body.String(), `{"error":`) {
+				t.Errorf("error body = %s", w.Body)
+			}
+
+			// Heatmap days are keyed by date in either mode.
+			w = s.do(http.MethodGet, "/api/analytics/heatmap?year=2024", "")
+			expect(t, w, http.StatusOK)
+			if !strings.Contains(w.Body.String(), `"2024-03-01":`) {
+				t.Errorf("heatmap %s lacks the day 2024-03-01", w.Body)
+			}
+		})
+	}
+}
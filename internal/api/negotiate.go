@@ -0,0 +1,79 @@
+package api
+
+import (
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	mimeJSON   = "application/json"
+	mimeNDJSON = "application/x-ndjson"
+)
+
+// produces rejects requests whose Accept header rules out every media type
+// the route can produce. A missing Accept header accepts anything. When
+// StrictAccept is off the Accept header is ignored altogether.
+func (a *API) produces(types ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !a.cfg.StrictAccept {
+			return
+		}
+		if !acceptable(c.GetHeader("Accept"), types) {
+			writeError(c, http.StatusNotAcceptable, "not acceptable; this endpoint produces "+strings.Join(types, ", "))
+			c.Abort()
+		}
+	}
+}
+
+// acceptable reports whether any media range in an Accept header matches
+// one of types. Ranges with q=0 are explicit refusals and are skipped;
+// unparsable ranges are ignored.
+func acceptable(header string, types []string) bool {
+	if strings.TrimSpace(header) == "" {
+		return true
+	}
+	for _, part := range strings.Split(header, ",") {
+		mediaRange, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		if q, ok := params["q"]; ok {
+			if v, err := strconv.ParseFloat(q, 64); err != nil || v <= 0 {
+				continue
+			}
+		}
+		for _, t := range types {
+			if mediaMatches(mediaRange, t) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func mediaMatches(mediaRange, typ string) bool {
+	if mediaRange == "*/*" || mediaRange == typ {
+		return true
+	}
+	major, sub, _ := strings.Cut(mediaRange, "/")
+	return sub == "*" && strings.HasPrefix(typ, major+"/")
+}
+
+// queryBool parses an optional boolean query parameter, answering 400 and
+// returning ok=false when it is malformed.
+func queryBool(c *gin.Context, name string) (v, ok bool) {
+	raw := c.Query(name)
+	if raw == "" {
+		return false, true
+	}
+	v, err := strconv.ParseBool(raw)
+	if err != nil {
+		writeError(c, http.StatusBadRequest, name+" must be a boolean")
+		return false, false
+	}
+	return v, true
+}
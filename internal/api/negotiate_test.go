@@ -0,0 +1,51 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"yiwang/internal/store"
+)
+
+func TestStrictAccept(t *testing.T) {
+	s := newTestServer(t, Config{StrictAccept: true}, store.Options{})
+
+	for _, tc := range []struct {
+		path, accept string
+		status       int
+	}{
+		{"/api/tasks", "", http.StatusOK},
+		{"/api/tasks", "*/*", http.StatusOK},
+		{"/api/tasks", "application/*", http.StatusOK},
+		{"/api/tasks", "application/xml, application/json;q=0.5", http.StatusOK},
+		{"/api/tasks", "application/xml", http.StatusNotAcceptable},
+		{"/api/tasks", "text/html, application/xhtml+xml", http.StatusNotAcceptable},
+		// q=0 refuses JSON outright.
+		{"/api/tasks", "application/json;q=0", http.StatusNotAcceptable},
+		{"/api/tasks", "*/*;q=0", http.StatusNotAcceptable},
+		{"/api/tasks", ";;;,,garbage", http.StatusNotAcceptable},
+		// Exports produce their own type whichever one is asked for.
+		{"/api/tasks/export?format=csv", "text/csv", http.StatusOK},
+		{"/api/tasks/export?format=csv", "application/xml", http.StatusNotAcceptable},
+	} {
+		w := s.do(http.MethodGet, tc.path, "", "Accept", tc.accept)
+		if w.Code != tc.status {
+			t.Errorf("GET %s with Accept %q = %d, want %d", tc.path, tc.accept, w.Code, tc.status)
+			continue
+		}
+		if w.Code != http.StatusNotAcceptable {
+			continue
+		}
+		var body struct{ Error string }
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || !strings.Contains(body.Error, "not acceptable") {
+			t.Errorf("GET %s with Accept %q answered %s, want a JSON error", tc.path, tc.accept, w.Body)
+		}
+	}
+}
+
+func TestAcceptIgnoredWhenNotStrict(t *testing.T) {
+	s := newTestServer(t, Config{}, store.Options{})
+	expect(t, s.do(http.MethodGet, "/api/tasks", "", "Accept", "application/xml"), http.StatusOK)
+}
@@ -0,0 +1,34 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"yiwang/internal/tasks"
+)
+
+type normalizePreviewResponse struct {
+	Question        string `json:"question"`
+	Answer          string `json:"answer"`
+	QuestionChanged bool   `json:"questionChanged"`
+	AnswerChanged   bool   `json:"answerChanged"`
+}
+
+// normalizePreview shows how question and answer would be stored, without
+// creating anything.
+func (a *API) normalizePreview(c *gin.Context) {
+	var req createTaskRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		writeError(c, http.StatusBadRequest, "invalid json")
+		return
+	}
+	q := tasks.Normalize(req.Question)
+	ans := tasks.Normalize(req.Answer)
+	renderJSON(c, http.StatusOK, normalizePreviewResponse{
+		Question:        q,
+		Answer:          ans,
+		QuestionChanged: q != req.Question,
+		AnswerChanged:   ans != req.Answer,
+	})
+}
@@ -0,0 +1,166 @@
+package api
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"yiwang/internal/oauth"
+	"yiwang/internal/session"
+	"yiwang/internal/store"
+)
+
+// stateCookie carries the OAuth state from the login redirect to the
+// callback, tying the two to the same browser.
+const stateCookie = "yiwang_oauth_state"
+
+// authProviders lists the providers users can sign in with, so the UI
+// knows which buttons to show.
+func (a *API) authProviders(c *gin.Context) {
+	names := make([]string, 0, len(a.cfg.OAuth))
+	if a.cfg.Sessions != nil {
+		for _, p := range a.cfg.OAuth {
+			names = append(names, p.Name)
+		}
+	}
+	renderJSON(c, http.StatusOK, gin.H{"providers": names})
+}
+
+// oauthLogin sends the browser to the provider to sign in.
+func (a *API) oauthLogin(c *gin.Context) {
+	p := a.provider(c)
+	if p == nil {
+		return
+	}
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		a.internalError(c, err)
+		return
+	}
+	state := hex.EncodeToString(b[:])
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     stateCookie,
+		Value:    state,
+		Path:     c.Request.URL.Path[:strings.LastIndex(c.Request.URL.Path, "/")],
+		MaxAge:   600,
+		HttpOnly: true,
+		Secure:   a.cfg.Sessions.Secure,
+		SameSite: http.SameSiteLaxMode,
+	})
+	c.Redirect(http.StatusFound, p.AuthCodeURL(state, a.callbackURL(c, p)))
+}
+
+// oauthCallback finishes signing in: it trades the provider's code for the
+// identity, finds or creates the user it belongs to and starts a session.
+// Signing in while already signed in links the identity to the same user;
+// otherwise the account must be on SignInAllow or AdminEmails.
+func (a *API) oauthCallback(c *gin.Context) {
+	p := a.provider(c)
+	if p == nil {
+		return
+	}
+	cookie, err := c.Request.Cookie(stateCookie)
+	if err != nil || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(c.Query("state"))) != 1 {
+		writeError(c, http.StatusBadRequest, "sign-in state mismatch; start again")
+		return
+	}
+	http.SetCookie(c.Writer, &http.Cookie{Name: stateCookie, Path: cookie.Path, MaxAge: -1})
+	if e := c.Query("error"); e != "" {
+		writeError(c, http.StatusBadRequest, "sign-in refused: "+e)
+		return
+	}
+
+	id, err := p.Exchange(c.Request.Context(), c.Query("code"), a.callbackURL(c, p))
+	if err != nil {
+		slog.WarnContext(c.Request.Context(), "oauth sign-in failed", "provider", p.Name, "err", err)
+		writeError(c, http.StatusBadGateway, "sign-in with "+p.Name+" failed")
+		return
+	}
+	if id.Subject == "" {
+		writeError(c, http.StatusBadGateway, "sign-in with "+p.Name+" returned no account")
+		return
+	}
+	var linkTo string
+	if u, ok := c.Get(userKey); ok {
+		linkTo = u.(store.User).ID
+	}
+	role, allowed := a.signInRole(id.Email, id.EmailVerified)
+	if !allowed && linkTo == "" {
+		slog.WarnContext(c.Request.Context(), "oauth sign-in refused", "provider", p.Name, "email", id.Email)
+		writeError(c, http.StatusForbidden, "this account may not sign in here")
+		return
+	}
+	u, err := a.storeFor(c).SignIn(store.Identity{
+		Provider:      p.Name,
+		Subject:       id.Subject,
+		Name:          id.Name,
+		Email:         id.Email,
+		EmailVerified: id.EmailVerified,
+	}, linkTo, role, a.now())
+	if err != nil {
+		a.internalError(c, err)
+		return
+	}
+	if err := a.cfg.Sessions.Start(c.Request.Context(), c.Writer, session.Session{UserID: u.ID}); err != nil {
+		a.internalError(c, err)
+		return
+	}
+	slog.InfoContext(c.Request.Context(), "signed in", "provider", p.Name, "user", u.ID)
+	c.Redirect(http.StatusFound, "/")
+}
+
+// signInRole reports whether an account with email may sign in, by
+// SignInAllow and AdminEmails, and the role a new user for it gets.
+// Unverified emails match neither list.
+func (a *API) signInRole(email string, verified bool) (role string, allowed bool) {
+	email = strings.ToLower(strings.TrimSpace(email))
+	if !verified || email == "" {
+		return store.RoleUser, false
+	}
+	for _, e := range a.cfg.AdminEmails {
+		if strings.EqualFold(e, email) {
+			return store.RoleAdmin, true
+		}
+	}
+	_, domain, _ := strings.Cut(email, "@")
+	for _, e := range a.cfg.SignInAllow {
+		e = strings.ToLower(strings.TrimPrefix(e, "@"))
+		if e == email || e == domain {
+			return store.RoleUser, true
+		}
+	}
+	return store.RoleUser, false
+}
+
+// provider is the provider named in the route, or nil after answering 404.
+func (a *API) provider(c *gin.Context) *oauth.Provider {
+	if a.cfg.Sessions != nil {
+		for _, p := range a.cfg.OAuth {
+			if p.Name == c.Param("provider") {
+				return p
+			}
+		}
+	}
+	writeError(c, http.StatusNotFound, "unknown sign-in provider")
+	return nil
+}
+
+// callbackURL is where p sends the browser back to, which must match the
+// redirect URL registered with p exactly.
+func (a *API) callbackURL(c *gin.Context, p *oauth.Provider) string {
+	base := strings.TrimRight(a.cfg.PublicURL, "/")
+	if base == "" {
+		scheme := "http"
+		if c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https" {
+			scheme = "https"
+		}
+		base = scheme + "://" + c.Request.Host
+	}
+	path := c.FullPath()
+	return base + path[:strings.Index(path, "/auth/")] + "/auth/" + p.Name + "/callback"
+}
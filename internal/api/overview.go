@@ -0,0 +1,150 @@
+package api
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	retentionDays = 30
+	maxAddedWeeks = 52
+	// streakChunk is how many days currentStreak counts per query.
+	streakChunk = 31
+)
+
+type weekCount struct {
+	// Week is the local date of the week's Monday.
+	Week  string `json:"week"`
+	Added int    `json:"added"`
+}
+
+type overviewResponse struct {
+	// Statuses counts tasks by status, deleted ones included; Total is
+	// the tasks not deleted.
+	Statuses map[string]int `json:"statuses"`
+	Total    int            `json:"total"`
+	// AverageStage is the mean stage of active tasks on the stage
+	// ladder, or null when there are none.
+	AverageStage *float64 `json:"averageStage"`
+	// Retention is the share of reviews remembered over the last 30
+	// days, including today, or null without reviews.
+	Retention *float64 `json:"retention"`
+	Reviews   int      `json:"reviews"`
+	// AddedPerWeek counts cards added in each of the last ?weeks weeks,
+	// oldest first, the current week last.
+	AddedPerWeek []weekCount `json:"addedPerWeek"`
+	// Streak is the current run of days meeting the daily target, as
+	// GET /streak reports it.
+	Streak int `json:"streak"`
+}
+
+// overview sums up the collection for a dashboard. Everything is counted
+// in the database, so the cost doesn't grow with the rows loaded.
+func (a *API) overview(c *gin.Context) {
+	weeks := 12
+	if raw := c.Query("weeks"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n <= 0 || n > maxAddedWeeks {
+			writeError(c, http.StatusBadRequest, "weeks must be between 1 and 52")
+			return
+		}
+		weeks = n
+	}
+
+	now := a.now()
+	statuses, err := a.storeFor(c).CountByStatus(now)
+	if err != nil {
+		a.internalError(c, err)
+		return
+	}
+	resp := overviewResponse{Statuses: map[string]int{}}
+	for _, s := range []string{"ready", "pending", "done", "suspended", "archived", "deleted"} {
+		resp.Statuses[s] = statuses[s]
+		if s != "deleted" {
+			resp.Total += statuses[s]
+		}
+	}
+
+	avg, n, err := a.storeFor(c).AverageStage()
+	if err != nil {
+		a.internalError(c, err)
+		return
+	}
+	if n > 0 {
+		avg = math.Round(avg*100) / 100
+		resp.AverageStage = &avg
+	}
+
+	end := a.startOfDay(now).AddDate(0, 0, 1)
+	remembered, forgot, err := a.storeFor(c).ReviewTally(end.AddDate(0, 0, -retentionDays), end)
+	if err != nil {
+		a.internalError(c, err)
+		return
+	}
+	resp.Reviews = remembered + forgot
+	resp.Retention = retention(remembered, resp.Reviews)
+
+	if resp.AddedPerWeek, err = a.addedPerWeek(c, weeks, now); err != nil {
+		a.internalError(c, err)
+		return
+	}
+	if resp.Streak, err = a.currentStreak(c, a.cfg.DailyTarget, now); err != nil {
+		a.internalError(c, err)
+		return
+	}
+	renderJSON(c, http.StatusOK, resp)
+}
+
+// addedPerWeek counts the cards added in each of the last weeks local
+// weeks, Monday to Sunday.
+func (a *API) addedPerWeek(c *gin.Context, weeks int, now time.Time) ([]weekCount, error) {
+	today := a.startOfDay(now)
+	monday := today.AddDate(0, 0, -(int(today.Weekday())+6)%7)
+	bounds := make([]time.Time, 0, weeks+1)
+	for i := weeks - 1; i >= -1; i-- {
+		bounds = append(bounds, monday.AddDate(0, 0, -7*i))
+	}
+	counts, err := a.storeFor(c).CreatedCounts(bounds)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]weekCount, len(counts))
+	for i, n := range counts {
+		out[i] = weekCount{Week: bounds[i].Format(time.DateOnly), Added: n}
+	}
+	return out, nil
+}
+
+// currentStreak is the current streak of streak's rules, counted in the
+// database a month at a time walking back from today.
+func (a *API) currentStreak(c *gin.Context, goal int, now time.Time) (int, error) {
+	today := a.startOfDay(now)
+	end := today.AddDate(0, 0, 1)
+	run := 0
+	for {
+		bounds := make([]time.Time, streakChunk+1)
+		for i := range bounds {
+			bounds[i] = end.AddDate(0, 0, i-streakChunk)
+		}
+		counts, err := a.storeFor(c).ReviewCounts(bounds)
+		if err != nil {
+			return 0, err
+		}
+		for i := len(counts) - 1; i >= 0; i-- {
+			if counts[i] >= goal {
+				run++
+				continue
+			}
+			if bounds[i].Equal(today) {
+				// Today isn't over, so falling short so far isn't a miss.
+				continue
+			}
+			return run, nil
+		}
+		end = bounds[0]
+	}
+}
@@ -0,0 +1,100 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"yiwang/internal/store"
+)
+
+const (
+	defaultTaskPage = 100
+	maxTaskPage     = 1000
+)
+
+type taskPageResponse struct {
+	Items []taskResponse `json:"items"`
+	// Total counts every task matching the filters, across all pages.
+	Total  int `json:"total"`
+	Limit  int `json:"limit"`
+	Offset int `json:"offset"`
+}
+
+// listTaskPage serves GET /tasks, filtering and ordering in SQL rather
+// than over the whole collection. ?sort is next_review_at, created_at
+// (the default) or stage, and ?order asc (the default) or desc. With
+// ?limit or ?offset it returns ?limit tasks (default 100, at most 1000)
+// after skipping ?offset, wrapped in an envelope with the total; without
+// them every match comes back as a plain array.
+func (a *API) listTaskPage(c *gin.Context, status string, scope listScope, preview int, now time.Time) {
+	paged := c.Query("limit") != "" || c.Query("offset") != ""
+	var page store.Page
+	if paged {
+		var ok bool
+		if page.Limit, ok = intParam(c, "limit", defaultTaskPage, 1, maxTaskPage); !ok {
+			return
+		}
+		if page.Offset, ok = intParam(c, "offset", 0, 0, -1); !ok {
+			return
+		}
+	}
+	page.Sort = strings.ToLower(strings.TrimSpace(c.Query("sort")))
+	switch strings.ToLower(strings.TrimSpace(c.Query("order"))) {
+	case "", "asc":
+	case "desc":
+		page.Desc = true
+	default:
+		writeError(c, http.StatusBadRequest, "order must be asc or desc")
+		return
+	}
+
+	f := store.Filter{Status: status, Tag: scope.tag, Deck: scope.deck, Leech: scope.leech}
+	ts, total, err := a.storeFor(c).ListPage(f, page, now)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrInvalidFilter):
+			writeError(c, http.StatusBadRequest, store.ErrInvalidFilter.Error()+", deleted")
+		case errors.Is(err, store.ErrInvalidSort):
+			writeError(c, http.StatusBadRequest, err.Error())
+		default:
+			a.internalError(c, err)
+		}
+		return
+	}
+	items := make([]taskResponse, 0, len(ts))
+	for _, t := range ts {
+		tr := mapTask(t, now)
+		tr.truncate(preview)
+		items = append(items, tr)
+	}
+	if !paged {
+		renderJSON(c, http.StatusOK, items)
+		return
+	}
+	renderJSON(c, http.StatusOK, taskPageResponse{Items: items, Total: total, Limit: page.Limit, Offset: page.Offset})
+}
+
+// intParam reads an optional integer query parameter between lo and hi,
+// where hi < 0 means no upper bound. It answers 400 itself and returns
+// false when the value is malformed or out of range.
+func intParam(c *gin.Context, name string, def, lo, hi int) (int, bool) {
+	raw := c.Query(name)
+	if raw == "" {
+		return def, true
+	}
+	n, err := strconv.Atoi(raw)
+	if err != nil || n < lo || (hi >= 0 && n > hi) {
+		msg := name + " must be at least " + strconv.Itoa(lo)
+		if hi >= 0 {
+			msg = name + " must be between " + strconv.Itoa(lo) + " and " + strconv.Itoa(hi)
+		}
+		writeError(c, http.StatusBadRequest, msg)
+		return 0, false
+	}
+	return n, true
+}
@@ -0,0 +1,61 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+)
+
+const ellipsis = "…"
+
+// previewParam reads ?preview=N, the rune limit for list previews; zero
+// means full text. It answers 400 and returns ok=false when malformed.
+func previewParam(c *gin.Context) (n int, ok bool) {
+	raw := c.Query("preview")
+	if raw == "" {
+		return 0, true
+	}
+	n, err := strconv.Atoi(raw)
+	if err != nil || n <= 0 {
+		writeError(c, http.StatusBadRequest, "preview must be a positive integer")
+		return 0, false
+	}
+	return n, true
+}
+
+// truncate shortens question and answer to at most n runes each, marking
+// the response as truncated when either was cut. The HTML of a cut side is
+// dropped, since it would still hold the whole text. n <= 0 is a no-op.
+func (r *taskResponse) truncate(n int) {
+	if n <= 0 {
+		return
+	}
+	var qCut, aCut bool
+	r.Question, qCut = truncateRunes(r.Question, n)
+	r.Answer, aCut = truncateRunes(r.Answer, n)
+	if qCut {
+		r.QuestionHTML = ""
+	}
+	if aCut {
+		r.AnswerHTML = ""
+	}
+	r.Truncated = qCut || aCut
+}
+
+// truncateRunes cuts s after n runes, never inside a multi-byte character,
+// and appends an ellipsis when anything was dropped.
+func truncateRunes(s string, n int) (string, bool) {
+	if utf8.RuneCountInString(s) <= n {
+		return s, false
+	}
+	i := 0
+	for pos := range s {
+		if i == n {
+			return s[:pos] + ellipsis, true
+		}
+		i++
+	}
+	return s, false
+}
@@ -0,0 +1,78 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"unicode/utf8"
+
+	"yiwang/internal/store"
+)
+
+func TestTruncateRunes(t *testing.T) {
+	for _, tc := range []struct {
+		in   string
+		n    int
+		want string
+		cut  bool
+	}{
+		{"hello", 5, "hello", false},
+		{"hello", 4, "hell…", true},
+		{"漢字かな", 4, "漢字かな", false},
+		{"漢字かな", 3, "漢字か…", true},
+		{"漢字かな", 1, "漢…", true},
+		// The boundary falls right after a multi-byte rune, and right
+		// before one.
+		{"ab漢字", 3, "ab漢…", true},
+		{"ab漢字", 2, "ab…", true},
+		// Four-byte runes count as one each.
+		{"😀😃😄", 2, "😀😃…", true},
+		{"a😀b", 2, "a😀…", true},
+		{"", 3, "", false},
+	} {
+		got, cut := truncateRunes(tc.in, tc.n)
+		if got != tc.want || cut != tc.cut {
+			t.Errorf("truncateRunes(%q, %d) = %q, %v; want %q, %v", tc.in, tc.n, got, cut, tc.want, tc.cut)
+		}
+		if !utf8.ValidString(got) {
+			t.Errorf("truncateRunes(%q, %d) = %q, which is not valid UTF-8", tc.in, tc.n, got)
+		}
+	}
+}
+
+func TestListPreview(t *testing.T) {
+	s := newTestServer(t, Config{}, store.Options{})
+	w := s.do(http.MethodPost, "/api/tasks", `{"question":"日本の首都は？","answer":"東京","format":"markdown"}`)
+	expect(t, w, http.StatusCreated)
+	var created taskResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &created); err != nil {
+		t.Fatal(err)
+	}
+
+	w = s.do(http.MethodGet, "/api/tasks?preview=3", "")
+	expect(t, w, http.StatusOK)
+	var list []taskResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &list); err != nil || len(list) != 1 {
+		t.Fatalf("list = %s", w.Body)
+	}
+	got := list[0]
+	if got.Question != "日本の…" || got.Answer != "東京" || !got.Truncated {
+		t.Errorf("preview = %q / %q truncated %v, want %q / %q truncated", got.Question, got.Answer, got.Truncated, "日本の…", "東京")
+	}
+	if got.QuestionHTML != "" || got.AnswerHTML == "" {
+		t.Errorf("HTML = %q / %q, want only the cut side's dropped", got.QuestionHTML, got.AnswerHTML)
+	}
+
+	// The detail endpoint always has the full text.
+	w = s.do(http.MethodGet, "/api/tasks/"+created.ID+"?preview=3", "")
+	expect(t, w, http.StatusOK)
+	var full taskResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &full); err != nil {
+		t.Fatal(err)
+	}
+	if full.Question != "日本の首都は？" || full.Truncated {
+		t.Errorf("detail = %q truncated %v, want the full question", full.Question, full.Truncated)
+	}
+
+	expect(t, s.do(http.MethodGet, "/api/tasks?preview=0", ""), http.StatusBadRequest)
+}
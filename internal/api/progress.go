@@ -0,0 +1,59 @@
+package api
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type progressResponse struct {
+	Date      string  `json:"date"`
+	Completed int     `json:"completed"`
+	Target    int     `json:"target"`
+	Percent   float64 `json:"percent"`
+	Remaining int     `json:"remaining"`
+}
+
+// progress reports today's review count against the daily target, plus how
+// many cards are still due right now.
+func (a *API) progress(c *gin.Context) {
+	target := a.cfg.DailyTarget
+	if raw := c.Query("target"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n <= 0 {
+			writeError(c, http.StatusBadRequest, "target must be a positive integer")
+			return
+		}
+		target = n
+	}
+
+	now := a.now()
+	start := a.startOfDay(now)
+	completed, err := a.storeFor(c).CountReviews(start, start.AddDate(0, 0, 1))
+	if err != nil {
+		a.internalError(c, err)
+		return
+	}
+	due, err := a.storeFor(c).CountDue(now)
+	if err != nil {
+		a.internalError(c, err)
+		return
+	}
+
+	renderJSON(c, http.StatusOK, progressResponse{
+		Date:      start.Format(time.DateOnly),
+		Completed: completed,
+		Target:    target,
+		Percent:   math.Round(float64(completed)/float64(target)*1000) / 10,
+		Remaining: due,
+	})
+}
+
+// startOfDay returns midnight of t's calendar day in the configured location.
+func (a *API) startOfDay(t time.Time) time.Time {
+	t = t.In(a.cfg.Location)
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, a.cfg.Location)
+}
@@ -0,0 +1,17 @@
+package api
+
+import (
+	"yiwang/internal/events"
+	"yiwang/internal/tasks"
+)
+
+// publish announces a change to t once the store has committed it.
+func (a *API) publish(kind events.Kind, t *tasks.Task, result string) {
+	a.events.Publish(events.Event{Kind: kind, TaskID: t.ID, Task: t, Result: result, At: a.now()})
+}
+
+func (a *API) publishAll(kind events.Kind, ts []*tasks.Task) {
+	for _, t := range ts {
+		a.publish(kind, t, "")
+	}
+}
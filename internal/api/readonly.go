@@ -0,0 +1,60 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// safeWrites are POST routes, relative to the Register group, that don't
+// change any data and so stay available in read-only mode.
+var safeWrites = []string{
+	"/tasks/:id/check",
+	"/tasks/batch-get",
+	"/normalize-preview",
+	"/admin/read-only",
+	"/auth/login",
+	"/auth/logout",
+}
+
+// ReadOnly reports whether writes are currently rejected.
+func (a *API) ReadOnly() bool {
+	return a.readOnly.Load()
+}
+
+// SetReadOnly turns read-only mode on or off.
+func (a *API) SetReadOnly(on bool) {
+	a.readOnly.Store(on)
+}
+
+// rejectWrites answers 503 to every mutating request while read-only mode
+// is on. It runs after routing, so routes are matched by their pattern.
+func (a *API) rejectWrites(safe map[string]bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !a.ReadOnly() || safe[c.FullPath()] {
+			return
+		}
+		switch c.Request.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			return
+		}
+		writeError(c, http.StatusServiceUnavailable, "server is in read-only mode; writes are disabled")
+		c.Abort()
+	}
+}
+
+type readOnlyRequest struct {
+	ReadOnly *bool `json:"readOnly"`
+}
+
+// setReadOnly is the admin toggle for read-only mode, for use around
+// backups and migrations.
+func (a *API) setReadOnly(c *gin.Context) {
+	var req readOnlyRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.ReadOnly == nil {
+		writeError(c, http.StatusBadRequest, "body must be {\"readOnly\": true|false}")
+		return
+	}
+	a.SetReadOnly(*req.ReadOnly)
+	renderJSON(c, http.StatusOK, gin.H{"readOnly": a.ReadOnly()})
+}
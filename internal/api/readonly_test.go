@@ -0,0 +1,55 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"yiwang/internal/store"
+)
+
+func TestReadOnlyMode(t *testing.T) {
+	s := newTestServer(t, Config{Admin: true}, store.Options{})
+	auth := s.adminAuth(t)
+	task := s.createTask(t, `{"question":"q","answer":"a","firstReviewIn":"0s"}`)
+	expect(t, s.do(http.MethodPut, "/api/admin/read-only", `{"readOnly":true}`, auth...), http.StatusOK)
+
+	for _, tc := range []struct{ method, path, body string }{
+		{http.MethodGet, "/api/tasks", ""},
+		{http.MethodGet, "/api/tasks/" + task.ID, ""},
+		{http.MethodGet, "/api/tasks/ready", ""},
+		{http.MethodGet, "/api/stats/overview", ""},
+		{http.MethodGet, "/api/healthz", ""},
+		// POSTs that change nothing stay open.
+		{http.MethodPost, "/api/tasks/" + task.ID + "/check", `{"answer":"a"}`},
+		{http.MethodPost, "/api/tasks/batch-get", `{"ids":["` + task.ID + `"]}`},
+	} {
+		if w := s.do(tc.method, tc.path, tc.body, auth...); w.Code != http.StatusOK {
+			t.Errorf("%s %s = %d in read-only mode, want 200; body: %s", tc.method, tc.path, w.Code, w.Body)
+		}
+	}
+
+	for _, tc := range []struct{ method, path, body string }{
+		{http.MethodPost, "/api/tasks", `{"question":"q2","answer":"a"}`},
+		{http.MethodPut, "/api/tasks/" + task.ID, `{"question":"changed","answer":"a"}`},
+		{http.MethodPatch, "/api/tasks/" + task.ID, `{"question":"changed"}`},
+		{http.MethodPost, "/api/tasks/" + task.ID + "/review", `{"result":"remembered"}`},
+		{http.MethodPost, "/api/tasks/" + task.ID + "/archive", ""},
+		{http.MethodDelete, "/api/tasks/" + task.ID, ""},
+		{http.MethodPost, "/api/keys", `{"name":"another"}`},
+	} {
+		w := s.do(tc.method, tc.path, tc.body, auth...)
+		if w.Code != http.StatusServiceUnavailable || !strings.Contains(w.Body.String(), "read-only mode") {
+			t.Errorf("%s %s = %d %s in read-only mode, want 503", tc.method, tc.path, w.Code, w.Body)
+		}
+	}
+	w := s.do(http.MethodGet, "/api/tasks/"+task.ID, "")
+	expect(t, w, http.StatusOK)
+	if !strings.Contains(w.Body.String(), `"question":"q"`) || !strings.Contains(w.Body.String(), `"stage":0`) {
+		t.Errorf("task changed in read-only mode: %s", w.Body)
+	}
+
+	// Turning it off lets writes through again.
+	expect(t, s.do(http.MethodPut, "/api/admin/read-only", `{"readOnly":false}`, auth...), http.StatusOK)
+	expect(t, s.do(http.MethodPost, "/api/tasks/"+task.ID+"/review", `{"result":"remembered"}`, auth...), http.StatusOK)
+}
@@ -0,0 +1,64 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"yiwang/internal/events"
+	"yiwang/internal/store"
+	"yiwang/internal/tasks"
+)
+
+// reclassifyLast fixes a misclicked review: the task's latest review is
+// given the corrected result and the schedule is recomputed from the time
+// of that review. 409 when the latest history entry isn't a review.
+func (a *API) reclassifyLast(c *gin.Context) {
+	var req reviewRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		writeError(c, http.StatusBadRequest, "invalid json")
+		return
+	}
+	outcome, err := tasks.ParseResult(req.Result)
+	if err != nil {
+		writeError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	t, err := a.storeFor(c).ReclassifyLast(c.Param("id"), outcome, a.now())
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			writeError(c, http.StatusNotFound, err.Error())
+		case errors.Is(err, store.ErrNoReview), errors.Is(err, tasks.ErrArchived), errors.Is(err, tasks.ErrSuspended),
+			errors.Is(err, tasks.ErrNotDue):
+			writeError(c, http.StatusConflict, err.Error())
+		default:
+			a.internalError(c, err)
+		}
+		return
+	}
+	a.publish(events.TaskUpdated, t, "")
+	renderJSON(c, http.StatusOK, mapTask(t, a.now()))
+}
+
+// undoReview takes back the task's latest review, restoring the schedule
+// it had before, e.g. after an accidental "forgot". 409 when the latest
+// history entry isn't a review.
+func (a *API) undoReview(c *gin.Context) {
+	t, err := a.storeFor(c).UndoLastReview(c.Param("id"), a.now())
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			writeError(c, http.StatusNotFound, err.Error())
+		case errors.Is(err, store.ErrNoReview), errors.Is(err, tasks.ErrArchived), errors.Is(err, tasks.ErrSuspended):
+			writeError(c, http.StatusConflict, err.Error())
+		default:
+			a.internalError(c, err)
+		}
+		return
+	}
+	a.publish(events.TaskUpdated, t, "")
+	renderJSON(c, http.StatusOK, mapTask(t, a.now()))
+}
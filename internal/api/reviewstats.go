@@ -0,0 +1,87 @@
+package api
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"yiwang/internal/store"
+)
+
+const maxReviewStatsDays = 365
+
+type reviewStatsDay struct {
+	Date       string `json:"date"`
+	Reviews    int    `json:"reviews"`
+	Remembered int    `json:"remembered"`
+	Forgot     int    `json:"forgot"`
+	// Retention is the share of reviews remembered, or null on days
+	// without reviews.
+	Retention *float64 `json:"retention"`
+}
+
+type reviewStatsResponse struct {
+	Days       []reviewStatsDay `json:"days"`
+	Reviews    int              `json:"reviews"`
+	Remembered int              `json:"remembered"`
+	Forgot     int              `json:"forgot"`
+	Retention  *float64         `json:"retention"`
+}
+
+// reviewStats reports reviews per local day over the last ?days days
+// (default 30, including today), split by result, with the share
+// remembered as a retention rate.
+func (a *API) reviewStats(c *gin.Context) {
+	days := 30
+	if raw := c.Query("days"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n <= 0 || n > maxReviewStatsDays {
+			writeError(c, http.StatusBadRequest, "days must be between 1 and 365")
+			return
+		}
+		days = n
+	}
+
+	end := a.startOfDay(a.now()).AddDate(0, 0, 1)
+	start := end.AddDate(0, 0, -days)
+
+	remembered, err := a.storeFor(c).ResultTimes(store.ResultRemembered, start, end)
+	if err != nil {
+		a.internalError(c, err)
+		return
+	}
+	forgot, err := a.storeFor(c).ResultTimes(store.ResultForgot, start, end)
+	if err != nil {
+		a.internalError(c, err)
+		return
+	}
+
+	rem := a.countByDay(remembered)
+	fgt := a.countByDay(forgot)
+	resp := reviewStatsResponse{Days: make([]reviewStatsDay, 0, days)}
+	for d := start; d.Before(end); d = d.AddDate(0, 0, 1) {
+		key := d.Format(time.DateOnly)
+		day := reviewStatsDay{Date: key, Remembered: rem[key], Forgot: fgt[key]}
+		day.Reviews = day.Remembered + day.Forgot
+		day.Retention = retention(day.Remembered, day.Reviews)
+		resp.Days = append(resp.Days, day)
+		resp.Remembered += day.Remembered
+		resp.Forgot += day.Forgot
+	}
+	resp.Reviews = resp.Remembered + resp.Forgot
+	resp.Retention = retention(resp.Remembered, resp.Reviews)
+	renderJSON(c, http.StatusOK, resp)
+}
+
+// retention is remembered out of total to three decimals, or nil when
+// total is 0.
+func retention(remembered, total int) *float64 {
+	if total == 0 {
+		return nil
+	}
+	r := math.Round(float64(remembered)/float64(total)*1000) / 1000
+	return &r
+}
@@ -0,0 +1,140 @@
+package api
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"yiwang/internal/events"
+	"yiwang/internal/store"
+	"yiwang/internal/tasks"
+)
+
+const maxBulkReviews = 500
+
+type bulkReviewItem struct {
+	ID     string `json:"id"`
+	Result string `json:"result"`
+	// ReviewedAt is when the card was reviewed on the client; zero means
+	// now. The schedule and the history entry are computed from it.
+	ReviewedAt time.Time `json:"reviewedAt"`
+	Token      string    `json:"token"`
+}
+
+type bulkReviewResult struct {
+	ID       string        `json:"id"`
+	Status   int           `json:"status"`
+	Replayed bool          `json:"replayed,omitempty"`
+	Task     *taskResponse `json:"task,omitempty"`
+	Error    string        `json:"error,omitempty"`
+}
+
+type bulkReviewResponse struct {
+	Applied int                `json:"applied"`
+	Failed  int                `json:"failed"`
+	Results []bulkReviewResult `json:"results"`
+}
+
+// bulkReview applies a batch of reviews recorded offline, such as a study
+// session on a phone without signal. Each review is applied in its own
+// transaction as of its reviewedAt, oldest first, so a card reviewed twice
+// in the session is scheduled as it would have been online. One failing
+// review doesn't stop the others: results come back in request order with
+// the status the single-review endpoint would have answered. Tokens make
+// resending the whole batch after a lost response safe.
+func (a *API) bulkReview(c *gin.Context) {
+	var items []bulkReviewItem
+	if err := c.ShouldBindJSON(&items); err != nil {
+		writeError(c, http.StatusBadRequest, "invalid json")
+		return
+	}
+	if len(items) == 0 {
+		writeError(c, http.StatusBadRequest, "no reviews")
+		return
+	}
+	if len(items) > maxBulkReviews {
+		writeError(c, http.StatusRequestEntityTooLarge, "at most 500 reviews per request")
+		return
+	}
+
+	now := a.now()
+	order := make([]int, len(items))
+	for i := range items {
+		if items[i].ReviewedAt.IsZero() {
+			items[i].ReviewedAt = now
+		}
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return items[order[i]].ReviewedAt.Before(items[order[j]].ReviewedAt)
+	})
+
+	st := a.storeFor(c)
+	resp := bulkReviewResponse{Results: make([]bulkReviewResult, len(items))}
+	for _, i := range order {
+		item := items[i]
+		r := a.applyBulkReview(c, st, item, now)
+		r.ID = item.ID
+		if r.Status == http.StatusOK {
+			resp.Applied++
+		} else {
+			resp.Failed++
+		}
+		resp.Results[i] = r
+	}
+	renderJSON(c, http.StatusOK, resp)
+}
+
+func (a *API) applyBulkReview(c *gin.Context, st *store.Store, item bulkReviewItem, now time.Time) bulkReviewResult {
+	if strings.TrimSpace(item.ID) == "" {
+		return bulkReviewResult{Status: http.StatusBadRequest, Error: "id is required"}
+	}
+	outcome, err := tasks.ParseResult(item.Result)
+	if err != nil {
+		return bulkReviewResult{Status: http.StatusBadRequest, Error: err.Error()}
+	}
+	if item.ReviewedAt.After(now) {
+		return bulkReviewResult{Status: http.StatusBadRequest, Error: "reviewedAt is in the future"}
+	}
+	token := strings.TrimSpace(item.Token)
+	if len(token) > maxReviewToken {
+		return bulkReviewResult{Status: http.StatusBadRequest, Error: "token must be at most 64 bytes"}
+	}
+
+	res, err := st.Review(item.ID, outcome, token, item.ReviewedAt)
+	if err != nil {
+		status := reviewErrorStatus(err)
+		if status == http.StatusInternalServerError {
+			slog.ErrorContext(c.Request.Context(), "bulk review", "id", item.ID, "err", err)
+			msg := "internal server error"
+			if a.cfg.ExposeErrors {
+				msg = err.Error()
+			}
+			return bulkReviewResult{Status: status, Error: msg}
+		}
+		return bulkReviewResult{Status: status, Error: err.Error()}
+	}
+	if !res.Replayed {
+		a.publish(events.TaskReviewed, res.Task, string(outcome))
+	}
+	t := mapTask(res.Task, now)
+	return bulkReviewResult{Status: http.StatusOK, Replayed: res.Replayed, Task: &t}
+}
+
+// reviewErrorStatus is the status a failed review is answered with.
+func reviewErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, tasks.ErrArchived), errors.Is(err, tasks.ErrSuspended),
+		errors.Is(err, tasks.ErrNotDue), errors.Is(err, store.ErrTokenReused):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
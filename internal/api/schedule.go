@@ -0,0 +1,49 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"yiwang/internal/events"
+	"yiwang/internal/store"
+	"yiwang/internal/tasks"
+)
+
+type scheduleRequest struct {
+	At     time.Time `json:"at"`
+	Revive bool      `json:"revive"`
+}
+
+// scheduleTask sets a task's next review to an explicit time, keeping its
+// stage. Past times are rejected unless AllowPastSchedule is on, in which
+// case the task simply becomes ready.
+func (a *API) scheduleTask(c *gin.Context) {
+	var req scheduleRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.At.IsZero() {
+		writeError(c, http.StatusBadRequest, "at must be an RFC 3339 time")
+		return
+	}
+	now := a.now()
+	if req.At.Before(now) && !a.cfg.AllowPastSchedule {
+		writeError(c, http.StatusBadRequest, "at must not be in the past")
+		return
+	}
+
+	t, err := a.storeFor(c).ScheduleAt(c.Param("id"), req.At, req.Revive, now)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			writeError(c, http.StatusNotFound, err.Error())
+		case errors.Is(err, tasks.ErrCompleted), errors.Is(err, tasks.ErrArchived), errors.Is(err, tasks.ErrSuspended):
+			writeError(c, http.StatusConflict, err.Error())
+		default:
+			a.internalError(c, err)
+		}
+		return
+	}
+	a.publish(events.TaskUpdated, t, "")
+	renderJSON(c, http.StatusOK, mapTask(t, now))
+}
@@ -0,0 +1,52 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultSearchResults = 20
+	maxSearchResults     = 100
+	maxSearchQuery       = 200
+)
+
+// searchTasks serves GET /tasks/search?q=: tasks whose question or answer
+// matches q, best match first, at most ?limit of them (default 20, at
+// most 100). Archived tasks are included.
+func (a *API) searchTasks(c *gin.Context) {
+	q := strings.TrimSpace(c.Query("q"))
+	if q == "" {
+		writeError(c, http.StatusBadRequest, "q is required")
+		return
+	}
+	if utf8.RuneCountInString(q) > maxSearchQuery {
+		writeError(c, http.StatusBadRequest, "q must be at most 200 characters")
+		return
+	}
+	limit, ok := intParam(c, "limit", defaultSearchResults, 1, maxSearchResults)
+	if !ok {
+		return
+	}
+	preview, ok := previewParam(c)
+	if !ok {
+		return
+	}
+
+	ts, err := a.storeFor(c).Search(q, limit)
+	if err != nil {
+		a.internalError(c, err)
+		return
+	}
+	now := a.now()
+	out := make([]taskResponse, 0, len(ts))
+	for _, t := range ts {
+		tr := mapTask(t, now)
+		tr.truncate(preview)
+		out = append(out, tr)
+	}
+	renderJSON(c, http.StatusOK, out)
+}
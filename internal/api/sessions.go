@@ -0,0 +1,141 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"yiwang/internal/store"
+	"yiwang/internal/tasks"
+)
+
+type sessionRequest struct {
+	// MaxReviews and MaxNew default to tasks.DefaultSessionReviews and
+	// tasks.DefaultSessionNew; 0 leaves that kind of card out.
+	MaxReviews *int   `json:"maxReviews"`
+	MaxNew     *int   `json:"maxNew"`
+	Tag        string `json:"tag"`
+	Deck       string `json:"deck"`
+}
+
+type sessionResponse struct {
+	ID         string `json:"id"`
+	MaxReviews int    `json:"maxReviews"`
+	MaxNew     int    `json:"maxNew"`
+	// Cards counts the cards picked when the session began, NewCards
+	// those of them never reviewed before.
+	Cards      int        `json:"cards"`
+	NewCards   int        `json:"newCards"`
+	Answered   int        `json:"answered"`
+	Remembered int        `json:"remembered"`
+	Forgot     int        `json:"forgot"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	FinishedAt *time.Time `json:"finishedAt,omitempty"`
+}
+
+func mapSession(s *tasks.Session) sessionResponse {
+	return sessionResponse{
+		ID:         s.ID,
+		MaxReviews: s.MaxReviews,
+		MaxNew:     s.MaxNew,
+		Cards:      len(s.TaskIDs),
+		NewCards:   s.NewCards,
+		Answered:   s.Answered,
+		Remembered: s.Remembered,
+		Forgot:     s.Forgot,
+		CreatedAt:  s.CreatedAt,
+		FinishedAt: s.FinishedAt,
+	}
+}
+
+type nextCardResponse struct {
+	Session sessionResponse `json:"session"`
+	// Task is the card to review next, or absent once the session is
+	// finished.
+	Task *taskResponse `json:"task,omitempty"`
+}
+
+// createSession picks a bounded set of ready cards to study, optionally
+// from one tag or deck: due reviews first, then new cards. The limits are
+// cut to what the daily limits have left, and 409 says nothing is. Cards
+// are answered through the usual POST /tasks/:id/review.
+func (a *API) createSession(c *gin.Context) {
+	var req sessionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		writeError(c, http.StatusBadRequest, "invalid json")
+		return
+	}
+	maxReviews, maxNew := tasks.DefaultSessionReviews, tasks.DefaultSessionNew
+	if req.MaxReviews != nil {
+		maxReviews = *req.MaxReviews
+	}
+	if req.MaxNew != nil {
+		maxNew = *req.MaxNew
+	}
+	// Out-of-range limits are left for CreateSession to reject.
+	if maxReviews >= 0 && maxNew >= 0 {
+		left, err := a.dailyAllowance(c, a.now())
+		if err != nil {
+			a.internalError(c, err)
+			return
+		}
+		wanted := maxReviews > 0 || maxNew > 0
+		maxReviews, maxNew = min(maxReviews, left.reviews), min(maxNew, left.fresh)
+		if wanted && maxReviews == 0 && maxNew == 0 {
+			writeError(c, http.StatusConflict, errDailyLimit.Error())
+			return
+		}
+	}
+	f := store.Filter{
+		Tag:  strings.ToLower(strings.TrimSpace(req.Tag)),
+		Deck: strings.TrimSpace(req.Deck),
+	}
+
+	s, err := a.storeFor(c).CreateSession(f, maxReviews, maxNew, a.now())
+	if err != nil {
+		a.sessionError(c, err)
+		return
+	}
+	renderJSON(c, http.StatusCreated, mapSession(s))
+}
+
+func (a *API) getSession(c *gin.Context) {
+	s, err := a.storeFor(c).Session(c.Param("id"))
+	if err != nil {
+		a.sessionError(c, err)
+		return
+	}
+	renderJSON(c, http.StatusOK, mapSession(s))
+}
+
+// nextSessionCard serves the session's next unanswered card. Once every
+// card is answered or has left the queue the session is finished, and the
+// response carries its final stats without a task.
+func (a *API) nextSessionCard(c *gin.Context) {
+	now := a.now()
+	t, s, err := a.storeFor(c).NextInSession(c.Param("id"), now)
+	if err != nil {
+		a.sessionError(c, err)
+		return
+	}
+	resp := nextCardResponse{Session: mapSession(s)}
+	if t != nil {
+		tr := mapTask(t, now)
+		resp.Task = &tr
+	}
+	renderJSON(c, http.StatusOK, resp)
+}
+
+func (a *API) sessionError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, store.ErrSessionNotFound):
+		writeError(c, http.StatusNotFound, err.Error())
+	case tasks.IsValidation(err):
+		writeError(c, http.StatusBadRequest, err.Error())
+	default:
+		a.internalError(c, err)
+	}
+}
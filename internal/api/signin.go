@@ -0,0 +1,89 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"yiwang/internal/session"
+	"yiwang/internal/store"
+)
+
+type loginRequest struct {
+	Key string `json:"key"`
+}
+
+type userResponse struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"createdAt"`
+	Role      string    `json:"role"`
+}
+
+func mapUser(u store.User) userResponse {
+	return userResponse{ID: u.ID, Name: u.Name, Email: u.Email, CreatedAt: u.CreatedAt, Role: u.Role}
+}
+
+type signInResponse struct {
+	SignedIn bool `json:"signedIn"`
+	// User is set for OAuth sign-ins, APIKey for API keys.
+	User   *userResponse `json:"user,omitempty"`
+	APIKey *keyResponse  `json:"apiKey,omitempty"`
+}
+
+// currentSession reports who the request is signed in as, whether by
+// session cookie or API key, so the web UI knows whether to offer sign-in.
+func (a *API) currentSession(c *gin.Context) {
+	var resp signInResponse
+	if u, ok := c.Get(userKey); ok {
+		m := mapUser(u.(store.User))
+		resp.SignedIn, resp.User = true, &m
+	} else if k, ok := c.Get(apiKeyKey); ok {
+		m := mapKey(k.(store.APIKey))
+		resp.SignedIn, resp.APIKey = true, &m
+	}
+	renderJSON(c, http.StatusOK, resp)
+}
+
+// login starts a web UI session for an API key, for servers without OAuth
+// sign-in: the key is entered once and the browser keeps only the cookie.
+func (a *API) login(c *gin.Context) {
+	if a.cfg.Sessions == nil {
+		writeError(c, http.StatusNotFound, "sessions are disabled")
+		return
+	}
+	var req loginRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.Key == "" {
+		writeError(c, http.StatusBadRequest, "body must be {\"key\": \"<api key>\"}")
+		return
+	}
+	k, err := a.storeFor(c).AuthenticateAPIKey(req.Key, a.now())
+	if errors.Is(err, store.ErrAPIKeyNotFound) {
+		writeError(c, http.StatusUnauthorized, "invalid api key")
+		return
+	}
+	if err != nil {
+		a.internalError(c, err)
+		return
+	}
+	if err := a.cfg.Sessions.Start(c.Request.Context(), c.Writer, session.Session{APIKeyID: k.ID}); err != nil {
+		a.internalError(c, err)
+		return
+	}
+	m := mapKey(k)
+	renderJSON(c, http.StatusOK, signInResponse{SignedIn: true, APIKey: &m})
+}
+
+// logout ends the request's session. It succeeds without one too.
+func (a *API) logout(c *gin.Context) {
+	if a.cfg.Sessions != nil {
+		if err := a.cfg.Sessions.End(c.Writer, c.Request); err != nil {
+			a.internalError(c, err)
+			return
+		}
+	}
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,146 @@
+package api
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"yiwang/internal/store"
+	"yiwang/internal/tasks"
+)
+
+type projectedReview struct {
+	Stage      int       `json:"stage"`
+	StageLabel string    `json:"stageLabel,omitempty"`
+	At         time.Time `json:"at"`
+}
+
+type simulationResponse struct {
+	TaskID      string            `json:"taskId"`
+	Status      string            `json:"status"`
+	Stage       int               `json:"stage"`
+	TotalStages int               `json:"totalStages"`
+	Reviews     []projectedReview `json:"reviews"`
+	// CompletesAt is null for a finished task without a completion time.
+	CompletesAt *time.Time `json:"completesAt"`
+	// Days counts local calendar days from today to CompletesAt.
+	Days int `json:"days"`
+}
+
+// simulateTask projects the days to completion of one task if every
+// review from now on is remembered on time. It follows the task's own
+// schedule and difficulty and stores nothing.
+func (a *API) simulateTask(c *gin.Context) {
+	t, err := a.storeFor(c).Get(c.Param("id"))
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			writeError(c, http.StatusNotFound, err.Error())
+			return
+		}
+		a.internalError(c, err)
+		return
+	}
+	renderJSON(c, http.StatusOK, a.simulate(t, a.now()))
+}
+
+func (a *API) simulate(t *tasks.Task, now time.Time) simulationResponse {
+	reviews, completesAt := t.Simulate(now)
+	out := simulationResponse{
+		TaskID:      t.ID,
+		Status:      t.Status(now),
+		Stage:       t.Stage,
+		TotalStages: t.StageCount(),
+		Reviews:     make([]projectedReview, len(reviews)),
+		CompletesAt: completesAt,
+	}
+	for i, r := range reviews {
+		out.Reviews[i] = projectedReview{Stage: r.Stage, At: r.At}
+		if t.ScheduleSource() == "default" && t.Graduates() {
+			out.Reviews[i].StageLabel = tasks.StageLabel(r.Stage)
+		}
+	}
+	if completesAt != nil {
+		out.Days = a.daysBetween(now, *completesAt)
+	}
+	return out
+}
+
+// daysBetween counts local calendar days from the day of from to the day
+// of to, or 0 when to is not later.
+func (a *API) daysBetween(from, to time.Time) int {
+	d := a.startOfDay(to).Sub(a.startOfDay(from)).Hours() / 24
+	if d <= 0 {
+		return 0
+	}
+	// Round rather than truncate: a day across a DST change is 23 or 25
+	// hours long.
+	return int(math.Round(d))
+}
+
+type deckSimulationTask struct {
+	ID          string     `json:"id"`
+	Reviews     int        `json:"reviews"`
+	CompletesAt *time.Time `json:"completesAt"`
+}
+
+type deckSimulationResponse struct {
+	Tasks   int `json:"tasks"`
+	Reviews int `json:"reviews"`
+	// CompletesAt is when the last task would graduate; null when none
+	// is left to study.
+	CompletesAt *time.Time           `json:"completesAt"`
+	Days        int                  `json:"days"`
+	Items       []deckSimulationTask `json:"items"`
+}
+
+// simulateDeck runs simulateTask over every unfinished active task,
+// optionally only those with ?tag, and reports when the last one would
+// graduate. Items are ordered by projected completion. SM-2 and FSRS
+// tasks never graduate and are left out.
+func (a *API) simulateDeck(c *gin.Context) {
+	now := a.now()
+	tag := strings.ToLower(strings.TrimSpace(c.Query("tag")))
+	all, err := a.storeFor(c).All()
+	if err != nil {
+		a.internalError(c, err)
+		return
+	}
+
+	out := deckSimulationResponse{Items: []deckSimulationTask{}}
+	for _, t := range all {
+		if tag != "" && !hasTag(t, tag) {
+			continue
+		}
+		if t.Status(now) == "done" || !t.Graduates() {
+			continue
+		}
+		reviews, completesAt := t.Simulate(now)
+		out.Tasks++
+		out.Reviews += len(reviews)
+		out.Items = append(out.Items, deckSimulationTask{ID: t.ID, Reviews: len(reviews), CompletesAt: completesAt})
+		if completesAt != nil && (out.CompletesAt == nil || completesAt.After(*out.CompletesAt)) {
+			out.CompletesAt = completesAt
+		}
+	}
+	sort.Slice(out.Items, func(i, j int) bool {
+		return out.Items[i].CompletesAt.Before(*out.Items[j].CompletesAt)
+	})
+	if out.CompletesAt != nil {
+		out.Days = a.daysBetween(now, *out.CompletesAt)
+	}
+	renderJSON(c, http.StatusOK, out)
+}
+
+func hasTag(t *tasks.Task, tag string) bool {
+	for _, have := range t.Tags {
+		if have == tag {
+			return true
+		}
+	}
+	return false
+}
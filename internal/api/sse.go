@@ -0,0 +1,96 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"yiwang/internal/events"
+)
+
+const (
+	mimeEventStream = "text/event-stream"
+	// sseHeartbeat is how often an idle stream sends a comment, so proxies
+	// don't close it and a vanished client is noticed.
+	sseHeartbeat = 30 * time.Second
+)
+
+// taskEvent is the data of an event on /events.
+type taskEvent struct {
+	Kind   events.Kind   `json:"kind"`
+	TaskID string        `json:"taskId"`
+	Task   *taskResponse `json:"task,omitempty"`
+	Result string        `json:"result,omitempty"`
+	At     time.Time     `json:"at"`
+}
+
+// streamEvents sends every task lifecycle event as a server-sent event
+// named after its kind (task.created, task.updated, task.reviewed,
+// task.deleted) with the task as data, so open tabs can stay in sync. A
+// client that falls too far behind loses events rather than slowing the
+// server, and should reload when it reconnects. The stream ends when the
+// server starts shutting down.
+func (a *API) streamEvents(c *gin.Context) {
+	queue := make(chan events.Event, 64)
+	unsubscribe := a.events.Subscribe("sse "+c.GetString(requestIDKey), 64, func(e events.Event) {
+		select {
+		case queue <- e:
+		default:
+		}
+	})
+	defer unsubscribe()
+
+	extendWriteDeadline(c, 0)
+	h := c.Writer.Header()
+	h.Set("Content-Type", mimeEventStream)
+	h.Set("Cache-Control", "no-cache")
+	// Keeps nginx from buffering the stream.
+	h.Set("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	c.Writer.Flush()
+
+	snake := c.GetBool(snakeCaseKey)
+	heartbeat := time.NewTicker(sseHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case e := <-queue:
+			if err := a.writeEvent(c, e, snake); err != nil {
+				return
+			}
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(c.Writer, ": keepalive\n\n"); err != nil {
+				return
+			}
+			c.Writer.Flush()
+		case <-a.draining:
+			return
+		case <-c.Request.Context().Done():
+			return
+		}
+	}
+}
+
+func (a *API) writeEvent(c *gin.Context, e events.Event, snake bool) error {
+	ev := taskEvent{Kind: e.Kind, TaskID: e.TaskID, Result: e.Result, At: e.At}
+	if e.Task != nil {
+		tr := mapTask(e.Task, a.now())
+		ev.Task = &tr
+	}
+	var v interface{} = ev
+	if snake {
+		v = snakeKeys(ev)
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(c.Writer, "event: %s\ndata: %s\n\n", e.Kind, data); err != nil {
+		return err
+	}
+	c.Writer.Flush()
+	return nil
+}
@@ -0,0 +1,65 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultStatusPage = 500
+	maxStatusPage     = 1000
+)
+
+type taskStatus struct {
+	ID           string     `json:"id"`
+	Status       string     `json:"status"`
+	NextReviewAt *time.Time `json:"nextReviewAt,omitempty"`
+}
+
+type statusesResponse struct {
+	Items []taskStatus `json:"items"`
+	// Next is the cursor for the following page, passed back as ?after;
+	// it is omitted on the last page.
+	Next string `json:"next,omitempty"`
+}
+
+// taskStatuses lists just the ID, status and next review of active tasks,
+// for overview widgets that don't need the cards themselves. Pages hold
+// ?limit tasks (default 500, at most 1000) in ID order, continuing after
+// the ID in ?after.
+func (a *API) taskStatuses(c *gin.Context) {
+	limit := defaultStatusPage
+	if raw := c.Query("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n <= 0 || n > maxStatusPage {
+			writeError(c, http.StatusBadRequest, "limit must be between 1 and "+strconv.Itoa(maxStatusPage))
+			return
+		}
+		limit = n
+	}
+
+	// One extra row tells whether another page follows.
+	ts, err := a.storeFor(c).Statuses(c.Query("after"), limit+1)
+	if err != nil {
+		a.internalError(c, err)
+		return
+	}
+	resp := statusesResponse{Items: make([]taskStatus, 0, min(len(ts), limit))}
+	if len(ts) > limit {
+		ts = ts[:limit]
+		resp.Next = ts[limit-1].ID
+	}
+	now := a.now()
+	for _, t := range ts {
+		s := taskStatus{ID: t.ID, Status: t.Status(now)}
+		if !t.NextReviewAt.IsZero() {
+			next := t.NextReviewAt
+			s.NextReviewAt = &next
+		}
+		resp.Items = append(resp.Items, s)
+	}
+	renderJSON(c, http.StatusOK, resp)
+}
@@ -0,0 +1,99 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type streakResponse struct {
+	Goal    int           `json:"goal"`
+	Current int           `json:"current"`
+	Longest int           `json:"longest"`
+	Today   todayProgress `json:"today"`
+}
+
+type todayProgress struct {
+	Date    string `json:"date"`
+	Reviews int    `json:"reviews"`
+	Met     bool   `json:"met"`
+}
+
+// streak reports how many consecutive local days, in cfg.Location, have
+// had at least goal reviews (?goal, default the daily target). A day
+// whose count falls short is missed and ends the streak. Today only
+// counts once its goal is met, but until midnight it doesn't break the
+// streak either: the current streak then runs up to yesterday.
+func (a *API) streak(c *gin.Context) {
+	a.renderStreak(c, a.cfg.DailyTarget)
+}
+
+// studyStreak is streak for GET /stats/streak, where any day with a review
+// counts unless ?goal asks for more.
+func (a *API) studyStreak(c *gin.Context) {
+	a.renderStreak(c, 1)
+}
+
+func (a *API) renderStreak(c *gin.Context, goal int) {
+	if raw := c.Query("goal"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n <= 0 {
+			writeError(c, http.StatusBadRequest, "goal must be a positive integer")
+			return
+		}
+		goal = n
+	}
+
+	today := a.startOfDay(a.now())
+	times, err := a.storeFor(c).ReviewTimes(time.Unix(0, 0), today.AddDate(0, 0, 1))
+	if err != nil {
+		a.internalError(c, err)
+		return
+	}
+	counts := a.countByDay(times)
+	current, longest := a.streaks(counts, goal, times, today)
+
+	n := counts[today.Format(time.DateOnly)]
+	renderJSON(c, http.StatusOK, streakResponse{
+		Goal:    goal,
+		Current: current,
+		Longest: longest,
+		Today: todayProgress{
+			Date:    today.Format(time.DateOnly),
+			Reviews: n,
+			Met:     n >= goal,
+		},
+	})
+}
+
+// streaks walks every local day from the first review through today and
+// returns the run of met days ending today (or yesterday, while today is
+// still short of goal) and the longest run overall.
+func (a *API) streaks(counts map[string]int, goal int, times []time.Time, today time.Time) (current, longest int) {
+	if len(times) == 0 {
+		return 0, 0
+	}
+	first := times[0]
+	for _, t := range times[1:] {
+		if t.Before(first) {
+			first = t
+		}
+	}
+
+	run := 0
+	for d := a.startOfDay(first); !d.After(today); d = d.AddDate(0, 0, 1) {
+		if counts[d.Format(time.DateOnly)] >= goal {
+			run++
+			longest = max(longest, run)
+			continue
+		}
+		if d.Equal(today) {
+			// Today isn't over, so falling short so far isn't a miss.
+			break
+		}
+		run = 0
+	}
+	return run, longest
+}
@@ -0,0 +1,80 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"yiwang/internal/store"
+)
+
+func TestStreakBreaks(t *testing.T) {
+	shanghai := time.FixedZone("UTC+8", 8*60*60)
+	a := &API{cfg: Config{Location: shanghai}}
+	// today is local midnight of testNow's day in Shanghai, 2024-03-01.
+	today := a.startOfDay(testNow)
+	// day returns n reviews at local noon, offset days from today.
+	day := func(offset, n int) []time.Time {
+		var out []time.Time
+		for i := 0; i < n; i++ {
+			out = append(out, today.AddDate(0, 0, offset).Add(12*time.Hour+time.Duration(i)*time.Minute))
+		}
+		return out
+	}
+	join := func(days ...[]time.Time) []time.Time {
+		var out []time.Time
+		for _, d := range days {
+			out = append(out, d...)
+		}
+		return out
+	}
+
+	for _, tc := range []struct {
+		name             string
+		times            []time.Time
+		current, longest int
+	}{
+		{"no reviews", nil, 0, 0},
+		{"met through today", join(day(-2, 2), day(-1, 2), day(0, 2)), 3, 3},
+		// Today isn't over, so being short of goal yet keeps the streak
+		// that ran through yesterday.
+		{"today short", join(day(-2, 2), day(-1, 2), day(0, 1)), 2, 2},
+		{"missed yesterday", join(day(-3, 2), day(-2, 2), day(0, 1)), 0, 2},
+		{"missed yesterday, met today", join(day(-3, 2), day(-2, 2), day(0, 2)), 1, 2},
+		// A day with reviews but fewer than goal is missed all the same.
+		{"short day breaks", join(day(-5, 2), day(-4, 2), day(-3, 2), day(-2, 1), day(-1, 2), day(0, 2)), 2, 3},
+		{"day without reviews breaks", join(day(-4, 3), day(-3, 3), day(-1, 2)), 1, 2},
+		// 23:30 UTC on Feb 29 is already March 1 in Shanghai.
+		{"local day boundary", join(day(-1, 2), []time.Time{
+			time.Date(2024, 2, 29, 23, 30, 0, 0, time.UTC),
+			time.Date(2024, 2, 29, 23, 45, 0, 0, time.UTC),
+		}), 2, 2},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			current, longest := a.streaks(a.countByDay(tc.times), 2, tc.times, today)
+			if current != tc.current || longest != tc.longest {
+				t.Errorf("streaks = %d current, %d longest; want %d, %d", current, longest, tc.current, tc.longest)
+			}
+		})
+	}
+}
+
+func TestStreakProgress(t *testing.T) {
+	s := newTestServer(t, Config{DailyTarget: 2}, store.Options{})
+	task := s.createTask(t, `{"question":"q","answer":"a","firstReviewIn":"0s"}`)
+	expect(t, s.do(http.MethodPost, "/api/tasks/"+task.ID+"/review", `{"result":"remembered"}`), http.StatusOK)
+
+	w := s.do(http.MethodGet, "/api/streak", "")
+	expect(t, w, http.StatusOK)
+	want := `{"goal":2,"current":0,"longest":0,"today":{"date":"2024-03-01","reviews":1,"met":false}}`
+	if w.Body.String() != want {
+		t.Errorf("streak = %s, want %s", w.Body, want)
+	}
+	w = s.do(http.MethodGet, "/api/streak?goal=1", "")
+	expect(t, w, http.StatusOK)
+	want = `{"goal":1,"current":1,"longest":1,"today":{"date":"2024-03-01","reviews":1,"met":true}}`
+	if w.Body.String() != want {
+		t.Errorf("streak with goal 1 = %s, want %s", w.Body, want)
+	}
+	expect(t, s.do(http.MethodGet, "/api/streak?goal=0", ""), http.StatusBadRequest)
+}
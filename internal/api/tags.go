@@ -0,0 +1,51 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"yiwang/internal/tasks"
+)
+
+type tagResponse struct {
+	Tag string `json:"tag"`
+	// Tasks counts the active tasks carrying the tag.
+	Tasks int `json:"tasks"`
+}
+
+// listTags returns every tag on an active task with its usage count,
+// most used first.
+func (a *API) listTags(c *gin.Context) {
+	counts, err := a.storeFor(c).TagCounts()
+	if err != nil {
+		a.internalError(c, err)
+		return
+	}
+	out := make([]tagResponse, 0, len(counts))
+	for _, tc := range counts {
+		out = append(out, tagResponse{Tag: tc.Tag, Tasks: tc.Tasks})
+	}
+	renderJSON(c, http.StatusOK, out)
+}
+
+// listScope narrows a task list to one tag and one deck; empty fields
+// match everything. leech keeps only tasks tagged as leeches.
+type listScope struct {
+	tag   string
+	deck  string
+	leech bool
+}
+
+// scopeParams reads ?tag, compared like stored tags, and ?deck.
+func scopeParams(c *gin.Context) listScope {
+	return listScope{
+		tag:  strings.ToLower(strings.TrimSpace(c.Query("tag"))),
+		deck: strings.TrimSpace(c.Query("deck")),
+	}
+}
+
+func (s listScope) match(t *tasks.Task) bool {
+	return (s.tag == "" || hasTag(t, s.tag)) && (s.deck == "" || t.DeckID == s.deck) && (!s.leech || hasTag(t, tasks.LeechTag))
+}
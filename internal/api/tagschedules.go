@@ -0,0 +1,82 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"yiwang/internal/store"
+	"yiwang/internal/tasks"
+)
+
+type tagScheduleRequest struct {
+	Schedule []string `json:"schedule"`
+}
+
+type tagScheduleResponse struct {
+	Tag       string    `json:"tag"`
+	Schedule  []string  `json:"schedule"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+func mapTagSchedule(ts store.TagSchedule) tagScheduleResponse {
+	return tagScheduleResponse{Tag: ts.Tag, Schedule: ts.Schedule.Strings(), UpdatedAt: ts.UpdatedAt}
+}
+
+// listTagSchedules returns every tag schedule. A task follows its own
+// schedule if it has one, else the schedule of its alphabetically first
+// tag that has one, else the default.
+func (a *API) listTagSchedules(c *gin.Context) {
+	all, err := a.storeFor(c).TagSchedules()
+	if err != nil {
+		a.internalError(c, err)
+		return
+	}
+	out := make([]tagScheduleResponse, 0, len(all))
+	for _, ts := range all {
+		out = append(out, mapTagSchedule(ts))
+	}
+	renderJSON(c, http.StatusOK, out)
+}
+
+// putTagSchedule sets the schedule of a tag. Tasks already waiting keep
+// their next review time and follow the new schedule after it.
+func (a *API) putTagSchedule(c *gin.Context) {
+	var req tagScheduleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		writeError(c, http.StatusBadRequest, "invalid json")
+		return
+	}
+	sched, err := tasks.ParseSchedule(req.Schedule)
+	if err != nil {
+		writeError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	ts, err := a.storeFor(c).SetTagSchedule(c.Param("tag"), sched, a.now())
+	if err != nil {
+		if tasks.IsValidation(err) {
+			writeError(c, http.StatusBadRequest, err.Error())
+			return
+		}
+		a.internalError(c, err)
+		return
+	}
+	renderJSON(c, http.StatusOK, mapTagSchedule(ts))
+}
+
+func (a *API) deleteTagSchedule(c *gin.Context) {
+	if err := a.storeFor(c).DeleteTagSchedule(c.Param("tag")); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNoTagSchedule):
+			writeError(c, http.StatusNotFound, err.Error())
+		case tasks.IsValidation(err):
+			writeError(c, http.StatusBadRequest, err.Error())
+		default:
+			a.internalError(c, err)
+		}
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,65 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"yiwang/internal/store"
+)
+
+type roleRequest struct {
+	Role string `json:"role"`
+}
+
+// listUsers returns everyone who has signed in, oldest first.
+func (a *API) listUsers(c *gin.Context) {
+	users, err := a.storeFor(c).Users()
+	if err != nil {
+		a.internalError(c, err)
+		return
+	}
+	out := make([]userResponse, 0, len(users))
+	for _, u := range users {
+		out = append(out, mapUser(u))
+	}
+	renderJSON(c, http.StatusOK, out)
+}
+
+// setUserRole makes a user an admin or a plain user. There is always at
+// least one admin user left.
+func (a *API) setUserRole(c *gin.Context) {
+	var req roleRequest
+	if err := c.ShouldBindJSON(&req); err != nil || !store.ValidRole(req.Role) {
+		writeError(c, http.StatusBadRequest, "body must be {\"role\": \"user\"|\"admin\"}")
+		return
+	}
+	u, err := a.storeFor(c).SetUserRole(c.Param("id"), req.Role)
+	if err != nil {
+		a.userError(c, err)
+		return
+	}
+	renderJSON(c, http.StatusOK, mapUser(u))
+}
+
+// deleteUser removes a user, signing them out. They can sign in again,
+// as a new user.
+func (a *API) deleteUser(c *gin.Context) {
+	if err := a.storeFor(c).DeleteUser(c.Param("id")); err != nil {
+		a.userError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func (a *API) userError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, store.ErrUserNotFound):
+		writeError(c, http.StatusNotFound, err.Error())
+	case errors.Is(err, store.ErrLastAdmin):
+		writeError(c, http.StatusConflict, err.Error())
+	default:
+		a.internalError(c, err)
+	}
+}
@@ -0,0 +1,168 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"yiwang/internal/events"
+	"yiwang/internal/store"
+)
+
+const (
+	maxWebhookURL     = 2048
+	maxWebhookSecret  = 128
+	defaultDeliveries = 50
+	maxDeliveries     = 200
+)
+
+type webhookRequest struct {
+	URL string `json:"url"`
+	// Secret signs the payloads; one is generated when it is empty.
+	Secret string `json:"secret"`
+	// Events are the kinds to send, e.g. task.created, task.reviewed and
+	// task.completed; empty sends every kind.
+	Events []string `json:"events"`
+}
+
+type webhookResponse struct {
+	ID        string        `json:"id"`
+	URL       string        `json:"url"`
+	Events    []events.Kind `json:"events"`
+	CreatedAt time.Time     `json:"createdAt"`
+	// Secret is only returned when the webhook is created.
+	Secret string `json:"secret,omitempty"`
+}
+
+func mapWebhook(w store.Webhook) webhookResponse {
+	kinds := w.Events
+	if kinds == nil {
+		kinds = []events.Kind{}
+	}
+	return webhookResponse{ID: w.ID, URL: w.URL, Events: kinds, CreatedAt: w.CreatedAt}
+}
+
+type deliveryResponse struct {
+	ID            int64       `json:"id"`
+	Event         events.Kind `json:"event"`
+	TaskID        string      `json:"taskId"`
+	CreatedAt     time.Time   `json:"createdAt"`
+	Attempts      int         `json:"attempts"`
+	NextAttemptAt *time.Time  `json:"nextAttemptAt"`
+	DeliveredAt   *time.Time  `json:"deliveredAt"`
+	StatusCode    int         `json:"statusCode,omitempty"`
+	LastError     string      `json:"lastError,omitempty"`
+}
+
+// createWebhook registers an endpoint for task events. Each payload is
+// signed with the webhook's secret, which is shown once, in the response.
+func (a *API) createWebhook(c *gin.Context) {
+	var req webhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		writeError(c, http.StatusBadRequest, "invalid json")
+		return
+	}
+	raw := strings.TrimSpace(req.URL)
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || len(raw) > maxWebhookURL {
+		writeError(c, http.StatusBadRequest, "url must be an http or https URL of at most 2048 bytes")
+		return
+	}
+	if len(req.Secret) > maxWebhookSecret {
+		writeError(c, http.StatusBadRequest, "secret must be at most 128 bytes")
+		return
+	}
+	var kinds []events.Kind
+	seen := make(map[events.Kind]bool)
+	for _, e := range req.Events {
+		k := events.Kind(strings.ToLower(strings.TrimSpace(e)))
+		if !k.Valid() {
+			writeError(c, http.StatusBadRequest, "events must be task.created, task.updated, task.reviewed, task.deleted, or task.completed")
+			return
+		}
+		if !seen[k] {
+			seen[k] = true
+			kinds = append(kinds, k)
+		}
+	}
+
+	w, err := a.storeFor(c).CreateWebhook(raw, req.Secret, kinds, a.now())
+	if err != nil {
+		a.internalError(c, err)
+		return
+	}
+	resp := mapWebhook(w)
+	resp.Secret = w.Secret
+	renderJSON(c, http.StatusCreated, resp)
+}
+
+// listWebhooks returns every registered webhook, without the secrets.
+func (a *API) listWebhooks(c *gin.Context) {
+	hooks, err := a.storeFor(c).Webhooks()
+	if err != nil {
+		a.internalError(c, err)
+		return
+	}
+	out := make([]webhookResponse, 0, len(hooks))
+	for _, w := range hooks {
+		out = append(out, mapWebhook(w))
+	}
+	renderJSON(c, http.StatusOK, out)
+}
+
+// deleteWebhook unregisters a webhook; deliveries not yet sent are dropped.
+func (a *API) deleteWebhook(c *gin.Context) {
+	err := a.storeFor(c).DeleteWebhook(c.Param("id"))
+	if errors.Is(err, store.ErrWebhookNotFound) {
+		writeError(c, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		a.internalError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// webhookDeliveries returns a webhook's latest deliveries, newest first,
+// with the outcome of the last attempt at each: the log to check when an
+// automation didn't fire.
+func (a *API) webhookDeliveries(c *gin.Context) {
+	limit, ok := intParam(c, "limit", defaultDeliveries, 1, maxDeliveries)
+	if !ok {
+		return
+	}
+	st := a.storeFor(c)
+	if _, err := st.Webhook(c.Param("id")); err != nil {
+		if errors.Is(err, store.ErrWebhookNotFound) {
+			writeError(c, http.StatusNotFound, err.Error())
+			return
+		}
+		a.internalError(c, err)
+		return
+	}
+	ds, err := st.Deliveries(c.Param("id"), limit)
+	if err != nil {
+		a.internalError(c, err)
+		return
+	}
+	out := make([]deliveryResponse, 0, len(ds))
+	for _, d := range ds {
+		out = append(out, deliveryResponse{
+			ID:            d.ID,
+			Event:         d.Kind,
+			TaskID:        d.TaskID,
+			CreatedAt:     d.CreatedAt,
+			Attempts:      d.Attempts,
+			NextAttemptAt: d.NextAttemptAt,
+			DeliveredAt:   d.DeliveredAt,
+			StatusCode:    d.StatusCode,
+			LastError:     d.LastError,
+		})
+	}
+	renderJSON(c, http.StatusOK, out)
+}
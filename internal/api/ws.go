@@ -0,0 +1,200 @@
+package api
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/net/websocket"
+)
+
+var errForbiddenOrigin = errors.New("origin not allowed")
+
+// readyMessage is what /ws pushes. Type "ready" carries just the ready
+// count, sent on connect and whenever the count changes without a task
+// turning ready; "task.ready" announces one task that just came due.
+type readyMessage struct {
+	Type  string        `json:"type"`
+	Ready int           `json:"ready"`
+	Task  *taskResponse `json:"task,omitempty"`
+}
+
+// readyHub fans task-ready notifications out to WebSocket clients.
+type readyHub struct {
+	mu      sync.Mutex
+	clients map[chan readyMessage]struct{}
+
+	// seen holds the IDs that were due at the watcher's last check, or is
+	// nil when nobody was listening then. Only the watcher touches it.
+	seen map[string]bool
+}
+
+func newReadyHub() *readyHub {
+	return &readyHub{clients: make(map[chan readyMessage]struct{})}
+}
+
+// subscribe registers a client; cancel must be called once it disconnects.
+func (h *readyHub) subscribe() (ch <-chan readyMessage, cancel func()) {
+	c := make(chan readyMessage, 16)
+	h.mu.Lock()
+	h.clients[c] = struct{}{}
+	h.mu.Unlock()
+	return c, func() {
+		h.mu.Lock()
+		delete(h.clients, c)
+		h.mu.Unlock()
+	}
+}
+
+func (h *readyHub) hasClients() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.clients) > 0
+}
+
+// broadcast hands m to every client, dropping it for clients that are
+// too far behind.
+func (h *readyHub) broadcast(m readyMessage) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for c := range h.clients {
+		select {
+		case c <- m:
+		default:
+		}
+	}
+}
+
+// checkReady compares the due tasks with the last check and announces
+// the ones that have come due since. The first check after a quiet spell
+// only records the set, since new clients get the count on connect.
+func (a *API) checkReady(now time.Time) {
+	ids, err := a.store.DueIDs(now)
+	if err != nil {
+		slog.Error("ready watcher", "err", err)
+		return
+	}
+	due := make(map[string]bool, len(ids))
+	var fresh []string
+	for _, id := range ids {
+		due[id] = true
+		if a.ready.seen != nil && !a.ready.seen[id] {
+			fresh = append(fresh, id)
+		}
+	}
+	first := a.ready.seen == nil
+	changed := len(due) != len(a.ready.seen)
+	a.ready.seen = due
+	if first {
+		return
+	}
+
+	if len(fresh) > 0 {
+		ts, err := a.store.GetMany(fresh)
+		if err != nil {
+			slog.Error("ready watcher", "err", err)
+			return
+		}
+		for _, t := range ts {
+			if t.Status(now) != "ready" {
+				continue
+			}
+			tr := mapTask(t, now)
+			a.ready.broadcast(readyMessage{Type: "task.ready", Ready: len(due), Task: &tr})
+		}
+		return
+	}
+	if changed {
+		a.ready.broadcast(readyMessage{Type: "ready", Ready: len(due)})
+	}
+}
+
+// readySocket upgrades to a WebSocket that pushes a readyMessage whenever
+// a task comes due, so an open page can keep a badge current without
+// polling. The socket is push-only; anything the client sends is ignored.
+func (a *API) readySocket(c *gin.Context) {
+	snake := c.GetBool(snakeCaseKey)
+	srv := websocket.Server{
+		Handshake: func(cfg *websocket.Config, r *http.Request) error {
+			return a.checkSocketOrigin(r)
+		},
+		Handler: func(ws *websocket.Conn) {
+			defer ws.Close()
+			// The server's read and write timeouts would otherwise cut
+			// the socket off.
+			_ = ws.SetDeadline(time.Time{})
+			a.serveReadySocket(c, ws, snake)
+		},
+	}
+	srv.ServeHTTP(c.Writer, c.Request)
+}
+
+func (a *API) serveReadySocket(c *gin.Context, ws *websocket.Conn, snake bool) {
+	messages, cancel := a.ready.subscribe()
+	defer cancel()
+	a.due.poke()
+
+	send := func(m readyMessage) bool {
+		var v interface{} = m
+		if snake {
+			v = snakeKeys(m)
+		}
+		return websocket.JSON.Send(ws, v) == nil
+	}
+
+	n, err := a.storeFor(c).CountDue(a.now())
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "ready socket", "err", err)
+		return
+	}
+	if !send(readyMessage{Type: "ready", Ready: n}) {
+		return
+	}
+
+	// Reading is how a closed connection is noticed.
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		var discard string
+		for websocket.Message.Receive(ws, &discard) == nil {
+		}
+	}()
+
+	for {
+		select {
+		case m := <-messages:
+			if !send(m) {
+				return
+			}
+		case <-closed:
+			return
+		case <-a.draining:
+			return
+		}
+	}
+}
+
+// checkSocketOrigin keeps other sites from opening a socket with the
+// user's cookies: a browser's Origin must be this host or one allowed by
+// -cors-origins. Clients that send no Origin aren't browsers.
+func (a *API) checkSocketOrigin(r *http.Request) error {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return nil
+	}
+	u, err := url.Parse(origin)
+	if err == nil && strings.EqualFold(u.Host, r.Host) {
+		return nil
+	}
+	for _, o := range a.cfg.Server.CORSOrigins {
+		if o == "*" || strings.EqualFold(o, origin) {
+			return nil
+		}
+	}
+	return errForbiddenOrigin
+}
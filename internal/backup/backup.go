@@ -0,0 +1,156 @@
+// Package backup wraps a store snapshot in a self-verifying file.
+//
+// The checksum is the SHA-256 of the canonical JSON encoding of the
+// snapshot: records sorted by key, tags sorted, timestamps in UTC as
+// RFC 3339 with only the fractional digits needed, and fields in struct
+// order with no extra whitespace. Canonicalizing before hashing means a
+// pretty-printed or re-serialized backup still verifies, while any change
+// to the data itself does not.
+package backup
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"yiwang/internal/store"
+)
+
+const (
+	// Format identifies yiwang backup files.
+	Format = "yiwang-backup"
+	// Version is the current file version.
+	Version = 1
+
+	checksumPrefix = "sha256:"
+)
+
+var (
+	ErrFormat   = errors.New("not a yiwang backup")
+	ErrVersion  = fmt.Errorf("unsupported backup version; this server reads version %d", Version)
+	ErrChecksum = errors.New("backup checksum does not match its contents; the file is corrupted or was modified")
+)
+
+// File is the backup document.
+type File struct {
+	Format    string          `json:"format"`
+	Version   int             `json:"version"`
+	CreatedAt time.Time       `json:"createdAt"`
+	Checksum  string          `json:"checksum"`
+	Data      *store.Snapshot `json:"data"`
+}
+
+// New canonicalizes snap and wraps it in a file with its checksum.
+func New(snap *store.Snapshot, now time.Time) (*File, error) {
+	sum, err := Checksum(snap)
+	if err != nil {
+		return nil, err
+	}
+	return &File{
+		Format:    Format,
+		Version:   Version,
+		CreatedAt: now.UTC(),
+		Checksum:  sum,
+		Data:      snap,
+	}, nil
+}
+
+// Verify checks the header and checksum of a decoded file.
+func (f *File) Verify() error {
+	if f.Format != Format || f.Data == nil {
+		return ErrFormat
+	}
+	if f.Version != Version {
+		return ErrVersion
+	}
+	if !strings.HasPrefix(f.Checksum, checksumPrefix) {
+		return ErrChecksum
+	}
+	sum, err := Checksum(f.Data)
+	if err != nil {
+		return err
+	}
+	if sum != f.Checksum {
+		return ErrChecksum
+	}
+	return nil
+}
+
+// Checksum canonicalizes snap in place and returns "sha256:" followed by
+// the hex digest of its canonical encoding.
+func Checksum(snap *store.Snapshot) (string, error) {
+	canonicalize(snap)
+	b, err := json.Marshal(snap)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(b)
+	return checksumPrefix + hex.EncodeToString(sum[:]), nil
+}
+
+// canonicalize fixes everything the encoding could otherwise vary on:
+// record order, tag order, nil versus empty slices, and time zones.
+func canonicalize(snap *store.Snapshot) {
+	if snap.Tasks == nil {
+		snap.Tasks = []store.SnapshotTask{}
+	}
+	if snap.Reviews == nil {
+		snap.Reviews = []store.SnapshotReview{}
+	}
+	if snap.Images == nil {
+		snap.Images = []store.SnapshotImage{}
+	}
+
+	sort.Slice(snap.Tasks, func(i, j int) bool { return snap.Tasks[i].ID < snap.Tasks[j].ID })
+	for i := range snap.Tasks {
+		t := &snap.Tasks[i]
+		if t.Tags == nil {
+			t.Tags = []string{}
+		}
+		sort.Strings(t.Tags)
+		t.CreatedAt = t.CreatedAt.UTC()
+		t.UpdatedAt = t.UpdatedAt.UTC()
+		t.NextReviewAt = utcPtr(t.NextReviewAt)
+		t.CompletedAt = utcPtr(t.CompletedAt)
+		t.DeletedAt = utcPtr(t.DeletedAt)
+		t.ArchivedAt = utcPtr(t.ArchivedAt)
+		t.SuspendedAt = utcPtr(t.SuspendedAt)
+	}
+
+	sort.Slice(snap.Reviews, func(i, j int) bool { return snap.Reviews[i].ID < snap.Reviews[j].ID })
+	for i := range snap.Reviews {
+		r := &snap.Reviews[i]
+		r.ReviewedAt = r.ReviewedAt.UTC()
+		r.PrevNextReviewAt = utcPtr(r.PrevNextReviewAt)
+		r.PrevCompletedAt = utcPtr(r.PrevCompletedAt)
+	}
+
+	sort.Slice(snap.Images, func(i, j int) bool {
+		a, b := snap.Images[i], snap.Images[j]
+		if a.TaskID != b.TaskID {
+			return a.TaskID < b.TaskID
+		}
+		return a.Side < b.Side
+	})
+	for i := range snap.Images {
+		snap.Images[i].UpdatedAt = snap.Images[i].UpdatedAt.UTC()
+	}
+
+	sort.Slice(snap.TagSchedules, func(i, j int) bool { return snap.TagSchedules[i].Tag < snap.TagSchedules[j].Tag })
+	for i := range snap.TagSchedules {
+		snap.TagSchedules[i].UpdatedAt = snap.TagSchedules[i].UpdatedAt.UTC()
+	}
+}
+
+func utcPtr(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	u := t.UTC()
+	return &u
+}
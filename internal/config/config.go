@@ -0,0 +1,121 @@
+// Package config fills in the server's flags from YIWANG_* environment
+// variables and a YAML file, so a deployment can keep its settings in
+// either. Every flag can be set all three ways: a flag given on the
+// command line wins over the environment, which wins over the file, which
+// wins over the flag's default.
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// EnvName is the environment variable for the flag name: YIWANG_ and the
+// name in upper case with dashes as underscores, e.g. YIWANG_DAILY_TARGET
+// for -daily-target.
+func EnvName(name string) string {
+	return "YIWANG_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
+
+// Apply sets each flag of fs that wasn't given on the command line from
+// its environment variable, else from the YAML file named by the flag
+// fileFlag, whose keys are flag names:
+//
+//	dsn: /var/lib/yiwang/yiwang.db
+//	daily-target: 30
+//	cors-origins: [https://app.example.com]
+//
+// Lists are joined with commas and maps written as key=value pairs, the
+// forms the flags take. Every bad setting is reported, each with where it
+// came from; an unknown key in the file is one.
+func Apply(fs *flag.FlagSet, fileFlag string) error {
+	given := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { given[f.Name] = true })
+
+	var errs []error
+	fs.VisitAll(func(f *flag.Flag) {
+		if given[f.Name] {
+			return
+		}
+		v, ok := os.LookupEnv(EnvName(f.Name))
+		if !ok {
+			return
+		}
+		if err := fs.Set(f.Name, v); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %v", EnvName(f.Name), err))
+		}
+		given[f.Name] = true
+	})
+
+	path := fs.Lookup(fileFlag).Value.String()
+	if path == "" {
+		return errors.Join(errs...)
+	}
+	settings, err := readFile(path)
+	if err != nil {
+		return errors.Join(append(errs, err)...)
+	}
+	keys := make([]string, 0, len(settings))
+	for k := range settings {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		switch {
+		case k == fileFlag || fs.Lookup(k) == nil:
+			errs = append(errs, fmt.Errorf("%s: unknown setting %q", path, k))
+		case given[k]:
+		default:
+			if err := fs.Set(k, settings[k]); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %s: %v", path, k, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// readFile reads a YAML mapping of settings, each rendered the way it
+// would be written as a flag.
+func readFile(path string) (map[string]string, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var raw map[string]interface{}
+	if err := yaml.Unmarshal(b, &raw); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	out := make(map[string]string, len(raw))
+	for k, v := range raw {
+		out[k] = flagValue(v)
+	}
+	return out, nil
+}
+
+func flagValue(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case []interface{}:
+		parts := make([]string, len(v))
+		for i, item := range v {
+			parts[i] = flagValue(item)
+		}
+		return strings.Join(parts, ",")
+	case map[string]interface{}:
+		parts := make([]string, 0, len(v))
+		for k, item := range v {
+			parts = append(parts, k+"="+flagValue(item))
+		}
+		sort.Strings(parts)
+		return strings.Join(parts, ",")
+	default:
+		return fmt.Sprint(v)
+	}
+}
@@ -0,0 +1,79 @@
+// Package cors lets browsers on other origins, such as a separately hosted
+// web app or a mobile webview, call the API. Only origins on an allowlist
+// get the CORS headers; the browser blocks the rest as usual.
+package cors
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxAge is how long browsers may cache a preflight answer.
+const maxAge = 10 * time.Minute
+
+// exposed are the response headers scripts on an allowed origin may read.
+const exposed = "X-Request-ID, Content-Disposition, Last-Modified, ETag, Idempotent-Replayed"
+
+// ParseOrigins splits a comma-separated origin list, such as the value of
+// -cors-origins, dropping blanks and trailing slashes.
+func ParseOrigins(list string) []string {
+	var origins []string
+	for _, o := range strings.Split(list, ",") {
+		if o = strings.TrimRight(strings.TrimSpace(o), "/"); o != "" {
+			origins = append(origins, o)
+		}
+	}
+	return origins
+}
+
+// Middleware answers CORS requests from the given origins, written as
+// scheme://host[:port]; "*" allows any origin. It must be installed on the
+// engine rather than a group so preflight OPTIONS requests, which match no
+// route, reach it. Requests from an allowed origin may carry credentials,
+// except under "*".
+func Middleware(origins []string) gin.HandlerFunc {
+	allowed := make(map[string]bool, len(origins))
+	for _, o := range origins {
+		allowed[strings.ToLower(o)] = true
+	}
+	anyOrigin := allowed["*"]
+
+	return func(c *gin.Context) {
+		origin := c.GetHeader("Origin")
+		if origin == "" {
+			c.Next()
+			return
+		}
+		c.Writer.Header().Add("Vary", "Origin")
+		if !anyOrigin && !allowed[strings.ToLower(origin)] {
+			c.Next()
+			return
+		}
+
+		h := c.Writer.Header()
+		if anyOrigin {
+			h.Set("Access-Control-Allow-Origin", "*")
+		} else {
+			h.Set("Access-Control-Allow-Origin", origin)
+			h.Set("Access-Control-Allow-Credentials", "true")
+		}
+
+		if c.Request.Method != http.MethodOptions || c.GetHeader("Access-Control-Request-Method") == "" {
+			h.Set("Access-Control-Expose-Headers", exposed)
+			c.Next()
+			return
+		}
+		h.Add("Vary", "Access-Control-Request-Method")
+		h.Add("Vary", "Access-Control-Request-Headers")
+		h.Set("Access-Control-Allow-Methods", "GET, HEAD, POST, PUT, PATCH, DELETE")
+		if req := c.GetHeader("Access-Control-Request-Headers"); req != "" {
+			h.Set("Access-Control-Allow-Headers", req)
+		}
+		h.Set("Access-Control-Max-Age", strconv.Itoa(int(maxAge.Seconds())))
+		c.AbortWithStatus(http.StatusNoContent)
+	}
+}
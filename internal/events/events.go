@@ -0,0 +1,139 @@
+// Package events is a small in-process bus for task lifecycle events, so
+// cross-cutting reactions (metrics, live notifications, webhooks) subscribe
+// in one place instead of being wired into every handler.
+package events
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"yiwang/internal/tasks"
+)
+
+// Kind names a lifecycle event.
+type Kind string
+
+const (
+	TaskCreated  Kind = "task.created"
+	TaskUpdated  Kind = "task.updated"
+	TaskReviewed Kind = "task.reviewed"
+	TaskDeleted  Kind = "task.deleted"
+	// TaskCompleted follows the TaskReviewed event of the review that
+	// finished a task. It is only written to the store's outbox.
+	TaskCompleted Kind = "task.completed"
+)
+
+// Valid reports whether k is one of the kinds above.
+func (k Kind) Valid() bool {
+	switch k {
+	case TaskCreated, TaskUpdated, TaskReviewed, TaskDeleted, TaskCompleted:
+		return true
+	}
+	return false
+}
+
+// Event is one change to a task. Task is a snapshot taken after the change
+// and must be treated as read-only, since every subscriber shares it.
+type Event struct {
+	Kind   Kind        `json:"kind"`
+	TaskID string      `json:"taskId"`
+	Task   *tasks.Task `json:"task,omitempty"`
+	// Result is the review outcome for TaskReviewed events.
+	Result string    `json:"result,omitempty"`
+	At     time.Time `json:"at"`
+}
+
+// Bus delivers events to subscribers asynchronously. Every subscriber has
+// its own buffered queue drained by its own goroutine; when a queue is
+// full the event is dropped for that subscriber, so a slow subscriber can
+// never block a request.
+type Bus struct {
+	mu     sync.RWMutex
+	subs   map[*subscriber]struct{}
+	closed bool
+	wg     sync.WaitGroup
+}
+
+type subscriber struct {
+	name    string
+	ch      chan Event
+	handler func(Event)
+}
+
+// NewBus returns an empty bus.
+func NewBus() *Bus {
+	return &Bus{subs: make(map[*subscriber]struct{})}
+}
+
+// Subscribe registers handler with a queue of buffer events. The returned
+// function unsubscribes; events already queued are still delivered.
+func (b *Bus) Subscribe(name string, buffer int, handler func(Event)) (unsubscribe func()) {
+	s := &subscriber{name: name, ch: make(chan Event, buffer), handler: handler}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return func() {}
+	}
+	b.subs[s] = struct{}{}
+	b.wg.Add(1)
+	go b.run(s)
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			b.mu.Lock()
+			defer b.mu.Unlock()
+			if _, ok := b.subs[s]; ok {
+				delete(b.subs, s)
+				close(s.ch)
+			}
+		})
+	}
+}
+
+// Publish queues e for every subscriber without blocking.
+func (b *Bus) Publish(e Event) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for s := range b.subs {
+		select {
+		case s.ch <- e:
+		default:
+			log.Printf("events: subscriber %s is full, dropped %s for %s", s.name, e.Kind, e.TaskID)
+		}
+	}
+}
+
+// Close stops accepting events and waits for subscribers to drain their
+// queues.
+func (b *Bus) Close() {
+	b.mu.Lock()
+	if !b.closed {
+		b.closed = true
+		for s := range b.subs {
+			delete(b.subs, s)
+			close(s.ch)
+		}
+	}
+	b.mu.Unlock()
+	b.wg.Wait()
+}
+
+func (b *Bus) run(s *subscriber) {
+	defer b.wg.Done()
+	for e := range s.ch {
+		b.deliver(s, e)
+	}
+}
+
+// deliver shields the subscriber loop from a panicking handler.
+func (b *Bus) deliver(s *subscriber, e Event) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("events: subscriber %s panicked on %s: %v", s.name, e.Kind, r)
+		}
+	}()
+	s.handler(e)
+}
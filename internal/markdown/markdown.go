@@ -0,0 +1,29 @@
+// Package markdown renders card text written in Markdown to HTML that is
+// safe to insert into a page.
+package markdown
+
+import (
+	"bytes"
+	"html"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+)
+
+// md renders CommonMark plus the GitHub extensions (tables,
+// strikethrough, autolinks, task lists). It is left in goldmark's safe
+// mode: raw HTML in the source is dropped rather than passed through, and
+// links and images with javascript:, vbscript:, file: or data: URLs
+// (other than images) lose their target, so the output can't run script.
+var md = goldmark.New(goldmark.WithExtensions(extension.GFM))
+
+// Render converts src to HTML. Rendering only fails on writer errors,
+// which a buffer doesn't have, so on the off chance it does src is
+// returned escaped instead.
+func Render(src string) string {
+	var buf bytes.Buffer
+	if err := md.Convert([]byte(src), &buf); err != nil {
+		return "<p>" + html.EscapeString(src) + "</p>"
+	}
+	return buf.String()
+}
@@ -0,0 +1,148 @@
+// Package metrics holds the Prometheus collectors exposed at /metrics.
+package metrics
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Review outcomes used as label values. The set is fixed so the label's
+// cardinality stays bounded no matter what clients send.
+const (
+	OutcomeRemembered = "remembered"
+	OutcomeForgot     = "forgot"
+	OutcomeHard       = "hard"
+	OutcomeEasy       = "easy"
+)
+
+var outcomes = []string{OutcomeRemembered, OutcomeForgot, OutcomeHard, OutcomeEasy}
+
+// statuses are the task statuses reported by yiwang_tasks, always all of
+// them so a status that empties out drops to zero rather than vanishing.
+var statuses = []string{"ready", "pending", "done", "suspended", "archived", "deleted"}
+
+var (
+	registry = prometheus.NewRegistry()
+
+	reviews = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "yiwang_reviews_total",
+		Help: "Reviews recorded, by outcome.",
+	}, []string{"outcome"})
+
+	requests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "yiwang_http_requests_total",
+		Help: "HTTP requests served, by method, route and status code.",
+	}, []string{"method", "route", "code"})
+
+	latency = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "yiwang_http_request_duration_seconds",
+		Help:    "Time taken to serve HTTP requests, by method and route.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "route"})
+
+	taskDesc = prometheus.NewDesc("yiwang_tasks", "Tasks by status.", []string{"status"}, nil)
+	dueDesc  = prometheus.NewDesc("yiwang_due_backlog", "Tasks ready for review now.", nil, nil)
+
+	poolOpenDesc     = prometheus.NewDesc("yiwang_db_open_connections", "Database connections open, by state.", []string{"state"}, nil)
+	poolMaxDesc      = prometheus.NewDesc("yiwang_db_max_open_connections", "Most database connections allowed open, 0 for no limit.", nil, nil)
+	poolWaitDesc     = prometheus.NewDesc("yiwang_db_wait_count_total", "Times a query waited for a free connection.", nil, nil)
+	poolWaitTimeDesc = prometheus.NewDesc("yiwang_db_wait_duration_seconds_total", "Time spent waiting for a free connection.", nil, nil)
+)
+
+func init() {
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		reviews,
+		requests,
+		latency,
+	)
+	// Start every outcome at zero so rate() works before the first review.
+	for _, o := range outcomes {
+		reviews.WithLabelValues(o)
+	}
+}
+
+// ObserveReview counts one stored review. Outcomes outside the fixed set
+// are ignored.
+func ObserveReview(outcome string) {
+	for _, o := range outcomes {
+		if o == outcome {
+			reviews.WithLabelValues(o).Inc()
+			return
+		}
+	}
+}
+
+// Middleware counts and times every request by its route pattern, not its
+// path, so task IDs don't become label values. Requests matching no route
+// are labelled "unmatched".
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		requests.WithLabelValues(c.Request.Method, route, strconv.Itoa(c.Writer.Status())).Inc()
+		latency.WithLabelValues(c.Request.Method, route).Observe(time.Since(start).Seconds())
+	}
+}
+
+// Source is what the store-backed metrics read at scrape time.
+type Source interface {
+	CountByStatus(now time.Time) (map[string]int, error)
+	Stats() sql.DBStats
+}
+
+// WatchStore adds task counts by status, the due backlog, and the
+// connection pool's statistics, all read from src on every scrape.
+func WatchStore(src Source) {
+	registry.MustRegister(storeCollector{src: src})
+}
+
+// storeCollector reads the store when scraped.
+type storeCollector struct {
+	src Source
+}
+
+func (c storeCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, d := range []*prometheus.Desc{taskDesc, dueDesc, poolOpenDesc, poolMaxDesc, poolWaitDesc, poolWaitTimeDesc} {
+		ch <- d
+	}
+}
+
+// Collect leaves out the task counts when counting fails, which
+// Prometheus shows as the series going missing, and logs why.
+func (c storeCollector) Collect(ch chan<- prometheus.Metric) {
+	st := c.src.Stats()
+	ch <- prometheus.MustNewConstMetric(poolOpenDesc, prometheus.GaugeValue, float64(st.InUse), "in_use")
+	ch <- prometheus.MustNewConstMetric(poolOpenDesc, prometheus.GaugeValue, float64(st.Idle), "idle")
+	ch <- prometheus.MustNewConstMetric(poolMaxDesc, prometheus.GaugeValue, float64(st.MaxOpenConnections))
+	ch <- prometheus.MustNewConstMetric(poolWaitDesc, prometheus.CounterValue, float64(st.WaitCount))
+	ch <- prometheus.MustNewConstMetric(poolWaitTimeDesc, prometheus.CounterValue, st.WaitDuration.Seconds())
+
+	counts, err := c.src.CountByStatus(time.Now())
+	if err != nil {
+		log.Printf("metrics: count tasks: %v", err)
+		return
+	}
+	for _, s := range statuses {
+		ch <- prometheus.MustNewConstMetric(taskDesc, prometheus.GaugeValue, float64(counts[s]), s)
+	}
+	ch <- prometheus.MustNewConstMetric(dueDesc, prometheus.GaugeValue, float64(counts["ready"]))
+}
+
+// Handler serves the registry in the Prometheus exposition format.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{Registry: registry})
+}
@@ -0,0 +1,158 @@
+// Package oauth signs users in with their Google or GitHub accounts
+// through the OAuth2 authorization code flow.
+package oauth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/endpoints"
+)
+
+// Identity is the account a provider signed someone in as.
+type Identity struct {
+	// Subject is the provider's stable ID for the account.
+	Subject       string
+	Name          string
+	Email         string
+	EmailVerified bool
+}
+
+// Provider is an OAuth2 identity provider with its client credentials.
+type Provider struct {
+	Name     string
+	config   oauth2.Config
+	identify func(ctx context.Context, client *http.Client) (Identity, error)
+}
+
+// Google returns the Google provider for an OAuth client.
+func Google(clientID, clientSecret string) *Provider {
+	return &Provider{
+		Name: "google",
+		config: oauth2.Config{
+			ClientID:     clientID,
+			ClientSecret: clientSecret,
+			Endpoint:     endpoints.Google,
+			Scopes:       []string{"openid", "email", "profile"},
+		},
+		identify: googleIdentity,
+	}
+}
+
+// GitHub returns the GitHub provider for an OAuth app.
+func GitHub(clientID, clientSecret string) *Provider {
+	return &Provider{
+		Name: "github",
+		config: oauth2.Config{
+			ClientID:     clientID,
+			ClientSecret: clientSecret,
+			Endpoint:     endpoints.GitHub,
+			Scopes:       []string{"read:user", "user:email"},
+		},
+		identify: githubIdentity,
+	}
+}
+
+// FromEnv returns the providers whose credentials are set in the
+// environment: GOOGLE_CLIENT_ID and GOOGLE_CLIENT_SECRET, GITHUB_CLIENT_ID
+// and GITHUB_CLIENT_SECRET.
+func FromEnv() []*Provider {
+	var out []*Provider
+	if id, secret := os.Getenv("GOOGLE_CLIENT_ID"), os.Getenv("GOOGLE_CLIENT_SECRET"); id != "" && secret != "" {
+		out = append(out, Google(id, secret))
+	}
+	if id, secret := os.Getenv("GITHUB_CLIENT_ID"), os.Getenv("GITHUB_CLIENT_SECRET"); id != "" && secret != "" {
+		out = append(out, GitHub(id, secret))
+	}
+	return out
+}
+
+// AuthCodeURL is where to send the browser to sign in. The provider sends
+// it back to redirectURL with state and a code for Exchange.
+func (p *Provider) AuthCodeURL(state, redirectURL string) string {
+	c := p.config
+	c.RedirectURL = redirectURL
+	return c.AuthCodeURL(state)
+}
+
+// Exchange trades the code from the provider's redirect for the identity
+// that signed in.
+func (p *Provider) Exchange(ctx context.Context, code, redirectURL string) (Identity, error) {
+	c := p.config
+	c.RedirectURL = redirectURL
+	tok, err := c.Exchange(ctx, code)
+	if err != nil {
+		return Identity{}, fmt.Errorf("%s: exchange code: %w", p.Name, err)
+	}
+	id, err := p.identify(ctx, c.Client(ctx, tok))
+	if err != nil {
+		return Identity{}, fmt.Errorf("%s: %w", p.Name, err)
+	}
+	return id, nil
+}
+
+func googleIdentity(ctx context.Context, client *http.Client) (Identity, error) {
+	var info struct {
+		Sub           string `json:"sub"`
+		Name          string `json:"name"`
+		Email         string `json:"email"`
+		EmailVerified bool   `json:"email_verified"`
+	}
+	if err := getJSON(ctx, client, "https://openidconnect.googleapis.com/v1/userinfo", &info); err != nil {
+		return Identity{}, err
+	}
+	return Identity{Subject: info.Sub, Name: info.Name, Email: info.Email, EmailVerified: info.EmailVerified}, nil
+}
+
+func githubIdentity(ctx context.Context, client *http.Client) (Identity, error) {
+	var user struct {
+		ID    int64  `json:"id"`
+		Login string `json:"login"`
+		Name  string `json:"name"`
+	}
+	if err := getJSON(ctx, client, "https://api.github.com/user", &user); err != nil {
+		return Identity{}, err
+	}
+	id := Identity{Subject: strconv.FormatInt(user.ID, 10), Name: user.Name}
+	if id.Name == "" {
+		id.Name = user.Login
+	}
+	// The profile's email is optional and unverified; the primary address
+	// from the email list is neither.
+	var emails []struct {
+		Email    string `json:"email"`
+		Primary  bool   `json:"primary"`
+		Verified bool   `json:"verified"`
+	}
+	if err := getJSON(ctx, client, "https://api.github.com/user/emails", &emails); err != nil {
+		return Identity{}, err
+	}
+	for _, e := range emails {
+		if e.Primary {
+			id.Email, id.EmailVerified = e.Email, e.Verified
+		}
+	}
+	return id, nil
+}
+
+func getJSON(ctx context.Context, client *http.Client, url string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
@@ -0,0 +1,94 @@
+// Package ratelimit caps how fast each client may call the API, so a
+// runaway script can't monopolize a small database. Each client gets a
+// token bucket; requests beyond it are answered 429 with a Retry-After.
+package ratelimit
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/time/rate"
+)
+
+// sweepEvery is how often buckets that have refilled, and so hold no
+// state worth keeping, are dropped.
+const sweepEvery = time.Minute
+
+// Limiter holds one token bucket per client.
+type Limiter struct {
+	limit rate.Limit
+	burst int
+
+	// Key names the client a request counts against; the client IP by
+	// default.
+	Key func(*gin.Context) string
+	// Exempt, when set, lets matching requests through uncounted.
+	Exempt func(*gin.Context) bool
+	// Deny answers a request over its limit, after Retry-After is set. It
+	// must abort the request; the default answers a bare JSON error.
+	Deny gin.HandlerFunc
+
+	mu        sync.Mutex
+	buckets   map[string]*rate.Limiter
+	lastSweep time.Time
+}
+
+// New returns a Limiter allowing each client perSecond requests a second
+// on average, in bursts of up to burst.
+func New(perSecond float64, burst int) *Limiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &Limiter{
+		limit:   rate.Limit(perSecond),
+		burst:   burst,
+		Key:     (*gin.Context).ClientIP,
+		buckets: map[string]*rate.Limiter{},
+	}
+}
+
+// Middleware rejects requests over their client's limit with 429.
+func (l *Limiter) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if l.Exempt != nil && l.Exempt(c) {
+			c.Next()
+			return
+		}
+		now := time.Now()
+		r := l.bucket(l.Key(c), now).ReserveN(now, 1)
+		if delay := r.DelayFrom(now); delay > 0 {
+			r.CancelAt(now)
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(delay.Seconds()))))
+			if l.Deny != nil {
+				l.Deny(c)
+				return
+			}
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": "rate limit exceeded"})
+			return
+		}
+		c.Next()
+	}
+}
+
+func (l *Limiter) bucket(key string, now time.Time) *rate.Limiter {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if now.Sub(l.lastSweep) >= sweepEvery {
+		for k, b := range l.buckets {
+			if b.TokensAt(now) >= float64(l.burst) {
+				delete(l.buckets, k)
+			}
+		}
+		l.lastSweep = now
+	}
+	b, ok := l.buckets[key]
+	if !ok {
+		b = rate.NewLimiter(l.limit, l.burst)
+		l.buckets[key] = b
+	}
+	return b
+}
@@ -0,0 +1,54 @@
+package session
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Memory keeps sessions in the server's memory; they end when it stops.
+type Memory struct {
+	mu       sync.Mutex
+	sessions map[string]memorySession
+}
+
+type memorySession struct {
+	Session
+	expires time.Time
+}
+
+// NewMemory returns an empty in-memory store.
+func NewMemory() *Memory {
+	return &Memory{sessions: map[string]memorySession{}}
+}
+
+// Save keeps s, dropping expired sessions on the way.
+func (m *Memory) Save(_ context.Context, id string, s Session, ttl time.Duration) error {
+	now := time.Now()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for k, s := range m.sessions {
+		if !now.Before(s.expires) {
+			delete(m.sessions, k)
+		}
+	}
+	m.sessions[id] = memorySession{Session: s, expires: now.Add(ttl)}
+	return nil
+}
+
+func (m *Memory) Load(_ context.Context, id string) (Session, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s, ok := m.sessions[id]
+	if !ok || !time.Now().Before(s.expires) {
+		return Session{}, false, nil
+	}
+	return s.Session, true, nil
+}
+
+func (m *Memory) Delete(_ context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.sessions, id)
+	return nil
+}
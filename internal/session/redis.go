@@ -0,0 +1,65 @@
+package session
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// keyPrefix namespaces session keys in a shared Redis.
+const keyPrefix = "yiwang:session:"
+
+// Redis keeps sessions in Redis, which expires them itself.
+type Redis struct {
+	client *redis.Client
+}
+
+// NewRedis connects to the Redis at url, e.g. redis://localhost:6379/0,
+// and checks that it answers.
+func NewRedis(ctx context.Context, url string) (*Redis, error) {
+	opts, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, err
+	}
+	client := redis.NewClient(opts)
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, err
+	}
+	return &Redis{client: client}, nil
+}
+
+func (r *Redis) Save(ctx context.Context, id string, s Session, ttl time.Duration) error {
+	b, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	return r.client.Set(ctx, keyPrefix+id, b, ttl).Err()
+}
+
+func (r *Redis) Load(ctx context.Context, id string) (Session, bool, error) {
+	b, err := r.client.Get(ctx, keyPrefix+id).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return Session{}, false, nil
+	}
+	if err != nil {
+		return Session{}, false, err
+	}
+	var s Session
+	if err := json.Unmarshal(b, &s); err != nil {
+		return Session{}, false, err
+	}
+	return s, true, nil
+}
+
+func (r *Redis) Delete(ctx context.Context, id string) error {
+	return r.client.Del(ctx, keyPrefix+id).Err()
+}
+
+// Close closes the connection pool.
+func (r *Redis) Close() error {
+	return r.client.Close()
+}
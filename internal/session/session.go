@@ -0,0 +1,92 @@
+// Package session keeps the sessions of browsers signed in to the web UI.
+// A session is a random ID in a cookie, naming who signed in in a Store:
+// server memory, or Redis when sessions should outlive a restart or be
+// shared between servers.
+package session
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"time"
+)
+
+// CookieName is the cookie holding the session ID.
+const CookieName = "yiwang_session"
+
+// Session is who a session signs in: a user who came through an OAuth
+// provider, or an API key given to POST /auth/login.
+type Session struct {
+	UserID   string `json:"userId,omitempty"`
+	APIKeyID string `json:"apiKeyId,omitempty"`
+}
+
+// Store keeps sessions by ID until they expire.
+type Store interface {
+	Save(ctx context.Context, id string, s Session, ttl time.Duration) error
+	// Load returns the session id, or false when there is none or it has
+	// expired.
+	Load(ctx context.Context, id string) (Session, bool, error)
+	Delete(ctx context.Context, id string) error
+}
+
+// Manager issues sessions, keeps them in a Store and ties them to
+// browsers with a cookie.
+type Manager struct {
+	store Store
+	// TTL is how long a session lasts after it starts.
+	TTL time.Duration
+	// Secure marks the cookie for HTTPS only.
+	Secure bool
+}
+
+// NewManager returns a Manager keeping sessions in store for ttl.
+func NewManager(store Store, ttl time.Duration, secure bool) *Manager {
+	return &Manager{store: store, TTL: ttl, Secure: secure}
+}
+
+// Start creates a session for s and sets its cookie on w.
+func (m *Manager) Start(ctx context.Context, w http.ResponseWriter, s Session) error {
+	var b [32]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return err
+	}
+	id := hex.EncodeToString(b[:])
+	if err := m.store.Save(ctx, id, s, m.TTL); err != nil {
+		return err
+	}
+	m.setCookie(w, id, int(m.TTL/time.Second))
+	return nil
+}
+
+// Load returns the session r's cookie names, or false.
+func (m *Manager) Load(r *http.Request) (Session, bool, error) {
+	c, err := r.Cookie(CookieName)
+	if err != nil || c.Value == "" {
+		return Session{}, false, nil
+	}
+	return m.store.Load(r.Context(), c.Value)
+}
+
+// End deletes r's session, if any, and clears its cookie on w.
+func (m *Manager) End(w http.ResponseWriter, r *http.Request) error {
+	m.setCookie(w, "", -1)
+	c, err := r.Cookie(CookieName)
+	if err != nil || c.Value == "" {
+		return nil
+	}
+	return m.store.Delete(r.Context(), c.Value)
+}
+
+func (m *Manager) setCookie(w http.ResponseWriter, id string, maxAge int) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     CookieName,
+		Value:    id,
+		Path:     "/",
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   m.Secure,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
@@ -0,0 +1,63 @@
+// Package stale suspends cards that have been overdue too long, so a long
+// break doesn't leave thousands of them in the ready queue. Suspended
+// cards keep their stage and come back with the unsuspend action.
+package stale
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"yiwang/internal/events"
+	"yiwang/internal/store"
+)
+
+// Suspender periodically suspends cards overdue by more than After.
+type Suspender struct {
+	store *store.Store
+	bus   *events.Bus
+	after time.Duration
+	now   func() time.Time
+	// Paused, when set and returning true, skips a sweep, e.g. while the
+	// API is in read-only mode.
+	Paused func() bool
+}
+
+// New returns a suspender for cards overdue by more than after. Each
+// suspended card is published on bus as events.TaskUpdated.
+func New(st *store.Store, bus *events.Bus, after time.Duration) *Suspender {
+	return &Suspender{store: st, bus: bus, after: after, now: time.Now}
+}
+
+// Run checks for stale cards every interval until ctx is done.
+func (s *Suspender) Run(ctx context.Context, every time.Duration) {
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+	for {
+		s.sweep()
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Suspender) sweep() {
+	if s.Paused != nil && s.Paused() {
+		return
+	}
+	now := s.now()
+	ts, err := s.store.SuspendStale(now.Add(-s.after), now)
+	if err != nil {
+		log.Printf("stale: suspend overdue cards: %v", err)
+		return
+	}
+	if len(ts) == 0 {
+		return
+	}
+	log.Printf("stale: suspended %d cards overdue by more than %s", len(ts), s.after)
+	for _, t := range ts {
+		s.bus.Publish(events.Event{Kind: events.TaskUpdated, TaskID: t.ID, Task: t, At: now})
+	}
+}
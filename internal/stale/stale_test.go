@@ -0,0 +1,100 @@
+package stale
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"yiwang/internal/events"
+	"yiwang/internal/store"
+	"yiwang/internal/tasks"
+)
+
+var testNow = time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)
+
+func TestSuspendAcrossThreshold(t *testing.T) {
+	st, err := store.NewWithOptions(filepath.Join(t.TempDir(), "test.db"), store.Options{Driver: store.DriverSQLite})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { st.Close() })
+	create := func(question string, in time.Duration) *tasks.Task {
+		t.Helper()
+		task, err := st.Create(question, "a", tasks.Options{FirstReviewIn: &in}, testNow)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return task
+	}
+	overdue := create("overdue", 0)
+	later := create("due a day later", 24*time.Hour)
+	manual := create("suspended by hand", 0)
+	if _, err := st.SuspendTask(manual.ID, testNow); err != nil {
+		t.Fatal(err)
+	}
+
+	const after = 7 * 24 * time.Hour
+	now := testNow
+	s := New(st, events.NewBus(), after)
+	s.now = func() time.Time { return now }
+	reason := func(id string) string {
+		t.Helper()
+		got, err := st.Get(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return got.SuspendReason
+	}
+
+	// Overdue by exactly the threshold isn't stale yet.
+	now = testNow.Add(after)
+	s.sweep()
+	if r := reason(overdue.ID); r != "" {
+		t.Fatalf("suspended at the threshold (%q)", r)
+	}
+
+	// Paused, nothing is suspended even past it.
+	now = testNow.Add(after + time.Minute)
+	s.Paused = func() bool { return true }
+	s.sweep()
+	if r := reason(overdue.ID); r != "" {
+		t.Fatalf("suspended while paused (%q)", r)
+	}
+
+	s.Paused = nil
+	s.sweep()
+	for _, tc := range []struct {
+		task *tasks.Task
+		want string
+	}{
+		{overdue, tasks.SuspendStale},
+		{later, ""},
+		{manual, tasks.SuspendManual},
+	} {
+		if r := reason(tc.task.ID); r != tc.want {
+			t.Errorf("%q suspended for %q, want %q", tc.task.Question, r, tc.want)
+		}
+	}
+
+	// Reviving the stale cards leaves the hand-suspended one alone and
+	// makes the revived one due now.
+	revived, err := st.Unsuspend(store.Filter{}, tasks.SuspendStale, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(revived) != 1 || revived[0].ID != overdue.ID {
+		t.Fatalf("revived %d tasks, want only %q", len(revived), overdue.Question)
+	}
+	if !revived[0].NextReviewAt.Equal(now) {
+		t.Errorf("revived card due at %v, want %v", revived[0].NextReviewAt, now)
+	}
+	if r := reason(manual.ID); r != tasks.SuspendManual {
+		t.Errorf("hand-suspended card now has reason %q", r)
+	}
+
+	// It stays out of the next sweep until it is overdue again.
+	s.sweep()
+	if r := reason(overdue.ID); r != "" {
+		t.Errorf("revived card suspended again at once (%q)", r)
+	}
+}
@@ -0,0 +1,162 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"yiwang/internal/events"
+	"yiwang/internal/tasks"
+)
+
+// ErrNoImage is returned when a task has no image on the requested side.
+var ErrNoImage = errors.New("task has no image")
+
+// Image is an image attached to one side of a task.
+type Image struct {
+	ContentType string
+	Data        []byte
+	UpdatedAt   time.Time
+}
+
+// SetImage attaches img to side of a live task, replacing any image
+// already there. The caller validates type and size.
+func (s *Store) SetImage(id string, side tasks.Side, img Image) (*tasks.Task, error) {
+	return s.changeAssets(id, img.UpdatedAt, func(tx *dbTx) error {
+		if _, err := tx.Exec(`DELETE FROM task_assets WHERE task_id = ? AND side = ?`, id, string(side)); err != nil {
+			return err
+		}
+		_, err := tx.Exec(`
+			INSERT INTO task_assets (task_id, side, content_type, data, updated_at)
+			VALUES (?, ?, ?, ?, ?)
+		`, id, string(side), img.ContentType, img.Data, img.UpdatedAt)
+		return err
+	})
+}
+
+// DeleteImage removes the image on side of a task, returning ErrNoImage if
+// there was none.
+func (s *Store) DeleteImage(id string, side tasks.Side, now time.Time) (*tasks.Task, error) {
+	return s.changeAssets(id, now, func(tx *dbTx) error {
+		res, err := tx.Exec(`DELETE FROM task_assets WHERE task_id = ? AND side = ?`, id, string(side))
+		if err != nil {
+			return err
+		}
+		affected, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if affected == 0 {
+			return ErrNoImage
+		}
+		return nil
+	})
+}
+
+// changeAssets runs change against a locked live task and bumps its
+// updated_at, so image and attachment edits show up like any other edit.
+func (s *Store) changeAssets(id string, now time.Time, change func(tx *dbTx) error) (*tasks.Task, error) {
+	tx, err := s.db.begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	t, err := s.lockTask(tx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := change(tx); err != nil {
+		return nil, err
+	}
+	t.UpdatedAt = now
+	if _, err := tx.Exec(`UPDATE tasks SET updated_at = ?, version = version + 1 WHERE id = ?`, t.UpdatedAt, t.ID); err != nil {
+		return nil, err
+	}
+	t.Version++
+	if err := loadRelated(tx, []*tasks.Task{t}); err != nil {
+		return nil, err
+	}
+	if err := s.enqueue(tx, events.TaskUpdated, t, "", now); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// GetImage returns the image on side of a live task.
+func (s *Store) GetImage(id string, side tasks.Side) (*Image, error) {
+	var img Image
+	err := s.db.QueryRow(`
+		SELECT a.content_type, a.data, a.updated_at
+		FROM task_assets a
+		JOIN tasks t ON t.id = a.task_id
+		WHERE a.task_id = ? AND a.side = ? AND t.deleted_at IS NULL
+	`, id, string(side)).Scan(&img.ContentType, &img.Data, &img.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		if _, err := s.Get(id); err != nil {
+			return nil, err
+		}
+		return nil, ErrNoImage
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &img, nil
+}
+
+// loadImages fills in Images for each task with one query.
+func loadImages(q queryer, ts []*tasks.Task) error {
+	if len(ts) == 0 {
+		return nil
+	}
+	byID := make(map[string]*tasks.Task, len(ts))
+	args := make([]interface{}, 0, len(ts))
+	for _, t := range ts {
+		t.Images = []tasks.Side{}
+		byID[t.ID] = t
+		args = append(args, t.ID)
+	}
+
+	rows, err := q.Query(`
+		SELECT task_id, side
+		FROM task_assets
+		WHERE task_id IN (`+placeholders(len(args))+`)
+		ORDER BY side DESC
+	`, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id, side string
+		if err := rows.Scan(&id, &side); err != nil {
+			return err
+		}
+		if t := byID[id]; t != nil {
+			t.Images = append(t.Images, tasks.Side(side))
+		}
+	}
+	return rows.Err()
+}
+
+// loadRelated fills in the data kept outside the tasks table, then clamps
+// the tasks' stages to their schedules.
+func loadRelated(q queryer, ts []*tasks.Task) error {
+	if err := loadTags(q, ts); err != nil {
+		return err
+	}
+	if err := loadTagSchedules(q, ts); err != nil {
+		return err
+	}
+	for _, t := range ts {
+		clampStage(q.context(), t)
+	}
+	if err := loadImages(q, ts); err != nil {
+		return err
+	}
+	return loadAttachments(q, ts)
+}
@@ -0,0 +1,119 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"yiwang/internal/tasks"
+)
+
+// ErrNoAttachment is returned when a task has no attachment by that ID.
+var ErrNoAttachment = errors.New("attachment not found")
+
+// AddAttachment records a file attached to a live task. The caller has
+// already stored the file itself.
+func (s *Store) AddAttachment(id string, att tasks.Attachment) (*tasks.Task, error) {
+	return s.changeAssets(id, att.CreatedAt, func(tx *dbTx) error {
+		_, err := tx.Exec(`
+			INSERT INTO attachments (id, task_id, filename, content_type, size, created_at)
+			VALUES (?, ?, ?, ?, ?, ?)
+		`, att.ID, id, att.Filename, att.ContentType, att.Size, att.CreatedAt)
+		return err
+	})
+}
+
+// Attachment returns one attachment of a live task.
+func (s *Store) Attachment(id, attID string) (tasks.Attachment, error) {
+	var att tasks.Attachment
+	err := s.db.QueryRow(`
+		SELECT a.id, a.filename, a.content_type, a.size, a.created_at
+		FROM attachments a
+		JOIN tasks t ON t.id = a.task_id
+		WHERE a.task_id = ? AND a.id = ? AND t.deleted_at IS NULL
+	`, id, attID).Scan(&att.ID, &att.Filename, &att.ContentType, &att.Size, &att.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		if _, err := s.Get(id); err != nil {
+			return att, err
+		}
+		return att, ErrNoAttachment
+	}
+	return att, err
+}
+
+// DeleteAttachment forgets an attachment of a live task, returning
+// ErrNoAttachment if there is none by that ID. The caller removes the
+// file.
+func (s *Store) DeleteAttachment(id, attID string, now time.Time) (*tasks.Task, error) {
+	return s.changeAssets(id, now, func(tx *dbTx) error {
+		res, err := tx.Exec(`DELETE FROM attachments WHERE task_id = ? AND id = ?`, id, attID)
+		if err != nil {
+			return err
+		}
+		affected, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if affected == 0 {
+			return ErrNoAttachment
+		}
+		return nil
+	})
+}
+
+// AttachmentIDs lists the IDs of a task's attachments, deleted or not, so
+// their files can be removed when the task is purged.
+func (s *Store) AttachmentIDs(id string) ([]string, error) {
+	rows, err := s.db.Query(`SELECT id FROM attachments WHERE task_id = ? ORDER BY id`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	ids := []string{}
+	for rows.Next() {
+		var attID string
+		if err := rows.Scan(&attID); err != nil {
+			return nil, err
+		}
+		ids = append(ids, attID)
+	}
+	return ids, rows.Err()
+}
+
+// loadAttachments fills in Attachments for each task with one query.
+func loadAttachments(q queryer, ts []*tasks.Task) error {
+	if len(ts) == 0 {
+		return nil
+	}
+	byID := make(map[string]*tasks.Task, len(ts))
+	args := make([]interface{}, 0, len(ts))
+	for _, t := range ts {
+		t.Attachments = []tasks.Attachment{}
+		byID[t.ID] = t
+		args = append(args, t.ID)
+	}
+
+	rows, err := q.Query(`
+		SELECT task_id, id, filename, content_type, size, created_at
+		FROM attachments
+		WHERE task_id IN (`+placeholders(len(args))+`)
+		ORDER BY created_at, id
+	`, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			taskID string
+			att    tasks.Attachment
+		)
+		if err := rows.Scan(&taskID, &att.ID, &att.Filename, &att.ContentType, &att.Size, &att.CreatedAt); err != nil {
+			return err
+		}
+		if t := byID[taskID]; t != nil {
+			t.Attachments = append(t.Attachments, att)
+		}
+	}
+	return rows.Err()
+}
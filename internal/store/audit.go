@@ -0,0 +1,182 @@
+package store
+
+import (
+	"time"
+
+	"yiwang/internal/tasks"
+)
+
+// auditSampleSize caps how many task IDs each audit finding lists.
+const auditSampleSize = 10
+
+// AuditFinding is the result of one consistency check: how many rows are
+// affected, a sample of the task IDs involved, and how many rows a repair
+// fixed. Repairable is false for checks whose fix would need a judgement
+// call.
+type AuditFinding struct {
+	Check       string
+	Description string
+	Count       int
+	Sample      []string
+	Repairable  bool
+	Repaired    int
+}
+
+// auditCheck finds anomalies with a query returning one task ID per
+// affected row, and fixes them with repair when that is safe.
+type auditCheck struct {
+	name        string
+	description string
+	find        string
+	repair      string
+	repairArgs  func(now time.Time) []interface{}
+}
+
+var auditChecks = []auditCheck{
+	{
+		name:        "negative_stage",
+		description: "tasks with a negative stage; they are read as stage 0, and repair stores 0",
+		find:        `SELECT id FROM tasks WHERE stage < 0`,
+		repair:      `UPDATE tasks SET stage = 0, version = version + 1 WHERE stage < 0`,
+	},
+	{
+		name:        "done_with_next_review",
+		description: "completed tasks that still have a next review time; repair clears it",
+		find:        `SELECT id FROM tasks WHERE completed_at IS NOT NULL AND next_review_at IS NOT NULL`,
+		repair:      `UPDATE tasks SET next_review_at = NULL, version = version + 1 WHERE completed_at IS NOT NULL AND next_review_at IS NOT NULL`,
+	},
+	{
+		name:        "open_without_next_review",
+		description: "unfinished tasks with no next review time, which always read as ready; repair makes them due now",
+		find:        `SELECT id FROM tasks WHERE completed_at IS NULL AND next_review_at IS NULL`,
+		repair:      `UPDATE tasks SET next_review_at = ?, version = version + 1 WHERE completed_at IS NULL AND next_review_at IS NULL`,
+		repairArgs:  func(now time.Time) []interface{} { return []interface{}{now} },
+	},
+	{
+		name:        "orphaned_history",
+		description: "history rows whose task no longer exists; repair deletes them",
+		find:        `SELECT task_id FROM reviews WHERE task_id NOT IN (SELECT id FROM tasks)`,
+		repair:      `DELETE FROM reviews WHERE task_id NOT IN (SELECT id FROM tasks)`,
+	},
+	{
+		name:        "orphaned_tags",
+		description: "tag rows whose task no longer exists; repair deletes them",
+		find:        `SELECT task_id FROM task_tags WHERE task_id NOT IN (SELECT id FROM tasks)`,
+		repair:      `DELETE FROM task_tags WHERE task_id NOT IN (SELECT id FROM tasks)`,
+	},
+	{
+		name:        "orphaned_images",
+		description: "images whose task no longer exists; repair deletes them",
+		find:        `SELECT task_id FROM task_assets WHERE task_id NOT IN (SELECT id FROM tasks)`,
+		repair:      `DELETE FROM task_assets WHERE task_id NOT IN (SELECT id FROM tasks)`,
+	},
+	{
+		name:        "orphaned_deck",
+		description: "tasks filed in a deck that no longer exists; repair unfiles them",
+		find:        `SELECT id FROM tasks WHERE deck_id IS NOT NULL AND deck_id NOT IN (SELECT id FROM decks)`,
+		repair:      `UPDATE tasks SET deck_id = NULL, version = version + 1 WHERE deck_id IS NOT NULL AND deck_id NOT IN (SELECT id FROM decks)`,
+	},
+}
+
+// Audit runs the consistency checks and, with repair, fixes the anomalies
+// that have a safe fix, all in one transaction. Counts describe the state
+// before any repair.
+func (s *Store) Audit(repair bool, now time.Time) ([]AuditFinding, error) {
+	tx, err := s.db.begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	out := make([]AuditFinding, 0, len(auditChecks)+1)
+	for _, check := range auditChecks {
+		ids, err := queryIDs(tx, check.find)
+		if err != nil {
+			return nil, err
+		}
+		f := newFinding(check.name, check.description, ids)
+		f.Repairable = true
+		if repair && f.Count > 0 {
+			var args []interface{}
+			if check.repairArgs != nil {
+				args = check.repairArgs(now)
+			}
+			res, err := tx.Exec(check.repair, args...)
+			if err != nil {
+				return nil, err
+			}
+			n, err := res.RowsAffected()
+			if err != nil {
+				return nil, err
+			}
+			f.Repaired = int(n)
+		}
+		out = append(out, f)
+	}
+
+	// Stage counts depend on task and tag schedules, so unfinished tasks
+	// past their last stage are found in Go rather than in SQL. They read
+	// as done already, and a schedule that shrank may grow again, so they
+	// are only reported. SM-2 tasks count repetitions in their stage and
+	// have no end.
+	// Rows that can't be read at all are ScanErrors' business.
+	ts, _, err := scanTasks(tx, `
+		SELECT `+taskColumns+`
+		FROM tasks
+		WHERE completed_at IS NULL AND stage > 0 AND scheduler = ?
+	`, string(tasks.SchedulerStages))
+	if err != nil {
+		return nil, err
+	}
+	if err := loadTags(tx, ts); err != nil {
+		return nil, err
+	}
+	if err := loadTagSchedules(tx, ts); err != nil {
+		return nil, err
+	}
+	var past []string
+	for _, t := range ts {
+		if t.Stage >= t.StageCount() {
+			past = append(past, t.ID)
+		}
+	}
+	out = append(out, newFinding("stage_past_end",
+		"unfinished tasks on or past the end of their schedule, which read as done; not repaired, since the schedule may grow again", past))
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func newFinding(check, description string, ids []string) AuditFinding {
+	f := AuditFinding{Check: check, Description: description, Count: len(ids), Sample: []string{}}
+	seen := map[string]bool{}
+	for _, id := range ids {
+		if len(f.Sample) == auditSampleSize {
+			break
+		}
+		if !seen[id] {
+			seen[id] = true
+			f.Sample = append(f.Sample, id)
+		}
+	}
+	return f
+}
+
+func queryIDs(q queryer, query string, args ...interface{}) ([]string, error) {
+	rows, err := q.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
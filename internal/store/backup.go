@@ -0,0 +1,450 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"yiwang/internal/tasks"
+)
+
+// Snapshot is the complete contents of the store, including deleted and
+// archived tasks, in a stable order: tasks by ID, reviews by ID, images by
+// task ID then side, tag schedules by tag, decks by ID, attachments by ID.
+// Attachments are only described; their files stay in the attachment
+// storage.
+type Snapshot struct {
+	Tasks        []SnapshotTask        `json:"tasks"`
+	Reviews      []SnapshotReview      `json:"reviews"`
+	Images       []SnapshotImage       `json:"images"`
+	TagSchedules []SnapshotTagSchedule `json:"tagSchedules,omitempty"`
+	Decks        []SnapshotDeck        `json:"decks,omitempty"`
+	Attachments  []SnapshotAttachment  `json:"attachments,omitempty"`
+}
+
+// SnapshotTask is one row of the tasks table plus its tags.
+type SnapshotTask struct {
+	ID           string     `json:"id"`
+	Question     string     `json:"question"`
+	Answer       string     `json:"answer"`
+	Stage        int        `json:"stage"`
+	Difficulty   string     `json:"difficulty"`
+	NextReviewAt *time.Time `json:"nextReviewAt"`
+	CreatedAt    time.Time  `json:"createdAt"`
+	UpdatedAt    time.Time  `json:"updatedAt"`
+	CompletedAt  *time.Time `json:"completedAt"`
+	DeletedAt    *time.Time `json:"deletedAt"`
+	ArchivedAt   *time.Time `json:"archivedAt"`
+	Tags         []string   `json:"tags"`
+	// Schedule is the task's own schedule, if any.
+	Schedule tasks.Schedule `json:"schedule,omitempty"`
+	// AnswerMatch is omitted for the default, exact.
+	AnswerMatch   string     `json:"answerMatch,omitempty"`
+	SuspendedAt   *time.Time `json:"suspendedAt,omitempty"`
+	SuspendReason string     `json:"suspendReason,omitempty"`
+	// Scheduler is omitted for the default, stages, and the SM-2 and
+	// FSRS state for tasks that never used them.
+	Scheduler       string     `json:"scheduler,omitempty"`
+	Ease            float64    `json:"ease,omitempty"`
+	IntervalSeconds int64      `json:"intervalSeconds,omitempty"`
+	Stability       float64    `json:"stability,omitempty"`
+	FSRSDifficulty  float64    `json:"fsrsDifficulty,omitempty"`
+	LastReviewedAt  *time.Time `json:"lastReviewedAt,omitempty"`
+	DeckID          string     `json:"deckId,omitempty"`
+	SiblingID       string     `json:"siblingId,omitempty"`
+	Lapses          int        `json:"lapses,omitempty"`
+	// Format and Type are omitted for the defaults, plain and basic.
+	Format string `json:"format,omitempty"`
+	Type   string `json:"type,omitempty"`
+	// Version is missing from backups made before tasks had one; those
+	// tasks restore at version 1.
+	Version int64 `json:"version,omitempty"`
+}
+
+// SnapshotReview is one row of the review history.
+type SnapshotReview struct {
+	ID               int64      `json:"id"`
+	TaskID           string     `json:"taskId"`
+	Result           string     `json:"result"`
+	StageBefore      int        `json:"stageBefore"`
+	StageAfter       int        `json:"stageAfter"`
+	ReviewedAt       time.Time  `json:"reviewedAt"`
+	Token            string     `json:"token,omitempty"`
+	PrevNextReviewAt *time.Time `json:"prevNextReviewAt"`
+	PrevCompletedAt  *time.Time `json:"prevCompletedAt"`
+	// Graduated is nil for rows written before completions were flagged.
+	Graduated *bool `json:"graduated,omitempty"`
+	// The previous ease is set for every task, and the rest of the SM-2
+	// and FSRS state for tasks using either.
+	PrevEase            *float64   `json:"prevEase,omitempty"`
+	PrevIntervalSeconds *int64     `json:"prevIntervalSeconds,omitempty"`
+	PrevStability       *float64   `json:"prevStability,omitempty"`
+	PrevFSRSDifficulty  *float64   `json:"prevFsrsDifficulty,omitempty"`
+	PrevLastReviewedAt  *time.Time `json:"prevLastReviewedAt,omitempty"`
+	// Grade is set for hard and easy reviews, whose Result is remembered.
+	Grade string `json:"grade,omitempty"`
+}
+
+// SnapshotImage is one task image.
+type SnapshotImage struct {
+	TaskID      string    `json:"taskId"`
+	Side        string    `json:"side"`
+	ContentType string    `json:"contentType"`
+	Data        []byte    `json:"data"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+}
+
+// SnapshotTagSchedule is one tag schedule.
+type SnapshotTagSchedule struct {
+	Tag       string         `json:"tag"`
+	Schedule  tasks.Schedule `json:"schedule"`
+	UpdatedAt time.Time      `json:"updatedAt"`
+}
+
+// SnapshotDeck is one deck.
+type SnapshotDeck struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// SnapshotAttachment is the record of one attached file.
+type SnapshotAttachment struct {
+	ID          string    `json:"id"`
+	TaskID      string    `json:"taskId"`
+	Filename    string    `json:"filename"`
+	ContentType string    `json:"contentType"`
+	Size        int64     `json:"size"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
+
+// Snapshot reads the whole store in one consistent, read-only transaction.
+func (s *Store) Snapshot(ctx context.Context) (*Snapshot, error) {
+	tx, err := s.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	snap := &Snapshot{
+		Tasks:   []SnapshotTask{},
+		Reviews: []SnapshotReview{},
+		Images:  []SnapshotImage{},
+	}
+
+	ts, err := queryTasks(tx, `SELECT `+taskColumns+` FROM tasks ORDER BY id`)
+	if err != nil {
+		return nil, fmt.Errorf("read tasks: %w", err)
+	}
+	for _, t := range ts {
+		st := SnapshotTask{
+			ID:            t.ID,
+			Question:      t.Question,
+			Answer:        t.Answer,
+			Stage:         t.Stage,
+			Difficulty:    string(t.Difficulty),
+			CreatedAt:     t.CreatedAt,
+			UpdatedAt:     t.UpdatedAt,
+			CompletedAt:   t.CompletedAt,
+			DeletedAt:     t.DeletedAt,
+			ArchivedAt:    t.ArchivedAt,
+			Tags:          t.Tags,
+			Schedule:      t.Schedule,
+			SuspendedAt:   t.SuspendedAt,
+			SuspendReason: t.SuspendReason,
+		}
+		if t.AnswerMatch != tasks.MatchExact {
+			st.AnswerMatch = string(t.AnswerMatch)
+		}
+		if t.Scheduler != tasks.SchedulerStages {
+			st.Scheduler = string(t.Scheduler)
+		}
+		if t.Format != tasks.FormatPlain {
+			st.Format = string(t.Format)
+		}
+		if t.Type != tasks.CardBasic {
+			st.Type = string(t.Type)
+		}
+		st.Ease = t.Ease
+		st.IntervalSeconds = int64(t.Interval / time.Second)
+		st.Stability = t.Stability
+		st.FSRSDifficulty = t.FSRSDifficulty
+		st.LastReviewedAt = t.LastReviewedAt
+		st.DeckID = t.DeckID
+		st.SiblingID = t.SiblingID
+		st.Lapses = t.Lapses
+		st.Version = t.Version
+		if !t.NextReviewAt.IsZero() {
+			next := t.NextReviewAt
+			st.NextReviewAt = &next
+		}
+		snap.Tasks = append(snap.Tasks, st)
+	}
+
+	rows, err := tx.QueryContext(ctx, `
+		SELECT id, task_id, result, stage_before, stage_after, reviewed_at, token, prev_next_review_at, prev_completed_at, graduated,
+			prev_ease, prev_interval_seconds, prev_stability, prev_fsrs_difficulty, prev_last_reviewed_at, grade
+		FROM reviews
+		ORDER BY id
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("read reviews: %w", err)
+	}
+	for rows.Next() {
+		var (
+			r                       SnapshotReview
+			token                   sql.NullString
+			prevNext, prevCompleted sql.NullTime
+			graduated               sql.NullBool
+			prev                    memoryState
+			grade                   sql.NullString
+		)
+		if err := rows.Scan(&r.ID, &r.TaskID, &r.Result, &r.StageBefore, &r.StageAfter, &r.ReviewedAt, &token, &prevNext, &prevCompleted, &graduated,
+			&prev.ease, &prev.interval, &prev.stability, &prev.difficulty, &prev.lastReview, &grade); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		r.Token = token.String
+		r.Grade = grade.String
+		r.PrevNextReviewAt = timePtr(prevNext)
+		r.PrevCompletedAt = timePtr(prevCompleted)
+		if graduated.Valid {
+			g := graduated.Bool
+			r.Graduated = &g
+		}
+		if prev.ease.Valid {
+			e := prev.ease.Float64
+			r.PrevEase = &e
+		}
+		if prev.interval.Valid {
+			ivl, st, d := prev.interval.Int64, prev.stability.Float64, prev.difficulty.Float64
+			r.PrevIntervalSeconds, r.PrevStability, r.PrevFSRSDifficulty = &ivl, &st, &d
+			r.PrevLastReviewedAt = timePtr(prev.lastReview)
+		}
+		snap.Reviews = append(snap.Reviews, r)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = tx.QueryContext(ctx, `
+		SELECT task_id, side, content_type, data, updated_at
+		FROM task_assets
+		ORDER BY task_id, side
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("read images: %w", err)
+	}
+	for rows.Next() {
+		var img SnapshotImage
+		if err := rows.Scan(&img.TaskID, &img.Side, &img.ContentType, &img.Data, &img.UpdatedAt); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		snap.Images = append(snap.Images, img)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = tx.QueryContext(ctx, `SELECT tag, schedule, updated_at FROM tag_schedules ORDER BY tag`)
+	if err != nil {
+		return nil, fmt.Errorf("read tag schedules: %w", err)
+	}
+	for rows.Next() {
+		var (
+			ts  SnapshotTagSchedule
+			raw string
+		)
+		if err := rows.Scan(&ts.Tag, &raw, &ts.UpdatedAt); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if ts.Schedule, err = tasks.ParseStoredSchedule(raw); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("tag %s: stored schedule: %w", ts.Tag, err)
+		}
+		snap.TagSchedules = append(snap.TagSchedules, ts)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = tx.QueryContext(ctx, `SELECT id, name, created_at, updated_at FROM decks ORDER BY id`)
+	if err != nil {
+		return nil, fmt.Errorf("read decks: %w", err)
+	}
+	for rows.Next() {
+		var d SnapshotDeck
+		if err := rows.Scan(&d.ID, &d.Name, &d.CreatedAt, &d.UpdatedAt); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		snap.Decks = append(snap.Decks, d)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = tx.QueryContext(ctx, `
+		SELECT id, task_id, filename, content_type, size, created_at
+		FROM attachments
+		ORDER BY id
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("read attachments: %w", err)
+	}
+	for rows.Next() {
+		var a SnapshotAttachment
+		if err := rows.Scan(&a.ID, &a.TaskID, &a.Filename, &a.ContentType, &a.Size, &a.CreatedAt); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		snap.Attachments = append(snap.Attachments, a)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return snap, tx.Commit()
+}
+
+// ReplaceAll swaps the entire contents of the store for snap in one
+// transaction; on any error nothing changes. The outbox is left alone and
+// no events are queued for the restored tasks.
+func (s *Store) ReplaceAll(ctx context.Context, snap *Snapshot) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, table := range []string{"task_assets", "attachments", "task_tags", "reviews", "tasks", "tag_schedules", "decks"} {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM `+table); err != nil {
+			return fmt.Errorf("clear %s: %w", table, err)
+		}
+	}
+
+	for _, d := range snap.Decks {
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO decks (id, name, created_at, updated_at) VALUES (?, ?, ?, ?)
+		`, d.ID, d.Name, d.CreatedAt, d.UpdatedAt); err != nil {
+			return fmt.Errorf("restore deck %s: %w", d.ID, err)
+		}
+	}
+	for _, t := range snap.Tasks {
+		match, err := tasks.ParseMatch(t.AnswerMatch)
+		if err != nil {
+			return fmt.Errorf("restore task %s: %w", t.ID, err)
+		}
+		format, err := tasks.ParseFormat(t.Format)
+		if err != nil {
+			return fmt.Errorf("restore task %s: %w", t.ID, err)
+		}
+		cardType, err := tasks.ParseCardType(t.Type)
+		if err != nil {
+			return fmt.Errorf("restore task %s: %w", t.ID, err)
+		}
+		scheduler := tasks.SchedulerStages
+		if t.Scheduler != "" {
+			if scheduler, err = tasks.ParseScheduler(t.Scheduler); err != nil {
+				return fmt.Errorf("restore task %s: %w", t.ID, err)
+			}
+		}
+		version := max(t.Version, 1)
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO tasks (id, question, answer, stage, next_review_at, created_at, updated_at, completed_at, deleted_at, difficulty, archived_at, schedule, answer_match, suspended_at, suspend_reason,
+				scheduler, ease, interval_seconds, stability, fsrs_difficulty, last_reviewed_at, deck_id, format, card_type, sibling_id, lapses, version)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		`, t.ID, t.Question, t.Answer, t.Stage, nullTimePtr(t.NextReviewAt), t.CreatedAt, t.UpdatedAt,
+			nullTimePtr(t.CompletedAt), nullTimePtr(t.DeletedAt), t.Difficulty, nullTimePtr(t.ArchivedAt), nullSchedule(t.Schedule),
+			match, nullTimePtr(t.SuspendedAt), sql.NullString{String: t.SuspendReason, Valid: t.SuspendReason != ""},
+			string(scheduler), t.Ease, t.IntervalSeconds, t.Stability, t.FSRSDifficulty, nullTimePtr(t.LastReviewedAt),
+			nullString(t.DeckID), string(format), string(cardType), nullString(t.SiblingID), t.Lapses, version); err != nil {
+			return fmt.Errorf("restore task %s: %w", t.ID, err)
+		}
+		if err := setTags(tx, t.ID, t.Tags); err != nil {
+			return fmt.Errorf("restore tags of %s: %w", t.ID, err)
+		}
+	}
+	for _, r := range snap.Reviews {
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO reviews (id, task_id, result, stage_before, stage_after, reviewed_at, token, prev_next_review_at, prev_completed_at, graduated,
+				prev_ease, prev_interval_seconds, prev_stability, prev_fsrs_difficulty, prev_last_reviewed_at, grade)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		`, r.ID, r.TaskID, r.Result, r.StageBefore, r.StageAfter, r.ReviewedAt,
+			sql.NullString{String: r.Token, Valid: r.Token != ""}, nullTimePtr(r.PrevNextReviewAt), nullTimePtr(r.PrevCompletedAt),
+			nullBoolPtr(r.Graduated), nullFloatPtr(r.PrevEase), nullInt64Ptr(r.PrevIntervalSeconds),
+			nullFloatPtr(r.PrevStability), nullFloatPtr(r.PrevFSRSDifficulty), nullTimePtr(r.PrevLastReviewedAt), nullString(r.Grade)); err != nil {
+			return fmt.Errorf("restore review %d: %w", r.ID, err)
+		}
+	}
+	if s.dialect.resetSequence != "" {
+		if _, err := tx.ExecContext(ctx, fmt.Sprintf(s.dialect.resetSequence, "reviews")); err != nil {
+			return fmt.Errorf("reset review IDs: %w", err)
+		}
+	}
+	for _, img := range snap.Images {
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO task_assets (task_id, side, content_type, data, updated_at)
+			VALUES (?, ?, ?, ?, ?)
+		`, img.TaskID, img.Side, img.ContentType, img.Data, img.UpdatedAt); err != nil {
+			return fmt.Errorf("restore image of %s: %w", img.TaskID, err)
+		}
+	}
+	for _, a := range snap.Attachments {
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO attachments (id, task_id, filename, content_type, size, created_at)
+			VALUES (?, ?, ?, ?, ?, ?)
+		`, a.ID, a.TaskID, a.Filename, a.ContentType, a.Size, a.CreatedAt); err != nil {
+			return fmt.Errorf("restore attachment %s: %w", a.ID, err)
+		}
+	}
+	for _, ts := range snap.TagSchedules {
+		if err := ts.Schedule.Validate(); err != nil {
+			return fmt.Errorf("restore schedule of tag %s: %w", ts.Tag, err)
+		}
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO tag_schedules (tag, schedule, updated_at) VALUES (?, ?, ?)
+		`, ts.Tag, ts.Schedule.String(), ts.UpdatedAt); err != nil {
+			return fmt.Errorf("restore schedule of tag %s: %w", ts.Tag, err)
+		}
+	}
+	return tx.Commit()
+}
+
+func nullBoolPtr(b *bool) sql.NullBool {
+	if b == nil {
+		return sql.NullBool{}
+	}
+	return sql.NullBool{Bool: *b, Valid: true}
+}
+
+func nullFloatPtr(f *float64) sql.NullFloat64 {
+	if f == nil {
+		return sql.NullFloat64{}
+	}
+	return sql.NullFloat64{Float64: *f, Valid: true}
+}
+
+func nullInt64Ptr(n *int64) sql.NullInt64 {
+	if n == nil {
+		return sql.NullInt64{}
+	}
+	return sql.NullInt64{Int64: *n, Valid: true}
+}
+
+func timePtr(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	v := t.Time
+	return &v
+}
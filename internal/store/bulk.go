@@ -0,0 +1,141 @@
+package store
+
+import (
+	"time"
+
+	"yiwang/internal/events"
+	"yiwang/internal/tasks"
+)
+
+// Reset moves every task matching f back to the first stage in one
+// transaction, recording a history row per task. It returns the tasks it
+// reset.
+func (s *Store) Reset(f Filter, now time.Time) ([]*tasks.Task, error) {
+	where, args, err := f.where(now)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := s.db.begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	ts, err := queryTasks(tx, `
+		SELECT `+taskColumns+`
+		FROM tasks
+		WHERE `+where+`
+	`+s.dialect.forUpdate, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, t := range ts {
+		before := *t
+		t.Reset(now)
+		if err := saveProgress(tx, t); err != nil {
+			return nil, err
+		}
+		if err := recordReview(tx, ResultReset, "", &before, t, now); err != nil {
+			return nil, err
+		}
+		if err := s.enqueue(tx, events.TaskUpdated, t, "", now); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return ts, nil
+}
+
+// ReviewAll applies outcome to every ready task matching f in one
+// transaction, as if each had been reviewed at now, and returns them.
+// f.Status is ignored: only ready tasks are reviewed.
+func (s *Store) ReviewAll(f Filter, outcome tasks.Outcome, now time.Time) ([]*tasks.Task, error) {
+	f.Status = "ready"
+	where, args, err := f.where(now)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := s.db.begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	ts, err := queryTasks(tx, `
+		SELECT `+taskColumns+`
+		FROM tasks
+		WHERE `+where+`
+	`+s.dialect.forUpdate, args...)
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range ts {
+		if err := s.applyReview(tx, t, outcome, "", now); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return ts, nil
+}
+
+// DeleteMatching soft-deletes every task matching f with one statement, as
+// Delete does one, and returns their IDs.
+func (s *Store) DeleteMatching(f Filter, now time.Time) ([]string, error) {
+	where, args, err := f.where(now)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := s.db.begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// Locking the matches first keeps the UPDATE to the rows whose
+	// deletion is announced.
+	rows, err := tx.Query(`SELECT id FROM tasks WHERE `+where+s.dialect.forUpdate, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	ids := []string{}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+	if len(ids) == 0 {
+		return ids, nil
+	}
+	if _, err := tx.Exec(`
+		UPDATE tasks
+		SET deleted_at = ?, updated_at = ?, version = version + 1
+		WHERE `+where, append([]interface{}{now, now}, args...)...); err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		if err := s.enqueueEvent(tx, events.Event{Kind: events.TaskDeleted, TaskID: id, At: now}); err != nil {
+			return nil, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
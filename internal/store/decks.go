@@ -0,0 +1,180 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"yiwang/internal/tasks"
+)
+
+var (
+	ErrDeckNotFound = errors.New("deck not found")
+	ErrDeckExists   = errors.New("a deck with that name already exists")
+)
+
+// Deck is a deck with the number of active tasks filed in it.
+type Deck struct {
+	tasks.Deck
+	Tasks int
+}
+
+const deckQuery = `
+	SELECT d.id, d.name, d.created_at, d.updated_at, COUNT(t.id)
+	FROM decks d
+	LEFT JOIN tasks t ON t.deck_id = d.id AND t.deleted_at IS NULL AND t.archived_at IS NULL
+`
+
+// Decks returns every deck, ordered by name.
+func (s *Store) Decks() ([]Deck, error) {
+	rows, err := s.db.Query(deckQuery + `
+		GROUP BY d.id, d.name, d.created_at, d.updated_at
+		ORDER BY d.name, d.id
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []Deck{}
+	for rows.Next() {
+		var d Deck
+		if err := rows.Scan(&d.ID, &d.Name, &d.CreatedAt, &d.UpdatedAt, &d.Tasks); err != nil {
+			return nil, err
+		}
+		out = append(out, d)
+	}
+	return out, rows.Err()
+}
+
+// Deck returns a deck by ID.
+func (s *Store) Deck(id string) (Deck, error) {
+	var d Deck
+	err := s.db.QueryRow(deckQuery+`
+		WHERE d.id = ?
+		GROUP BY d.id, d.name, d.created_at, d.updated_at
+	`, id).Scan(&d.ID, &d.Name, &d.CreatedAt, &d.UpdatedAt, &d.Tasks)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Deck{}, ErrDeckNotFound
+	}
+	return d, err
+}
+
+// CreateDeck adds an empty deck. Names are unique regardless of case.
+func (s *Store) CreateDeck(name string, now time.Time) (Deck, error) {
+	d, err := tasks.NewDeck(name, now)
+	if err != nil {
+		return Deck{}, err
+	}
+	tx, err := s.db.begin()
+	if err != nil {
+		return Deck{}, err
+	}
+	defer tx.Rollback()
+
+	if err := checkDeckName(tx, d.Name, ""); err != nil {
+		return Deck{}, err
+	}
+	if _, err := tx.Exec(`
+		INSERT INTO decks (id, name, created_at, updated_at) VALUES (?, ?, ?, ?)
+	`, d.ID, d.Name, d.CreatedAt, d.UpdatedAt); err != nil {
+		return Deck{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return Deck{}, err
+	}
+	return Deck{Deck: *d}, nil
+}
+
+// RenameDeck gives a deck a new name.
+func (s *Store) RenameDeck(id, name string, now time.Time) (Deck, error) {
+	name, err := tasks.NormalizeDeckName(name)
+	if err != nil {
+		return Deck{}, err
+	}
+	tx, err := s.db.begin()
+	if err != nil {
+		return Deck{}, err
+	}
+	defer tx.Rollback()
+
+	if err := checkDeckName(tx, name, id); err != nil {
+		return Deck{}, err
+	}
+	res, err := tx.Exec(`UPDATE decks SET name = ?, updated_at = ? WHERE id = ?`, name, now, id)
+	if err != nil {
+		return Deck{}, err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return Deck{}, err
+	} else if n == 0 {
+		return Deck{}, ErrDeckNotFound
+	}
+	if err := tx.Commit(); err != nil {
+		return Deck{}, err
+	}
+	return s.Deck(id)
+}
+
+// DeleteDeck removes a deck. Its tasks are kept and become unfiled.
+func (s *Store) DeleteDeck(id string, now time.Time) error {
+	tx, err := s.db.begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(`DELETE FROM decks WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrDeckNotFound
+	}
+	if _, err := tx.Exec(`UPDATE tasks SET deck_id = NULL, updated_at = ?, version = version + 1 WHERE deck_id = ?`, now, id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// checkDeck returns ErrDeckNotFound unless id is empty or names a deck.
+func checkDeck(q queryer, id string) error {
+	if id == "" {
+		return nil
+	}
+	var n int
+	if err := q.QueryRow(`SELECT COUNT(*) FROM decks WHERE id = ?`, id).Scan(&n); err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrDeckNotFound
+	}
+	return nil
+}
+
+// checkDeckName returns ErrDeckExists if a deck other than except already
+// has name, ignoring case. Names are compared in Go, since SQLite's LOWER
+// only folds ASCII.
+func checkDeckName(q queryer, name, except string) error {
+	rows, err := q.Query(`SELECT id, name FROM decks`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id, other string
+		if err := rows.Scan(&id, &other); err != nil {
+			return err
+		}
+		if id != except && strings.EqualFold(other, name) {
+			return ErrDeckExists
+		}
+	}
+	return rows.Err()
+}
+
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
@@ -0,0 +1,123 @@
+package store
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Drivers accepted in Options.Driver.
+const (
+	DriverMySQL    = "mysql"
+	DriverSQLite   = "sqlite"
+	DriverPostgres = "postgres"
+)
+
+// dialect holds the few pieces of SQL that differ between backends. The
+// queries themselves are written to run unchanged on all of them, and the
+// schema is written for MySQL and translated by ddl.
+type dialect struct {
+	name string
+	// driver is the database/sql driver name.
+	driver string
+	// types rewrites MySQL column types and table options in DDL.
+	types *strings.Replacer
+	// forUpdate locks the rows a SELECT reads until the transaction ends.
+	// SQLite locks the whole database per write transaction instead.
+	forUpdate string
+	// columnExists and indexExists count the columns or indexes of a
+	// table, given the table and column or index name.
+	columnExists string
+	indexExists  string
+	// fullText reports support for FULLTEXT indexes and MATCH ... AGAINST;
+	// the other dialects search with LIKE.
+	fullText bool
+	// resetSequence, when set, moves the ID sequence of a table past its
+	// largest ID after rows were inserted with explicit IDs.
+	resetSequence string
+}
+
+var dialects = map[string]dialect{
+	DriverMySQL: {
+		name:      DriverMySQL,
+		driver:    "mysql",
+		types:     strings.NewReplacer(),
+		forUpdate: " FOR UPDATE",
+		fullText:  true,
+		columnExists: `
+			SELECT COUNT(*)
+			FROM information_schema.COLUMNS
+			WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? AND COLUMN_NAME = ?
+		`,
+		indexExists: `
+			SELECT COUNT(*)
+			FROM information_schema.STATISTICS
+			WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? AND INDEX_NAME = ?
+		`,
+	},
+	DriverSQLite: {
+		name:   DriverSQLite,
+		driver: "sqlite-utc",
+		types: strings.NewReplacer(
+			"BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY", "INTEGER PRIMARY KEY AUTOINCREMENT",
+			"MEDIUMBLOB", "BLOB",
+			" ENGINE=InnoDB DEFAULT CHARSET=utf8mb4", "",
+		),
+		columnExists: `SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?`,
+		indexExists:  `SELECT COUNT(*) FROM sqlite_master WHERE type = 'index' AND tbl_name = ? AND name = ?`,
+	},
+	DriverPostgres: {
+		name:   DriverPostgres,
+		driver: "pgx-rebind",
+		types: strings.NewReplacer(
+			"BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY", "BIGSERIAL PRIMARY KEY",
+			"MEDIUMBLOB", "BYTEA",
+			"DATETIME", "TIMESTAMPTZ",
+			" ENGINE=InnoDB DEFAULT CHARSET=utf8mb4", "",
+		),
+		forUpdate: " FOR UPDATE",
+		columnExists: `
+			SELECT COUNT(*)
+			FROM information_schema.columns
+			WHERE table_schema = current_schema() AND table_name = ? AND column_name = ?
+		`,
+		indexExists: `
+			SELECT COUNT(*)
+			FROM pg_indexes
+			WHERE schemaname = current_schema() AND tablename = ? AND indexname = ?
+		`,
+		resetSequence: `SELECT setval(pg_get_serial_sequence('%[1]s', 'id'), COALESCE((SELECT MAX(id) FROM %[1]s), 0) + 1, false)`,
+	},
+}
+
+func lookupDialect(name string) (dialect, error) {
+	if name == "" {
+		name = DriverMySQL
+	}
+	d, ok := dialects[name]
+	if !ok {
+		return dialect{}, fmt.Errorf("unknown driver %q: want mysql, sqlite, or postgres", name)
+	}
+	return d, nil
+}
+
+// DriverFor guesses the driver from a DSN: postgres:// and postgresql://
+// URLs are Postgres, anything else MySQL. SQLite has to be asked for.
+func DriverFor(dsn string) string {
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		return DriverPostgres
+	}
+	return DriverMySQL
+}
+
+// ddl translates a MySQL schema statement for the dialect.
+func (d dialect) ddl(stmt string) string {
+	return d.types.Replace(stmt)
+}
+
+// dataSource completes dsn for the dialect's driver.
+func (d dialect) dataSource(dsn string) string {
+	if d.name != DriverSQLite || strings.Contains(dsn, "?") {
+		return dsn
+	}
+	return dsn + "?" + sqliteDefaults
+}
@@ -0,0 +1,60 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+
+	"yiwang/internal/tasks"
+)
+
+// exportBatch is how many tasks EachTask reads per query.
+const exportBatch = 500
+
+// EachTask calls fn with every task that isn't deleted, archived ones
+// included, oldest first and with related data loaded. Tasks are read a
+// batch at a time, continuing after the last one seen, so memory stays
+// bounded however many there are. Unreadable rows are logged and skipped,
+// as in All. It stops at the first error from fn or ctx.
+func (s *Store) EachTask(ctx context.Context, fn func(*tasks.Task) error) error {
+	var last *tasks.Task
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		where, args := "deleted_at IS NULL", []interface{}{}
+		if last != nil {
+			where += " AND (created_at > ? OR (created_at = ? AND id > ?))"
+			args = append(args, last.CreatedAt, last.CreatedAt, last.ID)
+		}
+		ts, bad, err := scanTasks(s.db, `
+			SELECT `+taskColumns+`
+			FROM tasks
+			WHERE `+where+`
+			ORDER BY created_at, id
+			LIMIT ?
+		`, append(args, exportBatch)...)
+		if err != nil {
+			return err
+		}
+		for _, e := range bad {
+			slog.WarnContext(ctx, "store: skipping unreadable task", "err", e)
+		}
+		if len(ts) == 0 && len(bad) == exportBatch {
+			// Nothing to continue after: a whole batch is unreadable.
+			return errors.New("store: too many unreadable tasks to export")
+		}
+		if err := loadRelated(s.db, ts); err != nil {
+			return err
+		}
+		for _, t := range ts {
+			if err := fn(t); err != nil {
+				return err
+			}
+		}
+		if len(ts)+len(bad) < exportBatch {
+			return nil
+		}
+		last = ts[len(ts)-1]
+	}
+}
@@ -0,0 +1,115 @@
+package store
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"yiwang/internal/tasks"
+)
+
+var ErrInvalidFilter = errors.New("status must be one of all, ready, pending, done, suspended, archived")
+
+// Filter selects a set of active tasks, or of archived ones with Status
+// "archived"; deleted tasks never match. Empty fields don't constrain the
+// selection, so the zero Filter matches every active task.
+type Filter struct {
+	IDs    []string
+	Status string
+	Tag    string
+	Deck   string
+	// Leech keeps only tasks tagged tasks.LeechTag.
+	Leech bool
+}
+
+// IsEmpty reports whether the filter would match every active task.
+func (f Filter) IsEmpty() bool {
+	return len(f.IDs) == 0 && (f.Status == "" || f.Status == "all") && f.Tag == "" && f.Deck == "" && !f.Leech
+}
+
+// where renders the filter as a condition on the tasks table, evaluating
+// status relative to now.
+func (f Filter) where(now time.Time) (string, []interface{}, error) {
+	return f.render(now, false)
+}
+
+// listWhere is where for listings, which also accept Status "deleted" for
+// soft-deleted tasks. Bulk actions use where, so they never touch those.
+func (f Filter) listWhere(now time.Time) (string, []interface{}, error) {
+	return f.render(now, true)
+}
+
+// effectiveSchedule is the stored form of the schedule a task follows:
+// its own, else that of its alphabetically first tag with one, as
+// loadTagSchedules resolves it, else NULL for the default.
+const effectiveSchedule = `COALESCE(NULLIF(tasks.schedule, ''), (
+	SELECT ts.schedule FROM task_tags tt JOIN tag_schedules ts ON ts.tag = tt.tag
+	WHERE tt.task_id = tasks.id ORDER BY tt.tag LIMIT 1))`
+
+// pastEnd matches stages tasks on or past the end of their schedule,
+// which Task.Status reads as done even without completed_at. Stored
+// schedules are comma-separated, so the commas count the stages. It takes
+// the default schedule's length as its one argument.
+const pastEnd = `(scheduler = '` + string(tasks.SchedulerStages) + `' AND stage >= COALESCE(
+	LENGTH(` + effectiveSchedule + `) - LENGTH(REPLACE(` + effectiveSchedule + `, ',', '')) + 1, ?))`
+
+// render matches statuses as Task.Status assigns them, so filtered
+// queries and bulk actions agree with the status the API reports.
+func (f Filter) render(now time.Time, allowDeleted bool) (string, []interface{}, error) {
+	deleted := allowDeleted && f.Status == "deleted"
+	conds := []string{"deleted_at IS NULL"}
+	if deleted {
+		conds = []string{"deleted_at IS NOT NULL"}
+	}
+	var args []interface{}
+
+	if len(f.IDs) > 0 {
+		conds = append(conds, "id IN ("+placeholders(len(f.IDs))+")")
+		for _, id := range f.IDs {
+			args = append(args, id)
+		}
+	}
+
+	switch {
+	case deleted:
+	case f.Status == "archived":
+		conds = append(conds, "archived_at IS NOT NULL")
+	default:
+		conds = append(conds, "archived_at IS NULL")
+	}
+	switch f.Status {
+	case "", "all", "archived":
+	case "deleted":
+		if !deleted {
+			return "", nil, ErrInvalidFilter
+		}
+	case "ready":
+		conds = append(conds, "suspended_at IS NULL AND completed_at IS NULL AND NOT "+pastEnd+
+			" AND (next_review_at IS NULL OR next_review_at <= ?)")
+		args = append(args, tasks.TotalStages(), now)
+	case "pending":
+		conds = append(conds, "suspended_at IS NULL AND completed_at IS NULL AND NOT "+pastEnd+" AND next_review_at > ?")
+		args = append(args, tasks.TotalStages(), now)
+	case "done":
+		conds = append(conds, "suspended_at IS NULL AND (completed_at IS NOT NULL OR "+pastEnd+")")
+		args = append(args, tasks.TotalStages())
+	case "suspended":
+		conds = append(conds, "suspended_at IS NOT NULL")
+	default:
+		return "", nil, ErrInvalidFilter
+	}
+
+	if f.Tag != "" {
+		conds = append(conds, "id IN (SELECT task_id FROM task_tags WHERE tag = ?)")
+		args = append(args, f.Tag)
+	}
+	if f.Deck != "" {
+		conds = append(conds, "deck_id = ?")
+		args = append(args, f.Deck)
+	}
+	if f.Leech {
+		conds = append(conds, "id IN (SELECT task_id FROM task_tags WHERE tag = ?)")
+		args = append(args, tasks.LeechTag)
+	}
+	return strings.Join(conds, " AND "), args, nil
+}
@@ -0,0 +1,184 @@
+package store
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"time"
+)
+
+var (
+	ErrAPIKeyNotFound = errors.New("api key not found")
+	ErrAdminExists    = errors.New("an admin already exists")
+)
+
+// apiKeyPrefix starts every key, so a leaked one is easy to recognize.
+const apiKeyPrefix = "yw_"
+
+// APIKey is a key scripts authenticate with. Only a hash of the secret is
+// stored; Prefix, the start of the secret, tells keys apart in listings.
+type APIKey struct {
+	ID         string
+	Name       string
+	Prefix     string
+	CreatedAt  time.Time
+	LastUsedAt *time.Time
+	// Role is RoleAdmin or RoleUser.
+	Role string
+}
+
+// CreateAPIKey mints a key named name with role and returns it with its
+// secret, which can't be recovered later.
+func (s *Store) CreateAPIKey(name, role string, now time.Time) (APIKey, string, error) {
+	return insertAPIKey(s.db, name, role, now)
+}
+
+// CreateFirstAPIKey mints the admin key that bootstraps a store without
+// an admin, or fails with ErrAdminExists once a user or key is an admin.
+// The check and the insert happen in a transaction that holds the
+// api_key_bootstrap row, so concurrent calls hand out one admin key, not
+// several.
+func (s *Store) CreateFirstAPIKey(name string, now time.Time) (APIKey, string, error) {
+	tx, err := s.db.begin()
+	if err != nil {
+		return APIKey{}, "", err
+	}
+	defer tx.Rollback()
+
+	var lock int
+	if err := tx.QueryRow(`SELECT id FROM api_key_bootstrap WHERE id = 1` + s.dialect.forUpdate).Scan(&lock); err != nil {
+		return APIKey{}, "", err
+	}
+	admin, err := hasAdmin(tx)
+	if err != nil {
+		return APIKey{}, "", err
+	}
+	if admin {
+		return APIKey{}, "", ErrAdminExists
+	}
+	k, key, err := insertAPIKey(tx, name, RoleAdmin, now)
+	if err != nil {
+		return APIKey{}, "", err
+	}
+	return k, key, tx.Commit()
+}
+
+func insertAPIKey(q queryer, name, role string, now time.Time) (APIKey, string, error) {
+	var id [12]byte
+	var secret [24]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		return APIKey{}, "", err
+	}
+	if _, err := rand.Read(secret[:]); err != nil {
+		return APIKey{}, "", err
+	}
+	key := apiKeyPrefix + hex.EncodeToString(secret[:])
+	k := APIKey{
+		ID:        hex.EncodeToString(id[:]),
+		Name:      name,
+		Prefix:    key[:len(apiKeyPrefix)+8],
+		CreatedAt: now,
+		Role:      role,
+	}
+	if _, err := q.Exec(`
+		INSERT INTO api_keys (id, name, prefix, key_hash, created_at, role) VALUES (?, ?, ?, ?, ?, ?)
+	`, k.ID, k.Name, k.Prefix, hashAPIKey(key), k.CreatedAt, k.Role); err != nil {
+		return APIKey{}, "", err
+	}
+	return k, key, nil
+}
+
+// AuthenticateAPIKey returns the key whose secret is key and records its
+// use, or ErrAPIKeyNotFound.
+func (s *Store) AuthenticateAPIKey(key string, now time.Time) (APIKey, error) {
+	var k APIKey
+	var used sql.NullTime
+	err := s.db.QueryRow(`
+		SELECT id, name, prefix, created_at, last_used_at, role FROM api_keys WHERE key_hash = ?
+	`, hashAPIKey(key)).Scan(&k.ID, &k.Name, &k.Prefix, &k.CreatedAt, &used, &k.Role)
+	if errors.Is(err, sql.ErrNoRows) {
+		return APIKey{}, ErrAPIKeyNotFound
+	}
+	if err != nil {
+		return APIKey{}, err
+	}
+	// Last use is kept to the minute, sparing a write on every request.
+	if !used.Valid || now.Sub(used.Time) >= time.Minute {
+		if _, err := s.db.Exec(`UPDATE api_keys SET last_used_at = ? WHERE id = ?`, now, k.ID); err != nil {
+			return APIKey{}, err
+		}
+		used = nullTime(now)
+	}
+	k.LastUsedAt = timePtr(used)
+	return k, nil
+}
+
+// APIKey returns a key by ID.
+func (s *Store) APIKey(id string) (APIKey, error) {
+	var k APIKey
+	var used sql.NullTime
+	err := s.db.QueryRow(`
+		SELECT id, name, prefix, created_at, last_used_at, role FROM api_keys WHERE id = ?
+	`, id).Scan(&k.ID, &k.Name, &k.Prefix, &k.CreatedAt, &used, &k.Role)
+	if errors.Is(err, sql.ErrNoRows) {
+		return APIKey{}, ErrAPIKeyNotFound
+	}
+	k.LastUsedAt = timePtr(used)
+	return k, err
+}
+
+// APIKeys returns every key, oldest first.
+func (s *Store) APIKeys() ([]APIKey, error) {
+	rows, err := s.db.Query(`
+		SELECT id, name, prefix, created_at, last_used_at, role FROM api_keys ORDER BY created_at, id
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []APIKey{}
+	for rows.Next() {
+		var k APIKey
+		var used sql.NullTime
+		if err := rows.Scan(&k.ID, &k.Name, &k.Prefix, &k.CreatedAt, &used, &k.Role); err != nil {
+			return nil, err
+		}
+		k.LastUsedAt = timePtr(used)
+		out = append(out, k)
+	}
+	return out, rows.Err()
+}
+
+// HasAdmin reports whether any user or API key is an admin.
+func (s *Store) HasAdmin() (bool, error) {
+	return hasAdmin(s.db)
+}
+
+func hasAdmin(q queryer) (bool, error) {
+	var n int
+	err := q.QueryRow(`
+		SELECT (SELECT COUNT(*) FROM users WHERE role = ?) + (SELECT COUNT(*) FROM api_keys WHERE role = ?)
+	`, RoleAdmin, RoleAdmin).Scan(&n)
+	return n > 0, err
+}
+
+// DeleteAPIKey revokes a key.
+func (s *Store) DeleteAPIKey(id string) error {
+	res, err := s.db.Exec(`DELETE FROM api_keys WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrAPIKeyNotFound
+	}
+	return nil
+}
+
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,34 @@
+package store
+
+import (
+	"slices"
+
+	"yiwang/internal/tasks"
+)
+
+// saveLeech stores what a lapse changed beyond the schedule when it made
+// t a leech: the leech tag and any suspension. Bulk reviews don't load
+// tags, so the tag row is checked rather than assumed missing.
+func saveLeech(q queryer, before, t *tasks.Task) error {
+	if slices.Contains(t.Tags, tasks.LeechTag) && !slices.Contains(before.Tags, tasks.LeechTag) {
+		var n int
+		if err := q.QueryRow(`
+			SELECT COUNT(*) FROM task_tags WHERE task_id = ? AND tag = ?
+		`, t.ID, tasks.LeechTag).Scan(&n); err != nil {
+			return err
+		}
+		if n == 0 {
+			if _, err := q.Exec(`INSERT INTO task_tags (task_id, tag) VALUES (?, ?)`, t.ID, tasks.LeechTag); err != nil {
+				return err
+			}
+		}
+	}
+	if t.SuspendedAt != nil && before.SuspendedAt == nil {
+		if _, err := q.Exec(`
+			UPDATE tasks SET suspended_at = ?, suspend_reason = ? WHERE id = ?
+		`, t.SuspendedAt, t.SuspendReason, t.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
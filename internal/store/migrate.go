@@ -0,0 +1,313 @@
+package store
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schema changes are versioned migrations, applied in order and recorded
+// in schema_migrations. Version 1 is the baseline: the schema as it stood
+// before migrations, which it brings any older database up to. Every later
+// change is a pair of files in migrations/, NNNN_name.up.sql and
+// NNNN_name.down.sql, written for MySQL like the rest of the schema and
+// translated for the other backends. Where a statement can't be
+// translated, NNNN_name.up.<driver>.sql or .down.<driver>.sql replaces the
+// file for that backend. Statements are separated by semicolons at the end
+// of a line.
+//
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+var (
+	ErrNoMigration  = errors.New("no applied migration to roll back")
+	ErrBaselineDown = errors.New("the baseline migration can't be rolled back")
+)
+
+const baselineVersion = 1
+
+var migrationName = regexp.MustCompile(`^(\d+)_([a-z0-9_]+)\.(up|down)(?:\.(mysql|sqlite|postgres))?\.sql$`)
+
+// Migration is one schema change and whether it has been applied.
+type Migration struct {
+	Version   int
+	Name      string
+	AppliedAt *time.Time
+}
+
+type migration struct {
+	version  int
+	name     string
+	up, down string
+}
+
+// migrations returns the dialect's migrations after the baseline, in
+// version order.
+func (d dialect) migrations() ([]migration, error) {
+	entries, err := fs.ReadDir(migrationFiles, "migrations")
+	if err != nil {
+		return nil, err
+	}
+	byVersion := map[int]*migration{}
+	// specific marks the files written for this dialect, which win over
+	// the generic ones whatever order they are read in.
+	specific := map[string]bool{}
+	for _, e := range entries {
+		m := migrationName.FindStringSubmatch(e.Name())
+		if m == nil {
+			return nil, fmt.Errorf("migration %s: name must be NNNN_name.up.sql or NNNN_name.down.sql", e.Name())
+		}
+		if m[4] != "" && m[4] != d.name {
+			continue
+		}
+		version, _ := strconv.Atoi(m[1])
+		if version <= baselineVersion {
+			return nil, fmt.Errorf("migration %s: versions start at %d", e.Name(), baselineVersion+1)
+		}
+		b, err := migrationFiles.ReadFile("migrations/" + e.Name())
+		if err != nil {
+			return nil, err
+		}
+		mig := byVersion[version]
+		if mig == nil {
+			mig = &migration{version: version, name: m[2]}
+			byVersion[version] = mig
+		} else if mig.name != m[2] {
+			return nil, fmt.Errorf("migration %d is both %s and %s", version, mig.name, m[2])
+		}
+		key := m[1] + "." + m[3]
+		if specific[key] && m[4] == "" {
+			continue
+		}
+		specific[key] = m[4] != ""
+		if m[3] == "up" {
+			mig.up = string(b)
+		} else {
+			mig.down = string(b)
+		}
+	}
+	out := make([]migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.up == "" || m.down == "" {
+			return nil, fmt.Errorf("migration %d_%s needs both an up and a down file", m.version, m.name)
+		}
+		out = append(out, *m)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].version < out[j].version })
+	return out, nil
+}
+
+// ensureMigrationTable creates the table recording applied migrations.
+func (s *Store) ensureMigrationTable() error {
+	if _, err := s.db.Exec(s.dialect.ddl(`
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INT NOT NULL PRIMARY KEY,
+			name VARCHAR(128) NOT NULL,
+			applied_at DATETIME NOT NULL
+		) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`)); err != nil {
+		return fmt.Errorf("create schema_migrations table: %w", err)
+	}
+	return nil
+}
+
+// applied returns when each applied migration was applied, by version.
+func (s *Store) applied() (map[int]time.Time, error) {
+	rows, err := s.db.Query(`SELECT version, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := map[int]time.Time{}
+	for rows.Next() {
+		var v int
+		var at time.Time
+		if err := rows.Scan(&v, &at); err != nil {
+			return nil, err
+		}
+		out[v] = at
+	}
+	return out, rows.Err()
+}
+
+// Migrations lists every migration this build knows, baseline first, with
+// when it was applied if it has been.
+func (s *Store) Migrations() ([]Migration, error) {
+	migs, err := s.dialect.migrations()
+	if err != nil {
+		return nil, err
+	}
+	applied, err := s.applied()
+	if err != nil {
+		return nil, err
+	}
+	out := []Migration{{Version: baselineVersion, Name: "baseline"}}
+	for _, m := range migs {
+		out = append(out, Migration{Version: m.version, Name: m.name})
+	}
+	for i := range out {
+		if at, ok := applied[out[i].Version]; ok {
+			out[i].AppliedAt = &at
+		}
+	}
+	return out, nil
+}
+
+// PendingMigrations counts the migrations not yet applied.
+func (s *Store) PendingMigrations() (int, error) {
+	all, err := s.Migrations()
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, m := range all {
+		if m.AppliedAt == nil {
+			n++
+		}
+	}
+	return n, nil
+}
+
+// MigrateUp applies every pending migration in version order and returns
+// those it applied. It stops at the first that fails. On MySQL, which
+// commits schema changes as it goes, a failed migration may be left half
+// done, so each should hold as few statements as it can.
+func (s *Store) MigrateUp(now time.Time) ([]Migration, error) {
+	migs, err := s.dialect.migrations()
+	if err != nil {
+		return nil, err
+	}
+	applied, err := s.applied()
+	if err != nil {
+		return nil, err
+	}
+	var done []Migration
+	if _, ok := applied[baselineVersion]; !ok {
+		if err := s.ensureTable(); err != nil {
+			return done, fmt.Errorf("migration %d_baseline: %w", baselineVersion, err)
+		}
+		if _, err := s.db.Exec(`
+			INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)
+		`, baselineVersion, "baseline", now); err != nil {
+			return done, err
+		}
+		done = append(done, Migration{Version: baselineVersion, Name: "baseline", AppliedAt: &now})
+	}
+	for _, m := range migs {
+		if _, ok := applied[m.version]; ok {
+			continue
+		}
+		if err := s.runMigration(m, m.up, func(tx *dbTx) error {
+			_, err := tx.Exec(`
+				INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)
+			`, m.version, m.name, now)
+			return err
+		}); err != nil {
+			return done, err
+		}
+		slog.Info("store: applied migration", "version", m.version, "name", m.name)
+		done = append(done, Migration{Version: m.version, Name: m.name, AppliedAt: &now})
+	}
+	for v := range applied {
+		if v > baselineVersion && !knownVersion(migs, v) {
+			slog.Warn("store: database has a migration this build doesn't know; it was migrated by a newer version", "version", v)
+		}
+	}
+	return done, nil
+}
+
+// MigrateDown rolls back the latest applied migration and returns it. The
+// baseline can't be rolled back.
+func (s *Store) MigrateDown() (Migration, error) {
+	migs, err := s.dialect.migrations()
+	if err != nil {
+		return Migration{}, err
+	}
+	applied, err := s.applied()
+	if err != nil {
+		return Migration{}, err
+	}
+	latest := 0
+	for v := range applied {
+		latest = max(latest, v)
+	}
+	switch {
+	case latest == 0:
+		return Migration{}, ErrNoMigration
+	case latest == baselineVersion:
+		return Migration{}, ErrBaselineDown
+	}
+	for _, m := range migs {
+		if m.version != latest {
+			continue
+		}
+		if err := s.runMigration(m, m.down, func(tx *dbTx) error {
+			_, err := tx.Exec(`DELETE FROM schema_migrations WHERE version = ?`, m.version)
+			return err
+		}); err != nil {
+			return Migration{}, err
+		}
+		slog.Info("store: rolled back migration", "version", m.version, "name", m.name)
+		return Migration{Version: m.version, Name: m.name}, nil
+	}
+	return Migration{}, fmt.Errorf("migration %d was applied by a newer version and can't be rolled back by this one", latest)
+}
+
+// runMigration runs the statements of one direction of m and then record,
+// in one transaction where the backend allows schema changes in one.
+func (s *Store) runMigration(m migration, script string, record func(*dbTx) error) error {
+	tx, err := s.db.begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, stmt := range splitStatements(script) {
+		if _, err := tx.Exec(s.dialect.ddl(stmt)); err != nil {
+			return fmt.Errorf("migration %d_%s: %w", m.version, m.name, err)
+		}
+	}
+	if err := record(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// splitStatements splits a migration script at semicolons ending a line,
+// dropping comment lines and empty statements.
+func splitStatements(script string) []string {
+	var out []string
+	var cur strings.Builder
+	for _, line := range strings.Split(script, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "--") {
+			continue
+		}
+		cur.WriteString(line)
+		cur.WriteString("\n")
+		if strings.HasSuffix(trimmed, ";") {
+			if stmt := strings.TrimSuffix(strings.TrimSpace(cur.String()), ";"); stmt != "" {
+				out = append(out, stmt)
+			}
+			cur.Reset()
+		}
+	}
+	if stmt := strings.TrimSpace(cur.String()); stmt != "" {
+		out = append(out, stmt)
+	}
+	return out
+}
+
+func knownVersion(migs []migration, v int) bool {
+	for _, m := range migs {
+		if m.version == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,2 @@
+-- Due-card queries and the forecast filter and sort on next_review_at.
+CREATE INDEX idx_tasks_next_review ON tasks (next_review_at);
@@ -0,0 +1,3 @@
+-- A task's version counts its changes, so an edit made against an old
+-- version can be refused instead of overwriting a newer one.
+ALTER TABLE tasks ADD COLUMN version BIGINT NOT NULL DEFAULT 1;
@@ -0,0 +1,26 @@
+-- Webhooks registered through the API, and one row per event each is
+-- sent, which is both the retry queue and the delivery log.
+CREATE TABLE IF NOT EXISTS webhooks (
+	id VARCHAR(24) NOT NULL PRIMARY KEY,
+	url VARCHAR(2048) NOT NULL,
+	secret VARCHAR(128) NOT NULL,
+	events VARCHAR(255) NOT NULL,
+	created_at DATETIME NOT NULL
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+	id BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+	webhook_id VARCHAR(24) NOT NULL,
+	kind VARCHAR(32) NOT NULL,
+	task_id VARCHAR(24) NOT NULL,
+	payload TEXT NOT NULL,
+	created_at DATETIME NOT NULL,
+	attempts INT NOT NULL DEFAULT 0,
+	next_attempt_at DATETIME NULL,
+	delivered_at DATETIME NULL,
+	status_code INT NULL,
+	last_error TEXT NULL
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE INDEX idx_webhook_deliveries_pending ON webhook_deliveries (next_attempt_at);
+CREATE INDEX idx_webhook_deliveries_webhook ON webhook_deliveries (webhook_id, id);
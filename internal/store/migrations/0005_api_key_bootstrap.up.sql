@@ -0,0 +1,7 @@
+-- A single row that minting the first API key locks, so two requests
+-- racing to bootstrap can't both be handed an admin key.
+CREATE TABLE IF NOT EXISTS api_key_bootstrap (
+	id INT NOT NULL PRIMARY KEY
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+INSERT INTO api_key_bootstrap (id) VALUES (1);
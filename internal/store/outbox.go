@@ -0,0 +1,104 @@
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"yiwang/internal/events"
+	"yiwang/internal/tasks"
+)
+
+// OutboxEntry is one lifecycle event waiting to be delivered to an external
+// integration. Payload is the JSON-encoded events.Event.
+type OutboxEntry struct {
+	ID       int64
+	Kind     events.Kind
+	TaskID   string
+	Payload  []byte
+	Attempts int
+}
+
+// enqueue writes an event about t to the outbox inside the caller's
+// transaction, so the event exists exactly when the change it describes was
+// committed.
+func (s *Store) enqueue(q queryer, kind events.Kind, t *tasks.Task, result string, at time.Time) error {
+	return s.enqueueEvent(q, events.Event{Kind: kind, TaskID: t.ID, Task: t, Result: result, At: at})
+}
+
+// enqueueEvent is enqueue for events without a task snapshot. Both do
+// nothing unless the store was opened with Options.Outbox.
+func (s *Store) enqueueEvent(q queryer, e events.Event) error {
+	if !s.opts.Outbox {
+		return nil
+	}
+	payload, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("encode outbox event: %w", err)
+	}
+	_, err = q.Exec(`
+		INSERT INTO outbox (kind, task_id, payload, created_at, attempts, next_attempt_at)
+		VALUES (?, ?, ?, ?, 0, ?)
+	`, string(e.Kind), e.TaskID, payload, e.At, e.At)
+	return err
+}
+
+// PendingOutbox returns up to limit undelivered entries whose next attempt
+// is due at now, oldest first.
+func (s *Store) PendingOutbox(now time.Time, limit int) ([]OutboxEntry, error) {
+	rows, err := s.db.Query(`
+		SELECT id, kind, task_id, payload, attempts
+		FROM outbox
+		WHERE sent_at IS NULL AND next_attempt_at <= ?
+		ORDER BY id
+		LIMIT ?
+	`, now, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []OutboxEntry{}
+	for rows.Next() {
+		var (
+			e    OutboxEntry
+			kind string
+		)
+		if err := rows.Scan(&e.ID, &kind, &e.TaskID, &e.Payload, &e.Attempts); err != nil {
+			return nil, err
+		}
+		e.Kind = events.Kind(kind)
+		out = append(out, e)
+	}
+	return out, rows.Err()
+}
+
+// MarkOutboxSent records a successful delivery.
+func (s *Store) MarkOutboxSent(id int64, now time.Time) error {
+	_, err := s.db.Exec(`
+		UPDATE outbox
+		SET sent_at = ?, attempts = attempts + 1, last_error = NULL
+		WHERE id = ?
+	`, now, id)
+	return err
+}
+
+// MarkOutboxFailed records a failed delivery and when to try again.
+func (s *Store) MarkOutboxFailed(id int64, retryAt time.Time, reason string) error {
+	_, err := s.db.Exec(`
+		UPDATE outbox
+		SET attempts = attempts + 1, next_attempt_at = ?, last_error = ?
+		WHERE id = ?
+	`, retryAt, reason, id)
+	return err
+}
+
+// PruneOutbox deletes entries delivered before cutoff and returns how many
+// were removed.
+func (s *Store) PruneOutbox(cutoff time.Time) (int64, error) {
+	res, err := s.db.Exec(`DELETE FROM outbox WHERE sent_at IS NOT NULL AND sent_at < ?`, cutoff)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,85 @@
+package store
+
+import (
+	"errors"
+	"log/slog"
+	"time"
+
+	"yiwang/internal/tasks"
+)
+
+var ErrInvalidSort = errors.New("sort must be one of next_review_at, created_at, stage")
+
+// sortColumns lists the columns a listing may be ordered by. Sort keys
+// are checked against it because they end up in the SQL text.
+var sortColumns = map[string]bool{
+	"next_review_at": true,
+	"created_at":     true,
+	"stage":          true,
+}
+
+// Page selects a window of a filtered task list and its order. Limit <= 0
+// returns every match from Offset 0. Sort defaults to created_at; ties are
+// broken by creation and then id so pages never overlap.
+type Page struct {
+	Limit  int
+	Offset int
+	Sort   string
+	Desc   bool
+}
+
+func (p Page) orderBy() (string, error) {
+	col := p.Sort
+	if col == "" {
+		col = "created_at"
+	}
+	if !sortColumns[col] {
+		return "", ErrInvalidSort
+	}
+	dir := ""
+	if p.Desc {
+		dir = " DESC"
+	}
+	order := col + dir
+	if col != "created_at" {
+		order += ", created_at" + dir
+	}
+	return order + ", id" + dir, nil
+}
+
+// ListPage returns one page of the tasks matching f, in p's order, and
+// how many match in all. Unreadable rows are logged and skipped, as in
+// All, and like All it reads from the replica when there is one. Unlike
+// the bulk actions, f.Status may be "deleted" to page through
+// soft-deleted tasks.
+func (s *Store) ListPage(f Filter, p Page, now time.Time) ([]*tasks.Task, int, error) {
+	where, args, err := f.listWhere(now)
+	if err != nil {
+		return nil, 0, err
+	}
+	order, err := p.orderBy()
+	if err != nil {
+		return nil, 0, err
+	}
+	var total int
+	if err := s.read.QueryRow(`SELECT COUNT(*) FROM tasks WHERE `+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+	query := `
+		SELECT ` + taskColumns + `
+		FROM tasks
+		WHERE ` + where + `
+		ORDER BY ` + order
+	if p.Limit > 0 {
+		query += ` LIMIT ? OFFSET ?`
+		args = append(args, p.Limit, p.Offset)
+	}
+	ts, bad, err := scanTasks(s.read, query, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	for _, e := range bad {
+		slog.WarnContext(s.read.ctx, "store: skipping unreadable task", "err", e)
+	}
+	return ts, total, loadRelated(s.read, ts)
+}
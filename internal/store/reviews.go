@@ -0,0 +1,420 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"log/slog"
+	"time"
+
+	"yiwang/internal/events"
+	"yiwang/internal/tasks"
+)
+
+// ErrNoReview is returned by ReclassifyLast and UndoLastReview when the
+// task's latest history entry isn't a review that can be reverted.
+var ErrNoReview = errors.New("task has no review to revert")
+
+// Results recorded in the reviews history table. Only remembered and forgot
+// are actual reviews; the rest log other schedule changes. Hard and easy
+// reviews are recorded as remembered, with the grade in its own column.
+const (
+	ResultRemembered = string(tasks.Remembered)
+	ResultForgot     = string(tasks.Forgot)
+	ResultReset      = "reset"
+	ResultScheduled  = "scheduled"
+)
+
+// recordReview appends one history row inside the caller's transaction,
+// describing the change from before to after. The schedule in before is
+// kept so the change can be reverted, and the row notes whether the change
+// completed the task, since schedules differ in length. Stage tasks also
+// keep their ease, and SM-2 and FSRS tasks their whole scheduler state.
+// token is the client's review token, or empty.
+func recordReview(tx *dbTx, result, token string, before, after *tasks.Task, at time.Time) error {
+	result, grade := splitGrade(result)
+	prev := memoryState{ease: sql.NullFloat64{Float64: before.Ease, Valid: true}}
+	if !before.Graduates() {
+		prev = memoryState{
+			ease:       sql.NullFloat64{Float64: before.Ease, Valid: true},
+			interval:   sql.NullInt64{Int64: int64(before.Interval / time.Second), Valid: true},
+			stability:  sql.NullFloat64{Float64: before.Stability, Valid: true},
+			difficulty: sql.NullFloat64{Float64: before.FSRSDifficulty, Valid: true},
+			lastReview: nullTimePtr(before.LastReviewedAt),
+		}
+	}
+	_, err := tx.Exec(`
+		INSERT INTO reviews (task_id, result, stage_before, stage_after, reviewed_at, token, prev_next_review_at, prev_completed_at, graduated,
+			prev_ease, prev_interval_seconds, prev_stability, prev_fsrs_difficulty, prev_last_reviewed_at, grade)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, after.ID, result, before.Stage, after.Stage, at, sql.NullString{String: token, Valid: token != ""},
+		nullTime(before.NextReviewAt), nullTimePtr(before.CompletedAt), graduated(before, after),
+		prev.ease, prev.interval, prev.stability, prev.difficulty, prev.lastReview, grade)
+	return err
+}
+
+// splitGrade turns a result into what the reviews table stores: hard and
+// easy become remembered, keeping the grade beside it, and every other
+// result has a NULL grade. joinGrade undoes it.
+func splitGrade(result string) (string, sql.NullString) {
+	switch tasks.Outcome(result) {
+	case tasks.Hard, tasks.Easy:
+		return ResultRemembered, sql.NullString{String: result, Valid: true}
+	}
+	return result, sql.NullString{}
+}
+
+func joinGrade(result string, grade sql.NullString) string {
+	if grade.Valid {
+		return grade.String
+	}
+	return result
+}
+
+// memoryState is the scheduler state a history row keeps: ease alone for
+// stage tasks, and all of it for SM-2 and FSRS. Rows from before stage
+// tasks had an ease keep none.
+type memoryState struct {
+	ease       sql.NullFloat64
+	interval   sql.NullInt64
+	stability  sql.NullFloat64
+	difficulty sql.NullFloat64
+	lastReview sql.NullTime
+}
+
+// restore puts the saved state back on t, if there is any.
+func (m memoryState) restore(t *tasks.Task) {
+	if !m.ease.Valid {
+		return
+	}
+	t.Ease = m.ease.Float64
+	if !m.interval.Valid {
+		return
+	}
+	t.Interval = time.Duration(m.interval.Int64) * time.Second
+	t.Stability = m.stability.Float64
+	t.FSRSDifficulty = m.difficulty.Float64
+	t.LastReviewedAt = timePtr(m.lastReview)
+}
+
+// graduated reports whether a change from before to after completed the
+// task.
+func graduated(before, after *tasks.Task) bool {
+	return before.CompletedAt == nil && after.CompletedAt != nil
+}
+
+// CountReviews returns how many reviews happened in [from, to).
+func (s *Store) CountReviews(from, to time.Time) (int, error) {
+	var n int
+	err := s.db.QueryRow(`
+		SELECT COUNT(*)
+		FROM reviews
+		WHERE result IN (?, ?) AND reviewed_at >= ? AND reviewed_at < ?
+	`, ResultRemembered, ResultForgot, from, to).Scan(&n)
+	return n, err
+}
+
+// ReviewTimes returns when each review in [from, to) happened. Callers
+// bucket the timestamps themselves, as with CreatedTimes.
+func (s *Store) ReviewTimes(from, to time.Time) ([]time.Time, error) {
+	rows, err := s.db.Query(`
+		SELECT reviewed_at
+		FROM reviews
+		WHERE result IN (?, ?) AND reviewed_at >= ? AND reviewed_at < ?
+	`, ResultRemembered, ResultForgot, from, to)
+	if err != nil {
+		return nil, err
+	}
+	return scanTimes(rows)
+}
+
+// ResultTimes returns when each review with result in [from, to)
+// happened, for result ResultRemembered or ResultForgot.
+func (s *Store) ResultTimes(result string, from, to time.Time) ([]time.Time, error) {
+	rows, err := s.db.Query(`
+		SELECT reviewed_at
+		FROM reviews
+		WHERE result = ? AND reviewed_at >= ? AND reviewed_at < ?
+	`, result, from, to)
+	if err != nil {
+		return nil, err
+	}
+	return scanTimes(rows)
+}
+
+// Due returns the active, unfinished, unsuspended tasks due at now, most
+// overdue first, at most limit of them when limit is positive. Tasks that
+// have passed their last stage without being marked complete are
+// included; Task.Status tells them apart. Like All, it leaves out rows
+// that can't be read.
+func (s *Store) Due(now time.Time, limit int) ([]*tasks.Task, error) {
+	query := `
+		SELECT ` + taskColumns + `
+		FROM tasks
+		WHERE next_review_at <= ? AND completed_at IS NULL
+			AND deleted_at IS NULL AND archived_at IS NULL AND suspended_at IS NULL
+		ORDER BY next_review_at, created_at, id`
+	args := []interface{}{now}
+	if limit > 0 {
+		query += ` LIMIT ?`
+		args = append(args, limit)
+	}
+	ts, bad, err := scanTasks(s.read, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range bad {
+		slog.WarnContext(s.read.ctx, "store: skipping unreadable task", "err", e)
+	}
+	return ts, loadRelated(s.read, ts)
+}
+
+// CountDue returns how many active, unfinished tasks are due at now.
+func (s *Store) CountDue(now time.Time) (int, error) {
+	var n int
+	err := s.db.QueryRow(`
+		SELECT COUNT(*)
+		FROM tasks
+		WHERE completed_at IS NULL AND deleted_at IS NULL AND archived_at IS NULL AND suspended_at IS NULL
+			AND next_review_at <= ?
+	`, now).Scan(&n)
+	return n, err
+}
+
+// DueIDs returns the IDs of the tasks CountDue counts, without loading
+// the tasks.
+func (s *Store) DueIDs(now time.Time) ([]string, error) {
+	rows, err := s.read.Query(`
+		SELECT id
+		FROM tasks
+		WHERE completed_at IS NULL AND deleted_at IS NULL AND archived_at IS NULL AND suspended_at IS NULL
+			AND next_review_at <= ?
+	`, now)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// ReclassifyLast changes the result of a task's latest review to outcome.
+// The review is reverted using the schedule saved with it, the corrected
+// outcome is applied as of the original review time, and the history row
+// is rewritten, all in one transaction. Only a review that is still the
+// task's latest history entry qualifies, so a later reset or reschedule
+// is never undone; otherwise the error is ErrNoReview.
+func (s *Store) ReclassifyLast(id string, outcome tasks.Outcome, now time.Time) (*tasks.Task, error) {
+	tx, err := s.db.begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	t, err := s.lockTask(tx, id)
+	if err != nil {
+		return nil, err
+	}
+	if t.ArchivedAt != nil {
+		return nil, tasks.ErrArchived
+	}
+	if t.SuspendedAt != nil {
+		return nil, tasks.ErrSuspended
+	}
+	if err := loadRelated(tx, []*tasks.Task{t}); err != nil {
+		return nil, err
+	}
+
+	last, err := latestReview(tx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if last.outcome() != outcome {
+		last.revert(t)
+		before := *t
+		if err := s.applyOutcome(t, outcome, last.reviewedAt); err != nil {
+			return nil, err
+		}
+		t.UpdatedAt = now
+
+		if err := saveProgress(tx, t); err != nil {
+			return nil, err
+		}
+		result, grade := splitGrade(string(outcome))
+		if _, err := tx.Exec(`
+			UPDATE reviews SET result = ?, grade = ?, stage_after = ?, graduated = ? WHERE id = ?
+		`, result, grade, t.Stage, graduated(&before, t), last.id); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := s.enqueue(tx, events.TaskUpdated, t, "", now); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// UndoLastReview takes back a task's latest review: the stage, schedule,
+// completion, and scheduler state saved with it are restored and the
+// history row is removed, all in one transaction. As with ReclassifyLast,
+// only a review that is still the task's latest history entry qualifies;
+// otherwise the error is ErrNoReview.
+func (s *Store) UndoLastReview(id string, now time.Time) (*tasks.Task, error) {
+	tx, err := s.db.begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	t, err := s.lockTask(tx, id)
+	if err != nil {
+		return nil, err
+	}
+	if t.ArchivedAt != nil {
+		return nil, tasks.ErrArchived
+	}
+	if t.SuspendedAt != nil {
+		return nil, tasks.ErrSuspended
+	}
+	if err := loadRelated(tx, []*tasks.Task{t}); err != nil {
+		return nil, err
+	}
+
+	last, err := latestReview(tx, id)
+	if err != nil {
+		return nil, err
+	}
+	last.revert(t)
+	t.UpdatedAt = now
+	if err := saveProgress(tx, t); err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec(`DELETE FROM reviews WHERE id = ?`, last.id); err != nil {
+		return nil, err
+	}
+
+	if err := s.enqueue(tx, events.TaskUpdated, t, "", now); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// savedReview is a task's latest history row with the schedule it
+// replaced.
+type savedReview struct {
+	id            int64
+	result        string
+	grade         sql.NullString
+	stageBefore   int
+	reviewedAt    time.Time
+	prevNext      sql.NullTime
+	prevCompleted sql.NullTime
+	prev          memoryState
+}
+
+// latestReview reads the task's latest history row, or ErrNoReview if
+// there is none or it isn't a review that can be reverted.
+func latestReview(tx *dbTx, id string) (savedReview, error) {
+	var r savedReview
+	err := tx.QueryRow(`
+		SELECT id, result, grade, stage_before, reviewed_at, prev_next_review_at, prev_completed_at,
+			prev_ease, prev_interval_seconds, prev_stability, prev_fsrs_difficulty, prev_last_reviewed_at
+		FROM reviews
+		WHERE task_id = ?
+		ORDER BY id DESC
+		LIMIT 1
+	`, id).Scan(&r.id, &r.result, &r.grade, &r.stageBefore, &r.reviewedAt, &r.prevNext, &r.prevCompleted,
+		&r.prev.ease, &r.prev.interval, &r.prev.stability, &r.prev.difficulty, &r.prev.lastReview)
+	if errors.Is(err, sql.ErrNoRows) {
+		return r, ErrNoReview
+	}
+	if err != nil {
+		return r, err
+	}
+	// Rows written before the previous schedule was kept have neither
+	// time and can't be reverted.
+	if (r.result != ResultRemembered && r.result != ResultForgot) || (!r.prevNext.Valid && !r.prevCompleted.Valid) {
+		return r, ErrNoReview
+	}
+	return r, nil
+}
+
+// outcome is the review's grade.
+func (r savedReview) outcome() tasks.Outcome {
+	return tasks.Outcome(joinGrade(r.result, r.grade))
+}
+
+// revert puts t back the way it was before the review.
+func (r savedReview) revert(t *tasks.Task) {
+	t.Stage = r.stageBefore
+	t.NextReviewAt = time.Time{}
+	if r.prevNext.Valid {
+		t.NextReviewAt = r.prevNext.Time
+	}
+	t.CompletedAt = nil
+	if r.prevCompleted.Valid {
+		c := r.prevCompleted.Time
+		t.CompletedAt = &c
+	}
+	r.prev.restore(t)
+	if r.result == ResultForgot && t.Lapses > 0 {
+		t.Lapses--
+	}
+}
+
+// CountStudied returns how many cards were reviewed for the first time
+// since from, and how many other reviews happened in that time.
+func (s *Store) CountStudied(from time.Time) (newCards, reviews int, err error) {
+	var total int
+	if err := s.db.QueryRow(`
+		SELECT COUNT(*)
+		FROM reviews
+		WHERE result IN (?, ?) AND reviewed_at >= ?
+	`, ResultRemembered, ResultForgot, from).Scan(&total); err != nil {
+		return 0, 0, err
+	}
+	if err := s.db.QueryRow(`
+		SELECT COUNT(*)
+		FROM (
+			SELECT task_id
+			FROM reviews
+			WHERE result IN (?, ?)
+			GROUP BY task_id
+			HAVING MIN(reviewed_at) >= ?
+		) first_reviews
+	`, ResultRemembered, ResultForgot, from).Scan(&newCards); err != nil {
+		return 0, 0, err
+	}
+	return newCards, total - newCards, nil
+}
+
+// StudiedIDs returns the set of tasks that have been reviewed at least
+// once; the rest are new cards.
+func (s *Store) StudiedIDs() (map[string]bool, error) {
+	ids, err := queryIDs(s.db, `
+		SELECT DISTINCT task_id
+		FROM reviews
+		WHERE result IN (?, ?)
+	`, ResultRemembered, ResultForgot)
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		out[id] = true
+	}
+	return out, nil
+}
@@ -0,0 +1,110 @@
+package store
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	mrand "math/rand/v2"
+	"time"
+
+	"yiwang/internal/tasks"
+)
+
+// RandomSample returns up to n tasks matching statusFilter (a Filter
+// status such as "all" or "ready") in random order.
+//
+// ORDER BY RAND() sorts the whole table, so instead each pick jumps to a
+// random point in the primary key: task IDs are random hex, so the first
+// ID at or after a random hex pivot is a near-uniform choice, found with
+// one index seek. When no more than n tasks match they are all returned,
+// shuffled.
+func (s *Store) RandomSample(n int, statusFilter string, now time.Time) ([]*tasks.Task, error) {
+	where, args, err := Filter{Status: statusFilter}.where(now)
+	if err != nil {
+		return nil, err
+	}
+	if n <= 0 {
+		return []*tasks.Task{}, nil
+	}
+
+	var total int
+	if err := s.db.QueryRow(`SELECT COUNT(*) FROM tasks WHERE `+where, args...).Scan(&total); err != nil {
+		return nil, err
+	}
+	if total <= n {
+		ts, err := queryTasks(s.db, `SELECT `+taskColumns+` FROM tasks WHERE `+where, args...)
+		if err != nil {
+			return nil, err
+		}
+		mrand.Shuffle(len(ts), func(i, j int) { ts[i], ts[j] = ts[j], ts[i] })
+		return ts, nil
+	}
+
+	// Two pivots can land in the same gap between IDs; a few spare
+	// attempts make up for the duplicates.
+	ids := make([]string, 0, n)
+	seen := make(map[string]bool, n)
+	for attempt := 0; len(ids) < n && attempt < 4*n; attempt++ {
+		pivot, err := randomPivot()
+		if err != nil {
+			return nil, err
+		}
+		id, err := s.firstIDFrom(where, args, pivot)
+		if err != nil {
+			return nil, err
+		}
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+
+	idArgs := make([]interface{}, len(ids))
+	for i, id := range ids {
+		idArgs[i] = id
+	}
+	ts, err := queryTasks(s.db, `
+		SELECT `+taskColumns+`
+		FROM tasks
+		WHERE id IN (`+placeholders(len(ids))+`)
+	`, idArgs...)
+	if err != nil {
+		return nil, err
+	}
+	// Put the tasks back in the order they were drawn.
+	byID := make(map[string]*tasks.Task, len(ts))
+	for _, t := range ts {
+		byID[t.ID] = t
+	}
+	out := make([]*tasks.Task, 0, len(ids))
+	for _, id := range ids {
+		if t := byID[id]; t != nil {
+			out = append(out, t)
+		}
+	}
+	return out, nil
+}
+
+// firstIDFrom returns the smallest matching ID at or after pivot, wrapping
+// around to the smallest matching ID overall.
+func (s *Store) firstIDFrom(where string, args []interface{}, pivot string) (string, error) {
+	var id string
+	err := s.db.QueryRow(`
+		SELECT id FROM tasks WHERE `+where+` AND id >= ? ORDER BY id LIMIT 1
+	`, append(append([]interface{}{}, args...), pivot)...).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		err = s.db.QueryRow(`
+			SELECT id FROM tasks WHERE `+where+` ORDER BY id LIMIT 1
+		`, args...).Scan(&id)
+	}
+	return id, err
+}
+
+func randomPivot() (string, error) {
+	var b [12]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b[:]), nil
+}
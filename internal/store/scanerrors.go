@@ -0,0 +1,32 @@
+package store
+
+import "fmt"
+
+// ScanError reports a stored task row that couldn't be turned into a
+// task, such as one with an unparseable schedule or timestamp.
+type ScanError struct {
+	ID  string
+	Err error
+}
+
+func (e *ScanError) Error() string {
+	return fmt.Sprintf("task %s: %v", e.ID, e.Err)
+}
+
+func (e *ScanError) Unwrap() error { return e.Err }
+
+// ScanErrors reads every stored task, including archived and deleted
+// ones, and returns the rows that can't be read. All skips these rows;
+// this is how to find them. A value the database driver itself rejects
+// still fails the whole query, since the driver doesn't say which row it
+// was reading.
+func (s *Store) ScanErrors() ([]*ScanError, error) {
+	_, bad, err := scanTasks(s.db, `SELECT `+taskColumns+` FROM tasks`)
+	if err != nil {
+		return nil, err
+	}
+	if bad == nil {
+		bad = []*ScanError{}
+	}
+	return bad, nil
+}
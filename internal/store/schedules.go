@@ -0,0 +1,160 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"yiwang/internal/tasks"
+)
+
+// ErrNoTagSchedule is returned when removing a tag schedule that isn't set.
+var ErrNoTagSchedule = errors.New("tag has no schedule")
+
+// TagSchedule is the stage ladder followed by tasks carrying Tag, unless
+// they have a schedule of their own.
+type TagSchedule struct {
+	Tag       string
+	Schedule  tasks.Schedule
+	UpdatedAt time.Time
+}
+
+// TagSchedules returns every tag schedule, ordered by tag.
+func (s *Store) TagSchedules() ([]TagSchedule, error) {
+	rows, err := s.db.Query(`SELECT tag, schedule, updated_at FROM tag_schedules ORDER BY tag`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []TagSchedule{}
+	for rows.Next() {
+		var (
+			ts  TagSchedule
+			raw string
+		)
+		if err := rows.Scan(&ts.Tag, &raw, &ts.UpdatedAt); err != nil {
+			return nil, err
+		}
+		if ts.Schedule, err = tasks.ParseStoredSchedule(raw); err != nil {
+			return nil, fmt.Errorf("tag %s: stored schedule: %w", ts.Tag, err)
+		}
+		out = append(out, ts)
+	}
+	return out, rows.Err()
+}
+
+// SetTagSchedule sets or replaces the schedule of tag. Tasks pick it up
+// from their next review on; their current review time is left alone.
+func (s *Store) SetTagSchedule(tag string, sched tasks.Schedule, now time.Time) (TagSchedule, error) {
+	tag, err := normalizeTag(tag)
+	if err != nil {
+		return TagSchedule{}, err
+	}
+	if err := sched.Validate(); err != nil {
+		return TagSchedule{}, err
+	}
+
+	tx, err := s.db.begin()
+	if err != nil {
+		return TagSchedule{}, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM tag_schedules WHERE tag = ?`, tag); err != nil {
+		return TagSchedule{}, err
+	}
+	if _, err := tx.Exec(`
+		INSERT INTO tag_schedules (tag, schedule, updated_at) VALUES (?, ?, ?)
+	`, tag, sched.String(), now); err != nil {
+		return TagSchedule{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return TagSchedule{}, err
+	}
+	return TagSchedule{Tag: tag, Schedule: sched, UpdatedAt: now}, nil
+}
+
+// DeleteTagSchedule removes the schedule of tag, returning its tasks to
+// their own schedule or the default.
+func (s *Store) DeleteTagSchedule(tag string) error {
+	tag, err := normalizeTag(tag)
+	if err != nil {
+		return err
+	}
+	res, err := s.db.Exec(`DELETE FROM tag_schedules WHERE tag = ?`, tag)
+	if err != nil {
+		return err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrNoTagSchedule
+	}
+	return nil
+}
+
+func normalizeTag(tag string) (string, error) {
+	tags, err := tasks.NormalizeTags([]string{tag})
+	if err != nil {
+		return "", err
+	}
+	return tags[0], nil
+}
+
+// loadTagSchedules resolves the tag schedule of each task. When several
+// of a task's tags have a schedule, the alphabetically first tag wins, so
+// the choice doesn't depend on the order tags were added in.
+func loadTagSchedules(q queryer, ts []*tasks.Task) error {
+	seen := map[string]bool{}
+	args := []interface{}{}
+	for _, t := range ts {
+		for _, tag := range t.Tags {
+			if !seen[tag] {
+				seen[tag] = true
+				args = append(args, tag)
+			}
+		}
+	}
+
+	byTag := map[string]tasks.Schedule{}
+	if len(args) > 0 {
+		rows, err := q.Query(`
+			SELECT tag, schedule
+			FROM tag_schedules
+			WHERE tag IN (`+placeholders(len(args))+`)
+		`, args...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var tag, raw string
+			if err := rows.Scan(&tag, &raw); err != nil {
+				return err
+			}
+			sched, err := tasks.ParseStoredSchedule(raw)
+			if err != nil {
+				return fmt.Errorf("tag %s: stored schedule: %w", tag, err)
+			}
+			byTag[tag] = sched
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+	}
+
+	for _, t := range ts {
+		tag, sched := "", tasks.Schedule(nil)
+		// Tags are kept sorted.
+		for _, candidate := range t.Tags {
+			if s, ok := byTag[candidate]; ok {
+				tag, sched = candidate, s
+				break
+			}
+		}
+		t.ApplyTagSchedule(tag, sched)
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package store
+
+import (
+	"sort"
+	"strings"
+
+	"yiwang/internal/tasks"
+)
+
+// Search returns up to limit tasks whose question or answer matches query,
+// best match first. Archived tasks are included, deleted ones are not.
+//
+// MySQL ranks with its FULLTEXT index. That index skips short words and
+// stopwords and doesn't split CJK text, so when it finds nothing, and on
+// the other backends, every word of query has to appear in the question or
+// the answer instead, and matches are ranked by how often they do,
+// counting the question twice.
+func (s *Store) Search(query string, limit int) ([]*tasks.Task, error) {
+	if s.dialect.fullText {
+		ts, err := queryTasks(s.db, `
+			SELECT `+taskColumns+`
+			FROM tasks
+			WHERE deleted_at IS NULL AND MATCH (question, answer) AGAINST (? IN NATURAL LANGUAGE MODE)
+			ORDER BY MATCH (question, answer) AGAINST (? IN NATURAL LANGUAGE MODE) DESC, created_at, id
+			LIMIT ?
+		`, query, query, limit)
+		if err != nil || len(ts) > 0 {
+			return ts, err
+		}
+	}
+	return s.searchLike(query, limit)
+}
+
+func (s *Store) searchLike(query string, limit int) ([]*tasks.Task, error) {
+	terms := strings.Fields(strings.ToLower(query))
+	if len(terms) == 0 {
+		return []*tasks.Task{}, nil
+	}
+	conds := []string{"deleted_at IS NULL"}
+	var args []interface{}
+	for _, term := range terms {
+		conds = append(conds, `(LOWER(question) LIKE ? ESCAPE '!' OR LOWER(answer) LIKE ? ESCAPE '!')`)
+		pattern := "%" + likeEscaper.Replace(term) + "%"
+		args = append(args, pattern, pattern)
+	}
+	ts, err := queryTasks(s.db, `
+		SELECT `+taskColumns+`
+		FROM tasks
+		WHERE `+strings.Join(conds, " AND ")+`
+		ORDER BY created_at, id
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	score := make(map[*tasks.Task]int, len(ts))
+	for _, t := range ts {
+		q, a := strings.ToLower(t.Question), strings.ToLower(t.Answer)
+		for _, term := range terms {
+			score[t] += 2*strings.Count(q, term) + strings.Count(a, term)
+		}
+	}
+	sort.SliceStable(ts, func(i, j int) bool { return score[ts[i]] > score[ts[j]] })
+	if len(ts) > limit {
+		ts = ts[:limit]
+	}
+	return ts, nil
+}
+
+// likeEscaper escapes LIKE wildcards for ESCAPE '!', which unlike a
+// backslash means the same in every dialect's string literals.
+var likeEscaper = strings.NewReplacer("!", "!!", "%", "!%", "_", "!_")
@@ -0,0 +1,242 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"yiwang/internal/tasks"
+)
+
+var ErrSessionNotFound = errors.New("session not found")
+
+// studied matches tasks with at least one real review in history.
+const studied = `EXISTS (SELECT 1 FROM reviews r WHERE r.task_id = tasks.id AND r.result IN (?, ?))`
+
+// CreateSession builds a study session from the ready tasks matching f:
+// up to maxReviews that have been reviewed before, most overdue first,
+// then up to maxNew that never have, oldest first. f.Status is ignored.
+// The session may hold fewer cards than the limits, or none.
+func (s *Store) CreateSession(f Filter, maxReviews, maxNew int, now time.Time) (*tasks.Session, error) {
+	sess, err := tasks.NewSession(maxReviews, maxNew, now)
+	if err != nil {
+		return nil, err
+	}
+	f.Status = "ready"
+	where, args, err := f.where(now)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := s.db.begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	due, err := queryIDs(tx, `
+		SELECT id
+		FROM tasks
+		WHERE `+where+` AND `+studied+`
+		ORDER BY next_review_at, id
+		LIMIT ?
+	`, append(args, ResultRemembered, ResultForgot, maxReviews)...)
+	if err != nil {
+		return nil, err
+	}
+	fresh, err := queryIDs(tx, `
+		SELECT id
+		FROM tasks
+		WHERE `+where+` AND NOT `+studied+`
+		ORDER BY created_at, id
+		LIMIT ?
+	`, append(args, ResultRemembered, ResultForgot, maxNew)...)
+	if err != nil {
+		return nil, err
+	}
+	sess.TaskIDs = append(due, fresh...)
+	sess.NewCards = len(fresh)
+
+	if _, err := tx.Exec(`
+		INSERT INTO sessions (id, max_reviews, max_new, created_at)
+		VALUES (?, ?, ?, ?)
+	`, sess.ID, sess.MaxReviews, sess.MaxNew, sess.CreatedAt); err != nil {
+		return nil, err
+	}
+	for i, id := range sess.TaskIDs {
+		if _, err := tx.Exec(`
+			INSERT INTO session_cards (session_id, position, task_id, is_new) VALUES (?, ?, ?, ?)
+		`, sess.ID, i, id, i >= len(due)); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return sess, nil
+}
+
+// Session returns a session with its progress so far.
+func (s *Store) Session(id string) (*tasks.Session, error) {
+	tx, err := s.db.begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	sess, err := loadSession(tx, id, "")
+	if err != nil {
+		return nil, err
+	}
+	if sess.FinishedAt == nil {
+		if _, err := sessionProgress(tx, sess); err != nil {
+			return nil, err
+		}
+	}
+	return sess, tx.Commit()
+}
+
+// NextInSession returns the session's first card that hasn't been
+// answered, along with the session. Cards that have left the queue since
+// the session began, by being suspended, archived, deleted, or
+// rescheduled, are skipped. When none are left the session is finished
+// and its stats fixed, and the task is nil.
+func (s *Store) NextInSession(id string, now time.Time) (*tasks.Task, *tasks.Session, error) {
+	tx, err := s.db.begin()
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tx.Rollback()
+
+	sess, err := loadSession(tx, id, s.dialect.forUpdate)
+	if err != nil {
+		return nil, nil, err
+	}
+	if sess.FinishedAt != nil {
+		return nil, sess, tx.Commit()
+	}
+	answered, err := sessionProgress(tx, sess)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var open []interface{}
+	for _, id := range sess.TaskIDs {
+		if !answered[id] {
+			open = append(open, id)
+		}
+	}
+	if len(open) > 0 {
+		ts, err := queryTasks(tx, `
+			SELECT `+taskColumns+`
+			FROM tasks
+			WHERE id IN (`+placeholders(len(open))+`)
+		`, open...)
+		if err != nil {
+			return nil, nil, err
+		}
+		byID := make(map[string]*tasks.Task, len(ts))
+		for _, t := range ts {
+			byID[t.ID] = t
+		}
+		for _, id := range open {
+			if t := byID[id.(string)]; t != nil && t.Status(now) == "ready" {
+				if err := loadRelated(tx, []*tasks.Task{t}); err != nil {
+					return nil, nil, err
+				}
+				return t, sess, tx.Commit()
+			}
+		}
+	}
+
+	sess.FinishedAt = &now
+	if _, err := tx.Exec(`
+		UPDATE sessions
+		SET finished_at = ?, answered = ?, remembered = ?, forgot = ?
+		WHERE id = ?
+	`, now, sess.Answered, sess.Remembered, sess.Forgot, sess.ID); err != nil {
+		return nil, nil, err
+	}
+	return nil, sess, tx.Commit()
+}
+
+// loadSession reads a session and its cards; lock is appended to the
+// session query, e.g. the dialect's forUpdate.
+func loadSession(tx *dbTx, id, lock string) (*tasks.Session, error) {
+	var (
+		sess     tasks.Session
+		finished sql.NullTime
+	)
+	err := tx.QueryRow(`
+		SELECT id, max_reviews, max_new, created_at, finished_at, answered, remembered, forgot
+		FROM sessions
+		WHERE id = ?
+	`+lock, id).Scan(&sess.ID, &sess.MaxReviews, &sess.MaxNew, &sess.CreatedAt, &finished,
+		&sess.Answered, &sess.Remembered, &sess.Forgot)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrSessionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	sess.FinishedAt = timePtr(finished)
+
+	rows, err := tx.Query(`
+		SELECT task_id, is_new
+		FROM session_cards
+		WHERE session_id = ?
+		ORDER BY position
+	`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	sess.TaskIDs = []string{}
+	for rows.Next() {
+		var (
+			taskID string
+			isNew  bool
+		)
+		if err := rows.Scan(&taskID, &isNew); err != nil {
+			return nil, err
+		}
+		sess.TaskIDs = append(sess.TaskIDs, taskID)
+		if isNew {
+			sess.NewCards++
+		}
+	}
+	return &sess, rows.Err()
+}
+
+// sessionProgress counts the reviews of the session's cards since it
+// began into sess and returns the set of cards answered. Undoing a review
+// removes it from history, so its card is open again.
+func sessionProgress(tx *dbTx, sess *tasks.Session) (map[string]bool, error) {
+	rows, err := tx.Query(`
+		SELECT r.task_id, r.result
+		FROM reviews r
+		JOIN session_cards c ON c.task_id = r.task_id
+		WHERE c.session_id = ? AND r.reviewed_at >= ? AND r.result IN (?, ?)
+	`, sess.ID, sess.CreatedAt, ResultRemembered, ResultForgot)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	answered := map[string]bool{}
+	sess.Remembered, sess.Forgot = 0, 0
+	for rows.Next() {
+		var taskID, result string
+		if err := rows.Scan(&taskID, &result); err != nil {
+			return nil, err
+		}
+		answered[taskID] = true
+		if result == ResultRemembered {
+			sess.Remembered++
+		} else {
+			sess.Forgot++
+		}
+	}
+	sess.Answered = len(answered)
+	return answered, rows.Err()
+}
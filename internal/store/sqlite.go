@@ -0,0 +1,76 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"time"
+
+	"modernc.org/sqlite"
+)
+
+// sqliteDefaults are added to a SQLite DSN that sets no options of its
+// own. WAL lets reads run beside a write, the busy timeout makes writers
+// queue instead of failing, and immediate transactions take the write
+// lock up front so a read-then-write transaction can't deadlock.
+const sqliteDefaults = "_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_txlock=immediate&_time_format=sqlite"
+
+// SQLite stores times as text and compares them as strings, which only
+// orders them correctly when they share an offset. The sqlite-utc driver
+// converts every time argument to UTC before it is written.
+func init() {
+	sql.Register("sqlite-utc", utcDriver{&sqlite.Driver{}})
+}
+
+type utcDriver struct {
+	driver.Driver
+}
+
+func (d utcDriver) Open(name string) (driver.Conn, error) {
+	c, err := d.Driver.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return utcConn{c}, nil
+}
+
+type utcConn struct {
+	driver.Conn
+}
+
+// BeginTx passes transaction options through; SQLite transactions are
+// serializable whatever isolation is asked for.
+func (c utcConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	return beginTx(ctx, c.Conn, opts)
+}
+
+// CheckNamedValue converts time arguments, including those behind a
+// driver.Valuer such as sql.NullTime, to UTC and leaves the rest to the
+// default conversion.
+func (utcConn) CheckNamedValue(nv *driver.NamedValue) error {
+	if v, ok := nv.Value.(driver.Valuer); ok {
+		val, err := v.Value()
+		if err != nil {
+			return err
+		}
+		nv.Value = val
+	}
+	switch t := nv.Value.(type) {
+	case time.Time:
+		nv.Value = t.UTC()
+	case *time.Time:
+		if t != nil {
+			nv.Value = t.UTC()
+		}
+	}
+	return driver.ErrSkip
+}
+
+// beginTx starts a transaction on a wrapped connection, keeping its
+// options when the driver supports them.
+func beginTx(ctx context.Context, c driver.Conn, opts driver.TxOptions) (driver.Tx, error) {
+	if b, ok := c.(driver.ConnBeginTx); ok {
+		return b.BeginTx(ctx, opts)
+	}
+	return c.Begin()
+}
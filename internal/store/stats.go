@@ -0,0 +1,182 @@
+package store
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+
+	"yiwang/internal/tasks"
+)
+
+// CreatedTimes returns the creation time of every active task created in
+// [from, to). Callers bucket the timestamps themselves so day boundaries
+// follow the configured time zone rather than the database session's.
+func (s *Store) CreatedTimes(from, to time.Time) ([]time.Time, error) {
+	rows, err := s.read.Query(`
+		SELECT created_at
+		FROM tasks
+		WHERE deleted_at IS NULL AND archived_at IS NULL AND created_at >= ? AND created_at < ?
+	`, from, to)
+	if err != nil {
+		return nil, err
+	}
+	return scanTimes(rows)
+}
+
+// GraduatedTimes returns when tasks were completed in [from, to), according
+// to the review history. History rows written before completions were
+// flagged count when they crossed totalStages, the default schedule's
+// length.
+func (s *Store) GraduatedTimes(from, to time.Time, totalStages int) ([]time.Time, error) {
+	rows, err := s.read.Query(`
+		SELECT reviewed_at
+		FROM reviews
+		WHERE (graduated OR (graduated IS NULL AND stage_before < ? AND stage_after >= ?))
+			AND reviewed_at >= ? AND reviewed_at < ?
+	`, totalStages, totalStages, from, to)
+	if err != nil {
+		return nil, err
+	}
+	return scanTimes(rows)
+}
+
+func scanTimes(rows *sql.Rows) ([]time.Time, error) {
+	defer rows.Close()
+	out := []time.Time{}
+	for rows.Next() {
+		var t time.Time
+		if err := rows.Scan(&t); err != nil {
+			return nil, err
+		}
+		out = append(out, t)
+	}
+	return out, rows.Err()
+}
+
+// NextReviewTimes returns the scheduled review time of every active,
+// unfinished, unsuspended task.
+func (s *Store) NextReviewTimes() ([]time.Time, error) {
+	rows, err := s.read.Query(`
+		SELECT next_review_at
+		FROM tasks
+		WHERE deleted_at IS NULL AND archived_at IS NULL AND suspended_at IS NULL AND completed_at IS NULL
+			AND next_review_at IS NOT NULL
+	`)
+	if err != nil {
+		return nil, err
+	}
+	return scanTimes(rows)
+}
+
+// CountByStatus counts every task by the status Task.Status would give it
+// at now: deleted, archived, suspended, done, ready, or pending. Tasks
+// count as done by their completion time, without resolving schedules.
+func (s *Store) CountByStatus(now time.Time) (map[string]int, error) {
+	rows, err := s.read.Query(`
+		SELECT CASE
+				WHEN deleted_at IS NOT NULL THEN 'deleted'
+				WHEN archived_at IS NOT NULL THEN 'archived'
+				WHEN suspended_at IS NOT NULL THEN 'suspended'
+				WHEN completed_at IS NOT NULL THEN 'done'
+				WHEN next_review_at <= ? THEN 'ready'
+				ELSE 'pending'
+			END AS status, COUNT(*)
+		FROM tasks
+		GROUP BY status
+	`, now)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := map[string]int{}
+	for rows.Next() {
+		var (
+			status string
+			n      int
+		)
+		if err := rows.Scan(&status, &n); err != nil {
+			return nil, err
+		}
+		out[status] = n
+	}
+	return out, rows.Err()
+}
+
+// AverageStage returns the mean stage of active tasks on the stages
+// scheduler, and how many there are; the mean is 0 when there are none.
+func (s *Store) AverageStage() (float64, int, error) {
+	var (
+		avg sql.NullFloat64
+		n   int
+	)
+	err := s.read.QueryRow(`
+		SELECT AVG(stage), COUNT(*)
+		FROM tasks
+		WHERE deleted_at IS NULL AND archived_at IS NULL AND scheduler = ?
+	`, string(tasks.SchedulerStages)).Scan(&avg, &n)
+	return avg.Float64, n, err
+}
+
+// ReviewTally counts the reviews in [from, to) by result.
+func (s *Store) ReviewTally(from, to time.Time) (remembered, forgot int, err error) {
+	err = s.read.QueryRow(`
+		SELECT COALESCE(SUM(CASE WHEN result = ? THEN 1 ELSE 0 END), 0),
+			COALESCE(SUM(CASE WHEN result = ? THEN 1 ELSE 0 END), 0)
+		FROM reviews
+		WHERE result IN (?, ?) AND reviewed_at >= ? AND reviewed_at < ?
+	`, ResultRemembered, ResultForgot, ResultRemembered, ResultForgot, from, to).Scan(&remembered, &forgot)
+	return remembered, forgot, err
+}
+
+// ReviewCounts counts the reviews in each window between consecutive
+// bounds, which must ascend: the first count is for [bounds[0],
+// bounds[1]). Like CreatedTimes it leaves the day boundaries to the
+// caller, but counts in the database.
+func (s *Store) ReviewCounts(bounds []time.Time) ([]int, error) {
+	return countWindows(s.read, "reviews", "reviewed_at", `result IN (?, ?)`,
+		[]interface{}{ResultRemembered, ResultForgot}, bounds)
+}
+
+// CreatedCounts counts the active tasks created in each window between
+// consecutive bounds, as ReviewCounts does for reviews.
+func (s *Store) CreatedCounts(bounds []time.Time) ([]int, error) {
+	return countWindows(s.read, "tasks", "created_at", `deleted_at IS NULL AND archived_at IS NULL`, nil, bounds)
+}
+
+// countWindows counts the rows of table matching cond whose column falls
+// in each window between consecutive bounds, in one query.
+func countWindows(q queryer, table, column, cond string, args []interface{}, bounds []time.Time) ([]int, error) {
+	if len(bounds) < 2 {
+		return []int{}, nil
+	}
+	var (
+		sums  []string
+		qargs []interface{}
+	)
+	for i := 1; i < len(bounds); i++ {
+		sums = append(sums, `COALESCE(SUM(CASE WHEN `+column+` >= ? AND `+column+` < ? THEN 1 ELSE 0 END), 0)`)
+		qargs = append(qargs, bounds[i-1], bounds[i])
+	}
+	qargs = append(qargs, args...)
+	qargs = append(qargs, bounds[0], bounds[len(bounds)-1])
+
+	counts := make([]int, len(bounds)-1)
+	dest := make([]interface{}, len(counts))
+	for i := range counts {
+		dest[i] = &counts[i]
+	}
+	err := q.QueryRow(`
+		SELECT `+strings.Join(sums, ", ")+`
+		FROM `+table+`
+		WHERE `+cond+` AND `+column+` >= ? AND `+column+` < ?
+	`, qargs...).Scan(dest...)
+	return counts, err
+}
+
+// DueCounts counts the active, unfinished, unsuspended tasks coming due in
+// each window between consecutive bounds, as ReviewCounts does for
+// reviews.
+func (s *Store) DueCounts(bounds []time.Time) ([]int, error) {
+	return countWindows(s.read, "tasks", "next_review_at",
+		`deleted_at IS NULL AND archived_at IS NULL AND suspended_at IS NULL AND completed_at IS NULL`, nil, bounds)
+}
@@ -0,0 +1,59 @@
+package store
+
+import (
+	"database/sql"
+
+	"yiwang/internal/tasks"
+)
+
+// Statuses returns up to limit active tasks with an ID after after, in ID
+// order, holding only what Task.Status needs: the stage, review and
+// completion times, suspension, the scheduler, and the schedules that
+// fix the stage count. Text, images and history aren't read.
+func (s *Store) Statuses(after string, limit int) ([]*tasks.Task, error) {
+	rows, err := s.db.Query(`
+		SELECT id, stage, next_review_at, completed_at, suspended_at, schedule, scheduler
+		FROM tasks
+		WHERE deleted_at IS NULL AND archived_at IS NULL AND id > ?
+		ORDER BY id
+		LIMIT ?
+	`, after, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []*tasks.Task{}
+	for rows.Next() {
+		var (
+			t         tasks.Task
+			next      sql.NullTime
+			completed sql.NullTime
+			suspended sql.NullTime
+			schedule  sql.NullString
+			scheduler string
+		)
+		if err := rows.Scan(&t.ID, &t.Stage, &next, &completed, &suspended, &schedule, &scheduler); err != nil {
+			return nil, err
+		}
+		sched, err := tasks.ParseStoredSchedule(schedule.String)
+		if err != nil {
+			return nil, &ScanError{ID: t.ID, Err: err}
+		}
+		t.NextReviewAt = next.Time
+		t.CompletedAt = timePtr(completed)
+		t.SuspendedAt = timePtr(suspended)
+		t.Schedule = sched
+		t.Scheduler = tasks.Scheduler(scheduler)
+		out = append(out, &t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	if err := loadTags(s.db, out); err != nil {
+		return nil, err
+	}
+	return out, loadTagSchedules(s.db, out)
+}
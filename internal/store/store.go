@@ -5,123 +5,455 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"log/slog"
 	"time"
 
+	"yiwang/internal/events"
 	"yiwang/internal/tasks"
 
 	_ "github.com/go-sql-driver/mysql"
 )
 
-var ErrNotFound = errors.New("task not found")
+var (
+	ErrNotFound   = errors.New("task not found")
+	ErrNotDeleted = errors.New("task must be deleted before it can be purged")
+	// ErrTokenReused means a review token was sent again with a different
+	// result than the review it first identified.
+	ErrTokenReused = errors.New("review token was already used with a different result")
+	// ErrVersionConflict means an update was made against a version of
+	// the task that another change has since replaced.
+	ErrVersionConflict = errors.New("task was changed by another update; fetch it and try again")
+)
+
+// taskColumns is the column list scanTask expects, in order.
+const taskColumns = `id, question, answer, stage, next_review_at, created_at, updated_at, completed_at, deleted_at, difficulty, archived_at, schedule, answer_match, suspended_at, suspend_reason, scheduler, ease, interval_seconds, stability, fsrs_difficulty, last_reviewed_at, deck_id, format, card_type, sibling_id, lapses, version`
 
-// Store manages task persistence in MySQL.
+// Store manages task persistence in MySQL, SQLite, or Postgres.
+//
+// Methods that return lists always return a non-nil slice, empty when
+// nothing matches, so handlers can encode them straight to "[]" in JSON.
 type Store struct {
-	db *sql.DB
+	db *dbConn
+	// read is the read replica, or db when there is none.
+	read    *dbConn
+	opts    Options
+	dialect dialect
+}
+
+// TaskStore is the core of what a task backend provides. Store implements
+// it on every supported database.
+type TaskStore interface {
+	Create(question, answer string, opts tasks.Options, now time.Time) (*tasks.Task, error)
+	All() ([]*tasks.Task, error)
+	Get(id string) (*tasks.Task, error)
+	UpdateContent(id string, question, answer *string, opts tasks.Options, now time.Time) (*tasks.Task, error)
+	Review(id string, outcome tasks.Outcome, token string, now time.Time) (ReviewResult, error)
+	Delete(id string, now time.Time) error
+}
+
+var _ TaskStore = (*Store)(nil)
+
+// Options tunes optional store behaviour.
+type Options struct {
+	// Driver is DriverMySQL (the default), DriverSQLite, or
+	// DriverPostgres. A SQLite DSN is a file path, optionally with driver
+	// parameters; a Postgres one a URL or key=value list.
+	Driver string
+	// Outbox records every task change as an event in the outbox table,
+	// in the same transaction as the change, for delivery by a worker.
+	Outbox bool
+	// EarlyReview decides what reviewing a pending card does. The zero
+	// value behaves like tasks.EarlyAllow.
+	EarlyReview tasks.EarlyReview
+	// ManualMigrations leaves pending schema migrations for MigrateUp
+	// instead of applying them on open.
+	ManualMigrations bool
+	// ReadDSN, when set, is a read replica of the database for All, Get
+	// and the statistics queries, sparing the primary the dashboard's
+	// reads. Writes and the reads that lock rows stay on the primary.
+	// Replicas lag, so those reads can miss a change made just before.
+	ReadDSN string
+	// Pool sizes the connection pool, and the replica's. Zero fields
+	// take DefaultPool's value; negative ones lift the limit, or keep no
+	// idle connections.
+	Pool Pool
+}
+
+// Pool sizes a connection pool, as the database/sql setters of the same
+// names do: a zero limit or lifetime means none.
+type Pool struct {
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+}
+
+// DefaultPool keeps well under the connection limit of a small MySQL
+// server and recycles connections before proxies and servers drop idle
+// ones.
+var DefaultPool = Pool{MaxOpenConns: 10, MaxIdleConns: 5, ConnMaxLifetime: 5 * time.Minute}
+
+// withDefaults fills zero fields from DefaultPool and turns negative ones
+// into zero, which database/sql reads as no limit. Idle connections are
+// capped at the open ones, as database/sql would.
+func (p Pool) withDefaults() Pool {
+	pick := func(v, def int) int {
+		switch {
+		case v == 0:
+			return def
+		case v < 0:
+			return 0
+		}
+		return v
+	}
+	p.MaxOpenConns = pick(p.MaxOpenConns, DefaultPool.MaxOpenConns)
+	p.MaxIdleConns = pick(p.MaxIdleConns, DefaultPool.MaxIdleConns)
+	if p.MaxOpenConns > 0 {
+		p.MaxIdleConns = min(p.MaxIdleConns, p.MaxOpenConns)
+	}
+	switch {
+	case p.ConnMaxLifetime == 0:
+		p.ConnMaxLifetime = DefaultPool.ConnMaxLifetime
+	case p.ConnMaxLifetime < 0:
+		p.ConnMaxLifetime = 0
+	}
+	return p
 }
 
-// New opens a MySQL-backed store and ensures schema.
+// New opens a MySQL-backed store and migrates its schema.
 func New(dsn string) (*Store, error) {
-	db, err := sql.Open("mysql", dsn)
+	return NewWithOptions(dsn, Options{})
+}
+
+// NewWithOptions is New with optional behaviour enabled.
+func NewWithOptions(dsn string, opts Options) (*Store, error) {
+	d, err := lookupDialect(opts.Driver)
 	if err != nil {
 		return nil, err
 	}
-	if err := db.Ping(); err != nil {
+	opts.Pool = opts.Pool.withDefaults()
+	db, err := openDB(d, dsn, opts.Pool)
+	if err != nil {
 		return nil, err
 	}
-
-	s := &Store{db: db}
-	if err := s.ensureTable(); err != nil {
+	s := &Store{db: db, read: db, opts: opts, dialect: d}
+	if opts.ReadDSN != "" {
+		if s.read, err = openDB(d, opts.ReadDSN, opts.Pool); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("open read replica: %w", err)
+		}
+	}
+	if err := s.ensureMigrationTable(); err != nil {
 		return nil, err
 	}
+	if !opts.ManualMigrations {
+		if _, err := s.MigrateUp(time.Now()); err != nil {
+			return nil, err
+		}
+	}
 	return s, nil
 }
 
-// Create adds a new task.
-func (s *Store) Create(question, answer string, now time.Time) (*tasks.Task, error) {
-	t, err := tasks.NewTask(question, answer, now)
+// openDB opens and checks a connection pool to dsn.
+func openDB(d dialect, dsn string, pool Pool) (*dbConn, error) {
+	db, err := sql.Open(d.driver, d.dataSource(dsn))
 	if err != nil {
 		return nil, err
 	}
+	db.SetMaxOpenConns(pool.MaxOpenConns)
+	db.SetMaxIdleConns(pool.MaxIdleConns)
+	db.SetConnMaxLifetime(pool.ConnMaxLifetime)
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &dbConn{DB: db, ctx: context.Background(), system: d.name}, nil
+}
+
+// WithContext returns a copy of the store whose operations run under ctx,
+// so they are abandoned if it is cancelled and traced as part of the span
+// it carries. Methods that take a context of their own use that instead.
+func (s *Store) WithContext(ctx context.Context) *Store {
+	c := *s
+	db := *s.db
+	db.ctx = ctx
+	c.db, c.read = &db, &db
+	if s.read != s.db {
+		read := *s.read
+		read.ctx = ctx
+		c.read = &read
+	}
+	return &c
+}
+
+// Close closes the connection pools, first waiting for queries already
+// running to finish.
+func (s *Store) Close() error {
+	err := s.db.Close()
+	if s.read != s.db {
+		err = errors.Join(err, s.read.Close())
+	}
+	return err
+}
+
+// Pool returns the connection pool's limits, with defaults filled in.
+func (s *Store) Pool() Pool {
+	return s.opts.Pool
+}
 
-	_, err = s.db.Exec(`
-		INSERT INTO tasks (id, question, answer, stage, next_review_at, created_at, updated_at, completed_at)
-		VALUES (?, ?, ?, ?, ?, ?, ?, NULL)
-	`, t.ID, t.Question, t.Answer, t.Stage, t.NextReviewAt, t.CreatedAt, t.UpdatedAt)
+// Stats reports the primary connection pool's statistics.
+func (s *Store) Stats() sql.DBStats {
+	return s.db.Stats()
+}
+
+// Create adds a new task.
+func (s *Store) Create(question, answer string, opts tasks.Options, now time.Time) (*tasks.Task, error) {
+	t, err := tasks.NewTaskWithOptions(question, answer, now, opts)
 	if err != nil {
 		return nil, err
 	}
+	if err := s.insertNew(now, t); err != nil {
+		return nil, err
+	}
 	return t, nil
 }
 
-// All returns every task.
+// CreateReversible adds a task and its reverse in one transaction; see
+// tasks.NewReversiblePair.
+func (s *Store) CreateReversible(question, answer string, opts tasks.Options, now time.Time) (*tasks.Task, *tasks.Task, error) {
+	t, r, err := tasks.NewReversiblePair(question, answer, now, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := s.insertNew(now, t, r); err != nil {
+		return nil, nil, err
+	}
+	return t, r, nil
+}
+
+// insertNew stores newly built tasks in one transaction.
+func (s *Store) insertNew(now time.Time, ts ...*tasks.Task) error {
+	tx, err := s.db.begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// The tag schedule decides when the first review is.
+	if err := loadTagSchedules(tx, ts); err != nil {
+		return err
+	}
+	for _, t := range ts {
+		if err := checkDeck(tx, t.DeckID); err != nil {
+			return err
+		}
+		if err := insertTask(tx, t); err != nil {
+			return err
+		}
+		if err := s.enqueue(tx, events.TaskCreated, t, "", now); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// Import inserts already-validated tasks in a single transaction, which is
+// rolled back if ctx is cancelled first.
+func (s *Store) Import(ctx context.Context, ts []*tasks.Task) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := loadTagSchedules(tx, ts); err != nil {
+		return err
+	}
+	for _, t := range ts {
+		if err := checkDeck(tx, t.DeckID); err != nil {
+			return err
+		}
+		if err := insertTask(tx, t); err != nil {
+			return err
+		}
+		if err := s.enqueue(tx, events.TaskCreated, t, "", t.CreatedAt); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func insertTask(q queryer, t *tasks.Task) error {
+	t.Version = 1
+	_, err := q.Exec(`
+		INSERT INTO tasks (id, question, answer, stage, next_review_at, created_at, updated_at, completed_at, difficulty, schedule, answer_match, scheduler, ease, interval_seconds, stability, fsrs_difficulty, deck_id, format, card_type, sibling_id, version)
+		VALUES (?, ?, ?, ?, ?, ?, ?, NULL, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, t.ID, t.Question, t.Answer, t.Stage, t.NextReviewAt, t.CreatedAt, t.UpdatedAt, t.Difficulty, nullSchedule(t.Schedule), t.AnswerMatch,
+		schedulerName(t.Scheduler), t.Ease, int64(t.Interval/time.Second), t.Stability, t.FSRSDifficulty,
+		nullString(t.DeckID), formatName(t.Format), cardTypeName(t.Type), nullString(t.SiblingID), t.Version)
+	if err != nil {
+		return err
+	}
+	return setTags(q, t.ID, t.Tags)
+}
+
+// All returns every active task; archived and deleted ones are returned
+// by Archived and Deleted instead. Rows that can't be read are logged and
+// left out rather than failing the whole list; ScanErrors reports them.
 func (s *Store) All() ([]*tasks.Task, error) {
-	rows, err := s.db.Query(`
-		SELECT id, question, answer, stage, next_review_at, created_at, updated_at, completed_at
+	ts, bad, err := scanTasks(s.read, `
+		SELECT `+taskColumns+`
 		FROM tasks
+		WHERE deleted_at IS NULL AND archived_at IS NULL
 	`)
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
-
-	var out []*tasks.Task
-	for rows.Next() {
-		t, err := scanTask(rows)
-		if err != nil {
-			return nil, err
-		}
-		out = append(out, t)
+	for _, e := range bad {
+		slog.WarnContext(s.read.ctx, "store: skipping unreadable task", "err", e)
 	}
-	return out, rows.Err()
+	return ts, loadRelated(s.read, ts)
+}
+
+// Archived returns every archived task that isn't deleted.
+func (s *Store) Archived() ([]*tasks.Task, error) {
+	return queryTasks(s.db, `
+		SELECT `+taskColumns+`
+		FROM tasks
+		WHERE deleted_at IS NULL AND archived_at IS NOT NULL
+	`)
+}
+
+// Deleted returns every soft-deleted task.
+func (s *Store) Deleted() ([]*tasks.Task, error) {
+	return queryTasks(s.db, `
+		SELECT `+taskColumns+`
+		FROM tasks
+		WHERE deleted_at IS NOT NULL
+	`)
 }
 
 // Get returns a task by ID.
 func (s *Store) Get(id string) (*tasks.Task, error) {
-	row := s.db.QueryRow(`
-		SELECT id, question, answer, stage, next_review_at, created_at, updated_at, completed_at
+	row := s.read.QueryRow(`
+		SELECT `+taskColumns+`
 		FROM tasks
-		WHERE id = ?
+		WHERE id = ? AND deleted_at IS NULL
 	`, id)
 	t, err := scanTask(row)
 	if errors.Is(err, sql.ErrNoRows) {
 		return nil, ErrNotFound
 	}
-	return t, err
+	if err != nil {
+		return nil, err
+	}
+	return t, loadRelated(s.read, []*tasks.Task{t})
 }
 
-// UpdateContent edits question/answer text.
-func (s *Store) UpdateContent(id, question, answer string, now time.Time) (*tasks.Task, error) {
-	ctx := context.Background()
-	tx, err := s.db.BeginTx(ctx, nil)
+// GetMany returns the tasks with the given IDs, in the order of ids, in
+// one query. IDs that don't name a live task are left out.
+func (s *Store) GetMany(ids []string) ([]*tasks.Task, error) {
+	if len(ids) == 0 {
+		return []*tasks.Task{}, nil
+	}
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+	ts, err := queryTasks(s.read, `
+		SELECT `+taskColumns+`
+		FROM tasks
+		WHERE id IN (`+placeholders(len(ids))+`) AND deleted_at IS NULL
+	`, args...)
 	if err != nil {
 		return nil, err
 	}
-	defer tx.Rollback()
+	byID := make(map[string]*tasks.Task, len(ts))
+	for _, t := range ts {
+		byID[t.ID] = t
+	}
+	out := make([]*tasks.Task, 0, len(ts))
+	for _, id := range ids {
+		if t, ok := byID[id]; ok {
+			out = append(out, t)
+			delete(byID, id)
+		}
+	}
+	return out, nil
+}
 
-	row := tx.QueryRow(`
-		SELECT id, question, answer, stage, next_review_at, created_at, updated_at, completed_at
+// TasksVersion returns a token that changes whenever a task list read at
+// now could: when a task is added, changed or purged, when one comes due,
+// or when a tag schedule changes. It is counted from the tables without
+// reading the tasks. Task changes show in the sum of their versions, which
+// every change bumps, rather than in updated_at, which several changes
+// within a second can share.
+func (s *Store) TasksVersion(now time.Time) (string, error) {
+	var (
+		count, due, schedules int
+		versions, latest      int64
+		schedUpdated          sql.NullString
+	)
+	err := s.read.QueryRow(`
+		SELECT COUNT(*), COALESCE(SUM(version), 0), COALESCE(MAX(version), 0),
+			COALESCE(SUM(CASE WHEN next_review_at <= ? THEN 1 ELSE 0 END), 0)
 		FROM tasks
-		WHERE id = ?
-		FOR UPDATE
-	`, id)
-	t, err := scanTask(row)
-	if errors.Is(err, sql.ErrNoRows) {
-		return nil, ErrNotFound
+	`, now).Scan(&count, &versions, &latest, &due)
+	if err != nil {
+		return "", err
+	}
+	err = s.read.QueryRow(`SELECT COUNT(*), MAX(updated_at) FROM tag_schedules`).Scan(&schedules, &schedUpdated)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%d/%d/%d/%d/%d/%s", count, versions, latest, due, schedules, schedUpdated.String), nil
+}
+
+// UpdateContent edits question/answer text and any optional fields set in
+// opts; nil text and unset options are left as they are. See
+// tasks.Task.UpdateContent.
+func (s *Store) UpdateContent(id string, question, answer *string, opts tasks.Options, now time.Time) (*tasks.Task, error) {
+	tx, err := s.db.begin()
+	if err != nil {
+		return nil, err
 	}
+	defer tx.Rollback()
+
+	t, err := s.lockTask(tx, id)
 	if err != nil {
 		return nil, err
 	}
 
-	if err := t.UpdateContent(question, answer); err != nil {
+	if opts.Version != 0 && opts.Version != t.Version {
+		return nil, ErrVersionConflict
+	}
+	if err := loadRelated(tx, []*tasks.Task{t}); err != nil {
+		return nil, err
+	}
+	if err := t.UpdateContent(question, answer, opts); err != nil {
+		return nil, err
+	}
+	if err := checkDeck(tx, t.DeckID); err != nil {
 		return nil, err
 	}
 	t.UpdatedAt = now
 
 	if _, err := tx.Exec(`
 		UPDATE tasks
-		SET question = ?, answer = ?, updated_at = ?
+		SET question = ?, answer = ?, difficulty = ?, schedule = ?, answer_match = ?, deck_id = ?, format = ?, card_type = ?, updated_at = ?, version = version + 1
 		WHERE id = ?
-	`, t.Question, t.Answer, t.UpdatedAt, t.ID); err != nil {
+	`, t.Question, t.Answer, t.Difficulty, nullSchedule(t.Schedule), t.AnswerMatch, nullString(t.DeckID), formatName(t.Format), cardTypeName(t.Type), t.UpdatedAt, t.ID); err != nil {
+		return nil, err
+	}
+	t.Version++
+	if opts.Tags != nil {
+		if err := setTags(tx, t.ID, t.Tags); err != nil {
+			return nil, err
+		}
+		if err := loadTagSchedules(tx, []*tasks.Task{t}); err != nil {
+			return nil, err
+		}
+	}
+	if err := s.enqueue(tx, events.TaskUpdated, t, "", now); err != nil {
 		return nil, err
 	}
 
@@ -131,40 +463,266 @@ func (s *Store) UpdateContent(id, question, answer string, now time.Time) (*task
 	return t, nil
 }
 
-// Review applies a remembered/forgot result.
-func (s *Store) Review(id string, remembered bool, now time.Time) (*tasks.Task, error) {
-	ctx := context.Background()
-	tx, err := s.db.BeginTx(ctx, nil)
+// ReviewResult describes what a review did.
+type ReviewResult struct {
+	Task *tasks.Task
+	// Next is the next due task other than Task, filled in by
+	// ReviewAndNext; nil when nothing else is due.
+	Next *tasks.Task
+	// Replayed is set when the review carried the token of an earlier
+	// review of the same task. Nothing was applied and Task is the
+	// current state.
+	Replayed bool
+}
+
+// Review applies a review outcome. Concurrent reviews of one task are
+// serialized by a row lock, so the second sees the state the first left
+// instead of overwriting it; if that made the card no longer due, the
+// second follows the EarlyReview policy. A retried or duplicated
+// submission should carry the same token, which makes it a no-op after
+// the first; see ErrTokenReused.
+func (s *Store) Review(id string, outcome tasks.Outcome, token string, now time.Time) (ReviewResult, error) {
+	tx, err := s.db.begin()
 	if err != nil {
-		return nil, err
+		return ReviewResult{}, err
+	}
+	defer tx.Rollback()
+
+	res, err := s.reviewTx(tx, id, outcome, token, now)
+	if err != nil {
+		return ReviewResult{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return ReviewResult{}, err
+	}
+	return res, nil
+}
+
+// ReviewAndNext is Review that also fetches, in the same transaction, the
+// next due task other than the reviewed one, so the result reflects the
+// post-review state.
+func (s *Store) ReviewAndNext(id string, outcome tasks.Outcome, token string, now time.Time) (ReviewResult, error) {
+	tx, err := s.db.begin()
+	if err != nil {
+		return ReviewResult{}, err
 	}
 	defer tx.Rollback()
 
+	res, err := s.reviewTx(tx, id, outcome, token, now)
+	if err != nil {
+		return ReviewResult{}, err
+	}
+
+	due, err := queryTasks(tx, `
+		SELECT `+taskColumns+`
+		FROM tasks
+		WHERE deleted_at IS NULL AND archived_at IS NULL AND suspended_at IS NULL AND completed_at IS NULL
+			AND next_review_at <= ? AND id <> ?
+		ORDER BY next_review_at
+		LIMIT 1
+	`, now, id)
+	if err != nil {
+		return ReviewResult{}, err
+	}
+	if len(due) > 0 {
+		res.Next = due[0]
+	}
+
+	if err := tx.Commit(); err != nil {
+		return ReviewResult{}, err
+	}
+	return res, nil
+}
+
+// lockTask loads a live task with a row lock held until tx ends.
+func (s *Store) lockTask(tx *dbTx, id string) (*tasks.Task, error) {
 	row := tx.QueryRow(`
-		SELECT id, question, answer, stage, next_review_at, created_at, updated_at, completed_at
+		SELECT `+taskColumns+`
 		FROM tasks
-		WHERE id = ?
-		FOR UPDATE
-	`, id)
+		WHERE id = ? AND deleted_at IS NULL
+	`+s.dialect.forUpdate, id)
 	t, err := scanTask(row)
 	if errors.Is(err, sql.ErrNoRows) {
 		return nil, ErrNotFound
 	}
+	return t, err
+}
+
+// reviewTx locks a task, applies the outcome, and records it in history.
+// Reviews of pending tasks follow the EarlyReview policy.
+func (s *Store) reviewTx(tx *dbTx, id string, outcome tasks.Outcome, token string, now time.Time) (ReviewResult, error) {
+	t, err := s.lockTask(tx, id)
+	if err != nil {
+		return ReviewResult{}, err
+	}
+	// Related data includes the tag schedule the outcome follows.
+	if err := loadRelated(tx, []*tasks.Task{t}); err != nil {
+		return ReviewResult{}, err
+	}
+
+	// The row lock is held, so an earlier review with this token has
+	// either committed or will never exist.
+	if token != "" {
+		var (
+			prev  string
+			grade sql.NullString
+		)
+		err := tx.QueryRow(`
+			SELECT result, grade FROM reviews WHERE task_id = ? AND token = ? LIMIT 1
+		`, id, token).Scan(&prev, &grade)
+		switch {
+		case err == nil:
+			if joinGrade(prev, grade) != string(outcome) {
+				return ReviewResult{}, ErrTokenReused
+			}
+			return ReviewResult{Task: t, Replayed: true}, nil
+		case !errors.Is(err, sql.ErrNoRows):
+			return ReviewResult{}, err
+		}
+	}
+
+	if t.ArchivedAt != nil {
+		return ReviewResult{}, tasks.ErrArchived
+	}
+	if t.SuspendedAt != nil {
+		return ReviewResult{}, tasks.ErrSuspended
+	}
+
+	if err := s.applyReview(tx, t, outcome, token, now); err != nil {
+		return ReviewResult{}, err
+	}
+	return ReviewResult{Task: t}, nil
+}
+
+// applyReview applies outcome to a locked task with its related data
+// loaded, then saves it, records the review, and queues the event, plus a
+// TaskCompleted one when the review finished the task.
+func (s *Store) applyReview(tx *dbTx, t *tasks.Task, outcome tasks.Outcome, token string, now time.Time) error {
+	before := *t
+	if err := s.applyOutcome(t, outcome, now); err != nil {
+		return err
+	}
+
+	if err := saveProgress(tx, t); err != nil {
+		return err
+	}
+	if t.Lapses != before.Lapses {
+		if err := saveLeech(tx, &before, t); err != nil {
+			return err
+		}
+	}
+	if err := recordReview(tx, string(outcome), token, &before, t, now); err != nil {
+		return err
+	}
+	if err := s.enqueue(tx, events.TaskReviewed, t, string(outcome), now); err != nil {
+		return err
+	}
+	if before.Status(now) != "done" && t.Status(now) == "done" {
+		return s.enqueue(tx, events.TaskCompleted, t, string(outcome), now)
+	}
+	return nil
+}
+
+// applyOutcome updates t for a review at now, following the EarlyReview
+// policy for pending tasks.
+func (s *Store) applyOutcome(t *tasks.Task, outcome tasks.Outcome, now time.Time) error {
+	if t.Status(now) == "pending" {
+		switch s.opts.EarlyReview {
+		case tasks.EarlyReject:
+			return tasks.ErrNotDue
+		case tasks.EarlyNoAdvance:
+			t.UpdatedAt = now
+			return nil
+		}
+	}
+	return t.Apply(outcome, now)
+}
+
+// ScheduleAt moves a task's next review to at without touching its stage,
+// logging the change in history. See tasks.Task.Reschedule for revive.
+func (s *Store) ScheduleAt(id string, at time.Time, revive bool, now time.Time) (*tasks.Task, error) {
+	tx, err := s.db.begin()
 	if err != nil {
 		return nil, err
 	}
+	defer tx.Rollback()
 
-	if remembered {
-		t.MarkRemembered(now)
+	t, err := s.lockTask(tx, id)
+	if err != nil {
+		return nil, err
+	}
+	if t.ArchivedAt != nil {
+		return nil, tasks.ErrArchived
+	}
+	if t.SuspendedAt != nil {
+		return nil, tasks.ErrSuspended
+	}
+	if err := loadRelated(tx, []*tasks.Task{t}); err != nil {
+		return nil, err
+	}
+	before := *t
+	if err := t.Reschedule(at, revive, now); err != nil {
+		return nil, err
+	}
+
+	if err := saveProgress(tx, t); err != nil {
+		return nil, err
+	}
+	if err := recordReview(tx, ResultScheduled, "", &before, t, now); err != nil {
+		return nil, err
+	}
+	if err := s.enqueue(tx, events.TaskUpdated, t, "", now); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// Archive retires a task from study. Archived tasks keep their schedule
+// and history but are left out of lists, queues, and stats until
+// Unarchive.
+func (s *Store) Archive(id string, now time.Time) (*tasks.Task, error) {
+	return s.setArchived(id, true, now)
+}
+
+// Unarchive returns an archived task to study.
+func (s *Store) Unarchive(id string, now time.Time) (*tasks.Task, error) {
+	return s.setArchived(id, false, now)
+}
+
+func (s *Store) setArchived(id string, archived bool, now time.Time) (*tasks.Task, error) {
+	tx, err := s.db.begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	t, err := s.lockTask(tx, id)
+	if err != nil {
+		return nil, err
+	}
+	if archived {
+		t.Archive(now)
 	} else {
-		t.MarkForgot(now)
+		t.Unarchive(now)
 	}
 
 	if _, err := tx.Exec(`
 		UPDATE tasks
-		SET stage = ?, next_review_at = ?, completed_at = ?, updated_at = ?
+		SET archived_at = ?, updated_at = ?, version = version + 1
 		WHERE id = ?
-	`, t.Stage, nullTime(t.NextReviewAt), nullTimePtr(t.CompletedAt), t.UpdatedAt, t.ID); err != nil {
+	`, nullTimePtr(t.ArchivedAt), t.UpdatedAt, t.ID); err != nil {
+		return nil, err
+	}
+	t.Version++
+	if err := loadRelated(tx, []*tasks.Task{t}); err != nil {
+		return nil, err
+	}
+	if err := s.enqueue(tx, events.TaskUpdated, t, "", now); err != nil {
 		return nil, err
 	}
 
@@ -174,9 +732,20 @@ func (s *Store) Review(id string, remembered bool, now time.Time) (*tasks.Task,
 	return t, nil
 }
 
-// Delete removes a task by ID.
-func (s *Store) Delete(id string) error {
-	res, err := s.db.Exec(`DELETE FROM tasks WHERE id = ?`, id)
+// Delete soft-deletes a task; it disappears from every read but keeps its
+// row and history until purged with HardDelete.
+func (s *Store) Delete(id string, now time.Time) error {
+	tx, err := s.db.begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(`
+		UPDATE tasks
+		SET deleted_at = ?, updated_at = ?, version = version + 1
+		WHERE id = ? AND deleted_at IS NULL
+	`, now, now, id)
 	if err != nil {
 		return err
 	}
@@ -187,11 +756,105 @@ func (s *Store) Delete(id string) error {
 	if affected == 0 {
 		return ErrNotFound
 	}
-	return nil
+	if err := s.enqueueEvent(tx, events.Event{Kind: events.TaskDeleted, TaskID: id, At: now}); err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 
+// Restore brings a soft-deleted task back.
+func (s *Store) Restore(id string, now time.Time) (*tasks.Task, error) {
+	tx, err := s.db.begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(`
+		UPDATE tasks
+		SET deleted_at = NULL, updated_at = ?, version = version + 1
+		WHERE id = ? AND deleted_at IS NOT NULL
+	`, now, id)
+	if err != nil {
+		return nil, err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	if affected == 0 {
+		return nil, ErrNotFound
+	}
+	t, err := s.lockTask(tx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := loadRelated(tx, []*tasks.Task{t}); err != nil {
+		return nil, err
+	}
+	if err := s.enqueue(tx, events.TaskUpdated, t, "", now); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// HardDelete permanently removes a soft-deleted task together with its
+// review history, tags, images, attachments, and places in study
+// sessions. Tasks that are not soft-deleted yet
+// are rejected with ErrNotDeleted.
+func (s *Store) HardDelete(id string) error {
+	tx, err := s.db.begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var deleted sql.NullTime
+	err = tx.QueryRow(`SELECT deleted_at FROM tasks WHERE id = ?`+s.dialect.forUpdate, id).Scan(&deleted)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if !deleted.Valid {
+		return ErrNotDeleted
+	}
+
+	if _, err := tx.Exec(`DELETE FROM reviews WHERE task_id = ?`, id); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM task_tags WHERE task_id = ?`, id); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM task_assets WHERE task_id = ?`, id); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM attachments WHERE task_id = ?`, id); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM session_cards WHERE task_id = ?`, id); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`UPDATE tasks SET sibling_id = NULL, version = version + 1 WHERE sibling_id = ?`, id); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM tasks WHERE id = ?`, id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ensureTable is the baseline migration: it creates the schema as it stood
+// before versioned migrations, or brings an older one up to it. Schema
+// changes since belong in migrations/.
 func (s *Store) ensureTable() error {
-	_, err := s.db.Exec(`
+	d := s.dialect
+	if _, err := s.db.Exec(d.ddl(`
 		CREATE TABLE IF NOT EXISTS tasks (
 			id VARCHAR(24) NOT NULL PRIMARY KEY,
 			question TEXT NOT NULL,
@@ -200,34 +863,393 @@ func (s *Store) ensureTable() error {
 			next_review_at DATETIME NULL,
 			created_at DATETIME NOT NULL,
 			updated_at DATETIME NOT NULL,
-			completed_at DATETIME NULL
-		) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
-	`)
-	if err != nil {
+			completed_at DATETIME NULL,
+			deleted_at DATETIME NULL,
+			difficulty VARCHAR(8) NOT NULL DEFAULT 'normal',
+			archived_at DATETIME NULL,
+			schedule TEXT NULL,
+			answer_match VARCHAR(16) NOT NULL DEFAULT 'exact',
+			suspended_at DATETIME NULL,
+			suspend_reason VARCHAR(16) NULL,
+			scheduler VARCHAR(16) NOT NULL DEFAULT 'stages',
+			ease DOUBLE PRECISION NOT NULL DEFAULT 0,
+			interval_seconds BIGINT NOT NULL DEFAULT 0,
+			stability DOUBLE PRECISION NOT NULL DEFAULT 0,
+			fsrs_difficulty DOUBLE PRECISION NOT NULL DEFAULT 0,
+			last_reviewed_at DATETIME NULL,
+			deck_id VARCHAR(24) NULL,
+			format VARCHAR(16) NOT NULL DEFAULT 'plain',
+			card_type VARCHAR(16) NOT NULL DEFAULT 'basic',
+			sibling_id VARCHAR(24) NULL,
+			lapses INT NOT NULL DEFAULT 0
+		) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`)); err != nil {
 		return fmt.Errorf("create table: %w", err)
 	}
+	if err := s.ensureColumn("tasks", "deleted_at", "DATETIME NULL"); err != nil {
+		return err
+	}
+	if err := s.ensureColumn("tasks", "difficulty", "VARCHAR(8) NOT NULL DEFAULT 'normal'"); err != nil {
+		return err
+	}
+	if err := s.ensureColumn("tasks", "archived_at", "DATETIME NULL"); err != nil {
+		return err
+	}
+	if err := s.ensureColumn("tasks", "schedule", "TEXT NULL"); err != nil {
+		return err
+	}
+	if err := s.ensureColumn("tasks", "answer_match", "VARCHAR(16) NOT NULL DEFAULT 'exact'"); err != nil {
+		return err
+	}
+	if err := s.ensureColumn("tasks", "suspended_at", "DATETIME NULL"); err != nil {
+		return err
+	}
+	if err := s.ensureColumn("tasks", "suspend_reason", "VARCHAR(16) NULL"); err != nil {
+		return err
+	}
+	for _, col := range []struct{ name, def string }{
+		{"scheduler", "VARCHAR(16) NOT NULL DEFAULT 'stages'"},
+		{"ease", "DOUBLE PRECISION NOT NULL DEFAULT 0"},
+		{"interval_seconds", "BIGINT NOT NULL DEFAULT 0"},
+		{"stability", "DOUBLE PRECISION NOT NULL DEFAULT 0"},
+		{"fsrs_difficulty", "DOUBLE PRECISION NOT NULL DEFAULT 0"},
+		{"last_reviewed_at", "DATETIME NULL"},
+		{"deck_id", "VARCHAR(24) NULL"},
+		{"format", "VARCHAR(16) NOT NULL DEFAULT 'plain'"},
+		{"card_type", "VARCHAR(16) NOT NULL DEFAULT 'basic'"},
+		{"sibling_id", "VARCHAR(24) NULL"},
+		{"lapses", "INT NOT NULL DEFAULT 0"},
+	} {
+		if err := s.ensureColumn("tasks", col.name, col.def); err != nil {
+			return err
+		}
+	}
+	if err := s.ensureIndex("tasks", "idx_tasks_deck", "deck_id"); err != nil {
+		return err
+	}
+	if d.fullText {
+		if err := s.ensureIndexKind("FULLTEXT INDEX", "tasks", "idx_tasks_text", "question, answer"); err != nil {
+			return err
+		}
+	}
+	if _, err := s.db.Exec(d.ddl(`
+		CREATE TABLE IF NOT EXISTS reviews (
+			id BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+			task_id VARCHAR(24) NOT NULL,
+			result VARCHAR(16) NOT NULL,
+			stage_before INT NOT NULL,
+			stage_after INT NOT NULL,
+			reviewed_at DATETIME NOT NULL,
+			token VARCHAR(64) NULL,
+			prev_next_review_at DATETIME NULL,
+			prev_completed_at DATETIME NULL,
+			graduated BOOLEAN NULL,
+			prev_ease DOUBLE PRECISION NULL,
+			prev_interval_seconds BIGINT NULL,
+			prev_stability DOUBLE PRECISION NULL,
+			prev_fsrs_difficulty DOUBLE PRECISION NULL,
+			prev_last_reviewed_at DATETIME NULL,
+			grade VARCHAR(16) NULL
+		) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`)); err != nil {
+		return fmt.Errorf("create reviews table: %w", err)
+	}
+	for _, col := range []struct{ name, def string }{
+		{"token", "VARCHAR(64) NULL"},
+		{"prev_next_review_at", "DATETIME NULL"},
+		{"prev_completed_at", "DATETIME NULL"},
+		{"graduated", "BOOLEAN NULL"},
+		{"prev_ease", "DOUBLE PRECISION NULL"},
+		{"prev_interval_seconds", "BIGINT NULL"},
+		{"prev_stability", "DOUBLE PRECISION NULL"},
+		{"prev_fsrs_difficulty", "DOUBLE PRECISION NULL"},
+		{"prev_last_reviewed_at", "DATETIME NULL"},
+		{"grade", "VARCHAR(16) NULL"},
+	} {
+		if err := s.ensureColumn("reviews", col.name, col.def); err != nil {
+			return err
+		}
+	}
+	if err := s.ensureIndex("reviews", "idx_reviews_task", "task_id"); err != nil {
+		return err
+	}
+	if err := s.ensureIndex("reviews", "idx_reviews_reviewed_at", "reviewed_at"); err != nil {
+		return err
+	}
+	if _, err := s.db.Exec(d.ddl(`
+		CREATE TABLE IF NOT EXISTS task_tags (
+			task_id VARCHAR(24) NOT NULL,
+			tag VARCHAR(64) NOT NULL,
+			PRIMARY KEY (task_id, tag)
+		) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`)); err != nil {
+		return fmt.Errorf("create task_tags table: %w", err)
+	}
+	if err := s.ensureIndex("task_tags", "idx_task_tags_tag", "tag"); err != nil {
+		return err
+	}
+	if _, err := s.db.Exec(d.ddl(`
+		CREATE TABLE IF NOT EXISTS task_assets (
+			task_id VARCHAR(24) NOT NULL,
+			side VARCHAR(16) NOT NULL,
+			content_type VARCHAR(32) NOT NULL,
+			data MEDIUMBLOB NOT NULL,
+			updated_at DATETIME NOT NULL,
+			PRIMARY KEY (task_id, side)
+		) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`)); err != nil {
+		return fmt.Errorf("create task_assets table: %w", err)
+	}
+	if _, err := s.db.Exec(d.ddl(`
+		CREATE TABLE IF NOT EXISTS attachments (
+			id VARCHAR(24) NOT NULL PRIMARY KEY,
+			task_id VARCHAR(24) NOT NULL,
+			filename VARCHAR(255) NOT NULL,
+			content_type VARCHAR(128) NOT NULL,
+			size BIGINT NOT NULL,
+			created_at DATETIME NOT NULL
+		) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`)); err != nil {
+		return fmt.Errorf("create attachments table: %w", err)
+	}
+	if err := s.ensureIndex("attachments", "idx_attachments_task", "task_id"); err != nil {
+		return err
+	}
+	if _, err := s.db.Exec(d.ddl(`
+		CREATE TABLE IF NOT EXISTS tag_schedules (
+			tag VARCHAR(64) NOT NULL PRIMARY KEY,
+			schedule TEXT NOT NULL,
+			updated_at DATETIME NOT NULL
+		) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`)); err != nil {
+		return fmt.Errorf("create tag_schedules table: %w", err)
+	}
+	if _, err := s.db.Exec(d.ddl(`
+		CREATE TABLE IF NOT EXISTS decks (
+			id VARCHAR(24) NOT NULL PRIMARY KEY,
+			name VARCHAR(64) NOT NULL,
+			created_at DATETIME NOT NULL,
+			updated_at DATETIME NOT NULL
+		) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`)); err != nil {
+		return fmt.Errorf("create decks table: %w", err)
+	}
+	if _, err := s.db.Exec(d.ddl(`
+		CREATE TABLE IF NOT EXISTS sessions (
+			id VARCHAR(24) NOT NULL PRIMARY KEY,
+			max_reviews INT NOT NULL,
+			max_new INT NOT NULL,
+			created_at DATETIME NOT NULL,
+			finished_at DATETIME NULL,
+			answered INT NOT NULL DEFAULT 0,
+			remembered INT NOT NULL DEFAULT 0,
+			forgot INT NOT NULL DEFAULT 0
+		) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`)); err != nil {
+		return fmt.Errorf("create sessions table: %w", err)
+	}
+	if _, err := s.db.Exec(d.ddl(`
+		CREATE TABLE IF NOT EXISTS session_cards (
+			session_id VARCHAR(24) NOT NULL,
+			position INT NOT NULL,
+			task_id VARCHAR(24) NOT NULL,
+			is_new BOOLEAN NOT NULL,
+			PRIMARY KEY (session_id, position)
+		) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`)); err != nil {
+		return fmt.Errorf("create session_cards table: %w", err)
+	}
+	if _, err := s.db.Exec(d.ddl(`
+		CREATE TABLE IF NOT EXISTS outbox (
+			id BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+			kind VARCHAR(32) NOT NULL,
+			task_id VARCHAR(24) NOT NULL,
+			payload TEXT NOT NULL,
+			created_at DATETIME NOT NULL,
+			attempts INT NOT NULL DEFAULT 0,
+			next_attempt_at DATETIME NOT NULL,
+			sent_at DATETIME NULL,
+			last_error TEXT NULL
+		) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`)); err != nil {
+		return fmt.Errorf("create outbox table: %w", err)
+	}
+	if err := s.ensureIndex("outbox", "idx_outbox_pending", "sent_at, next_attempt_at"); err != nil {
+		return err
+	}
+	if _, err := s.db.Exec(d.ddl(`
+		CREATE TABLE IF NOT EXISTS api_keys (
+			id VARCHAR(24) NOT NULL PRIMARY KEY,
+			name VARCHAR(64) NOT NULL,
+			prefix VARCHAR(16) NOT NULL,
+			key_hash CHAR(64) NOT NULL,
+			created_at DATETIME NOT NULL,
+			last_used_at DATETIME NULL,
+			role VARCHAR(16) NOT NULL DEFAULT 'admin'
+		) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`)); err != nil {
+		return fmt.Errorf("create api_keys table: %w", err)
+	}
+	// Keys minted before roles could do anything, so they stay admins.
+	if err := s.ensureColumn("api_keys", "role", "VARCHAR(16) NOT NULL DEFAULT 'admin'"); err != nil {
+		return err
+	}
+	if err := s.ensureIndexKind("UNIQUE INDEX", "api_keys", "idx_api_keys_hash", "key_hash"); err != nil {
+		return err
+	}
+	if _, err := s.db.Exec(d.ddl(`
+		CREATE TABLE IF NOT EXISTS users (
+			id VARCHAR(24) NOT NULL PRIMARY KEY,
+			name VARCHAR(128) NOT NULL,
+			email VARCHAR(255) NOT NULL,
+			created_at DATETIME NOT NULL,
+			role VARCHAR(16) NOT NULL DEFAULT 'user'
+		) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`)); err != nil {
+		return fmt.Errorf("create users table: %w", err)
+	}
+	if err := s.ensureColumn("users", "role", "VARCHAR(16) NOT NULL DEFAULT 'user'"); err != nil {
+		return err
+	}
+	if _, err := s.db.Exec(d.ddl(`
+		CREATE TABLE IF NOT EXISTS user_identities (
+			provider VARCHAR(16) NOT NULL,
+			subject VARCHAR(255) NOT NULL,
+			user_id VARCHAR(24) NOT NULL,
+			email VARCHAR(255) NOT NULL,
+			created_at DATETIME NOT NULL,
+			PRIMARY KEY (provider, subject)
+		) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`)); err != nil {
+		return fmt.Errorf("create user_identities table: %w", err)
+	}
+	return s.ensureIndex("users", "idx_users_email", "email")
+}
+
+// ensureColumn adds a column to an existing table when an older schema
+// predates it.
+func (s *Store) ensureColumn(table, column, definition string) error {
+	var n int
+	if err := s.db.QueryRow(s.dialect.columnExists, table, column).Scan(&n); err != nil {
+		return fmt.Errorf("inspect %s.%s: %w", table, column, err)
+	}
+	if n > 0 {
+		return nil
+	}
+	if _, err := s.db.Exec(s.dialect.ddl(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))); err != nil {
+		return fmt.Errorf("add column %s.%s: %w", table, column, err)
+	}
+	return nil
+}
+
+// ensureIndex creates an index unless the table already has one by that
+// name. Tables created by older versions declared theirs inline.
+func (s *Store) ensureIndex(table, name, columns string) error {
+	return s.ensureIndexKind("INDEX", table, name, columns)
+}
+
+// ensureIndexKind is ensureIndex for other kinds of index, such as
+// "FULLTEXT INDEX".
+func (s *Store) ensureIndexKind(kind, table, name, columns string) error {
+	var n int
+	if err := s.db.QueryRow(s.dialect.indexExists, table, name).Scan(&n); err != nil {
+		return fmt.Errorf("inspect index %s: %w", name, err)
+	}
+	if n > 0 {
+		return nil
+	}
+	if _, err := s.db.Exec(fmt.Sprintf("CREATE %s %s ON %s (%s)", kind, name, table, columns)); err != nil {
+		return fmt.Errorf("create index %s: %w", name, err)
+	}
 	return nil
 }
 
+// queryer is satisfied by both the store's dbConn and its transactions.
+type queryer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+	context() context.Context
+}
+
+// queryTasks runs a SELECT of taskColumns and returns the tasks with their
+// tags loaded. A row that can't be read fails the query.
+func queryTasks(q queryer, query string, args ...interface{}) ([]*tasks.Task, error) {
+	out, bad, err := scanTasks(q, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	if len(bad) > 0 {
+		return nil, bad[0]
+	}
+	return out, loadRelated(q, out)
+}
+
+// scanTasks runs a SELECT of taskColumns and returns the rows it could
+// read, without related data, and a ScanError for each it couldn't.
+func scanTasks(q queryer, query string, args ...interface{}) ([]*tasks.Task, []*ScanError, error) {
+	rows, err := q.Query(query, args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	out := []*tasks.Task{}
+	var bad []*ScanError
+	for rows.Next() {
+		t, err := scanTask(rows)
+		if err != nil {
+			var se *ScanError
+			if !errors.As(err, &se) {
+				return nil, nil, err
+			}
+			bad = append(bad, se)
+			continue
+		}
+		out = append(out, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+	return out, bad, nil
+}
+
 type scanner interface {
 	Scan(dest ...interface{}) error
 }
 
 func scanTask(row scanner) (*tasks.Task, error) {
 	var (
-		tid       string
-		question  string
-		answer    string
-		stage     int
-		next      sql.NullTime
-		createdAt time.Time
-		updatedAt time.Time
-		completed sql.NullTime
+		tid        string
+		question   string
+		answer     string
+		stage      int
+		next       sql.NullTime
+		createdAt  time.Time
+		updatedAt  time.Time
+		completed  sql.NullTime
+		deleted    sql.NullTime
+		difficulty string
+		archived   sql.NullTime
+		schedule   sql.NullString
+		match      string
+		suspended  sql.NullTime
+		reason     sql.NullString
+		scheduler  string
+		ease       float64
+		ivlSeconds int64
+		stability  float64
+		fsrsDiff   float64
+		lastReview sql.NullTime
+		deck       sql.NullString
+		format     string
+		cardType   string
+		sibling    sql.NullString
+		lapses     int
+		version    int64
 	)
-	if err := row.Scan(&tid, &question, &answer, &stage, &next, &createdAt, &updatedAt, &completed); err != nil {
-		return nil, err
+	// Scan fills destinations in order and stops at the first it can't
+	// convert, so the ID is known whenever a later column is bad.
+	if err := row.Scan(&tid, &question, &answer, &stage, &next, &createdAt, &updatedAt, &completed, &deleted, &difficulty, &archived, &schedule, &match, &suspended, &reason, &scheduler, &ease, &ivlSeconds, &stability, &fsrsDiff, &lastReview, &deck, &format, &cardType, &sibling, &lapses, &version); err != nil {
+		if tid == "" {
+			return nil, err
+		}
+		return nil, &ScanError{ID: tid, Err: err}
+	}
+	sched, err := tasks.ParseStoredSchedule(schedule.String)
+	if err != nil {
+		return nil, &ScanError{ID: tid, Err: fmt.Errorf("stored schedule: %w", err)}
+	}
+	if createdAt.IsZero() || updatedAt.IsZero() {
+		return nil, &ScanError{ID: tid, Err: errors.New("missing created_at or updated_at")}
 	}
-
 	var nextReview time.Time
 	if next.Valid {
 		nextReview = next.Time
@@ -237,19 +1259,107 @@ func scanTask(row scanner) (*tasks.Task, error) {
 		c := completed.Time
 		completedAt = &c
 	}
+	var deletedAt *time.Time
+	if deleted.Valid {
+		d := deleted.Time
+		deletedAt = &d
+	}
+	var archivedAt *time.Time
+	if archived.Valid {
+		a := archived.Time
+		archivedAt = &a
+	}
 
 	return &tasks.Task{
-		ID:           tid,
-		Question:     question,
-		Answer:       answer,
-		Stage:        stage,
-		NextReviewAt: nextReview,
-		CreatedAt:    createdAt,
-		UpdatedAt:    updatedAt,
-		CompletedAt:  completedAt,
+		ID:             tid,
+		Question:       question,
+		Answer:         answer,
+		Stage:          stage,
+		NextReviewAt:   nextReview,
+		CreatedAt:      createdAt,
+		UpdatedAt:      updatedAt,
+		CompletedAt:    completedAt,
+		DeletedAt:      deletedAt,
+		ArchivedAt:     archivedAt,
+		Difficulty:     tasks.Difficulty(difficulty),
+		AnswerMatch:    tasks.Match(match),
+		Schedule:       sched,
+		SuspendedAt:    timePtr(suspended),
+		SuspendReason:  reason.String,
+		Scheduler:      tasks.Scheduler(scheduler),
+		Ease:           ease,
+		Interval:       time.Duration(ivlSeconds) * time.Second,
+		Stability:      stability,
+		FSRSDifficulty: fsrsDiff,
+		LastReviewedAt: timePtr(lastReview),
+		DeckID:         deck.String,
+		Format:         tasks.Format(format),
+		Type:           tasks.CardType(cardType),
+		SiblingID:      sibling.String,
+		Lapses:         lapses,
+		Version:        version,
 	}, nil
 }
 
+// clampStage puts a stored stage that is out of range back in it, as
+// loadRelated's last word on a task read from the database. A negative
+// stage becomes 0, and a stages task beyond the end of its schedule, as
+// resolved with its tags, is left at the end, where it reads as done.
+// Neither is written back; the audit reports the rows.
+func clampStage(ctx context.Context, t *tasks.Task) {
+	switch {
+	case t.Stage < 0:
+		slog.WarnContext(ctx, "store: task has a negative stage, treating it as 0", "task", t.ID, "stage", t.Stage)
+		t.Stage = 0
+	case t.Graduates() && t.Stage > t.StageCount():
+		slog.WarnContext(ctx, "store: task is past the end of its schedule, treating it as done",
+			"task", t.ID, "stage", t.Stage, "stages", t.StageCount())
+		t.Stage = t.StageCount()
+	}
+}
+
+// saveProgress writes a task's schedule state: its stage, next review,
+// completion, lapses, and SM-2 or FSRS state.
+func saveProgress(q queryer, t *tasks.Task) error {
+	_, err := q.Exec(`
+		UPDATE tasks
+		SET stage = ?, next_review_at = ?, completed_at = ?, updated_at = ?, version = version + 1, ease = ?, interval_seconds = ?,
+			stability = ?, fsrs_difficulty = ?, last_reviewed_at = ?, lapses = ?
+		WHERE id = ?
+	`, t.Stage, nullTime(t.NextReviewAt), nullTimePtr(t.CompletedAt), t.UpdatedAt, t.Ease, int64(t.Interval/time.Second),
+		t.Stability, t.FSRSDifficulty, nullTimePtr(t.LastReviewedAt), t.Lapses, t.ID)
+	if err != nil {
+		return err
+	}
+	t.Version++
+	return nil
+}
+
+// schedulerName is the stored name of s; tasks built without one use the
+// stages scheduler.
+func schedulerName(s tasks.Scheduler) string {
+	if s == "" {
+		return string(tasks.SchedulerStages)
+	}
+	return string(s)
+}
+
+// formatName is the stored name of f; tasks built without one are plain.
+func formatName(f tasks.Format) string {
+	if f == "" {
+		return string(tasks.FormatPlain)
+	}
+	return string(f)
+}
+
+// cardTypeName is the stored name of c; tasks built without one are basic.
+func cardTypeName(c tasks.CardType) string {
+	if c == "" {
+		return string(tasks.CardBasic)
+	}
+	return string(c)
+}
+
 func nullTime(t time.Time) sql.NullTime {
 	if t.IsZero() {
 		return sql.NullTime{}
@@ -257,6 +1367,13 @@ func nullTime(t time.Time) sql.NullTime {
 	return sql.NullTime{Time: t, Valid: true}
 }
 
+func nullSchedule(s tasks.Schedule) sql.NullString {
+	if len(s) == 0 {
+		return sql.NullString{}
+	}
+	return sql.NullString{String: s.String(), Valid: true}
+}
+
 func nullTimePtr(t *time.Time) sql.NullTime {
 	if t == nil || t.IsZero() {
 		return sql.NullTime{}
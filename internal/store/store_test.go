@@ -0,0 +1,717 @@
+package store
+
+import (
+	"cmp"
+	"errors"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"yiwang/internal/tasks"
+)
+
+// testNow is the clock the store tests run at, unless they move it.
+var testNow = time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)
+
+// openTest opens a store on a fresh SQLite database that is removed when
+// the test ends.
+func openTest(t *testing.T, opts Options) *Store {
+	t.Helper()
+	opts.Driver = DriverSQLite
+	s, err := NewWithOptions(filepath.Join(t.TempDir(), "test.db"), opts)
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+// createDue adds a task that is ready for review at testNow.
+func createDue(t *testing.T, s *Store) *tasks.Task {
+	t.Helper()
+	var now time.Duration
+	task, err := s.Create("question", "answer", tasks.Options{FirstReviewIn: &now}, testNow)
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	return task
+}
+
+// reviewRows returns the stages each history row of a task moved between,
+// oldest first.
+func reviewRows(t *testing.T, s *Store, id string) [][2]int {
+	t.Helper()
+	rows, err := s.db.Query(`SELECT stage_before, stage_after FROM reviews WHERE task_id = ? ORDER BY id`, id)
+	if err != nil {
+		t.Fatalf("query reviews: %v", err)
+	}
+	defer rows.Close()
+	var out [][2]int
+	for rows.Next() {
+		var r [2]int
+		if err := rows.Scan(&r[0], &r[1]); err != nil {
+			t.Fatalf("scan review: %v", err)
+		}
+		out = append(out, r)
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatalf("query reviews: %v", err)
+	}
+	return out
+}
+
+// reviewConcurrently runs one Review per token at once and returns their
+// results in token order.
+func reviewConcurrently(t *testing.T, s *Store, id string, tokens ...string) []ReviewResult {
+	t.Helper()
+	results := make([]ReviewResult, len(tokens))
+	errs := make([]error, len(tokens))
+	var (
+		wg    sync.WaitGroup
+		start = make(chan struct{})
+	)
+	for i, token := range tokens {
+		wg.Add(1)
+		go func(i int, token string) {
+			defer wg.Done()
+			<-start
+			results[i], errs[i] = s.Review(id, tasks.Remembered, token, testNow)
+		}(i, token)
+	}
+	close(start)
+	wg.Wait()
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("review %d: %v", i, err)
+		}
+	}
+	return results
+}
+
+func TestConcurrentReviewsSameToken(t *testing.T) {
+	s := openTest(t, Options{})
+	task := createDue(t, s)
+
+	results := reviewConcurrently(t, s, task.ID, "tok", "tok")
+
+	replayed := 0
+	for _, r := range results {
+		if r.Replayed {
+			replayed++
+		}
+	}
+	if replayed != 1 {
+		t.Errorf("replayed reviews = %d, want 1", replayed)
+	}
+	got, err := s.Get(task.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Stage != task.Stage+1 {
+		t.Errorf("stage = %d, want %d: one advancement", got.Stage, task.Stage+1)
+	}
+	if rows := reviewRows(t, s, task.ID); len(rows) != 1 {
+		t.Errorf("history rows = %v, want one", rows)
+	}
+}
+
+func TestConcurrentReviewsDistinctTokens(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		policy tasks.EarlyReview
+		// advances is how far the two reviews move the task together.
+		advances int
+	}{
+		// The second review finds the card no longer due, so under
+		// no-advance it is logged without moving the card again.
+		{"no advance", tasks.EarlyNoAdvance, 1},
+		// Allowed early, the second advances from where the first left
+		// the card rather than overwriting it.
+		{"allow", tasks.EarlyAllow, 2},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			s := openTest(t, Options{EarlyReview: tc.policy})
+			task := createDue(t, s)
+
+			reviewConcurrently(t, s, task.ID, "a", "b")
+
+			got, err := s.Get(task.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := task.Stage + tc.advances; got.Stage != want {
+				t.Errorf("stage = %d, want %d", got.Stage, want)
+			}
+			rows := reviewRows(t, s, task.ID)
+			if len(rows) != 2 {
+				t.Fatalf("history rows = %v, want two", rows)
+			}
+			// Each review starts from the state the other left.
+			if rows[0][0] != task.Stage || rows[1][0] != rows[0][1] {
+				t.Errorf("history rows = %v, want the second to start at the first's stage %d", rows, rows[0][1])
+			}
+			if rows[0][1] != task.Stage+1 {
+				t.Errorf("first review moved to stage %d, want %d", rows[0][1], task.Stage+1)
+			}
+		})
+	}
+}
+
+// countRows counts the rows of table whose column equals value.
+func countRows(t *testing.T, s *Store, table, column, value string) int {
+	t.Helper()
+	var n int
+	if err := s.db.QueryRow(`SELECT COUNT(*) FROM `+table+` WHERE `+column+` = ?`, value).Scan(&n); err != nil {
+		t.Fatalf("count %s: %v", table, err)
+	}
+	return n
+}
+
+func TestHardDeleteCascades(t *testing.T) {
+	s := openTest(t, Options{})
+	var now time.Duration
+	task, reverse, err := s.CreateReversible("front", "back", tasks.Options{Tags: []string{"a", "b"}, FirstReviewIn: &now}, testNow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sess, err := s.CreateSession(Filter{}, 10, 10, testNow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Review(task.ID, tasks.Remembered, "", testNow); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.SetImage(task.ID, tasks.SideQuestion, Image{ContentType: "image/png", Data: []byte("png"), UpdatedAt: testNow}); err != nil {
+		t.Fatal(err)
+	}
+	att := tasks.Attachment{ID: "att1", Filename: "notes.txt", ContentType: "text/plain", Size: 5, CreatedAt: testNow}
+	if _, err := s.AddAttachment(task.ID, att); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.HardDelete(task.ID); !errors.Is(err, ErrNotDeleted) {
+		t.Fatalf("HardDelete of a live task = %v, want ErrNotDeleted", err)
+	}
+	if err := s.Delete(task.ID, testNow); err != nil {
+		t.Fatal(err)
+	}
+	related := []struct{ table, column string }{
+		{"tasks", "id"},
+		{"reviews", "task_id"},
+		{"task_tags", "task_id"},
+		{"task_assets", "task_id"},
+		{"attachments", "task_id"},
+		{"session_cards", "task_id"},
+		{"tasks", "sibling_id"},
+	}
+	for _, c := range related {
+		if n := countRows(t, s, c.table, c.column, task.ID); n == 0 {
+			t.Fatalf("no %s rows with %s = %s before the purge", c.table, c.column, task.ID)
+		}
+	}
+	if err := s.HardDelete(task.ID); err != nil {
+		t.Fatalf("HardDelete: %v", err)
+	}
+
+	for _, c := range related {
+		if n := countRows(t, s, c.table, c.column, task.ID); n != 0 {
+			t.Errorf("%s rows with %s = %s: %d, want 0", c.table, c.column, task.ID, n)
+		}
+	}
+	sess, err = s.Session(sess.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(sess.TaskIDs, []string{reverse.ID}) || sess.NewCards != 1 {
+		t.Errorf("session holds %v with %d new, want only the reverse", sess.TaskIDs, sess.NewCards)
+	}
+	got, err := s.Get(reverse.ID)
+	if err != nil {
+		t.Fatalf("reverse of the purged task: %v", err)
+	}
+	if got.SiblingID != "" {
+		t.Errorf("reverse still links to %q", got.SiblingID)
+	}
+	if err := s.HardDelete(task.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("second HardDelete = %v, want ErrNotFound", err)
+	}
+}
+
+// TestEmptyListsAreNotNil checks that list methods return an empty slice,
+// never nil, when there is nothing to list.
+func TestEmptyListsAreNotNil(t *testing.T) {
+	s := openTest(t, Options{})
+	lists := map[string]func() (int, bool, error){
+		"All":             taskList(s.All),
+		"Archived":        taskList(s.Archived),
+		"Deleted":         taskList(s.Deleted),
+		"GetMany nil":     taskList(func() ([]*tasks.Task, error) { return s.GetMany(nil) }),
+		"GetMany missing": taskList(func() ([]*tasks.Task, error) { return s.GetMany([]string{"missing"}) }),
+		"Due":             taskList(func() ([]*tasks.Task, error) { return s.Due(testNow, 10) }),
+		"Search":          taskList(func() ([]*tasks.Task, error) { return s.Search("x", 10) }),
+		"Decks": func() (int, bool, error) {
+			ds, err := s.Decks()
+			return len(ds), ds == nil, err
+		},
+		"TagSchedules": func() (int, bool, error) {
+			ts, err := s.TagSchedules()
+			return len(ts), ts == nil, err
+		},
+		"TagCounts": func() (int, bool, error) {
+			tc, err := s.TagCounts()
+			return len(tc), tc == nil, err
+		},
+	}
+	for name, list := range lists {
+		n, isNil, err := list()
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+		} else if isNil || n != 0 {
+			t.Errorf("%s returned nil or %d items, want an empty slice", name, n)
+		}
+	}
+}
+
+func taskList(list func() ([]*tasks.Task, error)) func() (int, bool, error) {
+	return func() (int, bool, error) {
+		ts, err := list()
+		return len(ts), ts == nil, err
+	}
+}
+
+func TestEarlyReviewPolicies(t *testing.T) {
+	hour := time.Hour
+	for _, tc := range []struct {
+		policy tasks.EarlyReview
+		err    error
+		// advances reports whether the early review moves the card on;
+		// logged whether it is recorded in history.
+		advances, logged bool
+	}{
+		{tasks.EarlyAllow, nil, true, true},
+		{"", nil, true, true},
+		{tasks.EarlyReject, tasks.ErrNotDue, false, false},
+		{tasks.EarlyNoAdvance, nil, false, true},
+	} {
+		t.Run(cmp.Or(string(tc.policy), "default"), func(t *testing.T) {
+			s := openTest(t, Options{EarlyReview: tc.policy})
+			pending, err := s.Create("pending", "a", tasks.Options{FirstReviewIn: &hour}, testNow)
+			if err != nil {
+				t.Fatal(err)
+			}
+			due := createDue(t, s)
+			// Half-way to the pending card's review, with the clock stopped.
+			now := testNow.Add(30 * time.Minute)
+
+			_, err = s.Review(pending.ID, tasks.Remembered, "", now)
+			if !errors.Is(err, tc.err) {
+				t.Fatalf("early review = %v, want %v", err, tc.err)
+			}
+			got, err := s.Get(pending.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if advanced := got.Stage != pending.Stage; advanced != tc.advances {
+				t.Errorf("stage %d -> %d, want advanced %v", pending.Stage, got.Stage, tc.advances)
+			}
+			if !tc.advances && !got.NextReviewAt.Equal(pending.NextReviewAt) {
+				t.Errorf("next review moved from %v to %v", pending.NextReviewAt, got.NextReviewAt)
+			}
+			rows := reviewRows(t, s, pending.ID)
+			if logged := len(rows) == 1; logged != tc.logged {
+				t.Errorf("history = %v, want logged %v", rows, tc.logged)
+			}
+			if tc.logged && !tc.advances && rows[0][0] != rows[0][1] {
+				t.Errorf("no-advance review logged a stage change: %v", rows)
+			}
+
+			// A due card advances under every policy.
+			res, err := s.Review(due.ID, tasks.Remembered, "", now)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.Task.Stage != due.Stage+1 {
+				t.Errorf("due card at stage %d, want %d", res.Task.Stage, due.Stage+1)
+			}
+		})
+	}
+}
+
+func TestScheduleResolution(t *testing.T) {
+	s := openTest(t, Options{})
+	alpha := tasks.Schedule{time.Hour, 2 * time.Hour}
+	beta := tasks.Schedule{3 * time.Hour, 4 * time.Hour, 5 * time.Hour}
+	own := tasks.Schedule{10 * time.Minute}
+	for tag, sched := range map[string]tasks.Schedule{"alpha": alpha, "beta": beta} {
+		if _, err := s.SetTagSchedule(tag, sched, testNow); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, tc := range []struct {
+		name   string
+		opts   tasks.Options
+		source string
+		want   tasks.Schedule
+		tag    string
+	}{
+		{"untagged", tasks.Options{}, "default", tasks.Schedule(tasks.StageDurations), ""},
+		{"unscheduled tag", tasks.Options{Tags: []string{"other"}}, "default", tasks.Schedule(tasks.StageDurations), ""},
+		{"one tag", tasks.Options{Tags: []string{"beta"}}, "tag", beta, "beta"},
+		// Of several scheduled tags the first in sort order wins, whatever
+		// order they were given in.
+		{"conflicting tags", tasks.Options{Tags: []string{"other", "beta", "alpha"}}, "tag", alpha, "alpha"},
+		{"explicit over tag", tasks.Options{Tags: []string{"alpha"}, Schedule: own}, "task", own, ""},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			created, err := s.Create("q", "a", tc.opts, testNow)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := s.Get(created.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, task := range []*tasks.Task{created, got} {
+				if src := task.ScheduleSource(); src != tc.source {
+					t.Errorf("source = %q, want %q", src, tc.source)
+				}
+				if !slices.Equal(task.Stages(), tc.want) {
+					t.Errorf("stages = %v, want %v", task.Stages(), tc.want)
+				}
+				if tc.tag != "" && task.ScheduleTag != tc.tag {
+					t.Errorf("schedule tag = %q, want %q", task.ScheduleTag, tc.tag)
+				}
+			}
+		})
+	}
+
+	// Dropping a tag's schedule sends its tasks back to the default.
+	tagged, err := s.Create("q", "a", tasks.Options{Tags: []string{"beta"}}, testNow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.DeleteTagSchedule("beta"); err != nil {
+		t.Fatal(err)
+	}
+	got, err := s.Get(tagged.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if src := got.ScheduleSource(); src != "default" {
+		t.Errorf("source after the tag schedule went = %q, want default", src)
+	}
+}
+
+func TestCorruptRows(t *testing.T) {
+	s := openTest(t, Options{})
+	negative := createDue(t, s)
+	past := createDue(t, s)
+	badSchedule := createDue(t, s)
+	badTime := createDue(t, s)
+	good := createDue(t, s)
+	for _, c := range []struct {
+		id, set string
+	}{
+		{negative.ID, `stage = -3`},
+		{past.ID, `stage = 99`},
+		{badSchedule.ID, `schedule = 'not a schedule'`},
+		{badTime.ID, `created_at = 'yesterday'`},
+	} {
+		if _, err := s.db.Exec(`UPDATE tasks SET `+c.set+` WHERE id = ?`, c.id); err != nil {
+			t.Fatalf("corrupt %s: %v", c.set, err)
+		}
+	}
+
+	got, err := s.Get(negative.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Stage != 0 {
+		t.Errorf("negative stage read as %d, want 0", got.Stage)
+	}
+	if _, err := s.Review(negative.ID, tasks.Remembered, "", testNow); err != nil {
+		t.Errorf("review from a negative stage: %v", err)
+	}
+
+	// A stage past the schedule's end reads as done instead of indexing
+	// past it.
+	got, err = s.Get(past.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Stage != got.StageCount() || got.Status(testNow) != "done" {
+		t.Errorf("stage 99 read as stage %d, %s; want %d, done", got.Stage, got.Status(testNow), got.StageCount())
+	}
+	if _, err := s.Review(past.ID, tasks.Remembered, "", testNow); err != nil && !errors.Is(err, tasks.ErrCompleted) {
+		t.Errorf("review past the end = %v", err)
+	}
+
+	// Unreadable rows are skipped by lists and reported by ScanErrors.
+	all, err := s.All()
+	if err != nil {
+		t.Fatalf("All with corrupt rows: %v", err)
+	}
+	var ids []string
+	for _, task := range all {
+		ids = append(ids, task.ID)
+	}
+	if want := sortedIDs(negative.ID, past.ID, good.ID); !slices.Equal(sortedIDs(ids...), want) {
+		t.Errorf("All = %v, want %v", ids, want)
+	}
+	bad, err := s.ScanErrors()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var badIDs []string
+	for _, e := range bad {
+		badIDs = append(badIDs, e.ID)
+	}
+	if want := sortedIDs(badSchedule.ID, badTime.ID); !slices.Equal(sortedIDs(badIDs...), want) {
+		t.Errorf("ScanErrors = %v, want %v", bad, want)
+	}
+	for _, id := range []string{badSchedule.ID, badTime.ID} {
+		var se *ScanError
+		if _, err := s.Get(id); !errors.As(err, &se) || se.ID != id {
+			t.Errorf("Get(%s) = %v, want a ScanError for it", id, err)
+		}
+	}
+}
+
+func sortedIDs(ids ...string) []string {
+	ids = slices.Clone(ids)
+	slices.Sort(ids)
+	return ids
+}
+
+func TestAuditFindsEachAnomaly(t *testing.T) {
+	s := openTest(t, Options{})
+	seeded := map[string]string{}
+	seed := func(check, set string) {
+		t.Helper()
+		task := createDue(t, s)
+		if _, err := s.db.Exec(`UPDATE tasks SET `+set+` WHERE id = ?`, task.ID); err != nil {
+			t.Fatalf("seed %s: %v", check, err)
+		}
+		seeded[check] = task.ID
+	}
+	seed("negative_stage", `stage = -1`)
+	seed("done_with_next_review", `completed_at = next_review_at`)
+	seed("open_without_next_review", `next_review_at = NULL`)
+	seed("orphaned_deck", `deck_id = 'gone'`)
+	seed("stage_past_end", `stage = 20`)
+
+	// A task removed behind the store's back leaves its history, tags and
+	// image behind.
+	var now time.Duration
+	gone, err := s.Create("gone", "a", tasks.Options{Tags: []string{"orphan"}, FirstReviewIn: &now}, testNow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Review(gone.ID, tasks.Remembered, "", testNow); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.SetImage(gone.ID, tasks.SideQuestion, Image{ContentType: "image/png", Data: []byte("png"), UpdatedAt: testNow}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.db.Exec(`DELETE FROM tasks WHERE id = ?`, gone.ID); err != nil {
+		t.Fatal(err)
+	}
+	for _, check := range []string{"orphaned_history", "orphaned_tags", "orphaned_images"} {
+		seeded[check] = gone.ID
+	}
+	// A healthy task shows up in no finding.
+	createDue(t, s)
+
+	findings, err := s.Audit(false, testNow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(findings) != len(seeded) {
+		t.Errorf("%d findings, want one per seeded anomaly, %d", len(findings), len(seeded))
+	}
+	for _, f := range findings {
+		id, ok := seeded[f.Check]
+		if !ok {
+			t.Errorf("unexpected check %s", f.Check)
+			continue
+		}
+		if f.Count != 1 || !slices.Equal(f.Sample, []string{id}) || f.Repaired != 0 {
+			t.Errorf("%s = %+v, want one row, %s, unrepaired", f.Check, f, id)
+		}
+		if f.Repairable == (f.Check == "stage_past_end") {
+			t.Errorf("%s repairable = %v", f.Check, f.Repairable)
+		}
+	}
+
+	repaired, err := s.Audit(true, testNow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range repaired {
+		want := 0
+		if f.Repairable {
+			want = 1
+		}
+		if f.Repaired != want {
+			t.Errorf("%s repaired %d rows, want %d", f.Check, f.Repaired, want)
+		}
+	}
+	after, err := s.Audit(false, testNow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range after {
+		want := 0
+		if !f.Repairable {
+			want = 1
+		}
+		if f.Count != want {
+			t.Errorf("%s after repair: %d rows, want %d", f.Check, f.Count, want)
+		}
+	}
+}
+
+// TestFilterMatchesStatus checks that each status filter selects exactly
+// the tasks Task.Status gives that status, including tasks past the end of
+// a schedule that shrank under them.
+func TestFilterMatchesStatus(t *testing.T) {
+	s := openTest(t, Options{})
+	hour := time.Hour
+	for tag, n := range map[string]int{"short": 2, "a-long": 10} {
+		sched := make(tasks.Schedule, n)
+		for i := range sched {
+			sched[i] = time.Duration(i+1) * time.Hour
+		}
+		if _, err := s.SetTagSchedule(tag, sched, testNow); err != nil {
+			t.Fatal(err)
+		}
+	}
+	create := func(opts tasks.Options, stage int) *tasks.Task {
+		t.Helper()
+		zero := time.Duration(0)
+		if opts.FirstReviewIn == nil {
+			opts.FirstReviewIn = &zero
+		}
+		task, err := s.Create("q", "a", opts, testNow)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := s.db.Exec(`UPDATE tasks SET stage = ? WHERE id = ?`, stage, task.ID); err != nil {
+			t.Fatal(err)
+		}
+		return task
+	}
+	pastDefault := create(tasks.Options{}, tasks.TotalStages())
+	pastTag := create(tasks.Options{Tags: []string{"short"}}, 2)
+	pastOwn := create(tasks.Options{Schedule: tasks.Schedule{hour}}, 1)
+	// On a longer tag schedule, a stage past the default's end is fine;
+	// of two tag schedules the alphabetically first one counts.
+	longTag := create(tasks.Options{Tags: []string{"a-long", "short"}}, 9)
+	ready := create(tasks.Options{}, 0)
+	pending := create(tasks.Options{FirstReviewIn: &hour}, 0)
+	if _, err := s.db.Exec(`UPDATE tasks SET next_review_at = NULL WHERE id = ?`, ready.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	all, err := s.All()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string][]string{}
+	for _, task := range all {
+		status := task.Status(testNow)
+		want[status] = append(want[status], task.ID)
+	}
+	if got := sortedIDs(want["done"]...); !slices.Equal(got, sortedIDs(pastDefault.ID, pastTag.ID, pastOwn.ID)) {
+		t.Fatalf("done by Status = %v, want the three tasks past their end", got)
+	}
+	if got := sortedIDs(want["ready"]...); !slices.Equal(got, sortedIDs(longTag.ID, ready.ID)) {
+		t.Fatalf("ready by Status = %v", got)
+	}
+	if !slices.Equal(want["pending"], []string{pending.ID}) {
+		t.Fatalf("pending by Status = %v", want["pending"])
+	}
+	for _, status := range []string{"ready", "pending", "done"} {
+		ts, total, err := s.ListPage(Filter{Status: status}, Page{}, testNow)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var ids []string
+		for _, task := range ts {
+			ids = append(ids, task.ID)
+		}
+		if got := sortedIDs(ids...); !slices.Equal(got, sortedIDs(want[status]...)) || total != len(ids) {
+			t.Errorf("status=%s lists %v (total %d), want %v", status, got, total, sortedIDs(want[status]...))
+		}
+	}
+
+	// Bulk actions on ready tasks leave the finished ones alone.
+	reset, err := s.Reset(Filter{Status: "ready"}, testNow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for _, task := range reset {
+		ids = append(ids, task.ID)
+	}
+	if got := sortedIDs(ids...); !slices.Equal(got, sortedIDs(want["ready"]...)) {
+		t.Errorf("reset %v, want only the ready tasks %v", got, sortedIDs(want["ready"]...))
+	}
+}
+
+func TestCreateFirstAPIKeyOnce(t *testing.T) {
+	s := openTest(t, Options{})
+
+	const n = 8
+	errs := make([]error, n)
+	var (
+		wg    sync.WaitGroup
+		start = make(chan struct{})
+	)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			<-start
+			_, _, errs[i] = s.CreateFirstAPIKey("script", testNow)
+		}(i)
+	}
+	close(start)
+	wg.Wait()
+
+	minted := 0
+	for i, err := range errs {
+		switch {
+		case err == nil:
+			minted++
+		case !errors.Is(err, ErrAdminExists):
+			t.Fatalf("mint %d: %v", i, err)
+		}
+	}
+	if minted != 1 {
+		t.Errorf("admin keys minted = %d, want 1", minted)
+	}
+}
+
+func TestCreateFirstAPIKeyAfterAdminUser(t *testing.T) {
+	s := openTest(t, Options{})
+	if _, _, err := s.CreateAPIKey("script", RoleUser, testNow); err != nil {
+		t.Fatal(err)
+	}
+	if admin, err := s.HasAdmin(); err != nil || admin {
+		t.Fatalf("HasAdmin with a user key = %v, %v; want false", admin, err)
+	}
+	id := Identity{Provider: "github", Subject: "1", Name: "Ada", Email: "ada@example.com"}
+	if _, err := s.SignIn(id, "", RoleAdmin, testNow); err != nil {
+		t.Fatal(err)
+	}
+	if admin, err := s.HasAdmin(); err != nil || !admin {
+		t.Fatalf("HasAdmin with an admin user = %v, %v; want true", admin, err)
+	}
+	if _, _, err := s.CreateFirstAPIKey("script", testNow); !errors.Is(err, ErrAdminExists) {
+		t.Errorf("CreateFirstAPIKey = %v, want ErrAdminExists", err)
+	}
+}
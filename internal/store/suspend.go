@@ -0,0 +1,170 @@
+package store
+
+import (
+	"time"
+
+	"yiwang/internal/events"
+	"yiwang/internal/tasks"
+)
+
+// SuspendStale suspends every active, unfinished task whose review was due
+// before cutoff, recording tasks.SuspendStale as the reason. It returns
+// the tasks it suspended.
+func (s *Store) SuspendStale(cutoff, now time.Time) ([]*tasks.Task, error) {
+	tx, err := s.db.begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	ts, err := queryTasks(tx, `
+		SELECT `+taskColumns+`
+		FROM tasks
+		WHERE deleted_at IS NULL AND archived_at IS NULL AND suspended_at IS NULL
+			AND completed_at IS NULL AND next_review_at < ?
+	`+s.dialect.forUpdate, cutoff)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, t := range ts {
+		t.Suspend(tasks.SuspendStale, now)
+		if _, err := tx.Exec(`
+			UPDATE tasks
+			SET suspended_at = ?, suspend_reason = ?, updated_at = ?, version = version + 1
+			WHERE id = ?
+		`, t.SuspendedAt, t.SuspendReason, t.UpdatedAt, t.ID); err != nil {
+			return nil, err
+		}
+		t.Version++
+		if err := s.enqueue(tx, events.TaskUpdated, t, "", now); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return ts, nil
+}
+
+// Unsuspend returns the suspended tasks matching f to the queue, only
+// those suspended for reason unless it is empty; f.Status is ignored. Tasks
+// that were overdue become due at now, which is logged in history like any
+// reschedule. It returns the tasks it unsuspended.
+func (s *Store) Unsuspend(f Filter, reason string, now time.Time) ([]*tasks.Task, error) {
+	f.Status = "suspended"
+	where, args, err := f.where(now)
+	if err != nil {
+		return nil, err
+	}
+	if reason != "" {
+		where += " AND suspend_reason = ?"
+		args = append(args, reason)
+	}
+
+	tx, err := s.db.begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	ts, err := queryTasks(tx, `
+		SELECT `+taskColumns+`
+		FROM tasks
+		WHERE `+where+`
+	`+s.dialect.forUpdate, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, t := range ts {
+		before := *t
+		t.Unsuspend(now)
+		if _, err := tx.Exec(`
+			UPDATE tasks
+			SET suspended_at = NULL, suspend_reason = NULL, next_review_at = ?, updated_at = ?, version = version + 1
+			WHERE id = ?
+		`, nullTime(t.NextReviewAt), t.UpdatedAt, t.ID); err != nil {
+			return nil, err
+		}
+		t.Version++
+		if !t.NextReviewAt.Equal(before.NextReviewAt) {
+			if err := recordReview(tx, ResultScheduled, "", &before, t, now); err != nil {
+				return nil, err
+			}
+		}
+		if err := s.enqueue(tx, events.TaskUpdated, t, "", now); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return ts, nil
+}
+
+// SuspendTask takes one task out of the review queue, keeping its stage,
+// schedule, and history, and records tasks.SuspendManual as the reason.
+// Suspending a suspended task keeps its original time and reason.
+func (s *Store) SuspendTask(id string, now time.Time) (*tasks.Task, error) {
+	return s.setSuspended(id, true, now)
+}
+
+// UnsuspendTask returns one suspended task to the queue, whatever it was
+// suspended for. Like Unsuspend, an overdue task becomes due at now.
+func (s *Store) UnsuspendTask(id string, now time.Time) (*tasks.Task, error) {
+	return s.setSuspended(id, false, now)
+}
+
+func (s *Store) setSuspended(id string, suspended bool, now time.Time) (*tasks.Task, error) {
+	tx, err := s.db.begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	t, err := s.lockTask(tx, id)
+	if err != nil {
+		return nil, err
+	}
+	before := *t
+	if suspended {
+		t.Suspend(tasks.SuspendManual, now)
+	} else {
+		t.Unsuspend(now)
+	}
+	if (t.SuspendedAt != nil) == (before.SuspendedAt != nil) {
+		// Already in the requested state: nothing to write or announce.
+		if err := loadRelated(tx, []*tasks.Task{t}); err != nil {
+			return nil, err
+		}
+		return t, nil
+	}
+
+	if _, err := tx.Exec(`
+		UPDATE tasks
+		SET suspended_at = ?, suspend_reason = ?, next_review_at = ?, updated_at = ?, version = version + 1
+		WHERE id = ?
+	`, nullTimePtr(t.SuspendedAt), nullString(t.SuspendReason), nullTime(t.NextReviewAt), t.UpdatedAt, t.ID); err != nil {
+		return nil, err
+	}
+	t.Version++
+	if !t.NextReviewAt.Equal(before.NextReviewAt) {
+		if err := recordReview(tx, ResultScheduled, "", &before, t, now); err != nil {
+			return nil, err
+		}
+	}
+	if err := loadRelated(tx, []*tasks.Task{t}); err != nil {
+		return nil, err
+	}
+	if err := s.enqueue(tx, events.TaskUpdated, t, "", now); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
@@ -0,0 +1,92 @@
+package store
+
+import (
+	"strings"
+
+	"yiwang/internal/tasks"
+)
+
+// setTags replaces a task's tags.
+func setTags(q queryer, taskID string, tags []string) error {
+	if _, err := q.Exec(`DELETE FROM task_tags WHERE task_id = ?`, taskID); err != nil {
+		return err
+	}
+	for _, tag := range tags {
+		if _, err := q.Exec(`INSERT INTO task_tags (task_id, tag) VALUES (?, ?)`, taskID, tag); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadTags fills in Tags for each task with one query.
+func loadTags(q queryer, ts []*tasks.Task) error {
+	if len(ts) == 0 {
+		return nil
+	}
+	byID := make(map[string]*tasks.Task, len(ts))
+	args := make([]interface{}, 0, len(ts))
+	for _, t := range ts {
+		t.Tags = []string{}
+		byID[t.ID] = t
+		args = append(args, t.ID)
+	}
+
+	rows, err := q.Query(`
+		SELECT task_id, tag
+		FROM task_tags
+		WHERE task_id IN (`+placeholders(len(args))+`)
+		ORDER BY tag
+	`, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id, tag string
+		if err := rows.Scan(&id, &tag); err != nil {
+			return err
+		}
+		if t := byID[id]; t != nil {
+			t.Tags = append(t.Tags, tag)
+		}
+	}
+	return rows.Err()
+}
+
+// TagCount is a tag with the number of active tasks carrying it.
+type TagCount struct {
+	Tag   string
+	Tasks int
+}
+
+// TagCounts returns every tag used by an active task, most used first
+// and then by name.
+func (s *Store) TagCounts() ([]TagCount, error) {
+	rows, err := s.db.Query(`
+		SELECT tt.tag, COUNT(*) AS n
+		FROM task_tags tt
+		JOIN tasks t ON t.id = tt.task_id
+		WHERE t.deleted_at IS NULL AND t.archived_at IS NULL
+		GROUP BY tt.tag
+		ORDER BY n DESC, tt.tag
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []TagCount{}
+	for rows.Next() {
+		var tc TagCount
+		if err := rows.Scan(&tc.Tag, &tc.Tasks); err != nil {
+			return nil, err
+		}
+		out = append(out, tc)
+	}
+	return out, rows.Err()
+}
+
+// placeholders returns "?, ?, ..." with n markers.
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
@@ -0,0 +1,180 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("yiwang/internal/store")
+
+// dbConn is the store's handle on the database. Its statements and the
+// transactions it begins run under ctx unless given their own, and each
+// statement gets a trace span, a child of whatever span ctx carries. A
+// failed statement is logged with ctx's request ID.
+// Without a tracer provider installed the spans cost next to nothing.
+type dbConn struct {
+	*sql.DB
+	ctx    context.Context
+	system string
+}
+
+// dbTx is a transaction begun by dbConn. Its statements are traced like
+// dbConn's, under one span covering the whole transaction.
+type dbTx struct {
+	*sql.Tx
+	ctx    context.Context
+	span   trace.Span
+	system string
+}
+
+// BeginTx starts a transaction under ctx.
+func (d *dbConn) BeginTx(ctx context.Context, opts *sql.TxOptions) (*dbTx, error) {
+	ctx, span := tracer.Start(ctx, "db transaction", trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("db.system", d.system)))
+	tx, err := d.DB.BeginTx(ctx, opts)
+	if err != nil {
+		endSpan(span, err)
+		return nil, err
+	}
+	return &dbTx{Tx: tx, ctx: ctx, span: span, system: d.system}, nil
+}
+
+// begin starts a transaction under the handle's own context.
+func (d *dbConn) begin() (*dbTx, error) {
+	return d.BeginTx(d.ctx, nil)
+}
+
+// context is what the handle's statements run under.
+func (d *dbConn) context() context.Context { return d.ctx }
+
+func (d *dbConn) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return d.ExecContext(d.ctx, query, args...)
+}
+
+func (d *dbConn) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return d.QueryContext(d.ctx, query, args...)
+}
+
+func (d *dbConn) QueryRow(query string, args ...interface{}) *sql.Row {
+	return d.QueryRowContext(d.ctx, query, args...)
+}
+
+func (d *dbConn) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	ctx, span := startStatement(ctx, d.system, query)
+	res, err := d.DB.ExecContext(ctx, query, args...)
+	endStatement(ctx, span, query, err)
+	return res, err
+}
+
+func (d *dbConn) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	ctx, span := startStatement(ctx, d.system, query)
+	rows, err := d.DB.QueryContext(ctx, query, args...)
+	endStatement(ctx, span, query, err)
+	return rows, err
+}
+
+// QueryRowContext's span ends before the row is scanned, so it times the
+// query but can't see a sql.ErrNoRows.
+func (d *dbConn) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	ctx, span := startStatement(ctx, d.system, query)
+	row := d.DB.QueryRowContext(ctx, query, args...)
+	endStatement(ctx, span, query, row.Err())
+	return row
+}
+
+// context is what the transaction's statements run under.
+func (t *dbTx) context() context.Context { return t.ctx }
+
+func (t *dbTx) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return t.ExecContext(t.ctx, query, args...)
+}
+
+func (t *dbTx) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return t.QueryContext(t.ctx, query, args...)
+}
+
+func (t *dbTx) QueryRow(query string, args ...interface{}) *sql.Row {
+	return t.QueryRowContext(t.ctx, query, args...)
+}
+
+func (t *dbTx) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	ctx, span := startStatement(ctx, t.system, query)
+	res, err := t.Tx.ExecContext(ctx, query, args...)
+	endStatement(ctx, span, query, err)
+	return res, err
+}
+
+func (t *dbTx) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	ctx, span := startStatement(ctx, t.system, query)
+	rows, err := t.Tx.QueryContext(ctx, query, args...)
+	endStatement(ctx, span, query, err)
+	return rows, err
+}
+
+func (t *dbTx) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	ctx, span := startStatement(ctx, t.system, query)
+	row := t.Tx.QueryRowContext(ctx, query, args...)
+	endStatement(ctx, span, query, row.Err())
+	return row
+}
+
+func (t *dbTx) Commit() error {
+	err := t.Tx.Commit()
+	endSpan(t.span, err)
+	return err
+}
+
+// Rollback ends the transaction's span unless Commit already did, as it
+// has when a deferred Rollback runs after a successful Commit.
+func (t *dbTx) Rollback() error {
+	err := t.Tx.Rollback()
+	if err == sql.ErrTxDone {
+		return err
+	}
+	t.span.SetAttributes(attribute.Bool("db.rolled_back", true))
+	endSpan(t.span, err)
+	return err
+}
+
+// startStatement starts the span of one SQL statement, named after its
+// first keyword, with the statement itself as an attribute.
+func startStatement(ctx context.Context, system, query string) (context.Context, trace.Span) {
+	ctx, span := tracer.Start(ctx, "db statement", trace.WithSpanKind(trace.SpanKindClient))
+	if !span.IsRecording() {
+		return ctx, span
+	}
+	statement := strings.Join(strings.Fields(query), " ")
+	op, _, _ := strings.Cut(statement, " ")
+	op = strings.ToUpper(op)
+	span.SetName("db " + op)
+	span.SetAttributes(
+		attribute.String("db.system", system),
+		attribute.String("db.operation", op),
+		attribute.String("db.statement", statement),
+	)
+	return ctx, span
+}
+
+// endStatement ends a statement's span and logs its failure, with the
+// request ID ctx carries, unless the caller gave up on it first.
+func endStatement(ctx context.Context, span trace.Span, query string, err error) {
+	if err != nil && err != sql.ErrNoRows && ctx.Err() == nil {
+		slog.WarnContext(ctx, "store: statement failed", "statement", strings.Join(strings.Fields(query), " "), "err", err)
+	}
+	endSpan(span, err)
+}
+
+func endSpan(span trace.Span, err error) {
+	if err != nil && err != sql.ErrNoRows {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
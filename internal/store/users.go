@@ -0,0 +1,218 @@
+package store
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+)
+
+var (
+	ErrUserNotFound = errors.New("user not found")
+	ErrLastAdmin    = errors.New("the last admin can't be removed or demoted")
+)
+
+// Roles of users and API keys. Admins can also manage users, keys and
+// server settings.
+const (
+	RoleAdmin = "admin"
+	RoleUser  = "user"
+)
+
+// ValidRole reports whether role is a known role.
+func ValidRole(role string) bool {
+	return role == RoleAdmin || role == RoleUser
+}
+
+// User is someone who signs in through an OAuth provider.
+type User struct {
+	ID        string
+	Name      string
+	Email     string
+	CreatedAt time.Time
+	Role      string
+}
+
+const userColumns = `id, name, email, created_at, role`
+
+func scanUser(row interface{ Scan(...interface{}) error }, u *User) error {
+	return row.Scan(&u.ID, &u.Name, &u.Email, &u.CreatedAt, &u.Role)
+}
+
+// Identity is a user's account at an OAuth provider, such as their
+// GitHub user ID.
+type Identity struct {
+	Provider string
+	Subject  string
+	Name     string
+	Email    string
+	// EmailVerified is set when the provider vouches for Email, which is
+	// what lets it link the identity to a user with the same address.
+	EmailVerified bool
+}
+
+// SignIn returns the user an identity belongs to. An identity seen for the
+// first time is linked to the user linkTo when given, as when a signed-in
+// user connects a second provider, else to the user with the same verified
+// email, else to a new user with role. Who may sign in, and who becomes an
+// admin, is the caller's decision.
+func (s *Store) SignIn(id Identity, linkTo, role string, now time.Time) (User, error) {
+	tx, err := s.db.begin()
+	if err != nil {
+		return User{}, err
+	}
+	defer tx.Rollback()
+
+	var userID string
+	err = tx.QueryRow(`
+		SELECT user_id FROM user_identities WHERE provider = ? AND subject = ?
+	`, id.Provider, id.Subject).Scan(&userID)
+	switch {
+	case err == nil:
+		return userByID(tx, userID)
+	case !errors.Is(err, sql.ErrNoRows):
+		return User{}, err
+	}
+
+	email := strings.ToLower(strings.TrimSpace(id.Email))
+	switch {
+	case linkTo != "":
+		userID = linkTo
+	case email != "" && id.EmailVerified:
+		err := tx.QueryRow(`SELECT id FROM users WHERE email = ? ORDER BY created_at LIMIT 1`, email).Scan(&userID)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return User{}, err
+		}
+	}
+	if userID == "" {
+		if userID, err = newUserID(); err != nil {
+			return User{}, err
+		}
+		name := strings.TrimSpace(id.Name)
+		if name == "" {
+			name, _, _ = strings.Cut(email, "@")
+		}
+		if _, err := tx.Exec(`
+			INSERT INTO users (id, name, email, created_at, role) VALUES (?, ?, ?, ?, ?)
+		`, userID, name, email, now, role); err != nil {
+			return User{}, err
+		}
+	}
+	if _, err := tx.Exec(`
+		INSERT INTO user_identities (provider, subject, user_id, email, created_at) VALUES (?, ?, ?, ?, ?)
+	`, id.Provider, id.Subject, userID, email, now); err != nil {
+		return User{}, err
+	}
+	u, err := userByID(tx, userID)
+	if err != nil {
+		return User{}, err
+	}
+	return u, tx.Commit()
+}
+
+// User returns a user by ID.
+func (s *Store) User(id string) (User, error) {
+	return userByID(s.db, id)
+}
+
+// Users returns every user, oldest first.
+func (s *Store) Users() ([]User, error) {
+	rows, err := s.db.Query(`SELECT ` + userColumns + ` FROM users ORDER BY created_at, id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []User{}
+	for rows.Next() {
+		var u User
+		if err := scanUser(rows, &u); err != nil {
+			return nil, err
+		}
+		out = append(out, u)
+	}
+	return out, rows.Err()
+}
+
+// SetUserRole changes a user's role. Demoting the last admin fails with
+// ErrLastAdmin.
+func (s *Store) SetUserRole(id, role string) (User, error) {
+	tx, err := s.db.begin()
+	if err != nil {
+		return User{}, err
+	}
+	defer tx.Rollback()
+
+	u, err := userByID(tx, id)
+	if err != nil {
+		return User{}, err
+	}
+	if u.Role == RoleAdmin && role != RoleAdmin {
+		if err := checkOtherAdmin(tx, id); err != nil {
+			return User{}, err
+		}
+	}
+	if _, err := tx.Exec(`UPDATE users SET role = ? WHERE id = ?`, role, id); err != nil {
+		return User{}, err
+	}
+	u.Role = role
+	return u, tx.Commit()
+}
+
+// DeleteUser removes a user and their provider identities; their
+// sessions stop working. Removing the last admin fails with ErrLastAdmin.
+func (s *Store) DeleteUser(id string) error {
+	tx, err := s.db.begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	u, err := userByID(tx, id)
+	if err != nil {
+		return err
+	}
+	if u.Role == RoleAdmin {
+		if err := checkOtherAdmin(tx, id); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.Exec(`DELETE FROM user_identities WHERE user_id = ?`, id); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM users WHERE id = ?`, id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// checkOtherAdmin returns ErrLastAdmin unless a user other than id is an
+// admin.
+func checkOtherAdmin(q queryer, id string) error {
+	var n int
+	if err := q.QueryRow(`SELECT COUNT(*) FROM users WHERE role = ? AND id <> ?`, RoleAdmin, id).Scan(&n); err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrLastAdmin
+	}
+	return nil
+}
+
+func userByID(q queryer, id string) (User, error) {
+	var u User
+	err := scanUser(q.QueryRow(`SELECT `+userColumns+` FROM users WHERE id = ?`, id), &u)
+	if errors.Is(err, sql.ErrNoRows) {
+		return User{}, ErrUserNotFound
+	}
+	return u, err
+}
+
+func newUserID() (string, error) {
+	var b [12]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b[:]), nil
+}
@@ -0,0 +1,272 @@
+package store
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"yiwang/internal/events"
+)
+
+var ErrWebhookNotFound = errors.New("webhook not found")
+
+// Webhook is an endpoint registered to receive events. Payloads sent to
+// it are signed with Secret.
+type Webhook struct {
+	ID     string
+	URL    string
+	Secret string
+	// Events are the kinds sent to the hook; empty means all of them.
+	Events    []events.Kind
+	CreatedAt time.Time
+}
+
+// Wants reports whether events of kind should be sent to w.
+func (w Webhook) Wants(kind events.Kind) bool {
+	if len(w.Events) == 0 {
+		return true
+	}
+	for _, k := range w.Events {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// Delivery is one event sent, or still to be sent, to a webhook. An empty
+// WebhookID is the endpoint given by -webhook-url.
+type Delivery struct {
+	ID        int64
+	WebhookID string
+	Kind      events.Kind
+	TaskID    string
+	Payload   []byte
+	CreatedAt time.Time
+	Attempts  int
+	// NextAttemptAt is nil once the delivery succeeded or was given up.
+	NextAttemptAt *time.Time
+	DeliveredAt   *time.Time
+	// StatusCode is the endpoint's answer to the latest attempt, 0 when
+	// it didn't answer.
+	StatusCode int
+	LastError  string
+}
+
+// CreateWebhook registers url for events (all kinds when empty), signing
+// with secret or, when it is empty, a generated one.
+func (s *Store) CreateWebhook(url, secret string, kinds []events.Kind, now time.Time) (Webhook, error) {
+	var id [12]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		return Webhook{}, err
+	}
+	if secret == "" {
+		var b [24]byte
+		if _, err := rand.Read(b[:]); err != nil {
+			return Webhook{}, err
+		}
+		secret = hex.EncodeToString(b[:])
+	}
+	w := Webhook{ID: hex.EncodeToString(id[:]), URL: url, Secret: secret, Events: kinds, CreatedAt: now}
+	if _, err := s.db.Exec(`
+		INSERT INTO webhooks (id, url, secret, events, created_at) VALUES (?, ?, ?, ?, ?)
+	`, w.ID, w.URL, w.Secret, joinKinds(kinds), w.CreatedAt); err != nil {
+		return Webhook{}, err
+	}
+	return w, nil
+}
+
+// Webhooks returns every registered webhook, oldest first.
+func (s *Store) Webhooks() ([]Webhook, error) {
+	rows, err := s.db.Query(`SELECT id, url, secret, events, created_at FROM webhooks ORDER BY created_at, id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []Webhook{}
+	for rows.Next() {
+		var (
+			w     Webhook
+			kinds string
+		)
+		if err := rows.Scan(&w.ID, &w.URL, &w.Secret, &kinds, &w.CreatedAt); err != nil {
+			return nil, err
+		}
+		w.Events = splitKinds(kinds)
+		out = append(out, w)
+	}
+	return out, rows.Err()
+}
+
+// Webhook returns one webhook, or ErrWebhookNotFound.
+func (s *Store) Webhook(id string) (Webhook, error) {
+	var (
+		w     Webhook
+		kinds string
+	)
+	err := s.db.QueryRow(`
+		SELECT id, url, secret, events, created_at FROM webhooks WHERE id = ?
+	`, id).Scan(&w.ID, &w.URL, &w.Secret, &kinds, &w.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Webhook{}, ErrWebhookNotFound
+	}
+	if err != nil {
+		return Webhook{}, err
+	}
+	w.Events = splitKinds(kinds)
+	return w, nil
+}
+
+// DeleteWebhook unregisters a webhook along with its delivery log, so
+// nothing more is sent to it.
+func (s *Store) DeleteWebhook(id string) error {
+	tx, err := s.db.begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	res, err := tx.Exec(`DELETE FROM webhooks WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrWebhookNotFound
+	}
+	if _, err := tx.Exec(`DELETE FROM webhook_deliveries WHERE webhook_id = ?`, id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// QueueDeliveries turns an outbox entry into a delivery for each of
+// webhookIDs and marks it sent, in one transaction, so an entry is fanned
+// out exactly once.
+func (s *Store) QueueDeliveries(e OutboxEntry, webhookIDs []string, now time.Time) error {
+	tx, err := s.db.begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, id := range webhookIDs {
+		if _, err := tx.Exec(`
+			INSERT INTO webhook_deliveries (webhook_id, kind, task_id, payload, created_at, attempts, next_attempt_at)
+			VALUES (?, ?, ?, ?, ?, 0, ?)
+		`, id, string(e.Kind), e.TaskID, e.Payload, now, now); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.Exec(`
+		UPDATE outbox
+		SET sent_at = ?, attempts = attempts + 1, last_error = NULL
+		WHERE id = ?
+	`, now, e.ID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// PendingDeliveries returns up to limit deliveries whose next attempt is
+// due at now, oldest first.
+func (s *Store) PendingDeliveries(now time.Time, limit int) ([]Delivery, error) {
+	return s.queryDeliveries(`
+		SELECT `+deliveryColumns+`
+		FROM webhook_deliveries
+		WHERE next_attempt_at <= ?
+		ORDER BY id
+		LIMIT ?
+	`, now, limit)
+}
+
+// Deliveries returns the latest limit deliveries to a webhook, newest
+// first.
+func (s *Store) Deliveries(webhookID string, limit int) ([]Delivery, error) {
+	return s.queryDeliveries(`
+		SELECT `+deliveryColumns+`
+		FROM webhook_deliveries
+		WHERE webhook_id = ?
+		ORDER BY id DESC
+		LIMIT ?
+	`, webhookID, limit)
+}
+
+// RecordAttempt logs one attempt at a delivery: status is the endpoint's
+// answer, 0 if it gave none, and reason is empty on success. retryAt is
+// when to try again after a failure, or nil to give up.
+func (s *Store) RecordAttempt(id int64, status int, reason string, retryAt *time.Time, now time.Time) error {
+	var delivered sql.NullTime
+	if reason == "" {
+		delivered = nullTime(now)
+	}
+	_, err := s.db.Exec(`
+		UPDATE webhook_deliveries
+		SET attempts = attempts + 1, next_attempt_at = ?, delivered_at = ?, status_code = ?, last_error = ?
+		WHERE id = ?
+	`, nullTimePtr(retryAt), delivered, sql.NullInt64{Int64: int64(status), Valid: status != 0}, nullString(reason), id)
+	return err
+}
+
+// PruneDeliveries deletes finished deliveries created before cutoff and
+// returns how many were removed.
+func (s *Store) PruneDeliveries(cutoff time.Time) (int64, error) {
+	res, err := s.db.Exec(`
+		DELETE FROM webhook_deliveries WHERE next_attempt_at IS NULL AND created_at < ?
+	`, cutoff)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+const deliveryColumns = `id, webhook_id, kind, task_id, payload, created_at, attempts, next_attempt_at, delivered_at, status_code, last_error`
+
+func (s *Store) queryDeliveries(query string, args ...interface{}) ([]Delivery, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []Delivery{}
+	for rows.Next() {
+		var (
+			d               Delivery
+			kind            string
+			next, delivered sql.NullTime
+			status          sql.NullInt64
+			lastErr         sql.NullString
+		)
+		if err := rows.Scan(&d.ID, &d.WebhookID, &kind, &d.TaskID, &d.Payload, &d.CreatedAt, &d.Attempts,
+			&next, &delivered, &status, &lastErr); err != nil {
+			return nil, err
+		}
+		d.Kind = events.Kind(kind)
+		d.NextAttemptAt = timePtr(next)
+		d.DeliveredAt = timePtr(delivered)
+		d.StatusCode = int(status.Int64)
+		d.LastError = lastErr.String
+		out = append(out, d)
+	}
+	return out, rows.Err()
+}
+
+func joinKinds(kinds []events.Kind) string {
+	parts := make([]string, len(kinds))
+	for i, k := range kinds {
+		parts[i] = string(k)
+	}
+	return strings.Join(parts, ",")
+}
+
+func splitKinds(s string) []events.Kind {
+	var out []events.Kind
+	for _, p := range strings.Split(s, ",") {
+		if p != "" {
+			out = append(out, events.Kind(p))
+		}
+	}
+	return out
+}
@@ -0,0 +1,43 @@
+package tasks
+
+import (
+	"path"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// maxFilename caps attachment filenames, in bytes.
+const maxFilename = 255
+
+// Attachment describes a file attached to a task. The file itself is
+// kept by the attachment storage; see package attach.
+type Attachment struct {
+	ID          string    `json:"id"`
+	Filename    string    `json:"filename"`
+	ContentType string    `json:"contentType"`
+	Size        int64     `json:"size"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
+
+// NewAttachment describes a new upload. The filename is reduced to its
+// last path element and cut to 255 bytes; an empty one becomes
+// "attachment".
+func NewAttachment(filename, contentType string, size int64, now time.Time) (Attachment, error) {
+	name := strings.TrimSpace(path.Base(strings.ReplaceAll(filename, `\`, "/")))
+	if name == "." || name == "/" {
+		name = ""
+	}
+	for len(name) > maxFilename {
+		_, n := utf8.DecodeLastRuneInString(name)
+		name = name[:len(name)-n]
+	}
+	if name == "" {
+		name = "attachment"
+	}
+	id, err := generateID()
+	if err != nil {
+		return Attachment{}, err
+	}
+	return Attachment{ID: id, Filename: name, ContentType: contentType, Size: size, CreatedAt: now}, nil
+}
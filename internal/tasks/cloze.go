@@ -0,0 +1,73 @@
+package tasks
+
+import (
+	"regexp"
+	"strings"
+)
+
+// CardType says how a task's question and answer are made.
+type CardType string
+
+const (
+	// CardBasic tasks are a question and an answer as written.
+	CardBasic CardType = "basic"
+	// CardCloze tasks are one text with deletions marked {{c1::...}} or
+	// {{c1::...::hint}}, stored in Question. They are shown with every
+	// deletion masked, and Answer holds the deleted text, one deletion per
+	// line, so typed-answer checks ask for what was hidden.
+	CardCloze CardType = "cloze"
+)
+
+// ParseCardType accepts basic or cloze; empty means basic.
+func ParseCardType(s string) (CardType, error) {
+	switch c := CardType(strings.ToLower(strings.TrimSpace(s))); c {
+	case "":
+		return CardBasic, nil
+	case CardBasic, CardCloze:
+		return c, nil
+	}
+	return "", invalid("type must be basic or cloze")
+}
+
+// clozeMarker matches one deletion: its number, text, and optional hint.
+var clozeMarker = regexp.MustCompile(`(?s)\{\{c(\d+)::(.*?)(?:::(.*?))?\}\}`)
+
+// ClozeDeletions returns the text of each deletion in text, in order.
+func ClozeDeletions(text string) []string {
+	var out []string
+	for _, m := range clozeMarker.FindAllStringSubmatch(text, -1) {
+		out = append(out, strings.TrimSpace(m[2]))
+	}
+	return out
+}
+
+// MaskCloze replaces each deletion in text with its hint in brackets, or
+// with [...] when it has none.
+func MaskCloze(text string) string {
+	return clozeMarker.ReplaceAllStringFunc(text, func(m string) string {
+		hint := strings.TrimSpace(clozeMarker.FindStringSubmatch(m)[3])
+		if hint == "" {
+			hint = "..."
+		}
+		return "[" + hint + "]"
+	})
+}
+
+// RevealCloze replaces each deletion in text with its deleted text.
+func RevealCloze(text string) string {
+	return clozeMarker.ReplaceAllString(text, "$2")
+}
+
+// clozeAnswer is the Answer of a cloze task with the given text.
+func clozeAnswer(text string) (string, error) {
+	deletions := ClozeDeletions(text)
+	if len(deletions) == 0 {
+		return "", invalid("cloze text needs at least one deletion, e.g. {{c1::Paris}}")
+	}
+	for _, d := range deletions {
+		if d == "" {
+			return "", invalid("cloze deletions must not be empty")
+		}
+	}
+	return strings.Join(deletions, "\n"), nil
+}
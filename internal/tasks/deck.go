@@ -0,0 +1,46 @@
+package tasks
+
+import (
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+const maxDeckNameLength = 64
+
+// Deck groups tasks by subject. A task belongs to at most one deck, named
+// by Task.DeckID; tasks without one are unfiled.
+type Deck struct {
+	ID        string
+	Name      string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// NewDeck validates name and builds a deck with a fresh ID.
+func NewDeck(name string, now time.Time) (*Deck, error) {
+	name, err := NormalizeDeckName(name)
+	if err != nil {
+		return nil, err
+	}
+	id, err := generateID()
+	if err != nil {
+		return nil, err
+	}
+	return &Deck{ID: id, Name: name, CreatedAt: now, UpdatedAt: now}, nil
+}
+
+// NormalizeDeckName trims name and requires it to be 1 to 64 characters.
+// Unlike tags, deck names keep their case.
+func NormalizeDeckName(name string) (string, error) {
+	name = strings.TrimSpace(norm.NFC.String(name))
+	if name == "" {
+		return "", invalid("deck name is required")
+	}
+	if utf8.RuneCountInString(name) > maxDeckNameLength {
+		return "", invalid("deck name must be at most 64 characters")
+	}
+	return name, nil
+}
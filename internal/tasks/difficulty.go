@@ -0,0 +1,45 @@
+package tasks
+
+import (
+	"strings"
+	"time"
+)
+
+// Difficulty is a per-task knob that stretches or shrinks its intervals.
+type Difficulty string
+
+const (
+	DifficultyEasy   Difficulty = "easy"
+	DifficultyNormal Difficulty = "normal"
+	DifficultyHard   Difficulty = "hard"
+)
+
+// ParseDifficulty accepts easy, normal, or hard; empty means normal.
+func ParseDifficulty(s string) (Difficulty, error) {
+	switch d := Difficulty(strings.ToLower(strings.TrimSpace(s))); d {
+	case "":
+		return DifficultyNormal, nil
+	case DifficultyEasy, DifficultyNormal, DifficultyHard:
+		return d, nil
+	}
+	return "", invalid("difficulty must be easy, normal, or hard")
+}
+
+// Multiplier is the factor applied to scheduled intervals.
+func (d Difficulty) Multiplier() float64 {
+	switch d {
+	case DifficultyEasy:
+		return 1.3
+	case DifficultyHard:
+		return 0.7
+	}
+	return 1
+}
+
+// scale multiplies d by f, rounding to whole seconds.
+func scale(d time.Duration, f float64) time.Duration {
+	if f == 1 {
+		return d
+	}
+	return time.Duration(float64(d) * f).Round(time.Second)
+}
@@ -0,0 +1,71 @@
+package tasks
+
+import (
+	"testing"
+	"time"
+)
+
+var testNow = time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)
+
+func TestDifficultyScalesEachStage(t *testing.T) {
+	schedule := Schedule{time.Hour, 10 * time.Hour, 100 * time.Hour, 1000 * time.Hour}
+	for _, tc := range []struct {
+		difficulty string
+		multiplier float64
+	}{
+		{"easy", 1.3},
+		{"normal", 1},
+		{"", 1},
+		{"hard", 0.7},
+	} {
+		for stage := 1; stage < len(schedule); stage++ {
+			task, err := NewTaskWithOptions("q", "a", testNow, Options{Difficulty: tc.difficulty, Schedule: schedule})
+			if err != nil {
+				t.Fatal(err)
+			}
+			// Review from the stage before, at an ease of 1 that the
+			// review raises by the Remembered step.
+			task.Stage = stage - 1
+			task.Ease = 1
+			if err := task.Apply(Remembered, testNow); err != nil {
+				t.Fatal(err)
+			}
+			ease := 1 + stageEaseStep[Remembered]
+			want := time.Duration(float64(schedule[stage]) * tc.multiplier * ease).Round(time.Second)
+			if task.Stage != stage {
+				t.Fatalf("%q: stage = %d, want %d", tc.difficulty, task.Stage, stage)
+			}
+			if got := task.NextReviewAt.Sub(testNow); got != want {
+				t.Errorf("%q at stage %d waits %s, want %s", tc.difficulty, stage, got, want)
+			}
+		}
+	}
+}
+
+func TestDifficultyLeavesFirstReview(t *testing.T) {
+	for _, d := range []string{"easy", "normal", "hard"} {
+		task, err := NewTaskWithOptions("q", "a", testNow, Options{Difficulty: d})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := task.NextReviewAt.Sub(testNow), StageDurations[0]; got != want {
+			t.Errorf("%s task's first review in %s, want the first stage's %s", d, got, want)
+		}
+	}
+}
+
+func TestParseDifficulty(t *testing.T) {
+	for in, want := range map[string]Difficulty{
+		"":       DifficultyNormal,
+		"easy":   DifficultyEasy,
+		" Hard ": DifficultyHard,
+		"NORMAL": DifficultyNormal,
+	} {
+		if got, err := ParseDifficulty(in); err != nil || got != want {
+			t.Errorf("ParseDifficulty(%q) = %q, %v; want %q", in, got, err, want)
+		}
+	}
+	if _, err := ParseDifficulty("brutal"); err == nil {
+		t.Error("ParseDifficulty accepted brutal")
+	}
+}
@@ -0,0 +1,30 @@
+package tasks
+
+import "errors"
+
+// EarlyReview is the policy for reviewing a card before it is due.
+type EarlyReview string
+
+const (
+	// EarlyAllow applies early reviews like any other.
+	EarlyAllow EarlyReview = "allow"
+	// EarlyReject refuses them with ErrNotDue.
+	EarlyReject EarlyReview = "rejectEarly"
+	// EarlyNoAdvance records them in history but leaves the stage and
+	// schedule as they were.
+	EarlyNoAdvance EarlyReview = "allowNoAdvance"
+)
+
+// ErrNotDue is returned when reviewing a pending card under EarlyReject.
+var ErrNotDue = errors.New("task is not due yet")
+
+// ParseEarlyReview validates a policy name; an empty name means EarlyAllow.
+func ParseEarlyReview(s string) (EarlyReview, error) {
+	switch p := EarlyReview(s); p {
+	case "":
+		return EarlyAllow, nil
+	case EarlyAllow, EarlyReject, EarlyNoAdvance:
+		return p, nil
+	}
+	return "", invalid("early review policy must be allow, rejectEarly, or allowNoAdvance")
+}
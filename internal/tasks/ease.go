@@ -0,0 +1,34 @@
+package tasks
+
+import "math"
+
+// Stage tasks keep an ease too, in Ease, multiplying every stage duration
+// on top of difficulty: each grade moves it by stageEaseStep, so cards that
+// keep being recalled easily spread out faster than ones that keep
+// slipping. It starts at 1, which a stored 0 also means, and stays within
+// stageMinEase and stageMaxEase.
+const (
+	stageMinEase = 0.5
+	stageMaxEase = 2.5
+)
+
+var stageEaseStep = map[Outcome]float64{
+	Forgot:     -0.2,
+	Hard:       -0.05,
+	Remembered: 0.05,
+	Easy:       0.15,
+}
+
+// stageEase is the factor a stage task's intervals are multiplied by.
+func (t *Task) stageEase() float64 {
+	if t.Ease == 0 {
+		return 1
+	}
+	return t.Ease
+}
+
+// gradeEase moves a stage task's ease by the grade of a review.
+func (t *Task) gradeEase(o Outcome) {
+	e := math.Min(stageMaxEase, math.Max(stageMinEase, t.stageEase()+stageEaseStep[o]))
+	t.Ease = round3(e)
+}
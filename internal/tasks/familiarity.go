@@ -0,0 +1,82 @@
+package tasks
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Familiarity is how well the user already knows a card when adding it,
+// which decides the stage it starts on.
+type Familiarity string
+
+const (
+	FamiliarityNew      Familiarity = "new"
+	FamiliarityFamiliar Familiarity = "familiar"
+	FamiliarityKnown    Familiarity = "known"
+)
+
+// FamiliarityStart maps each rating to how far along its schedule a new
+// card starts, from 0 (the first stage) to 1 (the last), so the mapping
+// fits schedules of any length. New cards always start on the first
+// stage. SetFamiliarityStart may replace it at startup.
+var FamiliarityStart = map[Familiarity]float64{
+	FamiliarityNew:      0,
+	FamiliarityFamiliar: 0.5,
+	FamiliarityKnown:    0.85,
+}
+
+// ParseFamiliarity accepts new, familiar, or known; empty means new.
+func ParseFamiliarity(s string) (Familiarity, error) {
+	switch f := Familiarity(strings.ToLower(strings.TrimSpace(s))); f {
+	case "":
+		return FamiliarityNew, nil
+	case FamiliarityNew, FamiliarityFamiliar, FamiliarityKnown:
+		return f, nil
+	}
+	return "", invalid("familiarity must be new, familiar, or known")
+}
+
+// startStage is the stage a card rated f starts on in a schedule of
+// count stages.
+func (f Familiarity) startStage(count int) int {
+	stage := int(math.Round(FamiliarityStart[f] * float64(count-1)))
+	return max(0, min(stage, count-1))
+}
+
+// ParseFamiliarityStart reads a mapping such as "familiar=0.5,known=0.85".
+// Ratings left out keep their current position.
+func ParseFamiliarityStart(s string) (map[Familiarity]float64, error) {
+	out := make(map[Familiarity]float64, len(FamiliarityStart))
+	for f, pos := range FamiliarityStart {
+		out[f] = pos
+	}
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		name, raw, ok := strings.Cut(part, "=")
+		if !ok {
+			return nil, fmt.Errorf("%q: want rating=position", part)
+		}
+		f, err := ParseFamiliarity(name)
+		if err != nil || strings.TrimSpace(name) == "" {
+			return nil, fmt.Errorf("%q: unknown familiarity", name)
+		}
+		pos, err := strconv.ParseFloat(strings.TrimSpace(raw), 64)
+		if err != nil || pos < 0 || pos > 1 {
+			return nil, fmt.Errorf("%q: position must be between 0 and 1", part)
+		}
+		out[f] = pos
+	}
+	if out[FamiliarityNew] != 0 {
+		return nil, errors.New("new cards must start at position 0")
+	}
+	if out[FamiliarityFamiliar] > out[FamiliarityKnown] {
+		return nil, errors.New("known cards must not start before familiar ones")
+	}
+	return out, nil
+}
@@ -0,0 +1,103 @@
+package tasks
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFamiliarityStart(t *testing.T) {
+	short := Schedule{time.Hour, 2 * time.Hour, 3 * time.Hour, 4 * time.Hour, 5 * time.Hour}
+	for _, tc := range []struct {
+		familiarity string
+		schedule    Schedule
+		stage       int
+	}{
+		// The default schedule has eight stages, 0 to 7.
+		{"", nil, 0},
+		{"new", nil, 0},
+		{"familiar", nil, 4},
+		{"known", nil, 6},
+		{"FAMILIAR", nil, 4},
+		// Five stages: halfway is stage 2, 0.85 of the way rounds to 3.
+		{"new", short, 0},
+		{"familiar", short, 2},
+		{"known", short, 3},
+	} {
+		task, err := NewTaskWithOptions("q", "a", testNow, Options{Familiarity: tc.familiarity, Schedule: tc.schedule})
+		if err != nil {
+			t.Fatalf("%q: %v", tc.familiarity, err)
+		}
+		stages := task.Stages()
+		if task.Stage != tc.stage {
+			t.Errorf("%q on %d stages starts at stage %d, want %d", tc.familiarity, len(stages), task.Stage, tc.stage)
+		}
+		// It waits as long as if it had reached the stage by review.
+		want := task.interval(tc.stage)
+		if tc.stage == 0 {
+			want = stages[0]
+		}
+		if got := task.NextReviewAt.Sub(testNow); got != want {
+			t.Errorf("%q on %d stages first reviewed in %s, want %s", tc.familiarity, len(stages), got, want)
+		}
+		if tc.stage > 0 && want < stages[tc.stage] {
+			t.Errorf("%q waits %s, less than its stage's %s", tc.familiarity, want, stages[tc.stage])
+		}
+	}
+
+	if _, err := NewTaskWithOptions("q", "a", testNow, Options{Familiarity: "expert"}); !IsValidation(err) {
+		t.Errorf("familiarity expert = %v, want a validation error", err)
+	}
+}
+
+func TestFamiliarityFollowsTagSchedule(t *testing.T) {
+	task, err := NewTaskWithOptions("q", "a", testNow, Options{Familiarity: "known", Tags: []string{"go"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tagged := Schedule{time.Hour, 2 * time.Hour, 3 * time.Hour}
+	task.ApplyTagSchedule("go", tagged)
+	// 0.85 of the way along three stages rounds to the last, 2.
+	if task.Stage != 2 {
+		t.Errorf("known on the tag schedule starts at stage %d, want 2", task.Stage)
+	}
+	if got, want := task.NextReviewAt.Sub(testNow), task.interval(2); got != want {
+		t.Errorf("first review in %s, want %s", got, want)
+	}
+
+	// An explicit first review delay is kept.
+	in := 30 * time.Minute
+	task, err = NewTaskWithOptions("q", "a", testNow, Options{Familiarity: "familiar", FirstReviewIn: &in})
+	if err != nil {
+		t.Fatal(err)
+	}
+	task.ApplyTagSchedule("go", tagged)
+	if task.Stage != 1 || !task.NextReviewAt.Equal(testNow.Add(in)) {
+		t.Errorf("familiar with a delay: stage %d at %v, want stage 1 at %v", task.Stage, task.NextReviewAt, testNow.Add(in))
+	}
+}
+
+func TestConfiguredFamiliarityStart(t *testing.T) {
+	start, err := ParseFamiliarityStart("familiar=0.25, known=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := FamiliarityStart
+	FamiliarityStart = start
+	t.Cleanup(func() { FamiliarityStart = old })
+
+	for familiarity, want := range map[string]int{"new": 0, "familiar": 2, "known": 7} {
+		task, err := NewTaskWithOptions("q", "a", testNow, Options{Familiarity: familiarity})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if task.Stage != want {
+			t.Errorf("%s starts at stage %d, want %d", familiarity, task.Stage, want)
+		}
+	}
+
+	for _, bad := range []string{"new=0.5", "familiar=0.9,known=0.5", "familiar=2", "expert=0.5", "familiar"} {
+		if _, err := ParseFamiliarityStart(bad); err == nil {
+			t.Errorf("ParseFamiliarityStart(%q) accepted it", bad)
+		}
+	}
+}
@@ -0,0 +1,24 @@
+package tasks
+
+import "strings"
+
+// Format says how question and answer text is meant to be displayed.
+type Format string
+
+const (
+	// FormatPlain is shown as typed.
+	FormatPlain Format = "plain"
+	// FormatMarkdown is rendered as Markdown; see package markdown.
+	FormatMarkdown Format = "markdown"
+)
+
+// ParseFormat accepts plain or markdown; empty means plain.
+func ParseFormat(s string) (Format, error) {
+	switch f := Format(strings.ToLower(strings.TrimSpace(s))); f {
+	case "":
+		return FormatPlain, nil
+	case FormatPlain, FormatMarkdown:
+		return f, nil
+	}
+	return "", invalid("format must be plain or markdown")
+}
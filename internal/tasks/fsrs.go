@@ -0,0 +1,155 @@
+package tasks
+
+import (
+	"math"
+	"time"
+)
+
+// fsrsWeights are the default FSRS-4.5 model parameters.
+var fsrsWeights = [17]float64{
+	0.4872, 1.4003, 3.7145, 13.8206, 5.1618, 1.2298, 0.8975, 0.031, 1.6474,
+	0.1367, 1.0461, 2.1072, 0.0793, 0.3246, 1.587, 0.2272, 2.8755,
+}
+
+// FSRS rates a review Again (1), Hard (2), Good (3) or Easy (4), which
+// are the four outcomes. Easy also places known tasks.
+const (
+	fsrsAgain = 1
+	fsrsHard  = 2
+	fsrsGood  = 3
+	fsrsEasy  = 4
+)
+
+var fsrsGrade = map[Outcome]int{
+	Forgot:     fsrsAgain,
+	Hard:       fsrsHard,
+	Remembered: fsrsGood,
+	Easy:       fsrsEasy,
+}
+
+// fsrsRetention is the recall probability intervals aim for. At 0.9 the
+// interval in days equals the stability.
+const fsrsRetention = 0.9
+
+const (
+	fsrsDecay  = -0.5
+	fsrsFactor = 19.0 / 81
+)
+
+// retrievability is the modelled chance of recall after elapsed days at
+// the given stability.
+func retrievability(elapsed, stability float64) float64 {
+	return math.Pow(1+fsrsFactor*elapsed/stability, fsrsDecay)
+}
+
+func fsrsInitialStability(g int) float64 {
+	return fsrsWeights[g-1]
+}
+
+func fsrsInitialDifficulty(g int) float64 {
+	return clampDifficulty(fsrsWeights[4] - float64(g-3)*fsrsWeights[5])
+}
+
+func clampDifficulty(d float64) float64 {
+	return math.Min(10, math.Max(1, d))
+}
+
+// reviewFSRS applies an FSRS review of grade g at now. Stage counts the
+// successful reviews in a row. The first review seeds stability and
+// difficulty from the grade; later ones update both from the time since
+// the last review, or since creation for a task placed further along.
+func (t *Task) reviewFSRS(g int, now time.Time) {
+	if t.Stability == 0 {
+		t.Stability = fsrsInitialStability(g)
+		t.FSRSDifficulty = fsrsInitialDifficulty(g)
+	} else {
+		last := t.CreatedAt
+		if t.LastReviewedAt != nil {
+			last = *t.LastReviewedAt
+		}
+		elapsed := math.Max(0, now.Sub(last).Hours()/24)
+		r := retrievability(elapsed, t.Stability)
+		t.Stability = t.nextStability(g, r)
+		d := t.FSRSDifficulty - fsrsWeights[6]*float64(g-3)
+		t.FSRSDifficulty = clampDifficulty(fsrsWeights[7]*fsrsInitialDifficulty(fsrsGood) + (1-fsrsWeights[7])*d)
+	}
+	t.Stability = round3(t.Stability)
+	t.FSRSDifficulty = round3(t.FSRSDifficulty)
+	if g == fsrsAgain {
+		t.Stage = 0
+	} else {
+		t.Stage++
+	}
+
+	t.Interval = fsrsInterval(t.Stability)
+	t.CompletedAt = nil
+	t.LastReviewedAt = &now
+	t.NextReviewAt = now.Add(capInterval(scale(t.Interval, t.Difficulty.Multiplier())))
+	t.UpdatedAt = now
+}
+
+// nextStability is the stability after a review of grade g at
+// retrievability r.
+func (t *Task) nextStability(g int, r float64) float64 {
+	w, s, d := fsrsWeights, t.Stability, t.FSRSDifficulty
+	if g == fsrsAgain {
+		forgot := w[11] * math.Pow(d, -w[12]) * (math.Pow(s+1, w[13]) - 1) * math.Exp(w[14]*(1-r))
+		return math.Min(forgot, s)
+	}
+	bonus := 1.0
+	switch g {
+	case fsrsHard:
+		bonus = w[15]
+	case fsrsEasy:
+		bonus = w[16]
+	}
+	return s * (1 + math.Exp(w[8])*(11-d)*math.Pow(s, -w[9])*(math.Exp(w[10]*(1-r))-1)*bonus)
+}
+
+// fsrsInterval is the wait in whole days, at least one, that brings
+// recall down to fsrsRetention.
+func fsrsInterval(stability float64) time.Duration {
+	days := math.Round(stability / fsrsFactor * (math.Pow(fsrsRetention, 1/fsrsDecay) - 1))
+	return time.Duration(max(days, 1)) * 24 * time.Hour
+}
+
+// startFSRS places a new FSRS task as if a familiar one had been
+// answered Good once and a known one Easy.
+func (t *Task) startFSRS() {
+	t.resetFSRS()
+	var g int
+	switch t.familiarity {
+	case FamiliarityFamiliar:
+		g = fsrsGood
+	case FamiliarityKnown:
+		g = fsrsEasy
+	default:
+		return
+	}
+	t.Stage = 1
+	t.Stability = round3(fsrsInitialStability(g))
+	t.FSRSDifficulty = round3(fsrsInitialDifficulty(g))
+	t.Interval = fsrsInterval(t.Stability)
+}
+
+// placeNearFSRS takes on an interval of a day or more from elsewhere as
+// one Good review whose stability matches it.
+func (t *Task) placeNearFSRS(interval time.Duration) {
+	t.resetFSRS()
+	if interval < 24*time.Hour {
+		return
+	}
+	t.Stage = 1
+	t.Stability = round3(interval.Hours() / 24)
+	t.FSRSDifficulty = round3(fsrsInitialDifficulty(fsrsGood))
+	t.Interval = interval
+}
+
+// resetFSRS clears the task's FSRS state, making it new to the model.
+func (t *Task) resetFSRS() {
+	t.Stage = 0
+	t.Stability = 0
+	t.FSRSDifficulty = 0
+	t.Interval = 0
+	t.LastReviewedAt = nil
+}
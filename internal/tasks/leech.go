@@ -0,0 +1,35 @@
+package tasks
+
+import (
+	"slices"
+	"time"
+)
+
+// LeechTag marks a task that keeps being forgotten. SuspendLeech is the
+// suspend reason when LeechSuspend takes such a task out of the queue.
+const (
+	LeechTag     = "leech"
+	SuspendLeech = "leech"
+)
+
+// LeechThreshold is how many lapses make a task a leech; 0 turns leech
+// detection off. LeechSuspend also suspends a task when it becomes one.
+var (
+	LeechThreshold = 8
+	LeechSuspend   = false
+)
+
+// markLeech tags the task once its lapses reach LeechThreshold, and
+// suspends it if LeechSuspend is set. Later lapses change nothing, so a
+// user who removes the tag isn't nagged again on every miss.
+func (t *Task) markLeech(now time.Time) {
+	if LeechThreshold <= 0 || t.Lapses != LeechThreshold {
+		return
+	}
+	if !slices.Contains(t.Tags, LeechTag) {
+		t.Tags = append(t.Tags, LeechTag)
+	}
+	if LeechSuspend {
+		t.Suspend(SuspendLeech, now)
+	}
+}
@@ -0,0 +1,64 @@
+package tasks
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Match names how a typed answer is compared with the stored one.
+type Match string
+
+const (
+	// MatchExact compares the texts after Normalize.
+	MatchExact Match = "exact"
+	// MatchWhitespace also ignores indentation and spacing: each line is
+	// trimmed, runs of whitespace inside it count as one space, and blank
+	// lines are dropped. Meant for code, where layout varies but the
+	// tokens don't.
+	MatchWhitespace Match = "whitespace"
+)
+
+// Comparator reports whether typed is an acceptable answer for expected.
+type Comparator func(typed, expected string) bool
+
+var comparators = map[Match]Comparator{
+	MatchExact: func(typed, expected string) bool {
+		return Normalize(typed) == Normalize(expected)
+	},
+	MatchWhitespace: func(typed, expected string) bool {
+		return collapseWhitespace(typed) == collapseWhitespace(expected)
+	},
+}
+
+// ParseMatch accepts exact or whitespace; empty means exact.
+func ParseMatch(s string) (Match, error) {
+	m := Match(strings.ToLower(strings.TrimSpace(s)))
+	if m == "" {
+		return MatchExact, nil
+	}
+	if _, ok := comparators[m]; !ok {
+		return "", invalid("match must be exact or whitespace")
+	}
+	return m, nil
+}
+
+// Check compares a typed answer with expected using m, falling back to
+// MatchExact for an unknown or empty mode.
+func (m Match) Check(typed, expected string) bool {
+	cmp, ok := comparators[m]
+	if !ok {
+		cmp = comparators[MatchExact]
+	}
+	return cmp(typed, expected)
+}
+
+func collapseWhitespace(s string) string {
+	s = Normalize(s)
+	var lines []string
+	for _, line := range strings.Split(s, "\n") {
+		if fields := strings.FieldsFunc(line, unicode.IsSpace); len(fields) > 0 {
+			lines = append(lines, strings.Join(fields, " "))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
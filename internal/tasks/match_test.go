@@ -0,0 +1,43 @@
+package tasks
+
+import "testing"
+
+const storedSnippet = "func add(a, b int) int {\n\treturn a + b\n}"
+
+func TestMatchReformattedCode(t *testing.T) {
+	for _, tc := range []struct {
+		name, typed string
+		// exact and whitespace are the results under each mode.
+		exact, whitespace bool
+	}{
+		{"same", storedSnippet, true, true},
+		{"spaces for tabs", "func add(a, b int) int {\n    return a + b\n}", false, true},
+		{"extra spacing", "func  add(a,  b int)   int {\n\t\treturn a +   b\n}", false, true},
+		{"blank lines and trailing space", "\nfunc add(a, b int) int {  \n\n\treturn a + b\n}\n\n", false, true},
+		{"CRLF", "func add(a, b int) int {\r\n\treturn a + b\r\n}", true, true},
+		// Joining lines changes the code's layout, not just its spacing.
+		{"one line", "func add(a, b int) int { return a + b }", false, false},
+		{"spacing inside a token", "func add(a, b int) int {\n\tre turn a + b\n}", false, false},
+		{"different code", "func add(a, b int) int {\n\treturn a - b\n}", false, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := MatchExact.Check(tc.typed, storedSnippet); got != tc.exact {
+				t.Errorf("exact = %v, want %v", got, tc.exact)
+			}
+			if got := MatchWhitespace.Check(tc.typed, storedSnippet); got != tc.whitespace {
+				t.Errorf("whitespace = %v, want %v", got, tc.whitespace)
+			}
+		})
+	}
+}
+
+func TestParseMatch(t *testing.T) {
+	for in, want := range map[string]Match{"": MatchExact, "exact": MatchExact, " Whitespace ": MatchWhitespace} {
+		if got, err := ParseMatch(in); err != nil || got != want {
+			t.Errorf("ParseMatch(%q) = %q, %v; want %q", in, got, err, want)
+		}
+	}
+	if _, err := ParseMatch("fuzzy"); !IsValidation(err) {
+		t.Errorf("ParseMatch(fuzzy) = %v, want a validation error", err)
+	}
+}
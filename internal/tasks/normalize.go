@@ -0,0 +1,36 @@
+package tasks
+
+import (
+	"strings"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Normalize is applied to question and answer text before it is stored:
+// Unicode NFC, LF line endings, no trailing whitespace on lines, runs of
+// blank lines collapsed to one, and no leading or trailing whitespace.
+// Spacing inside a line is kept so code and indentation survive, and
+// full-width CJK punctuation is left alone (NFC, unlike NFKC, doesn't fold
+// it to ASCII).
+func Normalize(s string) string {
+	s = norm.NFC.String(s)
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	s = strings.ReplaceAll(s, "\r", "\n")
+
+	lines := strings.Split(s, "\n")
+	out := lines[:0]
+	blank := false
+	for _, line := range lines {
+		line = strings.TrimRight(line, " \t　")
+		if line == "" {
+			if blank {
+				continue
+			}
+			blank = true
+		} else {
+			blank = false
+		}
+		out = append(out, line)
+	}
+	return strings.TrimSpace(strings.Join(out, "\n"))
+}
@@ -0,0 +1,45 @@
+package tasks
+
+import "strings"
+
+// Outcome is the result of one review: a grade from the four buttons
+// again, hard, good, and easy. Again and good keep their original names,
+// forgot and remembered.
+type Outcome string
+
+const (
+	Remembered Outcome = "remembered"
+	Forgot     Outcome = "forgot"
+	Hard       Outcome = "hard"
+	Easy       Outcome = "easy"
+)
+
+// Outcomes lists every outcome in its canonical spelling, from worst to
+// best.
+var Outcomes = []Outcome{Forgot, Hard, Remembered, Easy}
+
+// resultSynonyms maps each accepted spelling of a review result to its
+// outcome. Canonical names must be listed too; adding an alias or a new
+// outcome is a one-line change here.
+var resultSynonyms = map[string]Outcome{
+	"remembered": Remembered,
+	"remember":   Remembered,
+	"ok":         Remembered,
+	"done":       Remembered,
+	"good":       Remembered,
+	"forgot":     Forgot,
+	"forget":     Forgot,
+	"miss":       Forgot,
+	"again":      Forgot,
+	"hard":       Hard,
+	"easy":       Easy,
+}
+
+// ParseResult maps a review result to its Outcome, ignoring case and
+// surrounding whitespace.
+func ParseResult(s string) (Outcome, error) {
+	if o, ok := resultSynonyms[strings.ToLower(strings.TrimSpace(s))]; ok {
+		return o, nil
+	}
+	return "", invalid("result must be 'again', 'hard', 'good', or 'easy' ('forgot' and 'remembered' also work)")
+}
@@ -0,0 +1,60 @@
+package tasks
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+// documentedResults is every spelling ParseResult accepts. It must match
+// resultSynonyms exactly, so a new synonym is listed here as well.
+var documentedResults = map[string]Outcome{
+	"again":      Forgot,
+	"forgot":     Forgot,
+	"forget":     Forgot,
+	"miss":       Forgot,
+	"hard":       Hard,
+	"good":       Remembered,
+	"remembered": Remembered,
+	"remember":   Remembered,
+	"ok":         Remembered,
+	"done":       Remembered,
+	"easy":       Easy,
+}
+
+func TestParseResultSynonyms(t *testing.T) {
+	for in, want := range documentedResults {
+		for _, spelling := range []string{in, strings.ToUpper(in), " " + in + "\t"} {
+			got, err := ParseResult(spelling)
+			if err != nil || got != want {
+				t.Errorf("ParseResult(%q) = %q, %v; want %q", spelling, got, err, want)
+			}
+		}
+	}
+	for in, o := range resultSynonyms {
+		if _, ok := documentedResults[in]; !ok {
+			t.Errorf("synonym %q for %q is missing from documentedResults", in, o)
+		}
+	}
+}
+
+func TestParseResultCanonicalNames(t *testing.T) {
+	for _, o := range Outcomes {
+		if got, err := ParseResult(string(o)); err != nil || got != o {
+			t.Errorf("ParseResult(%q) = %q, %v; want itself", o, got, err)
+		}
+	}
+	for in, o := range resultSynonyms {
+		if !slices.Contains(Outcomes, o) {
+			t.Errorf("synonym %q maps to %q, which is not in Outcomes", in, o)
+		}
+	}
+}
+
+func TestParseResultRejectsUnknown(t *testing.T) {
+	for _, in := range []string{"", " ", "skip", "remembered!", "re membered", "yes", "0", "forgotten"} {
+		if _, err := ParseResult(in); !IsValidation(err) {
+			t.Errorf("ParseResult(%q) = %v, want a validation error", in, err)
+		}
+	}
+}
@@ -0,0 +1,207 @@
+package tasks
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// StageLabels optionally names each stage of StageDurations; it is either
+// empty or the same length.
+var StageLabels []string
+
+// stageEntry is one schedule file entry: either a bare duration string or
+// a {duration, label} object.
+type stageEntry struct {
+	Duration string `yaml:"duration"`
+	Label    string `yaml:"label"`
+}
+
+func (e *stageEntry) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		e.Duration = node.Value
+		return nil
+	}
+	type plain stageEntry
+	return node.Decode((*plain)(e))
+}
+
+// LoadSchedule reads a JSON or YAML list of stage durations such as
+// ["5m", "1h", "1d"] or [{"duration": "5m", "label": "soon"}, ...].
+func LoadSchedule(path string) (durations []time.Duration, labels []string, err error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	var entries []stageEntry
+	if err := yaml.Unmarshal(data, &entries); err != nil {
+		return nil, nil, fmt.Errorf("parse schedule %s: %w", path, err)
+	}
+
+	hasLabels := false
+	for i, e := range entries {
+		d, err := ParseDuration(e.Duration)
+		if err != nil {
+			return nil, nil, fmt.Errorf("schedule stage %d: %w", i, err)
+		}
+		durations = append(durations, d)
+		labels = append(labels, e.Label)
+		hasLabels = hasLabels || e.Label != ""
+	}
+	if !hasLabels {
+		labels = nil
+	}
+	if err := ValidateSchedule(durations); err != nil {
+		return nil, nil, err
+	}
+	return durations, labels, nil
+}
+
+// ParseStageList reads a comma-separated list of stage durations such as
+// "5m,30m,1d,3d,7d", the form of the -stages flag.
+func ParseStageList(s string) ([]time.Duration, error) {
+	var durations []time.Duration
+	for i, spec := range strings.Split(s, ",") {
+		d, err := ParseDuration(strings.TrimSpace(spec))
+		if err != nil {
+			return nil, fmt.Errorf("stage %d: %w", i, err)
+		}
+		durations = append(durations, d)
+	}
+	if err := ValidateSchedule(durations); err != nil {
+		return nil, err
+	}
+	return durations, nil
+}
+
+// ValidateSchedule requires at least one stage and strictly increasing,
+// positive durations.
+func ValidateSchedule(durations []time.Duration) error {
+	if len(durations) == 0 {
+		return errors.New("schedule needs at least one stage")
+	}
+	for i, d := range durations {
+		if d <= 0 {
+			return fmt.Errorf("schedule stage %d: duration must be positive", i)
+		}
+		if i > 0 && d <= durations[i-1] {
+			return fmt.Errorf("schedule stage %d: %s does not increase on %s", i, FormatDuration(d), FormatDuration(durations[i-1]))
+		}
+	}
+	return nil
+}
+
+// SetSchedule replaces the process-wide schedule. It is meant to run once
+// at startup, before any task is handled.
+func SetSchedule(durations []time.Duration, labels []string) error {
+	if err := ValidateSchedule(durations); err != nil {
+		return err
+	}
+	if len(labels) != 0 && len(labels) != len(durations) {
+		return errors.New("schedule labels must match the number of stages")
+	}
+	StageDurations = durations
+	StageLabels = labels
+	return nil
+}
+
+// StageLabel returns the configured label of stage, or "" when unnamed.
+func StageLabel(stage int) string {
+	if stage < 0 || stage >= len(StageLabels) {
+		return ""
+	}
+	return StageLabels[stage]
+}
+
+// MaxScheduleStages caps how many stages a task or tag schedule may have.
+const MaxScheduleStages = 32
+
+// Schedule is a ladder of stage durations set on a task or a tag in place
+// of StageDurations. It is written as a list of duration strings such as
+// ["1h", "1d", "7d"] in JSON and as "1h,1d,7d" in the database.
+type Schedule []time.Duration
+
+// ParseSchedule parses and validates a list of duration strings.
+func ParseSchedule(specs []string) (Schedule, error) {
+	s := make(Schedule, 0, len(specs))
+	for i, spec := range specs {
+		d, err := ParseDuration(spec)
+		if err != nil {
+			return nil, invalid(fmt.Sprintf("schedule stage %d: %v", i, err))
+		}
+		s = append(s, d)
+	}
+	if err := s.Validate(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Validate applies ValidateSchedule and the stage cap, returning a
+// *ValidationError.
+func (s Schedule) Validate() error {
+	if err := ValidateSchedule(s); err != nil {
+		return invalid(err.Error())
+	}
+	if len(s) > MaxScheduleStages {
+		return invalid(fmt.Sprintf("schedule may have at most %d stages", MaxScheduleStages))
+	}
+	return nil
+}
+
+// Strings formats each stage with FormatDuration.
+func (s Schedule) Strings() []string {
+	out := make([]string, len(s))
+	for i, d := range s {
+		out[i] = FormatDuration(d)
+	}
+	return out
+}
+
+// String is the comma-separated form stored in the database.
+func (s Schedule) String() string {
+	return strings.Join(s.Strings(), ",")
+}
+
+// ParseStoredSchedule reads the String form back; "" is no schedule.
+func ParseStoredSchedule(v string) (Schedule, error) {
+	if v == "" {
+		return nil, nil
+	}
+	return ParseSchedule(strings.Split(v, ","))
+}
+
+func (s Schedule) MarshalJSON() ([]byte, error) {
+	if s == nil {
+		return []byte("null"), nil
+	}
+	return json.Marshal(s.Strings())
+}
+
+// UnmarshalJSON accepts a list of duration strings. An empty list yields a
+// non-nil empty Schedule, which updates take as "clear the override".
+func (s *Schedule) UnmarshalJSON(b []byte) error {
+	var specs []string
+	if err := json.Unmarshal(b, &specs); err != nil {
+		return invalid(`schedule must be a list of durations such as ["1h", "1d"]`)
+	}
+	if specs == nil {
+		*s = nil
+		return nil
+	}
+	if len(specs) == 0 {
+		*s = Schedule{}
+		return nil
+	}
+	parsed, err := ParseSchedule(specs)
+	if err != nil {
+		return err
+	}
+	*s = parsed
+	return nil
+}
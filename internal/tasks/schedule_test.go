@@ -0,0 +1,110 @@
+package tasks
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeSchedule(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadSchedule(t *testing.T) {
+	for _, tc := range []struct {
+		name, file, content string
+		durations           []time.Duration
+		labels              []string
+	}{
+		{
+			name:      "json durations",
+			file:      "schedule.json",
+			content:   `["5m", "1h", "1d"]`,
+			durations: []time.Duration{5 * time.Minute, time.Hour, 24 * time.Hour},
+		},
+		{
+			name:      "json with labels",
+			file:      "schedule.json",
+			content:   `[{"duration": "10m", "label": "soon"}, {"duration": "2d"}]`,
+			durations: []time.Duration{10 * time.Minute, 48 * time.Hour},
+			labels:    []string{"soon", ""},
+		},
+		{
+			name:      "yaml",
+			file:      "schedule.yaml",
+			content:   "- 30m\n- duration: 6h\n  label: later\n",
+			durations: []time.Duration{30 * time.Minute, 6 * time.Hour},
+			labels:    []string{"", "later"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			durations, labels, err := LoadSchedule(writeSchedule(t, tc.file, tc.content))
+			if err != nil {
+				t.Fatalf("LoadSchedule: %v", err)
+			}
+			if !reflect.DeepEqual(durations, tc.durations) || !reflect.DeepEqual(labels, tc.labels) {
+				t.Errorf("got %v %q, want %v %q", durations, labels, tc.durations, tc.labels)
+			}
+		})
+	}
+}
+
+func TestLoadScheduleInvalid(t *testing.T) {
+	for _, tc := range []struct {
+		name, content, want string
+	}{
+		{"equal", `["1h", "1h"]`, "does not increase"},
+		{"decreasing", `["1d", "1h"]`, "does not increase"},
+		{"zero", `["0s", "1h"]`, "must be positive"},
+		{"empty", `[]`, "at least one stage"},
+		{"bad duration", `["soon"]`, "stage 0"},
+		{"not a list", `{"stages": "1h"}`, "parse schedule"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, _, err := LoadSchedule(writeSchedule(t, "schedule.json", tc.content))
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("LoadSchedule(%s) = %v, want an error containing %q", tc.content, err, tc.want)
+			}
+		})
+	}
+}
+
+func TestLoadScheduleMissingFile(t *testing.T) {
+	_, _, err := LoadSchedule(filepath.Join(t.TempDir(), "missing.json"))
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("LoadSchedule of a missing file = %v, want fs.ErrNotExist", err)
+	}
+}
+
+func TestSetScheduleKeepsDefaultOnError(t *testing.T) {
+	saved, savedLabels := StageDurations, StageLabels
+	t.Cleanup(func() { StageDurations, StageLabels = saved, savedLabels })
+
+	if err := SetSchedule([]time.Duration{time.Hour, time.Minute}, nil); err == nil {
+		t.Fatal("SetSchedule accepted a decreasing schedule")
+	}
+	if err := SetSchedule([]time.Duration{time.Minute}, []string{"a", "b"}); err == nil {
+		t.Fatal("SetSchedule accepted more labels than stages")
+	}
+	if !reflect.DeepEqual(StageDurations, saved) {
+		t.Errorf("StageDurations = %v after failed sets, want the default %v", StageDurations, saved)
+	}
+
+	want := []time.Duration{time.Minute, time.Hour}
+	if err := SetSchedule(want, []string{"first", "second"}); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(StageDurations, want) || StageLabel(1) != "second" || StageLabel(2) != "" {
+		t.Errorf("after SetSchedule: %v, labels %q", StageDurations, StageLabels)
+	}
+}
@@ -0,0 +1,139 @@
+package tasks
+
+import (
+	"math"
+	"strings"
+	"time"
+)
+
+// Scheduler names the algorithm that times a task's reviews.
+type Scheduler string
+
+const (
+	// SchedulerStages walks the task's stage ladder and completes the
+	// task after the last stage.
+	SchedulerStages Scheduler = "stages"
+	// SchedulerSM2 follows SuperMemo 2: each success multiplies the
+	// interval by the task's ease, which failures lower. SM-2 tasks never
+	// complete on their own.
+	SchedulerSM2 Scheduler = "sm2"
+	// SchedulerFSRS follows the Free Spaced Repetition Scheduler, which
+	// models each task's memory stability and difficulty and waits until
+	// recall is predicted to drop to 90%. FSRS tasks never complete on
+	// their own either.
+	SchedulerFSRS Scheduler = "fsrs"
+)
+
+// DefaultScheduler is used for new tasks that don't pick one. Like
+// StageDurations it is meant to be set at startup.
+var DefaultScheduler = SchedulerStages
+
+// ParseScheduler accepts stages, sm2 or fsrs; empty means
+// DefaultScheduler.
+func ParseScheduler(s string) (Scheduler, error) {
+	switch sc := Scheduler(strings.ToLower(strings.TrimSpace(s))); sc {
+	case "":
+		return DefaultScheduler, nil
+	case SchedulerStages, SchedulerSM2, SchedulerFSRS:
+		return sc, nil
+	}
+	return "", invalid("scheduler must be stages, sm2, or fsrs")
+}
+
+// SM-2 parameters. Ease starts at sm2InitialEase and never drops below
+// sm2MinEase; the first two successful repetitions wait fixed intervals.
+const (
+	sm2InitialEase = 2.5
+	sm2MinEase     = 1.3
+	sm2FirstStep   = 24 * time.Hour
+	sm2SecondStep  = 6 * 24 * time.Hour
+)
+
+// SM-2 grades a review from 0 to 5, and 3 or more is a success. Forgot is
+// a clear failure, and the passing outcomes run from a hard-won pass to a
+// perfect one.
+var sm2Quality = map[Outcome]int{
+	Forgot:     1,
+	Hard:       3,
+	Remembered: 4,
+	Easy:       5,
+}
+
+// reviewSM2 applies an SM-2 review of quality q at now. Stage counts the
+// successful repetitions in a row; intervals are whole days, as in SM-2.
+func (t *Task) reviewSM2(q int, now time.Time) {
+	if t.Ease == 0 {
+		t.Ease = sm2InitialEase
+	}
+	if q >= 3 {
+		switch t.Stage {
+		case 0:
+			t.Interval = sm2FirstStep
+		case 1:
+			t.Interval = sm2SecondStep
+		default:
+			days := math.Round(t.Interval.Hours() / 24 * t.Ease)
+			t.Interval = time.Duration(days) * 24 * time.Hour
+		}
+		t.Stage++
+	} else {
+		t.Stage = 0
+		t.Interval = sm2FirstStep
+	}
+	d := float64(5 - q)
+	t.Ease = math.Max(sm2MinEase, t.Ease+0.1-d*(0.08+d*0.02))
+	t.Ease = round3(t.Ease)
+
+	t.CompletedAt = nil
+	t.NextReviewAt = now.Add(capInterval(scale(t.Interval, t.Difficulty.Multiplier())))
+	t.UpdatedAt = now
+}
+
+// round3 rounds scheduler state to three decimals, which keeps it
+// readable in responses without changing any interval.
+func round3(x float64) float64 {
+	return math.Round(x*1000) / 1000
+}
+
+// startSM2 places a new SM-2 task as if it had been recalled once for a
+// familiar rating and twice for a known one.
+func (t *Task) startSM2() {
+	t.Ease = sm2InitialEase
+	t.Interval = 0
+	switch t.familiarity {
+	case FamiliarityFamiliar:
+		t.Stage, t.Interval = 1, sm2FirstStep
+	case FamiliarityKnown:
+		t.Stage, t.Interval = 2, sm2SecondStep
+	default:
+		t.Stage = 0
+	}
+}
+
+// placeNearSM2 takes on an interval from elsewhere. A day or more counts
+// as one recall, six days or more as two, as in SM-2's own first steps.
+func (t *Task) placeNearSM2(interval time.Duration) {
+	t.resetSM2()
+	if interval >= sm2FirstStep {
+		t.Stage = 1
+	}
+	if interval >= sm2SecondStep {
+		t.Stage = 2
+	}
+	if interval > 0 {
+		t.Interval = interval
+	}
+}
+
+// resetSM2 starts the task's SM-2 state over.
+func (t *Task) resetSM2() {
+	t.Stage = 0
+	t.Ease = sm2InitialEase
+	t.Interval = 0
+}
+
+// Graduates reports whether the task completes after its last stage,
+// which only the stages scheduler does.
+func (t *Task) Graduates() bool {
+	return t.Scheduler == "" || t.Scheduler == SchedulerStages
+}
@@ -0,0 +1,49 @@
+package tasks
+
+import "time"
+
+// Default and largest card counts for a study session.
+const (
+	DefaultSessionReviews = 20
+	DefaultSessionNew     = 10
+	MaxSessionCards       = 500
+)
+
+// Session is a bounded study run: up to MaxReviews due cards that have
+// been reviewed before, then up to MaxNew due cards that never have, served
+// one at a time in TaskIDs order. A card counts as answered once it has a
+// review dated after CreatedAt, however the review was made.
+type Session struct {
+	ID         string
+	MaxReviews int
+	MaxNew     int
+	// TaskIDs lists the session's cards, the last NewCards of them new.
+	TaskIDs    []string
+	NewCards   int
+	CreatedAt  time.Time
+	FinishedAt *time.Time
+
+	// Answered counts the cards reviewed so far, and Remembered and
+	// Forgot the reviews of them by result. Once the session is finished
+	// they are fixed.
+	Answered   int
+	Remembered int
+	Forgot     int
+}
+
+// NewSession validates the limits and builds an empty session with a
+// fresh ID. Each limit must be between 0 and MaxSessionCards, and at least
+// one must be positive.
+func NewSession(maxReviews, maxNew int, now time.Time) (*Session, error) {
+	if maxReviews < 0 || maxReviews > MaxSessionCards || maxNew < 0 || maxNew > MaxSessionCards {
+		return nil, invalid("session limits must be between 0 and 500")
+	}
+	if maxReviews == 0 && maxNew == 0 {
+		return nil, invalid("a session needs room for at least one card")
+	}
+	id, err := generateID()
+	if err != nil {
+		return nil, err
+	}
+	return &Session{ID: id, MaxReviews: maxReviews, MaxNew: maxNew, CreatedAt: now}, nil
+}
@@ -0,0 +1,23 @@
+package tasks
+
+import "time"
+
+// NewReversiblePair builds a task and its reverse, which has question and
+// answer swapped and the same options, linked to each other through
+// SiblingID. The two are scheduled independently. Cloze tasks can't be
+// reversed, since their answer is derived from the question.
+func NewReversiblePair(question, answer string, now time.Time, opts Options) (*Task, *Task, error) {
+	t, err := NewTaskWithOptions(question, answer, now, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	if t.Type == CardCloze {
+		return nil, nil, invalid("cloze tasks can't be reversible")
+	}
+	r, err := NewTaskWithOptions(answer, question, now, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	t.SiblingID, r.SiblingID = r.ID, t.ID
+	return t, r, nil
+}
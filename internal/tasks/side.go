@@ -0,0 +1,22 @@
+package tasks
+
+import "strings"
+
+// Side is one face of a card.
+type Side string
+
+const (
+	SideQuestion Side = "question"
+	SideAnswer   Side = "answer"
+)
+
+// ParseSide validates a side name; an empty name means the question.
+func ParseSide(s string) (Side, error) {
+	switch Side(strings.ToLower(strings.TrimSpace(s))) {
+	case "", SideQuestion:
+		return SideQuestion, nil
+	case SideAnswer:
+		return SideAnswer, nil
+	}
+	return "", invalid("side must be 'question' or 'answer'")
+}
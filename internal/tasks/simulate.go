@@ -0,0 +1,38 @@
+package tasks
+
+import "time"
+
+// ProjectedReview is one review of a simulated run: the stage the task is
+// at when reviewed, and when.
+type ProjectedReview struct {
+	Stage int
+	At    time.Time
+}
+
+// Simulate projects the rest of the task's schedule assuming every review
+// is remembered as soon as it is due, with a task that is already due
+// reviewed at now. It returns the projected reviews and when the last one
+// completes the task. A finished task has no reviews left and completes at
+// its CompletedAt, which may be nil. SM-2 and FSRS tasks never complete,
+// so for them the next StageCount reviews are projected and the
+// completion time is nil. t itself is not changed.
+func (t *Task) Simulate(now time.Time) ([]ProjectedReview, *time.Time) {
+	if t.CompletedAt != nil || t.pastLastStage() {
+		return []ProjectedReview{}, t.CompletedAt
+	}
+
+	sim := *t
+	at := sim.NextReviewAt
+	if at.Before(now) {
+		at = now
+	}
+	reviews := []ProjectedReview{}
+	// Each remembered review either advances a stage or completes the
+	// task, so the loop ends within StageCount steps.
+	for sim.CompletedAt == nil && len(reviews) < t.StageCount() {
+		reviews = append(reviews, ProjectedReview{Stage: sim.Stage, At: at})
+		sim.Apply(Remembered, at)
+		at = sim.NextReviewAt
+	}
+	return reviews, sim.CompletedAt
+}
@@ -1,8 +1,15 @@
 package tasks
 
-import "time"
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
 
-// StageDurations defines the spaced-repetition schedule.
+// StageDurations defines the spaced-repetition schedule. This is the
+// built-in default; SetSchedule may replace it at startup, from a
+// schedule file or the -stages flag.
 // Index meaning:
 // 0: +5m, 1: +10m, 2: +25m, 3: +1h, 4: +6h, 5: +24h, 6: +48h, 7: +168h (1 week)
 var StageDurations = []time.Duration{
@@ -16,7 +23,48 @@ var StageDurations = []time.Duration{
 	168 * time.Hour,
 }
 
+// MaxInterval caps how long any step of a schedule may wait, after
+// difficulty scaling, whatever schedule the task follows. 0, the default,
+// means no cap. Like StageDurations it is meant to be set at startup.
+var MaxInterval time.Duration
+
+// capInterval limits d to MaxInterval.
+func capInterval(d time.Duration) time.Duration {
+	if MaxInterval > 0 && d > MaxInterval {
+		return MaxInterval
+	}
+	return d
+}
+
 // TotalStages returns how many spaced-repetition steps exist before completion.
 func TotalStages() int {
 	return len(StageDurations)
 }
+
+// ParseDuration extends time.ParseDuration with a whole-day unit, so "7d"
+// means 168 hours.
+func ParseDuration(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration %q", s)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	return time.ParseDuration(s)
+}
+
+// FormatDuration renders d in the largest whole unit among days, hours,
+// and minutes, falling back to time.Duration's own format.
+func FormatDuration(d time.Duration) string {
+	switch {
+	case d != 0 && d%(24*time.Hour) == 0:
+		return strconv.FormatInt(int64(d/(24*time.Hour)), 10) + "d"
+	case d != 0 && d%time.Hour == 0:
+		return strconv.FormatInt(int64(d/time.Hour), 10) + "h"
+	case d != 0 && d%time.Minute == 0:
+		return strconv.FormatInt(int64(d/time.Minute), 10) + "m"
+	}
+	return d.String()
+}
@@ -0,0 +1,88 @@
+package tasks
+
+import (
+	"testing"
+	"time"
+)
+
+// setMaxInterval caps intervals at d for the rest of the test.
+func setMaxInterval(t *testing.T, d time.Duration) {
+	old := MaxInterval
+	MaxInterval = d
+	t.Cleanup(func() { MaxInterval = old })
+}
+
+func TestMaxIntervalClampsFinalStage(t *testing.T) {
+	const day = 24 * time.Hour
+	schedule := Schedule{time.Hour, 10 * day, 100 * day, 400 * day}
+	setMaxInterval(t, 30*day)
+
+	for _, difficulty := range []string{"easy", "normal", "hard"} {
+		task, err := NewTaskWithOptions("q", "a", testNow, Options{Difficulty: difficulty, Schedule: schedule})
+		if err != nil {
+			t.Fatal(err)
+		}
+		now := testNow
+		var waits []time.Duration
+		for task.CompletedAt == nil {
+			now = task.NextReviewAt
+			if err := task.Apply(Remembered, now); err != nil {
+				t.Fatal(err)
+			}
+			if task.CompletedAt == nil {
+				waits = append(waits, task.NextReviewAt.Sub(now))
+			}
+		}
+		if len(waits) != len(schedule)-1 {
+			t.Fatalf("%s: %d reviews before completion, want %d", difficulty, len(waits), len(schedule)-1)
+		}
+		// The second stage is under the cap whatever the multipliers; the
+		// later two, the final stage included, are clamped to it.
+		if waits[0] >= MaxInterval {
+			t.Errorf("%s: second stage waits %s, want it below the cap", difficulty, waits[0])
+		}
+		for _, w := range waits[1:] {
+			if w != MaxInterval {
+				t.Errorf("%s: waits %v, want later stages clamped to %s", difficulty, waits, MaxInterval)
+				break
+			}
+		}
+	}
+}
+
+func TestMaxIntervalRevivedFinalStage(t *testing.T) {
+	setMaxInterval(t, 30*24*time.Hour)
+	task, err := NewTaskWithOptions("q", "a", testNow, Options{Schedule: Schedule{time.Hour, 365 * 24 * time.Hour}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Revived onto the final stage, a lapse keeps it there, and its next
+	// wait is still capped.
+	task.Stage = 1
+	if err := task.Apply(Hard, testNow); err != nil {
+		t.Fatal(err)
+	}
+	if task.Stage != 1 || task.CompletedAt != nil {
+		t.Fatalf("hard at the final stage moved to stage %d, completed %v", task.Stage, task.CompletedAt)
+	}
+	if got := task.NextReviewAt.Sub(testNow); got != MaxInterval {
+		t.Errorf("final stage waits %s, want the cap %s", got, MaxInterval)
+	}
+}
+
+func TestNoMaxIntervalByDefault(t *testing.T) {
+	setMaxInterval(t, 0)
+	schedule := Schedule{time.Hour, 400 * 24 * time.Hour, 800 * 24 * time.Hour}
+	task, err := NewTaskWithOptions("q", "a", testNow, Options{Schedule: schedule})
+	if err != nil {
+		t.Fatal(err)
+	}
+	task.Ease = 1
+	if err := task.Apply(Remembered, testNow); err != nil {
+		t.Fatal(err)
+	}
+	want := time.Duration(float64(schedule[1]) * (1 + stageEaseStep[Remembered])).Round(time.Second)
+	if got := task.NextReviewAt.Sub(testNow); got != want {
+		t.Errorf("uncapped wait = %s, want %s", got, want)
+	}
+}
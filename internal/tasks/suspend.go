@@ -0,0 +1,42 @@
+package tasks
+
+import (
+	"errors"
+	"time"
+)
+
+// SuspendStale is the reason recorded when a task is suspended for being
+// overdue too long.
+const SuspendStale = "stale"
+
+// SuspendManual is the reason recorded when a user suspends a task.
+const SuspendManual = "manual"
+
+// ErrSuspended is returned when reviewing or rescheduling a suspended task.
+var ErrSuspended = errors.New("task is suspended; unsuspend it first")
+
+// Suspend takes the task out of the review queue, keeping its stage and
+// schedule, and records why. Suspending a suspended task changes nothing.
+func (t *Task) Suspend(reason string, now time.Time) {
+	if t.SuspendedAt != nil {
+		return
+	}
+	t.SuspendedAt = &now
+	t.SuspendReason = reason
+	t.UpdatedAt = now
+}
+
+// Unsuspend returns the task to the queue. A task whose review time passed
+// while suspended is due at now rather than back-dated, so it sorts with
+// the rest of the queue.
+func (t *Task) Unsuspend(now time.Time) {
+	if t.SuspendedAt == nil {
+		return
+	}
+	t.SuspendedAt = nil
+	t.SuspendReason = ""
+	if t.CompletedAt == nil && t.NextReviewAt.Before(now) {
+		t.NextReviewAt = now
+	}
+	t.UpdatedAt = now
+}
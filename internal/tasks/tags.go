@@ -0,0 +1,38 @@
+package tasks
+
+import (
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	maxTags      = 20
+	maxTagLength = 64
+)
+
+// NormalizeTags trims, lower-cases, de-duplicates, and sorts tags, rejecting
+// empty, overlong, or too many entries.
+func NormalizeTags(tags []string) ([]string, error) {
+	seen := make(map[string]bool, len(tags))
+	out := make([]string, 0, len(tags))
+	for _, raw := range tags {
+		tag := strings.ToLower(strings.TrimSpace(raw))
+		if tag == "" {
+			return nil, invalid("tags must not be empty")
+		}
+		if utf8.RuneCountInString(tag) > maxTagLength {
+			return nil, invalid("tags must be at most 64 characters")
+		}
+		if seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		out = append(out, tag)
+	}
+	if len(out) > maxTags {
+		return nil, invalid("a task can have at most 20 tags")
+	}
+	sort.Strings(out)
+	return out, nil
+}
@@ -4,6 +4,7 @@ import (
 	"crypto/rand"
 	"encoding/hex"
 	"errors"
+	"fmt"
 	"strings"
 	"time"
 )
@@ -13,41 +14,231 @@ type Task struct {
 	ID           string     `json:"id"`
 	Question     string     `json:"question"`
 	Answer       string     `json:"answer"`
-	Stage        int        `json:"stage"` // zero-based index into StageDurations
+	Stage        int        `json:"stage"` // zero-based index into Stages()
 	NextReviewAt time.Time  `json:"nextReviewAt"`
 	CreatedAt    time.Time  `json:"createdAt"`
 	UpdatedAt    time.Time  `json:"updatedAt"`
 	CompletedAt  *time.Time `json:"completedAt,omitempty"`
+	DeletedAt    *time.Time `json:"deletedAt,omitempty"`
+	ArchivedAt   *time.Time `json:"archivedAt,omitempty"`
+	// SuspendedAt is set while the task is out of the review queue, with
+	// SuspendReason saying why, e.g. SuspendStale.
+	SuspendedAt   *time.Time `json:"suspendedAt,omitempty"`
+	SuspendReason string     `json:"suspendReason,omitempty"`
+	Tags          []string   `json:"tags"`
+	// DeckID is the deck the task is filed in, or empty.
+	DeckID     string     `json:"deckId,omitempty"`
+	Images     []Side     `json:"images"`
+	Difficulty Difficulty `json:"difficulty"`
+	// AnswerMatch is how typed answers are checked against Answer.
+	AnswerMatch Match `json:"answerMatch"`
+	// Format is how Question and Answer are displayed.
+	Format Format `json:"format"`
+	// Type is basic or cloze; see CardCloze for how cloze tasks use
+	// Question and Answer.
+	Type CardType `json:"type"`
+	// SiblingID links a reversible task and its reverse; see
+	// NewReversiblePair.
+	SiblingID string `json:"siblingId,omitempty"`
+	// Lapses counts the times the task was forgotten; see LeechThreshold.
+	Lapses int `json:"lapses,omitempty"`
+	// Version starts at 1 and goes up with every change the store makes
+	// to the task, so edits can be checked against the version they
+	// started from.
+	Version int64 `json:"version"`
+	// Attachments are the files attached to the task, oldest first.
+	Attachments []Attachment `json:"attachments"`
+	// Schedule is the task's own stage ladder; nil follows its tags or
+	// the default.
+	Schedule Schedule `json:"schedule,omitempty"`
+	// TagSchedule and ScheduleTag are the schedule resolved from the
+	// task's tags and the tag it came from. The store fills them in.
+	TagSchedule Schedule `json:"-"`
+	ScheduleTag string   `json:"-"`
+	// Scheduler is the algorithm timing the reviews. With SchedulerSM2
+	// or SchedulerFSRS, Stage counts successful reviews in a row and
+	// Interval is the last interval before difficulty scaling. Ease is
+	// the SM-2 ease factor, or for stage tasks the factor on their stage
+	// durations (0 meaning 1); Stability (in days), FSRSDifficulty (1 to 10)
+	// and LastReviewedAt are the FSRS memory state.
+	Scheduler      Scheduler     `json:"scheduler"`
+	Ease           float64       `json:"ease,omitempty"`
+	Stability      float64       `json:"stability,omitempty"`
+	FSRSDifficulty float64       `json:"fsrsDifficulty,omitempty"`
+	LastReviewedAt *time.Time    `json:"-"`
+	Interval       time.Duration `json:"-"`
+
+	// newFirstReview is set on a task built by NewTaskWithOptions whose
+	// first review time should follow the schedule once it is resolved.
+	newFirstReview bool
+	// familiarity is the creation rating, kept so the starting stage can
+	// be placed again once the schedule is resolved.
+	familiarity Familiarity
+}
+
+// Options carries the optional fields of a task. On creation zero values
+// mean defaults; on update they mean "leave unchanged".
+type Options struct {
+	Tags        []string
+	Difficulty  string
+	AnswerMatch string
+	Format      string
+	// Type is basic or cloze. A cloze task's answer is derived from its
+	// question, so the answer given with it is ignored.
+	Type string
+	// FirstReviewIn overrides how long a new task waits for its first
+	// review; zero makes it ready at once. Nil uses the first stage
+	// duration. Updates ignore it.
+	FirstReviewIn *time.Duration
+	// Schedule overrides the stage ladder for this task. On update an
+	// empty, non-nil Schedule removes the override.
+	Schedule Schedule
+	// Familiarity picks the starting stage of a new task: new, familiar,
+	// or known, placed per FamiliarityStart. Updates ignore it.
+	Familiarity string
+	// Scheduler picks the algorithm of a new task; empty means
+	// DefaultScheduler. Updates ignore it.
+	Scheduler string
+	// Deck files the task in a deck by ID. Nil keeps the current deck;
+	// on update an empty ID removes the task from its deck. The store
+	// checks that the deck exists.
+	Deck *string
+	// Version is the task version an update was made against; the store
+	// refuses the update if the task has changed since. Zero skips the
+	// check. Creation ignores it.
+	Version int64
+}
+
+// ErrCompleted is returned when rescheduling a finished task without
+// reviving it.
+var ErrCompleted = errors.New("task is done; set revive to schedule it again")
+
+// ErrArchived is returned when reviewing or rescheduling an archived task.
+var ErrArchived = errors.New("task is archived; unarchive it first")
+
+// ValidationError reports task input that was rejected, as opposed to a
+// failure while storing it.
+type ValidationError struct {
+	msg string
+}
+
+func (e *ValidationError) Error() string { return e.msg }
+
+func invalid(msg string) error {
+	return &ValidationError{msg: msg}
+}
+
+// IsValidation reports whether err is or wraps a *ValidationError.
+func IsValidation(err error) bool {
+	var ve *ValidationError
+	return errors.As(err, &ve)
 }
 
 // NewTask constructs a task at stage 0 and schedules the first review.
 func NewTask(question, answer string, now time.Time) (*Task, error) {
-	q := strings.TrimSpace(question)
-	a := strings.TrimSpace(answer)
+	return NewTaskWithOptions(question, answer, now, Options{})
+}
+
+// NewTaskWithOptions is NewTask with optional fields validated and applied.
+// A familiar or known task starts further along its schedule and waits
+// that stage's interval for its first review.
+func NewTaskWithOptions(question, answer string, now time.Time, opts Options) (*Task, error) {
+	cardType, err := ParseCardType(opts.Type)
+	if err != nil {
+		return nil, err
+	}
+	q := Normalize(question)
+	a := Normalize(answer)
+	if cardType == CardCloze && q != "" {
+		if a, err = clozeAnswer(q); err != nil {
+			return nil, err
+		}
+	}
 	if q == "" || a == "" {
-		return nil, errors.New("question and answer are required")
+		return nil, invalid("question and answer are required")
 	}
-
-	id, err := generateID()
+	tags, err := NormalizeTags(opts.Tags)
+	if err != nil {
+		return nil, err
+	}
+	difficulty, err := ParseDifficulty(opts.Difficulty)
+	if err != nil {
+		return nil, err
+	}
+	match, err := ParseMatch(opts.AnswerMatch)
+	if err != nil {
+		return nil, err
+	}
+	format, err := ParseFormat(opts.Format)
+	if err != nil {
+		return nil, err
+	}
+	familiarity, err := ParseFamiliarity(opts.Familiarity)
+	if err != nil {
+		return nil, err
+	}
+	scheduler, err := ParseScheduler(opts.Scheduler)
 	if err != nil {
 		return nil, err
 	}
+	var schedule Schedule
+	if len(opts.Schedule) > 0 {
+		if err := opts.Schedule.Validate(); err != nil {
+			return nil, err
+		}
+		schedule = opts.Schedule
+	}
 
 	t := &Task{
-		ID:           id,
-		Question:     q,
-		Answer:       a,
-		Stage:        0,
-		CreatedAt:    now,
-		UpdatedAt:    now,
-		NextReviewAt: now.Add(StageDurations[0]),
+		Question:       q,
+		Answer:         a,
+		Stage:          0,
+		CreatedAt:      now,
+		UpdatedAt:      now,
+		Tags:           tags,
+		Images:         []Side{},
+		Difficulty:     difficulty,
+		AnswerMatch:    match,
+		Format:         format,
+		Type:           cardType,
+		Schedule:       schedule,
+		newFirstReview: opts.FirstReviewIn == nil,
+		Scheduler:      scheduler,
+		familiarity:    familiarity,
+	}
+	if opts.Deck != nil {
+		t.DeckID = strings.TrimSpace(*opts.Deck)
+	}
+	t.placeStart()
+	first := t.startInterval()
+	if opts.FirstReviewIn != nil {
+		if *opts.FirstReviewIn < 0 {
+			return nil, invalid("first review delay must not be negative")
+		}
+		first = *opts.FirstReviewIn
+	}
+
+	t.NextReviewAt = now.Add(first)
+
+	if t.ID, err = generateID(); err != nil {
+		return nil, err
 	}
 	return t, nil
 }
 
-// Status returns "done", "ready", or "pending".
+// Status returns "deleted", "archived", "suspended", "done", "ready", or
+// "pending".
 func (t *Task) Status(now time.Time) string {
-	if t.CompletedAt != nil || t.Stage >= TotalStages() {
+	if t.DeletedAt != nil {
+		return "deleted"
+	}
+	if t.ArchivedAt != nil {
+		return "archived"
+	}
+	if t.SuspendedAt != nil {
+		return "suspended"
+	}
+	if t.CompletedAt != nil || t.pastLastStage() {
 		return "done"
 	}
 	if !t.NextReviewAt.After(now) {
@@ -56,45 +247,340 @@ func (t *Task) Status(now time.Time) string {
 	return "pending"
 }
 
-// MarkRemembered advances the task to the next stage or marks it completed.
-func (t *Task) MarkRemembered(now time.Time) {
+// Apply grades a review at now. On the stage ladder Remembered (good)
+// advances one stage, Easy two, and Hard waits the current stage's
+// interval again, and every grade moves the task's ease; passing the last
+// stage completes the task, after which only Forgot changes anything.
+// Forgot (again) goes back to the first stage. SM-2 and FSRS tasks feed
+// the grade to their model instead. Every scheduler counts a Forgot as a
+// lapse, which can make the task a leech.
+func (t *Task) Apply(o Outcome, now time.Time) error {
+	switch o {
+	case Forgot:
+		t.forget(now)
+		return nil
+	case Hard, Remembered, Easy:
+	default:
+		return fmt.Errorf("unknown review outcome %q", o)
+	}
 	if t.CompletedAt != nil {
-		return
+		return nil
+	}
+	switch t.Scheduler {
+	case SchedulerSM2:
+		t.reviewSM2(sm2Quality[o], now)
+		return nil
+	case SchedulerFSRS:
+		t.reviewFSRS(fsrsGrade[o], now)
+		return nil
 	}
 
-	if t.Stage >= TotalStages()-1 {
-		t.Stage = TotalStages()
+	t.gradeEase(o)
+	steps := 1
+	switch o {
+	case Hard:
+		steps = 0
+	case Easy:
+		steps = 2
+	}
+	if steps > 0 && t.Stage+steps >= t.StageCount() {
+		t.Stage = t.StageCount()
 		t.NextReviewAt = time.Time{}
 		t.CompletedAt = &now
 		t.UpdatedAt = now
+		return nil
+	}
+
+	t.Stage += steps
+	t.NextReviewAt = now.Add(t.interval(t.Stage))
+	t.UpdatedAt = now
+	return nil
+}
+
+// Reschedule sets the next review time directly, leaving the stage as is.
+// A finished task is only rescheduled when revive is set, which puts it
+// back on the last stage so one more success completes it again.
+func (t *Task) Reschedule(at time.Time, revive bool, now time.Time) error {
+	if t.CompletedAt != nil || t.pastLastStage() {
+		if !revive {
+			return ErrCompleted
+		}
+		t.Stage = t.StageCount() - 1
+		t.CompletedAt = nil
+	}
+	t.NextReviewAt = at
+	t.UpdatedAt = now
+	return nil
+}
+
+// Archive retires the task from study while keeping it and its schedule.
+// Archiving an archived task keeps the original time.
+func (t *Task) Archive(now time.Time) {
+	if t.ArchivedAt != nil {
 		return
 	}
+	t.ArchivedAt = &now
+	t.UpdatedAt = now
+}
 
-	t.Stage++
-	t.NextReviewAt = now.Add(StageDurations[t.Stage])
+// Unarchive returns the task to study with its schedule as it was, so a
+// card whose review time passed while archived is ready straight away.
+func (t *Task) Unarchive(now time.Time) {
+	if t.ArchivedAt == nil {
+		return
+	}
+	t.ArchivedAt = nil
 	t.UpdatedAt = now
 }
 
-// MarkForgot resets the task to the first stage.
-func (t *Task) MarkForgot(now time.Time) {
+// Reset puts the task back at the first stage, clearing completion,
+// ease, and any SM-2 or FSRS progress.
+func (t *Task) Reset(now time.Time) {
 	t.Stage = 0
+	switch t.Scheduler {
+	case SchedulerSM2:
+		t.resetSM2()
+	case SchedulerFSRS:
+		t.resetFSRS()
+	default:
+		t.Ease = 0
+	}
 	t.CompletedAt = nil
-	t.NextReviewAt = now.Add(StageDurations[0])
+	t.NextReviewAt = now.Add(capInterval(t.Stages()[0]))
 	t.UpdatedAt = now
 }
 
-// UpdateContent edits the question or answer text.
-func (t *Task) UpdateContent(question, answer string) error {
-	q := strings.TrimSpace(question)
-	a := strings.TrimSpace(answer)
+// PlaceNear puts the task on the stage whose duration is closest to
+// interval and schedules its next review that stage's interval from now,
+// for cards brought in with study history from elsewhere. SM-2 and FSRS
+// tasks take the interval as their own and wait it out.
+func (t *Task) PlaceNear(interval time.Duration, now time.Time) {
+	t.newFirstReview = false
+	t.familiarity = ""
+	if !t.Graduates() {
+		if t.Scheduler == SchedulerSM2 {
+			t.placeNearSM2(interval)
+		} else {
+			t.placeNearFSRS(interval)
+		}
+		t.NextReviewAt = now.Add(capInterval(scale(max(interval, capInterval(t.Stages()[0])), t.Difficulty.Multiplier())))
+		t.UpdatedAt = now
+		return
+	}
+	stages := t.Stages()
+	best := 0
+	for i, d := range stages {
+		if (d - interval).Abs() < (stages[best] - interval).Abs() {
+			best = i
+		}
+	}
+	t.Stage = best
+	t.NextReviewAt = now.Add(t.interval(best))
+	t.UpdatedAt = now
+}
+
+// forget counts a lapse, lowers the ease and resets the task to the
+// first stage. SM-2 tasks restart their repetitions and lose ease
+// instead, and FSRS tasks lose stability.
+func (t *Task) forget(now time.Time) {
+	t.Lapses++
+	switch t.Scheduler {
+	case SchedulerSM2:
+		t.reviewSM2(sm2Quality[Forgot], now)
+	case SchedulerFSRS:
+		t.reviewFSRS(fsrsGrade[Forgot], now)
+	default:
+		t.gradeEase(Forgot)
+		t.Stage = 0
+		t.CompletedAt = nil
+		t.NextReviewAt = now.Add(capInterval(t.Stages()[0]))
+		t.UpdatedAt = now
+	}
+	t.markLeech(now)
+}
+
+// UpdateContent edits the question or answer text, plus any optional
+// fields set in opts. A nil question or answer keeps the current text, as
+// does a nil opts.Tags or opts.Schedule; an empty one clears them, which
+// only the tags and schedule allow. A new schedule applies from the next
+// review on.
+func (t *Task) UpdateContent(question, answer *string, opts Options) error {
+	cardType := t.Type
+	if opts.Type != "" {
+		var err error
+		if cardType, err = ParseCardType(opts.Type); err != nil {
+			return err
+		}
+	}
+	q, a := t.Question, t.Answer
+	if question != nil {
+		q = Normalize(*question)
+	}
+	if answer != nil {
+		a = Normalize(*answer)
+	}
+	if cardType == CardCloze && q != "" {
+		var err error
+		if a, err = clozeAnswer(q); err != nil {
+			return err
+		}
+	}
 	if q == "" || a == "" {
-		return errors.New("question and answer are required")
+		return invalid("question and answer are required")
+	}
+	var (
+		tags       = t.Tags
+		difficulty = t.Difficulty
+		match      = t.AnswerMatch
+		format     = t.Format
+		schedule   = t.Schedule
+		err        error
+	)
+	if opts.Tags != nil {
+		if tags, err = NormalizeTags(opts.Tags); err != nil {
+			return err
+		}
+	}
+	if opts.Difficulty != "" {
+		if difficulty, err = ParseDifficulty(opts.Difficulty); err != nil {
+			return err
+		}
+	}
+	if opts.AnswerMatch != "" {
+		if match, err = ParseMatch(opts.AnswerMatch); err != nil {
+			return err
+		}
+	}
+	if opts.Format != "" {
+		if format, err = ParseFormat(opts.Format); err != nil {
+			return err
+		}
+	}
+	if opts.Schedule != nil {
+		schedule = nil
+		if len(opts.Schedule) > 0 {
+			if err := opts.Schedule.Validate(); err != nil {
+				return err
+			}
+			schedule = opts.Schedule
+		}
 	}
 	t.Question = q
 	t.Answer = a
+	t.Tags = tags
+	t.Difficulty = difficulty
+	t.AnswerMatch = match
+	t.Format = format
+	t.Type = cardType
+	t.Schedule = schedule
+	if opts.Deck != nil {
+		t.DeckID = strings.TrimSpace(*opts.Deck)
+	}
 	return nil
 }
 
+// Stages returns the schedule the task follows: its own, else the one
+// resolved from its tags, else StageDurations.
+func (t *Task) Stages() Schedule {
+	switch {
+	case len(t.Schedule) > 0:
+		return t.Schedule
+	case len(t.TagSchedule) > 0:
+		return t.TagSchedule
+	}
+	return Schedule(StageDurations)
+}
+
+// StageCount is the number of stages in Stages.
+func (t *Task) StageCount() int {
+	return len(t.Stages())
+}
+
+// ScheduleSource reports where Stages comes from: "task", "tag", or
+// "default".
+func (t *Task) ScheduleSource() string {
+	switch {
+	case len(t.Schedule) > 0:
+		return "task"
+	case len(t.TagSchedule) > 0:
+		return "tag"
+	}
+	return "default"
+}
+
+// StageLabel returns the label of the current stage. Only the default
+// schedule has labels.
+func (t *Task) StageLabel() string {
+	if t.ScheduleSource() != "default" || !t.Graduates() {
+		return ""
+	}
+	return StageLabel(t.Stage)
+}
+
+// ApplyTagSchedule records the schedule resolved from the task's tags. A
+// task fresh from NewTaskWithOptions is placed again on the resolved
+// schedule per its familiarity, and without an explicit first review
+// delay has its first review re-timed to match.
+func (t *Task) ApplyTagSchedule(tag string, s Schedule) {
+	t.ScheduleTag = tag
+	t.TagSchedule = s
+	if t.familiarity != "" {
+		t.placeStart()
+	}
+	if t.newFirstReview {
+		t.NextReviewAt = t.CreatedAt.Add(t.startInterval())
+	}
+}
+
+// placeStart puts a new task on its starting stage per its familiarity.
+func (t *Task) placeStart() {
+	switch t.Scheduler {
+	case SchedulerSM2:
+		t.startSM2()
+		return
+	case SchedulerFSRS:
+		t.startFSRS()
+		return
+	}
+	t.Stage = t.familiarity.startStage(t.StageCount())
+}
+
+// startInterval is how long a new task waits on its starting stage. The
+// first stage isn't scaled by difficulty; later ones are, as if reached
+// by review. SM-2 and FSRS tasks start with the first stage too unless
+// placed further along.
+func (t *Task) startInterval() time.Duration {
+	if t.Stage == 0 {
+		return capInterval(t.Stages()[0])
+	}
+	if !t.Graduates() {
+		return capInterval(scale(t.Interval, t.Difficulty.Multiplier()))
+	}
+	return t.interval(t.Stage)
+}
+
+// pastLastStage reports whether a stages task has gone beyond its last
+// stage, which makes it done even without CompletedAt.
+func (t *Task) pastLastStage() bool {
+	return t.Graduates() && t.Stage >= t.StageCount()
+}
+
+// interval is how long the task waits at stage, scaled by its difficulty
+// and ease.
+// A stage past the end of a schedule that has since shrunk waits as long
+// as the last stage, and a negative one, which only corrupt data can
+// produce, as long as the first. The result never exceeds MaxInterval.
+func (t *Task) interval(stage int) time.Duration {
+	stages := t.Stages()
+	if stage >= len(stages) {
+		stage = len(stages) - 1
+	}
+	if stage < 0 {
+		stage = 0
+	}
+	return capInterval(scale(stages[stage], t.Difficulty.Multiplier()*t.stageEase()))
+}
+
 func generateID() (string, error) {
 	var b [12]byte
 	if _, err := rand.Read(b[:]); err != nil {
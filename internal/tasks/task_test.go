@@ -0,0 +1,94 @@
+package tasks
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStatusPrecedence(t *testing.T) {
+	at := testNow.Add(-time.Hour)
+	for _, tc := range []struct {
+		name string
+		set  func(*Task)
+		want string
+	}{
+		{"ready", func(t *Task) { t.NextReviewAt = at }, "ready"},
+		{"pending", func(t *Task) { t.NextReviewAt = testNow.Add(time.Hour) }, "pending"},
+		{"done", func(t *Task) { t.CompletedAt = &at }, "done"},
+		{"suspended over done", func(t *Task) { t.CompletedAt, t.SuspendedAt = &at, &at }, "suspended"},
+		{"archived over ready", func(t *Task) { t.NextReviewAt, t.ArchivedAt = at, &at }, "archived"},
+		{"archived over done", func(t *Task) { t.CompletedAt, t.ArchivedAt = &at, &at }, "archived"},
+		{"archived over suspended", func(t *Task) { t.SuspendedAt, t.ArchivedAt = &at, &at }, "archived"},
+		{"deleted over archived", func(t *Task) { t.ArchivedAt, t.DeletedAt = &at, &at }, "deleted"},
+	} {
+		task, err := NewTask("q", "a", testNow)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tc.set(task)
+		if got := task.Status(testNow); got != tc.want {
+			t.Errorf("%s: Status = %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestArchiveKeepsSchedule(t *testing.T) {
+	task, err := NewTask("q", "a", testNow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	task.Stage = 2
+	next := task.NextReviewAt
+
+	archivedAt := testNow.Add(time.Minute)
+	task.Archive(archivedAt)
+	task.Archive(archivedAt.Add(time.Hour))
+	if task.ArchivedAt == nil || !task.ArchivedAt.Equal(archivedAt) {
+		t.Errorf("ArchivedAt = %v, want the first archive's %v", task.ArchivedAt, archivedAt)
+	}
+
+	// Unarchived after its review time, the card is ready at once.
+	later := next.Add(24 * time.Hour)
+	task.Unarchive(later)
+	if task.ArchivedAt != nil || task.Stage != 2 || !task.NextReviewAt.Equal(next) {
+		t.Errorf("after Unarchive: archived %v, stage %d, next %v; want the schedule as it was", task.ArchivedAt, task.Stage, task.NextReviewAt)
+	}
+	if got := task.Status(later); got != "ready" {
+		t.Errorf("Status = %q, want ready", got)
+	}
+}
+
+func TestFirstReviewIn(t *testing.T) {
+	zero, delay, negative := time.Duration(0), 2*time.Hour, -time.Minute
+	for _, tc := range []struct {
+		name   string
+		first  *time.Duration
+		want   time.Duration
+		status string
+	}{
+		{"default", nil, StageDurations[0], "pending"},
+		{"immediate", &zero, 0, "ready"},
+		{"explicit delay", &delay, delay, "pending"},
+	} {
+		task, err := NewTaskWithOptions("q", "a", testNow, Options{FirstReviewIn: tc.first})
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		if got := task.NextReviewAt.Sub(testNow); got != tc.want {
+			t.Errorf("%s: first review in %s, want %s", tc.name, got, tc.want)
+		}
+		if got := task.Status(testNow); got != tc.status {
+			t.Errorf("%s: status %q, want %q", tc.name, got, tc.status)
+		}
+		if task.Stage != 0 {
+			t.Errorf("%s: stage %d, want 0", tc.name, task.Stage)
+		}
+	}
+	if _, err := NewTaskWithOptions("q", "a", testNow, Options{FirstReviewIn: &negative}); !IsValidation(err) {
+		t.Errorf("negative delay = %v, want a validation error", err)
+	}
+	// Content is validated whatever the delay.
+	if _, err := NewTaskWithOptions(" ", "a", testNow, Options{FirstReviewIn: &zero}); !IsValidation(err) {
+		t.Errorf("blank question = %v, want a validation error", err)
+	}
+}
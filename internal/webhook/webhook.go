@@ -0,0 +1,232 @@
+// Package webhook delivers task lifecycle events from the store's outbox to
+// HTTP endpoints: the webhooks registered through the API and the one
+// given by -webhook-url.
+//
+// Each outbox event is first turned into one delivery per endpoint that
+// wants it; deliveries are then sent and retried independently, and every
+// attempt is logged on the delivery. Delivery is at-least-once: a
+// delivery is marked done only after the endpoint answers 2xx, so a crash
+// in between sends it again on restart. Failed deliveries are retried with
+// backoff, and given up after maxAttempts, while later ones go ahead, so
+// receivers should tolerate reordering and dedupe on X-Yiwang-Delivery.
+//
+// Endpoints are sent to concurrently, each in order, so a slow one
+// doesn't hold up the rest. An endpoint that doesn't answer within
+// deliveryTimeout gets nothing more until the next pass.
+//
+// Payloads to a registered webhook are signed with its secret: the
+// X-Yiwang-Signature header is "sha256=" and the hex HMAC-SHA256 of the
+// body.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"yiwang/internal/store"
+)
+
+const (
+	batchSize  = 100
+	minBackoff = 5 * time.Second
+	maxBackoff = time.Hour
+	// maxAttempts is how often a delivery is tried before it is given up,
+	// which with the backoff above is about a day.
+	maxAttempts = 30
+	// keepSent is how long delivered entries stay in the outbox and the
+	// delivery log.
+	keepSent = 7 * 24 * time.Hour
+	// deliveryTimeout bounds one attempt, from connecting to reading the
+	// answer.
+	deliveryTimeout = 10 * time.Second
+)
+
+// Notifier posts outbox events to the registered webhooks and to URL.
+type Notifier struct {
+	store  *store.Store
+	url    string
+	client *http.Client
+	now    func() time.Time
+}
+
+// New returns a notifier for the registered webhooks and, unless it is
+// empty, url. The store must have been opened with store.Options.Outbox
+// or there will be nothing to send.
+func New(st *store.Store, url string) *Notifier {
+	return &Notifier{
+		store:  st,
+		url:    url,
+		client: &http.Client{Timeout: deliveryTimeout},
+		now:    time.Now,
+	}
+}
+
+// Run delivers pending events every interval until ctx is done.
+func (n *Notifier) Run(ctx context.Context, every time.Duration) {
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+	for {
+		n.flush(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// flush fans out new outbox entries, makes one pass over the due
+// deliveries, and prunes old finished ones.
+func (n *Notifier) flush(ctx context.Context) {
+	now := n.now()
+	hooks, err := n.store.Webhooks()
+	if err != nil {
+		slog.ErrorContext(ctx, "webhook: load webhooks", "err", err)
+		return
+	}
+	byID := make(map[string]store.Webhook, len(hooks))
+	for _, h := range hooks {
+		byID[h.ID] = h
+	}
+
+	entries, err := n.store.PendingOutbox(now, batchSize)
+	if err != nil {
+		slog.ErrorContext(ctx, "webhook: load outbox", "err", err)
+		return
+	}
+	for _, e := range entries {
+		var targets []string
+		if n.url != "" {
+			targets = append(targets, "")
+		}
+		for _, h := range hooks {
+			if h.Wants(e.Kind) {
+				targets = append(targets, h.ID)
+			}
+		}
+		if err := n.store.QueueDeliveries(e, targets, now); err != nil {
+			slog.ErrorContext(ctx, "webhook: queue deliveries", "entry", e.ID, "err", err)
+		}
+	}
+
+	deliveries, err := n.store.PendingDeliveries(now, batchSize)
+	if err != nil {
+		slog.ErrorContext(ctx, "webhook: load deliveries", "err", err)
+		return
+	}
+	// Deliveries come oldest first, and stay that way per endpoint.
+	byHook := map[string][]store.Delivery{}
+	for _, d := range deliveries {
+		byHook[d.WebhookID] = append(byHook[d.WebhookID], d)
+	}
+	var wg sync.WaitGroup
+	for id, ds := range byHook {
+		url, secret := n.url, ""
+		if id != "" {
+			h, ok := byID[id]
+			if !ok {
+				// Deleted since; its deliveries went with it.
+				continue
+			}
+			url, secret = h.URL, h.Secret
+		}
+		wg.Add(1)
+		go func(url, secret string, ds []store.Delivery) {
+			defer wg.Done()
+			n.sendAll(ctx, url, secret, ds)
+		}(url, secret, ds)
+	}
+	wg.Wait()
+
+	if _, err := n.store.PruneOutbox(now.Add(-keepSent)); err != nil {
+		slog.ErrorContext(ctx, "webhook: prune outbox", "err", err)
+	}
+	if _, err := n.store.PruneDeliveries(now.Add(-keepSent)); err != nil {
+		slog.ErrorContext(ctx, "webhook: prune deliveries", "err", err)
+	}
+}
+
+// sendAll makes one attempt at each of ds, which go to the same endpoint,
+// in order. It stops early if the endpoint doesn't answer at all, leaving
+// the rest due for the next pass, so a dead endpoint costs one timeout.
+func (n *Notifier) sendAll(ctx context.Context, url, secret string, ds []store.Delivery) {
+	for _, d := range ds {
+		if ctx.Err() != nil {
+			return
+		}
+		status, err := n.deliver(ctx, url, secret, d)
+		var retryAt *time.Time
+		reason := ""
+		if err != nil {
+			reason = err.Error()
+			if d.Attempts+1 < maxAttempts {
+				t := n.now().Add(backoff(d.Attempts))
+				retryAt = &t
+			}
+			slog.ErrorContext(ctx, "webhook: deliver", "kind", d.Kind, "delivery", d.ID, "url", url, "attempt", d.Attempts+1, "err", err)
+		}
+		if err := n.store.RecordAttempt(d.ID, status, reason, retryAt, n.now()); err != nil {
+			slog.ErrorContext(ctx, "webhook: record attempt", "delivery", d.ID, "err", err)
+		}
+		if err != nil && status == 0 {
+			return
+		}
+	}
+}
+
+// deliver posts d to url, signed with secret unless it is empty, and
+// returns the endpoint's status code, 0 if it didn't answer.
+func (n *Notifier) deliver(ctx context.Context, url, secret string, d store.Delivery) (int, error) {
+	if url == "" {
+		return 0, fmt.Errorf("no endpoint: -webhook-url is no longer set")
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(d.Payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Yiwang-Event", string(d.Kind))
+	req.Header.Set("X-Yiwang-Delivery", strconv.FormatInt(d.ID, 10))
+	if secret != "" {
+		req.Header.Set("X-Yiwang-Signature", Sign(secret, d.Payload))
+	}
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("endpoint answered %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// Sign returns the X-Yiwang-Signature value for body sent with secret,
+// for receivers to compare against with hmac.Equal.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// backoff doubles the wait after each failed attempt, from minBackoff up
+// to maxBackoff.
+func backoff(attempts int) time.Duration {
+	d := minBackoff
+	for i := 0; i < attempts && d < maxBackoff; i++ {
+		d *= 2
+	}
+	return min(d, maxBackoff)
+}
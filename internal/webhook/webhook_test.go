@@ -0,0 +1,205 @@
+package webhook
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"yiwang/internal/store"
+	"yiwang/internal/tasks"
+)
+
+var testNow = time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)
+
+// receiver is an endpoint that answers each request with the next of its
+// statuses, then 200, and records what it was sent.
+type receiver struct {
+	mu       sync.Mutex
+	statuses []int
+	got      []*http.Request
+	bodies   [][]byte
+}
+
+func (rc *receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.got = append(rc.got, r)
+	rc.bodies = append(rc.bodies, body)
+	status := http.StatusOK
+	if len(rc.statuses) > 0 {
+		status, rc.statuses = rc.statuses[0], rc.statuses[1:]
+	}
+	w.WriteHeader(status)
+}
+
+func (rc *receiver) requests() int {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	return len(rc.got)
+}
+
+func openStore(t *testing.T) *store.Store {
+	t.Helper()
+	st, err := store.NewWithOptions(filepath.Join(t.TempDir(), "test.db"), store.Options{Driver: store.DriverSQLite, Outbox: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { st.Close() })
+	return st
+}
+
+// notifier returns a Notifier for url whose clock reads *now.
+func notifier(st *store.Store, url string, now *time.Time) *Notifier {
+	n := New(st, url)
+	n.now = func() time.Time { return *now }
+	return n
+}
+
+func TestDeliveryFailsThenSucceeds(t *testing.T) {
+	st := openStore(t)
+	rc := &receiver{statuses: []int{http.StatusServiceUnavailable}}
+	srv := httptest.NewServer(rc)
+	defer srv.Close()
+
+	if _, err := st.Create("q", "a", tasks.Options{}, testNow); err != nil {
+		t.Fatal(err)
+	}
+	now := testNow
+	ctx := context.Background()
+
+	notifier(st, srv.URL, &now).flush(ctx)
+	if rc.requests() != 1 {
+		t.Fatalf("endpoint got %d requests, want 1", rc.requests())
+	}
+	ds, err := st.Deliveries("", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ds) != 1 || ds[0].Attempts != 1 || ds[0].StatusCode != http.StatusServiceUnavailable || ds[0].DeliveredAt != nil || ds[0].NextAttemptAt == nil {
+		t.Fatalf("after the failure: %+v, want one attempt logged and a retry scheduled", ds)
+	}
+
+	// Nothing is retried before the backoff is over.
+	notifier(st, srv.URL, &now).flush(ctx)
+	if rc.requests() != 1 {
+		t.Fatalf("endpoint got %d requests during the backoff, want 1", rc.requests())
+	}
+
+	// A new notifier, as after a restart, picks the delivery up again.
+	now = ds[0].NextAttemptAt.Add(time.Second)
+	notifier(st, srv.URL, &now).flush(ctx)
+	if rc.requests() != 2 {
+		t.Fatalf("endpoint got %d requests, want the retry", rc.requests())
+	}
+	ds, err = st.Deliveries("", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ds) != 1 || ds[0].Attempts != 2 || ds[0].StatusCode != http.StatusOK || ds[0].DeliveredAt == nil || ds[0].NextAttemptAt != nil || ds[0].LastError != "" {
+		t.Fatalf("after the retry: %+v, want it delivered", ds)
+	}
+
+	// Both attempts were the same delivery, for the receiver to dedupe.
+	rc.mu.Lock()
+	first, second := rc.got[0], rc.got[1]
+	sameBody := string(rc.bodies[0]) == string(rc.bodies[1])
+	rc.mu.Unlock()
+	if first.Header.Get("X-Yiwang-Delivery") != second.Header.Get("X-Yiwang-Delivery") || !sameBody {
+		t.Error("the retry is not the same delivery as the failed attempt")
+	}
+	if kind := second.Header.Get("X-Yiwang-Event"); kind != "task.created" {
+		t.Errorf("X-Yiwang-Event = %q, want task.created", kind)
+	}
+
+	// Once delivered it is never sent again.
+	now = now.Add(time.Hour)
+	notifier(st, srv.URL, &now).flush(ctx)
+	if rc.requests() != 2 {
+		t.Errorf("endpoint got %d requests, want no more after success", rc.requests())
+	}
+}
+
+func TestSignedDeliveryToRegisteredWebhook(t *testing.T) {
+	st := openStore(t)
+	rc := &receiver{}
+	srv := httptest.NewServer(rc)
+	defer srv.Close()
+
+	if _, err := st.CreateWebhook(srv.URL, "s3cret", nil, testNow); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := st.Create("q", "a", tasks.Options{}, testNow); err != nil {
+		t.Fatal(err)
+	}
+	now := testNow
+	notifier(st, "", &now).flush(context.Background())
+
+	if rc.requests() != 1 {
+		t.Fatalf("webhook got %d requests, want 1", rc.requests())
+	}
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	if got, want := rc.got[0].Header.Get("X-Yiwang-Signature"), Sign("s3cret", rc.bodies[0]); got != want {
+		t.Errorf("signature = %q, want %q", got, want)
+	}
+}
+
+func TestSlowEndpointDoesNotHoldUpOthers(t *testing.T) {
+	st := openStore(t)
+	release := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	t.Cleanup(slow.Close)
+	t.Cleanup(func() { close(release) })
+	rc := &receiver{}
+	fast := httptest.NewServer(rc)
+	defer fast.Close()
+
+	slowHook, err := st.CreateWebhook(slow.URL, "", nil, testNow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := st.CreateWebhook(fast.URL, "", nil, testNow); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := st.Create("q", "a", tasks.Options{}, testNow); err != nil {
+			t.Fatal(err)
+		}
+	}
+	now := testNow
+	n := notifier(st, "", &now)
+	n.client.Timeout = 50 * time.Millisecond
+
+	start := time.Now()
+	n.flush(context.Background())
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("pass took %s, want one timeout's worth", elapsed)
+	}
+	if rc.requests() != 3 {
+		t.Errorf("fast endpoint got %d requests, want 3", rc.requests())
+	}
+	// The slow endpoint timed out on its first delivery; the others wait
+	// for the next pass.
+	ds, err := st.Deliveries(slowHook.ID, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	attempts := 0
+	for _, d := range ds {
+		attempts += d.Attempts
+		if d.DeliveredAt != nil {
+			t.Errorf("delivery #%d to the slow endpoint marked delivered", d.ID)
+		}
+	}
+	if len(ds) != 3 || attempts != 1 {
+		t.Errorf("slow endpoint: %d deliveries, %d attempts; want 3 and 1", len(ds), attempts)
+	}
+}
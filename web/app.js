@@ -5,6 +5,8 @@ const allList = document.getElementById("all-list");
 const readyPagination = document.getElementById("ready-pagination");
 const allPagination = document.getElementById("all-pagination");
 const createForm = document.getElementById("create-form");
+const authBox = document.getElementById("auth");
+const readyCount = document.getElementById("ready-count");
 
 // Configure markdown to be GitHub-like and keep line breaks.
 if (window.marked) {
@@ -15,6 +17,8 @@ if (window.marked) {
 }
 
 const pageSize = 10;
+const schedulerNames = { sm2: "SM-2", fsrs: "FSRS" };
+const providerNames = { google: "Google", github: "GitHub" };
 let readyData = [];
 let allData = [];
 let readyPage = 1;
@@ -62,10 +66,60 @@ createForm.addEventListener("submit", async (e) => {
   await Promise.all([loadReady(), loadAll()]);
 });
 
+// 登录状态：已登录时显示退出，否则显示可用的登录方式。
+async function loadAuth() {
+  const [session, { providers }] = await Promise.all([
+    api("/auth/session"),
+    api("/auth/providers"),
+  ]);
+  authBox.innerHTML = "";
+  if (session.signedIn) {
+    const who = document.createElement("span");
+    who.textContent = session.user
+      ? `已登录：${session.user.name}`
+      : `已登录：密钥 ${session.apiKey.name}`;
+    const logoutBtn = document.createElement("button");
+    logoutBtn.className = "btn btn-ghost";
+    logoutBtn.textContent = "退出";
+    logoutBtn.onclick = async () => {
+      await api("/auth/logout", { method: "POST" });
+      location.reload();
+    };
+    authBox.append(who, logoutBtn);
+    return;
+  }
+  for (const p of providers) {
+    const link = document.createElement("a");
+    link.className = "btn btn-ghost";
+    link.href = `${apiBase}/auth/${p}/login`;
+    link.textContent = `${providerNames[p] || p} 登录`;
+    authBox.append(link);
+  }
+  const keyBtn = document.createElement("button");
+  keyBtn.className = "btn btn-ghost";
+  keyBtn.textContent = "API 密钥登录";
+  keyBtn.onclick = async () => {
+    const key = prompt("API 密钥");
+    if (!key) return;
+    await api("/auth/login", {
+      method: "POST",
+      body: JSON.stringify({ key: key.trim() }),
+    });
+    location.reload();
+  };
+  authBox.append(keyBtn);
+}
+
 async function loadReady() {
   readyData = await api("/tasks/ready");
   readyPage = 1;
   renderReadyPage();
+  await loadCounts();
+}
+
+async function loadCounts() {
+  const counts = await api("/tasks/counts");
+  readyCount.textContent = `${counts.ready} / ${counts.total}`;
 }
 
 async function loadAll() {
@@ -94,10 +148,13 @@ function renderList(container, pager, tasks, showActions, page, onPageChange) {
     head.className = "task-head";
     const title = document.createElement("div");
     title.className = "task-title markdown";
-    title.innerHTML = renderMarkdown(t.question);
+    title.innerHTML = t.questionHtml || renderMarkdown(t.question);
     const meta = document.createElement("div");
     meta.className = "task-meta";
-    meta.textContent = `阶段 ${t.stage + 1} / ${t.totalStages} · 状态 ${t.status}`;
+    meta.textContent =
+      t.scheduler === "sm2" || t.scheduler === "fsrs"
+        ? `${schedulerNames[t.scheduler]} · 间隔 ${t.interval || "-"} · 状态 ${t.status}`
+        : `阶段 ${t.stage + 1} / ${t.totalStages} · 状态 ${t.status}`;
     head.append(title, meta);
 
     const body = document.createElement("div");
@@ -109,7 +166,7 @@ function renderList(container, pager, tasks, showActions, page, onPageChange) {
     answerLabel.textContent = "答案";
     const answerContent = document.createElement("div");
     answerContent.className = "markdown";
-    answerContent.innerHTML = renderMarkdown(t.answer);
+    answerContent.innerHTML = t.answerHtml || renderMarkdown(t.answer);
     answerSection.append(answerLabel, answerContent);
 
     const metaSection = document.createElement("div");
@@ -130,15 +187,19 @@ function renderList(container, pager, tasks, showActions, page, onPageChange) {
     actions.className = "task-actions";
 
     if (showActions) {
-      const rememberBtn = document.createElement("button");
-      rememberBtn.className = "btn btn-small";
-      rememberBtn.textContent = "记住了";
-      rememberBtn.onclick = () => review(t.id, "remembered");
-      const forgetBtn = document.createElement("button");
-      forgetBtn.className = "btn btn-small btn-ghost";
-      forgetBtn.textContent = "忘记了";
-      forgetBtn.onclick = () => review(t.id, "forgot");
-      actions.append(toggleBtn, rememberBtn, forgetBtn);
+      actions.append(toggleBtn);
+      for (const [result, label, ghost] of [
+        ["again", "忘记了", true],
+        ["hard", "困难", true],
+        ["good", "记住了", false],
+        ["easy", "简单", false],
+      ]) {
+        const gradeBtn = document.createElement("button");
+        gradeBtn.className = ghost ? "btn btn-small btn-ghost" : "btn btn-small";
+        gradeBtn.textContent = label;
+        gradeBtn.onclick = () => review(t.id, result);
+        actions.append(gradeBtn);
+      }
     } else {
       const deleteBtn = document.createElement("button");
       deleteBtn.className = "btn btn-small btn-danger";
@@ -201,11 +262,24 @@ async function api(path, options = {}) {
       const data = await res.json();
       if (data && data.error) msg = data.error;
     } catch (_) {}
-    alert(msg);
+    // 未登录时由登录按钮提示，不再弹窗。
+    if (res.status !== 401) alert(msg);
     throw new Error(msg);
   }
   if (res.status === 204) return;
-  return res.json();
+  return camelKeys(await res.json());
+}
+
+// 服务器可配置为 snake_case 字段名（-json-naming），界面统一按 camelCase 读取。
+// 界面用到的响应里没有以数据为键的对象，整体转换即可。
+function camelKeys(v) {
+  if (Array.isArray(v)) return v.map(camelKeys);
+  if (v === null || typeof v !== "object") return v;
+  const out = {};
+  for (const [k, val] of Object.entries(v)) {
+    out[k.replace(/_([a-z0-9])/g, (_, c) => c.toUpperCase())] = camelKeys(val);
+  }
+  return out;
 }
 
 function formatTime(t) {
@@ -220,7 +294,39 @@ function renderMarkdown(md) {
   return DOMPurify.sanitize(marked.parse(md, { gfm: true, breaks: true }));
 }
 
+// 服务器在卡片到期时推送消息，徽标和待复习列表随之更新，无需轮询。
+function watchReady() {
+  const scheme = location.protocol === "https:" ? "wss:" : "ws:";
+  const ws = new WebSocket(`${scheme}//${location.host}${apiBase}/ws`);
+  ws.onmessage = (e) => {
+    const msg = JSON.parse(e.data);
+    if (msg.type === "task.ready") {
+      loadReady();
+    } else {
+      loadCounts();
+    }
+  };
+  // 断开后稍等再重连。
+  ws.onclose = () => setTimeout(watchReady, 5000);
+}
+
+// 其他标签页或设备改动任务时同步刷新；短时间内的多个事件合并为一次刷新。
+let syncTimer;
+function watchChanges() {
+  const source = new EventSource(`${apiBase}/events`);
+  const refresh = () => {
+    clearTimeout(syncTimer);
+    syncTimer = setTimeout(() => Promise.all([loadReady(), loadAll()]), 300);
+  };
+  for (const kind of ["task.created", "task.updated", "task.reviewed", "task.deleted"]) {
+    source.addEventListener(kind, refresh);
+  }
+}
+
 // 初始加载
+loadAuth();
 loadReady();
 loadAll();
+watchReady();
+watchChanges();
 